@@ -17,8 +17,11 @@
 package loader
 
 import (
+	"context"
 	"testing"
 
+	"github.com/compose-spec/compose-go/v2/types"
+
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 )
@@ -218,3 +221,67 @@ services:
 	assert.Check(t, is.Equal("./configs/app.conf", service.LocalConfigs["app_conf"].Source))
 	assert.Check(t, is.Equal("/app/.env", service.Sensitive["app_env"].Target))
 }
+
+func TestLoadCicdezFieldsOverride(t *testing.T) {
+	base := `
+name: test-cicdez-override
+services:
+  base:
+    image: myapp:latest
+    sensitive:
+      shared_env:
+        format: env
+        secrets:
+          - source: shared_secret
+  app:
+    extends:
+      service: base
+    sensitive:
+      app_env:
+        format: env
+        secrets:
+          - source: app_secret
+    local_configs:
+      app_conf:
+        source: ./configs/app.conf
+        target: /etc/app/app.conf
+`
+	override := `
+services:
+  app:
+    sensitive:
+      app_env:
+        format: json
+        secrets:
+          - source: prod_secret
+      prod_env:
+        secrets:
+          - source: prod_token
+    local_configs:
+      app_conf:
+        source: ./configs/app.prod.conf
+        target: /etc/app/app.conf
+`
+	actual, err := LoadWithContext(context.Background(), types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "compose.yaml", Content: []byte(base)},
+			{Filename: "compose.override.yaml", Content: []byte(override)},
+		},
+	}, func(options *Options) {
+		options.ResolvePaths = false
+	})
+	assert.NilError(t, err)
+
+	service := actual.Services["app"]
+
+	// entries from the extended service, the base and the override file add
+	// up, the override replaces an entry of the same name as a whole
+	assert.Check(t, is.Len(service.Sensitive, 3))
+	assert.Check(t, is.Equal("env", service.Sensitive["shared_env"].Format))
+	assert.Check(t, is.Equal("json", service.Sensitive["app_env"].Format))
+	assert.Check(t, is.Len(service.Sensitive["app_env"].Secrets, 1))
+	assert.Check(t, is.Equal("prod_secret", service.Sensitive["app_env"].Secrets[0].Source))
+	assert.Check(t, is.Len(service.Sensitive["prod_env"].Secrets, 1))
+	assert.Check(t, is.Len(service.LocalConfigs, 1))
+	assert.Check(t, is.Equal("./configs/app.prod.conf", service.LocalConfigs["app_conf"].Source))
+}
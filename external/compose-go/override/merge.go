@@ -61,10 +61,13 @@ func init() {
 	mergeSpecials["services.*.extra_hosts"] = mergeExtraHosts
 	mergeSpecials["services.*.healthcheck.test"] = override
 	mergeSpecials["services.*.labels"] = mergeToSequence
+	// cicdez extensions: an override file replaces an entry of the same name
+	mergeSpecials["services.*.local_configs.*"] = override
 	mergeSpecials["services.*.volumes.*.volume.labels"] = mergeToSequence
 	mergeSpecials["services.*.logging"] = mergeLogging
 	mergeSpecials["services.*.models"] = mergeModels
 	mergeSpecials["services.*.networks"] = mergeNetworks
+	mergeSpecials["services.*.sensitive.*"] = override
 	mergeSpecials["services.*.sysctls"] = mergeToSequence
 	mergeSpecials["services.*.tmpfs"] = mergeToSequence
 	mergeSpecials["services.*.ulimits.*"] = mergeUlimit
@@ -0,0 +1,99 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package override
+
+import (
+	"testing"
+)
+
+// sensitive entries of both files are kept, one with the same name is replaced
+func Test_mergeYamlSensitive(t *testing.T) {
+	assertMergeYaml(t, `
+services:
+  test:
+    image: foo
+    sensitive:
+      app:
+        format: env
+        secrets:
+          - source: DB_PASSWORD
+          - source: API_KEY
+      tls:
+        format: raw
+        secrets:
+          - source: TLS_KEY
+`, `
+services:
+  test:
+    sensitive:
+      app:
+        format: json
+        secrets:
+          - source: DB_PASSWORD
+      metrics:
+        secrets:
+          - source: METRICS_TOKEN
+`, `
+services:
+  test:
+    image: foo
+    sensitive:
+      app:
+        format: json
+        secrets:
+          - source: DB_PASSWORD
+      metrics:
+        secrets:
+          - source: METRICS_TOKEN
+      tls:
+        format: raw
+        secrets:
+          - source: TLS_KEY
+`)
+}
+
+func Test_mergeYamlLocalConfigs(t *testing.T) {
+	assertMergeYaml(t, `
+services:
+  test:
+    image: foo
+    local_configs:
+      nginx:
+        source: ./nginx.conf
+        target: /etc/nginx/nginx.conf
+        mode: 0440
+      app:
+        source: ./app.yaml
+`, `
+services:
+  test:
+    local_configs:
+      nginx:
+        source: ./nginx.prod.conf
+        target: /etc/nginx/nginx.conf
+`, `
+services:
+  test:
+    image: foo
+    local_configs:
+      nginx:
+        source: ./nginx.prod.conf
+        target: /etc/nginx/nginx.conf
+      app:
+        source: ./app.yaml
+`)
+}
@@ -53,7 +53,12 @@ func defaultSensitiveTarget(data any, p tree.Path, _ bool) (any, error) {
 	case map[string]any:
 		if _, ok := v["target"]; !ok {
 			name := p.Last()
-			v["target"] = fmt.Sprintf("/run/secrets/%s", name)
+			// configs mount at the root like regular configs do
+			if v["type"] == "config" {
+				v["target"] = fmt.Sprintf("/%s", name)
+			} else {
+				v["target"] = fmt.Sprintf("/run/secrets/%s", name)
+			}
 		}
 		return v, nil
 	default:
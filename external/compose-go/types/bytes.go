@@ -39,10 +39,16 @@ func (u *UnitBytes) DecodeMapstructure(value interface{}) error {
 	switch v := value.(type) {
 	case int:
 		*u = UnitBytes(v)
+	case int64:
+		*u = UnitBytes(v)
+	case float64:
+		*u = UnitBytes(v)
 	case string:
 		b, err := units.RAMInBytes(fmt.Sprint(value))
 		*u = UnitBytes(b)
 		return err
+	default:
+		return fmt.Errorf("unexpected value type %T for bytes", v)
 	}
 	return nil
 }
@@ -2144,6 +2144,7 @@ func deriveDeepCopy_51(dst, src *ServiceSecretConfig) {
 
 // deriveDeepCopy_52 recursively copies the contents of src into dst.
 func deriveDeepCopy_52(dst, src *SensitiveConfig) {
+	dst.Type = src.Type
 	dst.Target = src.Target
 	dst.Format = src.Format
 	if src.Secrets == nil {
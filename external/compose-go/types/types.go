@@ -908,6 +908,7 @@ type SensitiveSecret struct {
 
 // SensitiveConfig manages how secrets are injected into containers
 type SensitiveConfig struct {
+	Type       string            `yaml:"type,omitempty" json:"type,omitempty"`
 	Target     string            `yaml:"target,omitempty" json:"target,omitempty"`
 	Format     string            `yaml:"format,omitempty" json:"format,omitempty"`
 	Secrets    []SensitiveSecret `yaml:"secrets,omitempty" json:"secrets,omitempty"`
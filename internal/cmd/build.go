@@ -2,58 +2,167 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/blindlobstar/cicdez/internal/docker"
 	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/moby/moby/client"
 	"github.com/spf13/cobra"
 )
 
+// DockerClientFactory creates the local docker client images are built and
+// pushed with, tests swap in a fake
+type DockerClientFactory func() (client.APIClient, error)
+
+// defaultDockerClient connects to DOCKER_HOST, or the DOCKER_CONTEXT context
+func defaultDockerClient() (client.APIClient, error) {
+	return docker.NewContextClient("")
+}
+
+// contextClient returns a factory for the Docker CLI context name, or
+// newClient itself when no context is given
+func contextClient(name string, newClient DockerClientFactory) DockerClientFactory {
+	if name == "" {
+		return newClient
+	}
+	return func() (client.APIClient, error) {
+		return docker.NewContextClient(name)
+	}
+}
+
 type buildOptions struct {
 	composeFiles []string
+	envFiles     []string
+	sets         []string
+	contextPath  string
+	projectName  string
 	services     []string
 	noCache      bool
 	pull         bool
 	push         bool
+	load         bool
+	output       string
+	buildArgs    []string
+	target       string
+	exclude      []string
+	parallelism  int
+	retries      int
+	failFast     bool
+	dockerCtx    string
+	stdin        io.Reader
+	newClient    DockerClientFactory
 }
 
 func NewBuildCommand() *cobra.Command {
-	opts := buildOptions{}
+	opts := buildOptions{newClient: defaultDockerClient}
 	cmd := &cobra.Command{
 		Use:   "build [SERVICE...]",
 		Short: "Build images from compose file",
+		Long: `Build the images of the compose services, all of them or the given ones.
+
+Single-platform images are loaded into the local daemon, --push then pushes
+them. An image built for several platforms (build.platforms) needs BuildKit
+and either --push, which pushes a manifest list straight to the registry,
+or --output DIR, which writes an OCI archive per service to DIR.
+
+--build-arg and --target override the compose build config of every
+service built. A --build-arg without a value is taken from the environment.
+
+Services are built --build-parallelism at a time, one per CPU by default.
+Concurrent builds print their output per service once each finishes.
+
+Images are built on the daemon of DOCKER_HOST, DOCKER_CONTEXT, or the Docker
+CLI context given with --context.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.services = args
+			opts.stdin = cmd.InOrStdin()
 			return runBuild(cmd.Context(), cmd.OutOrStdout(), opts)
 		},
 	}
-	cmd.Flags().StringArrayVarP(&opts.composeFiles, "file", "f", []string{}, "compose file path(s)")
+	cmd.Flags().StringArrayVarP(&opts.composeFiles, "file", "f", []string{}, "compose file path(s), - reads stdin")
+	cmd.Flags().StringArrayVar(&opts.envFiles, "env-file", []string{}, "env file(s) for interpolation, later files win")
+	cmd.Flags().StringArrayVar(&opts.sets, "set", []string{}, "set an interpolation variable, KEY=VALUE, over env files and the environment (repeatable)")
+	cmd.Flags().StringVar(&opts.contextPath, "context-path", "", "base directory for relative build contexts")
+	cmd.Flags().StringVar(&opts.projectName, "compose-project-name", "", "set the compose project name, which names images without an image key, instead of taking it from the directory")
 	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "do not use cache when building")
 	cmd.Flags().BoolVar(&opts.pull, "pull", false, "pull newer versions of base images")
 	cmd.Flags().BoolVar(&opts.push, "push", false, "push images after build")
+	cmd.Flags().BoolVar(&opts.load, "load", false, "load images into the local daemon, single-platform only")
+	cmd.Flags().StringVar(&opts.output, "output", "", "write images as OCI archives to this directory instead of the daemon")
+	cmd.Flags().StringArrayVar(&opts.buildArgs, "build-arg", []string{}, "set a build argument, KEY=VALUE (repeatable)")
+	cmd.Flags().StringVar(&opts.target, "target", "", "build this stage of every Dockerfile")
+	cmd.Flags().StringArrayVar(&opts.exclude, "exclude", []string{}, "leave paths out of every build context, .dockerignore syntax (repeatable)")
+	cmd.Flags().IntVar(&opts.parallelism, "build-parallelism", runtime.NumCPU(), "number of services built at once")
+	cmd.Flags().IntVar(&opts.retries, "retries", 1, "retry a failed registryless image transfer to a server this many times")
+	cmd.Flags().BoolVar(&opts.failFast, "fail-fast", false, "stop the registryless image transfers to the other servers once one fails")
+	cmd.Flags().StringVar(&opts.dockerCtx, "context", "", "build on the daemon of this Docker CLI context")
 	return cmd
 }
 
 func runBuild(ctx context.Context, out io.Writer, opts buildOptions) error {
-	cwd, err := os.Getwd()
+	if opts.output != "" && (opts.push || opts.load) {
+		return errors.New("--output can't be combined with --push or --load")
+	}
+	buildArgs, err := parseBuildArgs(opts.buildArgs)
+	if err != nil {
+		return err
+	}
+
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	project, err := docker.LoadCompose(ctx, opts.composeFiles...)
+	env, err := docker.LoadEnvFiles(opts.envFiles...)
+	if err != nil {
+		return err
+	}
+	env, err = docker.SetVariables(env, opts.sets)
+	if err != nil {
+		return err
+	}
+
+	composeFiles, cleanup, err := docker.ReadComposeStdin(opts.stdin, opts.composeFiles)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	compose := docker.NewProject(env, composeFiles...)
+	compose.SetName(opts.projectName)
+	project, err := compose.Load(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to load compose file: %w", err)
 	}
+	if err := applyGitContext(ctx, out, false, project); err != nil {
+		return err
+	}
+	if opts.contextPath != "" {
+		declared, err := compose.Declared(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load compose file: %w", err)
+		}
+		if err := docker.RebaseBuildContexts(project, declared, opts.contextPath); err != nil {
+			return err
+		}
+	}
 
-	config, err := vault.LoadConfig(cwd)
+	config, err := vault.LoadConfig(root)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	authCfg, err := docker.WithRegistries(ctx, docker.LoadDockerAuth(), config.Registries)
+	if err != nil {
+		return err
+	}
 
-	dockerClient, err := client.New(client.WithHostFromEnv())
+	dockerClient, err := contextClient(opts.dockerCtx, opts.newClient)()
 	if err != nil {
 		return fmt.Errorf("failed to create docker client: %w", err)
 	}
@@ -65,14 +174,44 @@ func runBuild(ctx context.Context, out io.Writer, opts buildOptions) error {
 	}
 
 	buildOpts := docker.BuildOptions{
-		Services: servicesToBuild,
-		Auth:     docker.LoadDockerAuth(),
-		Servers:  config.Servers,
-		NoCache:  opts.noCache,
-		Pull:     opts.pull,
-		Push:     opts.push,
-		Out:      out,
+		Services:    servicesToBuild,
+		Auth:        authCfg,
+		Servers:     config.Servers,
+		NoCache:     opts.noCache,
+		Pull:        opts.pull,
+		Push:        opts.push,
+		Load:        opts.load,
+		Output:      opts.output,
+		BuildArgs:   buildArgs,
+		Target:      opts.target,
+		Exclude:     opts.exclude,
+		Parallelism: opts.parallelism,
+		Retries:     opts.retries,
+		FailFast:    opts.failFast,
+		Log:         newLogger(out, false),
+		Out:         out,
 	}
 
-	return docker.Build(ctx, dockerClient, project, buildOpts)
+	return docker.Build(ctx, dockerClient, *project, buildOpts)
+}
+
+// parseBuildArgs turns KEY=VALUE flags into build args, a bare KEY takes its
+// value from the environment and is dropped when unset, like docker build
+func parseBuildArgs(args []string) (types.MappingWithEquals, error) {
+	result := make(types.MappingWithEquals, len(args))
+	for _, arg := range args {
+		key, value, hasValue := strings.Cut(arg, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid --build-arg %q, expected KEY=VALUE", arg)
+		}
+		if !hasValue {
+			v, ok := os.LookupEnv(key)
+			if !ok {
+				continue
+			}
+			value = v
+		}
+		result[key] = &value
+	}
+	return result, nil
 }
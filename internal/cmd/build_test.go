@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/moby/moby/client"
+)
+
+// fakeBuildClient answers the calls of a classic (non-BuildKit) build
+type fakeBuildClient struct {
+	client.APIClient
+
+	builds []client.ImageBuildOptions
+	closed bool
+}
+
+func (f *fakeBuildClient) Ping(_ context.Context, _ client.PingOptions) (client.PingResult, error) {
+	return client.PingResult{}, nil
+}
+
+func (f *fakeBuildClient) ImageBuild(_ context.Context, buildContext io.Reader, opts client.ImageBuildOptions) (client.ImageBuildResult, error) {
+	if _, err := io.Copy(io.Discard, buildContext); err != nil {
+		return client.ImageBuildResult{}, err
+	}
+	f.builds = append(f.builds, opts)
+	body := `{"stream":"Step 1/1 : FROM scratch\n"}` + "\n" + `{"aux":{"ID":"sha256:0123"}}` + "\n"
+	return client.ImageBuildResult{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (f *fakeBuildClient) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestBuildWithClientFactory(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	compose := "services:\n  web:\n    image: registry.example.com/web:latest\n    build: .\n  db:\n    image: postgres:16\n"
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	fake := &fakeBuildClient{}
+	opts := buildOptions{
+		composeFiles: []string{filepath.Join(dir, "compose.yaml")},
+		newClient:    func() (client.APIClient, error) { return fake, nil },
+	}
+	if err := runBuild(context.Background(), new(bytes.Buffer), opts); err != nil {
+		t.Fatalf("runBuild failed: %v", err)
+	}
+
+	if len(fake.builds) != 1 {
+		t.Fatalf("expected one image build, got %d", len(fake.builds))
+	}
+	if !slices.Equal(fake.builds[0].Tags, []string{"registry.example.com/web:latest"}) {
+		t.Errorf("expected the web image tag, got %v", fake.builds[0].Tags)
+	}
+	if !fake.closed {
+		t.Error("expected the client to be closed")
+	}
+}
+
+func TestBuildComposeFromStdin(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := os.Mkdir(filepath.Join(dir, "web"), 0o755); err != nil {
+		t.Fatalf("failed to create build context: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "web", "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	fake := &fakeBuildClient{}
+	opts := buildOptions{
+		composeFiles: []string{"-"},
+		stdin:        strings.NewReader("services:\n  web:\n    image: registry.example.com/web:latest\n    build: ./web\n"),
+		newClient:    func() (client.APIClient, error) { return fake, nil },
+	}
+	if err := runBuild(context.Background(), new(bytes.Buffer), opts); err != nil {
+		t.Fatalf("runBuild failed: %v", err)
+	}
+
+	if len(fake.builds) != 1 || !slices.Equal(fake.builds[0].Tags, []string{"registry.example.com/web:latest"}) {
+		t.Fatalf("expected the web image from stdin to be built, got %+v", fake.builds)
+	}
+}
+
+func TestBuildOutputConflicts(t *testing.T) {
+	setupTestEnv(t)
+
+	for _, flag := range []string{"--push", "--load"} {
+		cmd := NewBuildCommand()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		cmd.SetArgs([]string{"--output", "dist", flag})
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--output can't be combined") {
+			t.Errorf("expected --output %s to be rejected, got %v", flag, err)
+		}
+	}
+}
+
+func TestBuildOverrides(t *testing.T) {
+	dir := setupTestEnv(t)
+	t.Setenv("FROM_ENV", "env-value")
+
+	compose := `services:
+  web:
+    image: registry.example.com/web:latest
+    build:
+      context: .
+      target: prod
+      args:
+        VERSION: "1"
+        KEEP: kept
+  worker:
+    image: registry.example.com/worker:latest
+    build: .
+`
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	fake := &fakeBuildClient{}
+	opts := buildOptions{
+		composeFiles: []string{filepath.Join(dir, "compose.yaml")},
+		buildArgs:    []string{"VERSION=2", "FROM_ENV", "UNSET_ARG"},
+		target:       "debug",
+		newClient:    func() (client.APIClient, error) { return fake, nil },
+	}
+	if err := runBuild(context.Background(), new(bytes.Buffer), opts); err != nil {
+		t.Fatalf("runBuild failed: %v", err)
+	}
+
+	if len(fake.builds) != 2 {
+		t.Fatalf("expected two image builds, got %d", len(fake.builds))
+	}
+	for _, build := range fake.builds {
+		if build.Target != "debug" {
+			t.Errorf("%v: expected target debug, got %q", build.Tags, build.Target)
+		}
+		if v := build.BuildArgs["VERSION"]; v == nil || *v != "2" {
+			t.Errorf("%v: expected VERSION=2, got %v", build.Tags, v)
+		}
+		if v := build.BuildArgs["FROM_ENV"]; v == nil || *v != "env-value" {
+			t.Errorf("%v: expected FROM_ENV from the environment, got %v", build.Tags, v)
+		}
+		if _, ok := build.BuildArgs["UNSET_ARG"]; ok {
+			t.Errorf("%v: expected an unset variable to be dropped", build.Tags)
+		}
+		if slices.Contains(build.Tags, "registry.example.com/web:latest") {
+			if v := build.BuildArgs["KEEP"]; v == nil || *v != "kept" {
+				t.Errorf("expected compose args to be kept, got %v", v)
+			}
+		}
+	}
+
+	opts.buildArgs = []string{"=oops"}
+	if err := runBuild(context.Background(), new(bytes.Buffer), opts); err == nil || !strings.Contains(err.Error(), "invalid --build-arg") {
+		t.Errorf("expected invalid --build-arg error, got %v", err)
+	}
+}
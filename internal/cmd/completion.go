@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the swarm query of a completion, a shell waits
+// on it before showing anything
+const completionTimeout = 5 * time.Second
+
+// completeStacks suggests the stacks on the swarm of the configured servers,
+// or of --server when the command has it. Only the first argument is a stack.
+func completeStacks(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	host, _ := cmd.Flags().GetString("server")
+	manager, err := managerClient(ctx, host)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer manager.Close()
+
+	stacks, err := docker.ListStacks(ctx, manager)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return stacks, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeServers suggests the configured server hosts
+func completeServers(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	root, err := vaultRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	hosts := make([]string, 0, len(cfg.Servers))
+	for host := range cfg.Servers {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	return hosts, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSecrets suggests the names in the vault, which needs no key
+func completeSecrets(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	root, err := vaultRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, err := vault.SecretNames(root)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRegistries suggests the registries the vault or docker login
+// stored credentials or set a credential helper for
+func completeRegistries(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	authCfg := docker.LoadDockerAuth()
+	var registries []string
+	for registry := range authCfg.AuthConfigs {
+		registries = append(registries, registry)
+	}
+	for registry := range authCfg.CredentialHelpers {
+		if !slices.Contains(registries, registry) {
+			registries = append(registries, registry)
+		}
+	}
+	if root, err := vaultRoot(); err == nil {
+		if has, _ := vault.HasRegistries(root); has {
+			if cfg, err := vault.LoadConfig(root); err == nil {
+				for registry := range cfg.Registries {
+					if !slices.Contains(registries, registry) {
+						registries = append(registries, registry)
+					}
+				}
+			}
+		}
+	}
+	slices.Sort(registries)
+	return registries, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeServerFlag suggests configured hosts for a --server flag
+func completeServerFlag(cmd *cobra.Command) {
+	_ = cmd.RegisterFlagCompletionFunc("server", func(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeServers(cmd, nil, toComplete)
+	})
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/docker/cli/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// completeArgs runs the ValidArgsFunction of the subcommand at path
+func completeArgs(t *testing.T, root *cobra.Command, path []string, args []string) []string {
+	t.Helper()
+	cmd, _, err := root.Find(path)
+	if err != nil {
+		t.Fatalf("command %v not found: %v", path, err)
+	}
+	if cmd.ValidArgsFunction == nil {
+		t.Fatalf("command %v has no completion", path)
+	}
+	got, directive := cmd.ValidArgsFunction(cmd, args, "")
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("%v: expected no file completion, got directive %d", path, directive)
+	}
+	return got
+}
+
+func TestCompleteServers(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveConfig(dir, vault.Config{Servers: map[string]vault.Server{
+		"203.0.113.2": {User: "deploy"},
+		"203.0.113.1": {User: "deploy"},
+	}}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	for _, path := range [][]string{{"remove"}, {"rename"}} {
+		got := completeArgs(t, NewServerCommand(), path, nil)
+		if !slices.Equal(got, []string{"203.0.113.1", "203.0.113.2"}) {
+			t.Errorf("%v: expected the configured hosts, got %v", path, got)
+		}
+	}
+	if got := completeArgs(t, NewServerCommand(), []string{"remove"}, []string{"203.0.113.1"}); len(got) != 0 {
+		t.Errorf("expected nothing after the host, got %v", got)
+	}
+}
+
+func TestCompleteSecrets(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveSecrets(dir, vault.Secrets{"DB_PASSWORD": "secret123", "API_KEY": "mykey"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	for _, path := range [][]string{{"remove"}, {"rename"}} {
+		got := completeArgs(t, NewSecretCommand(), path, nil)
+		if !slices.Equal(got, []string{"API_KEY", "DB_PASSWORD"}) {
+			t.Errorf("%v: expected the secret names, got %v", path, got)
+		}
+	}
+	if got := completeArgs(t, NewSecretCommand(), []string{"rename"}, []string{"API_KEY"}); len(got) != 0 {
+		t.Errorf("expected no suggestion for the new name, got %v", got)
+	}
+}
+
+func TestCompleteRegistries(t *testing.T) {
+	configDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{
+  "auths": {
+    "ghcr.io": {"auth": "dXNlcjpwYXNz"},
+    "https://index.docker.io/v1/": {}
+  },
+  "credHelpers": {
+    "123456789012.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login",
+    "ghcr.io": "desktop"
+  }
+}`), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write docker config: %v", err)
+	}
+	orig := config.Dir()
+	config.SetDir(configDir)
+	t.Cleanup(func() { config.SetDir(orig) })
+
+	got := completeArgs(t, NewRegistryCommand(), []string{"test"}, nil)
+	want := []string{"123456789012.dkr.ecr.eu-west-1.amazonaws.com", "ghcr.io", "https://index.docker.io/v1/"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected the registries with credentials, got %v", got)
+	}
+}
@@ -2,30 +2,77 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/blindlobstar/cicdez/internal/docker"
 	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/moby/moby/client"
 	"github.com/spf13/cobra"
 )
 
+var errNoServers = errors.New("no servers configured, run `cicdez server add` first")
+
+var errDeployTimeout = errors.New("deploy timed out")
+
 type deployOptions struct {
 	composeFiles []string
+	envFiles     []string
+	sets         []string
+	contextPath  string
+	projectName  string
 	stack        string
 	prune        bool
+	pruneNets    bool
+	pruneSecrets bool
+	pruneConfigs bool
 	resolveImage string
+	noResolve    bool
 	quiet        bool
+	progress     bool
 	noBuild      bool
 	noCache      bool
 	pull         bool
+	exclude      []string
+	parallelism  int
+	retries      int
+	failFast     bool
 	detach       bool
+	composeOut   string
+	showSecrets  bool
+	scale        []string
+	images       []string
+	profiles     []string
+	only         []string
+	skip         []string
+	strictRes    bool
+	strictPlace  bool
+	checkImages  bool
+	recreate     bool
+	forceUpdate  bool
+	recreateNets bool
+	local        bool
+	dockerCtx    string
+	timeout      time.Duration
+	waitTimeout  time.Duration
+	failTimeout  bool
+	historyLimit int
+	stdin        io.Reader
+	newClient    DockerClientFactory
 }
 
 func NewDeployCommand() *cobra.Command {
-	opts := deployOptions{}
+	opts := deployOptions{newClient: defaultDockerClient}
 	cmd := &cobra.Command{
 		Use:   "deploy [STACK]",
 		Short: "Deploy stack to Docker Swarm",
@@ -33,76 +80,265 @@ func NewDeployCommand() *cobra.Command {
 
 Images are built and pushed automatically unless --no-build is specified.
 Images prefixed with registryless/ are streamed directly to swarm nodes
-instead of a registry.
+instead of a registry; a node that fails is retried, the others carry on,
+and the failed ones are listed at the end unless --fail-fast stops early.
 Secrets are decrypted and injected during deployment.
-Stack name defaults to the project name from the compose file.`,
-		Args: cobra.MaximumNArgs(1),
+Stack name defaults to the project name from the compose file.
+With --detach the submitted services are recorded locally, so
+"cicdez status" and "cicdez wait" can pick the stack up later.
+With --compose-out the converted swarm specs are written to a file
+(JSON for .json, YAML otherwise) and nothing is built or deployed.
+Secret payloads are redacted unless --show-secrets is given.
+Services with compose profiles are only deployed when one of their profiles
+is selected with --profile, services without profiles always are.
+--only and --skip (repeatable) deploy a subset of the services; --only must
+name the services its picks depend on, and --prune is turned off for a subset.
+Use --scale SERVICE=REPLICAS (repeatable) to override replica counts
+without editing the compose file.
+--image SERVICE=IMAGE (repeatable) deploys a service with another image,
+such as a hotfix tag, without editing the compose file; that service is not
+built. It pairs with --only to bump a single service.
+--resolve-image never (or --no-resolve-image) skips every registry query,
+useful when the managers can't reach the registry; tags are submitted as is.
+A service can pick its own mode with x-cicdez.resolve_image, for example
+always for one tracking :latest while the rest use never.
+Placement constraints on node.labels no available node satisfies are
+reported as warnings, --strict-placement fails the deploy instead.
+--check-images has the manager look up every image that isn't built first,
+so a mistyped tag fails the deploy instead of leaving tasks unable to pull.
+--prune only removes services labeled io.cicdez.managed, so services a plain
+"docker stack deploy" put in the same stack are left alone.
+--prune-networks, --prune-secrets and --prune-configs remove the stack's
+objects of that kind the compose file no longer declares, unless a service,
+of this stack or another, still uses them.
+Swarm can't switch a running service between replicated and global mode,
+--recreate-on-mode-change removes and recreates such services instead of
+failing the deploy.
+--force-recreate replaces the tasks of every deployed service even when its
+spec didn't change, e.g. to pick up a new digest of a mutable tag. Unlike
+"cicdez restart" the new spec is still applied.
+Existing networks are kept as they are, --recreate-networks removes and
+creates again the ones whose driver, options or labels changed, as long as
+no service is attached to them anymore.
+--local deploys to the swarm of DOCKER_HOST or DOCKER_CONTEXT and --context
+to the one of a Docker CLI context, instead of the configured servers; images
+are built on that same daemon.
+--timeout bounds the whole deploy, from building to convergence; the error
+names the phase that was still running.
+--wait-timeout only bounds waiting for convergence: services still converging
+then are reported in the summary printed at the end, and only fail the
+deploy with --fail-on-timeout.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeStacks,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) > 0 {
 				opts.stack = args[0]
 			}
+			if opts.noResolve {
+				resolveSet := cmd.Flags().Changed("resolve-image") || cmd.Flags().Changed("pull-policy")
+				if resolveSet && opts.resolveImage != docker.ResolveImageNever {
+					return fmt.Errorf("--no-resolve-image can't be combined with --resolve-image %s", opts.resolveImage)
+				}
+				opts.resolveImage = docker.ResolveImageNever
+			}
+			if len(opts.only) > 0 && len(opts.skip) > 0 {
+				return errors.New("--only can't be combined with --skip")
+			}
+			if opts.local && opts.dockerCtx != "" {
+				return errors.New("--local can't be combined with --context")
+			}
+			opts.stdin = cmd.InOrStdin()
 			return runDeploy(cmd.Context(), cmd.OutOrStdout(), opts)
 		},
 	}
-	cmd.Flags().StringArrayVarP(&opts.composeFiles, "file", "f", []string{}, "compose file path(s)")
-	cmd.Flags().BoolVar(&opts.prune, "prune", false, "prune services no longer referenced")
+	cmd.Flags().StringArrayVarP(&opts.composeFiles, "file", "f", []string{}, "compose file path(s), - reads stdin")
+	cmd.Flags().StringArrayVar(&opts.envFiles, "env-file", []string{}, "env file(s) for interpolation, later files win")
+	cmd.Flags().StringArrayVar(&opts.sets, "set", []string{}, "set an interpolation variable, KEY=VALUE, over env files and the environment (repeatable)")
+	cmd.Flags().StringVar(&opts.contextPath, "context-path", "", "base directory for relative build contexts")
+	cmd.Flags().StringVar(&opts.projectName, "compose-project-name", "", "set the compose project name, which names images without an image key, instead of taking it from the directory")
+	cmd.Flags().BoolVar(&opts.prune, "prune", false, "remove services, and stale generated secrets and configs, no longer referenced")
+	cmd.Flags().BoolVar(&opts.pruneNets, "prune-networks", false, "remove stack networks no longer declared or used")
+	cmd.Flags().BoolVar(&opts.pruneSecrets, "prune-secrets", false, "remove stack secrets no longer declared or used")
+	cmd.Flags().BoolVar(&opts.pruneConfigs, "prune-configs", false, "remove stack configs no longer declared or used")
 	cmd.Flags().StringVar(&opts.resolveImage, "resolve-image", docker.ResolveImageAlways, "resolve image digests: always, changed, never")
-	cmd.Flags().BoolVarP(&opts.quiet, "quiet", "q", false, "suppress progress output")
+	cmd.Flags().StringVar(&opts.resolveImage, "pull-policy", docker.ResolveImageAlways, "alias for --resolve-image")
+	cmd.Flags().BoolVar(&opts.noResolve, "no-resolve-image", false, "never query the registry for digests, same as --resolve-image never")
+	cmd.Flags().BoolVarP(&opts.quiet, "quiet", "q", false, "suppress progress output, build and push streams included")
+	cmd.Flags().BoolVar(&opts.progress, "progress", false, "print per-service task counts and nodes while waiting")
 	cmd.Flags().BoolVar(&opts.noBuild, "no-build", false, "skip building images before deploy")
 	cmd.Flags().BoolVar(&opts.noCache, "no-cache", false, "do not use cache when building")
 	cmd.Flags().BoolVar(&opts.pull, "pull", false, "pull newer versions of base images")
+	cmd.Flags().StringArrayVar(&opts.exclude, "exclude", []string{}, "leave paths out of every build context, .dockerignore syntax (repeatable)")
+	cmd.Flags().IntVar(&opts.parallelism, "build-parallelism", runtime.NumCPU(), "number of services built at once")
+	cmd.Flags().IntVar(&opts.retries, "retries", 1, "retry a failed registryless image transfer to a server this many times")
+	cmd.Flags().BoolVar(&opts.failFast, "fail-fast", false, "stop the registryless image transfers to the other servers once one fails")
 	cmd.Flags().BoolVarP(&opts.detach, "detach", "d", false, "exit immediately instead of waiting for the services to converge")
+	cmd.Flags().StringArrayVar(&opts.profiles, "profile", []string{}, "also deploy the services of this compose profile (repeatable, * for all)")
+	cmd.Flags().StringArrayVar(&opts.only, "only", []string{}, "deploy only this service (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.skip, "skip", []string{}, "leave this service out of the deploy (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.scale, "scale", []string{}, "override replicas, SERVICE=REPLICAS")
+	cmd.Flags().StringArrayVar(&opts.images, "image", []string{}, "deploy SERVICE=IMAGE instead of the compose image, skipping its build (repeatable)")
+	cmd.Flags().BoolVar(&opts.strictRes, "strict-resources", false, "fail when a reservation exceeds the capacity of every node")
+	cmd.Flags().BoolVar(&opts.strictPlace, "strict-placement", false, "fail when no node has the labels a placement constraint asks for")
+	cmd.Flags().BoolVar(&opts.checkImages, "check-images", false, "fail before deploying when an image that isn't built can't be pulled")
+	cmd.Flags().BoolVar(&opts.forceUpdate, "force-recreate", false, "replace the tasks of every deployed service even when its spec is unchanged")
+	cmd.Flags().BoolVar(&opts.recreate, "recreate-on-mode-change", false, "remove and recreate services whose mode changes between replicated and global")
+	cmd.Flags().BoolVar(&opts.recreateNets, "recreate-networks", false, "remove and recreate unused networks whose settings changed")
+	cmd.Flags().BoolVar(&opts.local, "local", false, "deploy to the swarm of the local daemon instead of the configured servers")
+	cmd.Flags().StringVar(&opts.dockerCtx, "context", "", "deploy to the swarm of this Docker CLI context instead of the configured servers")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 0, "fail the deploy if it takes longer than this, e.g. 10m (0 waits forever)")
+	cmd.Flags().DurationVar(&opts.waitTimeout, "wait-timeout", 0, "stop waiting for convergence after this long and report the services still converging")
+	cmd.Flags().BoolVar(&opts.failTimeout, "fail-on-timeout", false, "fail the deploy if a service hasn't converged within --wait-timeout")
+	cmd.Flags().StringVar(&opts.composeOut, "compose-out", "", "write the rendered stack to a file instead of deploying")
+	cmd.Flags().BoolVar(&opts.showSecrets, "show-secrets", false, "include secret payloads in --compose-out output")
+	cmd.Flags().IntVar(&opts.historyLimit, "history-limit", vault.DefaultHistoryLimit, "deploys kept in the vault history, 0 records none")
 	return cmd
 }
 
-func runDeploy(ctx context.Context, out io.Writer, opts deployOptions) error {
-	cwd, err := os.Getwd()
+func runDeploy(ctx context.Context, out io.Writer, opts deployOptions) (err error) {
+	if err := docker.CheckResolveImage(opts.resolveImage); err != nil {
+		return err
+	}
+
+	phase := "loading the project"
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("%w after %s while %s: %w", errDeployTimeout, opts.timeout, phase, err)
+			}
+		}()
+	}
+
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
+	}
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
 	}
 
-	cfg, err := vault.LoadConfig(cwd)
+	scale, err := parseScaleArgs(opts.scale)
+	if err != nil {
+		return err
+	}
+	images, err := parseImageArgs(opts.images)
+	if err != nil {
+		return err
+	}
+
+	env, err := docker.LoadEnvFiles(opts.envFiles...)
+	if err != nil {
+		return err
+	}
+	env, err = docker.SetVariables(env, opts.sets)
 	if err != nil {
 		return err
 	}
 
-	project, err := docker.LoadCompose(ctx, opts.composeFiles...)
+	composeFiles, cleanup, err := docker.ReadComposeStdin(opts.stdin, opts.composeFiles)
 	if err != nil {
 		return err
 	}
+	defer cleanup()
+
+	// build and deploy share the parsed project
+	compose := docker.NewProject(env, composeFiles...)
+	compose.SetName(opts.projectName)
+	project, err := compose.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if err := docker.SelectProfiles(project, opts.profiles); err != nil {
+		return err
+	}
+	if err := selectServices(out, project, &opts); err != nil {
+		return err
+	}
+	if err := applyGitContext(ctx, out, opts.quiet, project); err != nil {
+		return err
+	}
+	if opts.contextPath != "" {
+		declared, err := compose.Declared(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load compose file: %w", err)
+		}
+		if err := docker.SelectProfiles(&declared, opts.profiles); err != nil {
+			return err
+		}
+		if err := docker.RebaseBuildContexts(project, declared, opts.contextPath); err != nil {
+			return err
+		}
+	}
+	if err := docker.OverrideImages(project, images); err != nil {
+		return err
+	}
 
 	if opts.stack == "" {
 		// compose-go defaults project.Name to the directory name if not set
 		opts.stack = project.Name
 	}
 
-	secrets, err := vault.LoadSecrets(cwd)
+	secrets, err := vault.LoadSecrets(root)
 	if err != nil {
 		return fmt.Errorf("failed to load secrets: %w", err)
 	}
 
-	authCfg := docker.LoadDockerAuth()
+	if opts.composeOut != "" {
+		return renderStack(ctx, out, *project, secrets, scale, opts)
+	}
 
-	if !opts.noBuild && docker.HasBuildConfig(project) {
-		dockerClient, err := client.New(client.WithHostFromEnv())
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return err
+	}
+
+	// a local swarm plays every role the servers would, registryless
+	// images are already on it once built
+	local := opts.local || opts.dockerCtx != ""
+	servers := cfg.Servers
+	if local {
+		servers = nil
+	} else if len(servers) == 0 {
+		return errNoServers
+	}
+	newClient := contextClient(opts.dockerCtx, opts.newClient)
+
+	authCfg, err := docker.WithRegistries(ctx, docker.LoadDockerAuth(), cfg.Registries)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(out, opts.quiet)
+
+	if !opts.noBuild && docker.HasBuildConfig(*project) {
+		dockerClient, err := newClient()
 		if err != nil {
 			return fmt.Errorf("failed to create local docker client: %w", err)
 		}
 		defer dockerClient.Close()
 
 		buildOpts := docker.BuildOptions{
-			Auth:    authCfg,
-			Servers: cfg.Servers,
-			NoCache: opts.noCache,
-			Pull:    opts.pull,
-			Push:    true,
-			Out:     out,
+			Auth:        authCfg,
+			Servers:     servers,
+			NoCache:     opts.noCache,
+			Pull:        opts.pull,
+			Push:        true,
+			Exclude:     opts.exclude,
+			Parallelism: opts.parallelism,
+			Retries:     opts.retries,
+			FailFast:    opts.failFast,
+			Quiet:       opts.quiet,
+			Log:         logger,
+			Out:         out,
 		}
 
+		phase = "building images"
 		if !opts.quiet {
 			fmt.Fprintln(out, "==> Building images")
 		}
-		if err := docker.Build(ctx, dockerClient, project, buildOpts); err != nil {
+		if err := docker.Build(ctx, dockerClient, *project, buildOpts); err != nil {
 			return fmt.Errorf("failed to build and push images: %w", err)
 		}
 		if !opts.quiet {
@@ -110,34 +346,215 @@ func runDeploy(ctx context.Context, out io.Writer, opts deployOptions) error {
 		}
 	}
 
-	client, _, err := docker.GetManagerClient(ctx, cfg.Servers)
-	if err != nil {
-		return err
+	phase = "connecting to the manager"
+	var manager client.APIClient
+	if local {
+		manager, err = newClient()
+		if err != nil {
+			return fmt.Errorf("failed to create local docker client: %w", err)
+		}
+	} else {
+		manager, _, err = docker.GetManagerClient(ctx, servers)
+		if err != nil {
+			return err
+		}
 	}
-	defer client.Close()
+	defer manager.Close()
 
+	phase = "resolving registryless images"
 	// resolve registryless tags on the manager: for these images the swarm
 	// plays the registry, so the tag there points at the last pushed content
-	if err := docker.PinServices(ctx, client, &project); err != nil {
+	if err := docker.PinServices(ctx, manager, project); err != nil {
 		return err
 	}
 
+	phase = "deploying stack " + opts.stack
 	if !opts.quiet {
 		fmt.Fprintf(out, "==> Deploying stack %s\n", opts.stack)
 	}
-	err = docker.Deploy(ctx, client, project, docker.DeployOptions{
-		Secrets:      secrets,
-		Stack:        opts.stack,
-		Prune:        opts.prune,
-		ResolveImage: opts.resolveImage,
-		Quiet:        opts.quiet,
-		Auth:         authCfg,
-		Detach:       opts.detach,
-		Out:          out,
+	services, err := docker.Deploy(ctx, manager, compose, docker.DeployOptions{
+		Secrets:         secrets,
+		Stack:           opts.stack,
+		Prune:           opts.prune,
+		ResolveImage:    opts.resolveImage,
+		Quiet:           opts.quiet,
+		Progress:        opts.progress,
+		Auth:            authCfg,
+		Detach:          true, // waited on below, so a timeout names the phase
+		Scale:           scale,
+		StrictResources: opts.strictRes,
+		StrictPlacement: opts.strictPlace,
+		CheckImages:     opts.checkImages,
+		RecreateMode:    opts.recreate,
+		ForceRecreate:   opts.forceUpdate,
+		NetworkRecreate: opts.recreateNets,
+		PruneNetworks:   opts.pruneNets,
+		PruneSecrets:    opts.pruneSecrets,
+		PruneConfigs:    opts.pruneConfigs,
+		Log:             logger,
+		Out:             out,
 	})
 	if err != nil {
 		return err
 	}
+	recordHistory(ctx, out, root, *project, opts.stack, slices.Sorted(maps.Keys(servers)), opts.historyLimit)
+
+	if !opts.detach && len(services) > 0 {
+		phase = "waiting for the services to converge"
+		waitCtx := ctx
+		if opts.waitTimeout > 0 {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, opts.waitTimeout)
+			defer cancel()
+		}
 
+		summary, err := docker.WaitOnServices(waitCtx, manager, services, opts.quiet, opts.progress, out)
+		if !opts.quiet {
+			fmt.Fprintln(out, "==> Summary")
+			if err := summary.Write(out); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// the whole deploy ran out of time rather than just the wait
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if timedOut := summary.TimedOut(); len(timedOut) > 0 && opts.failTimeout {
+			return fmt.Errorf("%w within %s: %s", docker.ErrNotConverged, opts.waitTimeout, strings.Join(timedOut, ", "))
+		}
+	}
+
+	if opts.detach {
+		state := vault.DeployState{
+			Stack:      opts.stack,
+			Servers:    slices.Sorted(maps.Keys(servers)),
+			Services:   services,
+			DeployedAt: time.Now().UTC(),
+		}
+		if err := vault.SaveDeployState(root, state); err != nil {
+			return fmt.Errorf("failed to save deploy state: %w", err)
+		}
+		return nil
+	}
+
+	// an attached deploy supersedes whatever a detached one recorded
+	return vault.RemoveDeployState(root, opts.stack)
+}
+
+// recordHistory appends the submitted deploy to the vault history. The stack
+// is already changed by then, so a failure only warns.
+func recordHistory(ctx context.Context, out io.Writer, root string, project types.Project, stack string, servers []string, limit int) {
+	if limit <= 0 {
+		return
+	}
+	entry := vault.HistoryEntry{
+		Time:    time.Now().UTC(),
+		Stack:   stack,
+		User:    currentUser(),
+		Images:  make(map[string]string, len(project.Services)),
+		Servers: servers,
+	}
+	// not every project lives in a git checkout
+	if gc, err := docker.LoadGitContext(ctx, project.WorkingDir); err == nil {
+		entry.Commit = gc.SHA
+	}
+	for name, svc := range project.Services {
+		entry.Images[name] = svc.Image
+	}
+	if err := vault.AppendHistory(root, entry, limit); err != nil {
+		fmt.Fprintf(out, "%s failed to record the deploy in the history: %v\n", docker.WarningPrefix(), err)
+	}
+}
+
+// currentUser names who runs cicdez for the history
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// parseImageArgs splits --image values into service name to image
+func parseImageArgs(args []string) (map[string]string, error) {
+	images := make(map[string]string, len(args))
+	for _, arg := range args {
+		service, image, ok := strings.Cut(arg, "=")
+		if !ok || service == "" || image == "" {
+			return nil, fmt.Errorf("invalid image argument %q, expected SERVICE=IMAGE", arg)
+		}
+		images[service] = image
+	}
+	return images, nil
+}
+
+// selectServices applies --only and --skip. Prune is turned off for a subset,
+// it would remove every service that wasn't selected.
+func selectServices(out io.Writer, project *types.Project, opts *deployOptions) error {
+	if len(opts.only) == 0 && len(opts.skip) == 0 {
+		return nil
+	}
+	if err := docker.SelectServices(project, opts.only, opts.skip); err != nil {
+		return err
+	}
+	for _, p := range []struct {
+		flag string
+		set  *bool
+	}{
+		{"--prune", &opts.prune},
+		{"--prune-networks", &opts.pruneNets},
+		{"--prune-secrets", &opts.pruneSecrets},
+		{"--prune-configs", &opts.pruneConfigs},
+	} {
+		if *p.set {
+			*p.set = false
+			fmt.Fprintf(out, "%s %s ignored, only a subset of the services is deployed\n", docker.WarningPrefix(), p.flag)
+		}
+	}
+	return nil
+}
+
+func renderStack(ctx context.Context, out io.Writer, project types.Project, secrets vault.Secrets, scale map[string]uint64, opts deployOptions) error {
+	data, err := docker.Render(ctx, project, docker.RenderOptions{
+		Secrets:     secrets,
+		Stack:       opts.stack,
+		ShowSecrets: opts.showSecrets,
+		JSON:        strings.EqualFold(filepath.Ext(opts.composeOut), ".json"),
+		Scale:       scale,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render stack: %w", err)
+	}
+
+	perm := os.FileMode(0o644)
+	if opts.showSecrets {
+		perm = 0o600
+	}
+	if err := os.WriteFile(opts.composeOut, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.composeOut, err)
+	}
+
+	if !opts.quiet {
+		fmt.Fprintf(out, "Rendered stack %s to %s\n", opts.stack, opts.composeOut)
+	}
 	return nil
 }
+
+// applyGitContext fills {git.*} tokens from the checkout holding the compose
+// project, git is only consulted when a token is present
+func applyGitContext(ctx context.Context, out io.Writer, quiet bool, project *types.Project) error {
+	if !docker.UsesGitContext(*project) {
+		return nil
+	}
+
+	gc, err := docker.LoadGitContext(ctx, project.WorkingDir)
+	if err != nil {
+		return err
+	}
+	if gc.Dirty && !quiet {
+		fmt.Fprintf(out, "%s working tree has uncommitted changes, {git.*} values describe commit %s\n", docker.WarningPrefix(), gc.SHA)
+	}
+	return docker.ApplyGitContext(project, gc)
+}
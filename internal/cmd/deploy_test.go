@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/client"
+)
+
+func TestDeployInvalidResolveImage(t *testing.T) {
+	// no vault, compose file or servers: the flag must be rejected before
+	// any of them, let alone docker, is looked at
+	setupTestEnv(t)
+
+	cmd := NewDeployCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"--resolve-image", "chnaged"})
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), `invalid --resolve-image value "chnaged"`) {
+		t.Fatalf("expected invalid --resolve-image error, got %v", err)
+	}
+	for _, mode := range []string{"always", "changed", "never"} {
+		if !strings.Contains(err.Error(), mode) {
+			t.Errorf("expected error to list %q, got %v", mode, err)
+		}
+	}
+}
+
+func TestDeployNoResolveImageConflict(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewDeployCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"--no-resolve-image", "--resolve-image", "always"})
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "--no-resolve-image can't be combined") {
+		t.Fatalf("expected a flag conflict error, got %v", err)
+	}
+}
+
+func TestDeployLocalSkipsServers(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := os.Mkdir(filepath.Join(dir, vault.Dir), 0o700); err != nil {
+		t.Fatalf("failed to create vault dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services:\n  web:\n    image: nginx:1.27\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	// the local daemon is never reached, the factory records the attempt
+	errDaemon := errors.New("local daemon unavailable")
+	dialed := false
+	opts := deployOptions{
+		composeFiles: []string{filepath.Join(dir, "compose.yaml")},
+		resolveImage: docker.ResolveImageAlways,
+		quiet:        true,
+		newClient: func() (client.APIClient, error) {
+			dialed = true
+			return nil, errDaemon
+		},
+	}
+
+	if err := runDeploy(context.Background(), new(bytes.Buffer), opts); !errors.Is(err, errNoServers) {
+		t.Fatalf("expected errNoServers without --local, got %v", err)
+	}
+	if dialed {
+		t.Error("expected no local client without --local")
+	}
+
+	opts.local = true
+	if err := runDeploy(context.Background(), new(bytes.Buffer), opts); !errors.Is(err, errDaemon) {
+		t.Fatalf("expected --local to deploy through the local client, got %v", err)
+	}
+	if !dialed {
+		t.Error("expected --local to create the local client")
+	}
+}
+
+// blockingClient hangs on every daemon call until the context is done
+type blockingClient struct {
+	client.APIClient
+}
+
+func (blockingClient) Info(ctx context.Context, _ client.InfoOptions) (client.InfoResult, error) {
+	<-ctx.Done()
+	return client.InfoResult{}, ctx.Err()
+}
+
+func (blockingClient) Close() error {
+	return nil
+}
+
+func TestDeployTimeout(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := os.Mkdir(filepath.Join(dir, vault.Dir), 0o700); err != nil {
+		t.Fatalf("failed to create vault dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services:\n  web:\n    image: nginx:1.27\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	opts := deployOptions{
+		composeFiles: []string{filepath.Join(dir, "compose.yaml")},
+		stack:        "prod",
+		resolveImage: docker.ResolveImageAlways,
+		quiet:        true,
+		local:        true,
+		timeout:      50 * time.Millisecond,
+		newClient: func() (client.APIClient, error) {
+			return blockingClient{}, nil
+		},
+	}
+
+	err := runDeploy(context.Background(), new(bytes.Buffer), opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to surface, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms while deploying stack prod") {
+		t.Errorf("expected the error to name the phase, got %v", err)
+	}
+	if code := ExitCode(err); code != ExitConvergence {
+		t.Errorf("expected exit code %d, got %d", ExitConvergence, code)
+	}
+}
+
+func TestDeployLocalContextConflict(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewDeployCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"--local", "--context", "desktop-linux"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--local can't be combined with --context") {
+		t.Fatalf("expected a flag conflict error, got %v", err)
+	}
+}
+
+func TestDeployOnlySkipConflict(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewDeployCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"--only", "web", "--skip", "worker"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--only can't be combined with --skip") {
+		t.Fatalf("expected a flag conflict error, got %v", err)
+	}
+}
+
+func TestSelectServicesDisablesPrune(t *testing.T) {
+	newProject := func() *types.Project {
+		return &types.Project{Services: types.Services{
+			"web":    types.ServiceConfig{Name: "web", Image: "nginx"},
+			"worker": types.ServiceConfig{Name: "worker", Image: "busybox"},
+		}}
+	}
+
+	for _, opts := range []deployOptions{
+		{prune: true, only: []string{"web"}},
+		{prune: true, pruneSecrets: true, skip: []string{"worker"}},
+	} {
+		project := newProject()
+		out := new(bytes.Buffer)
+		if err := selectServices(out, project, &opts); err != nil {
+			t.Fatalf("selectServices failed: %v", err)
+		}
+		if len(project.Services) != 1 {
+			t.Errorf("expected only web to be deployed, got %v", project.Services)
+		}
+		if opts.prune || opts.pruneSecrets {
+			t.Error("expected prune to be turned off for a subset")
+		}
+		if !strings.Contains(out.String(), "--prune ignored") {
+			t.Errorf("expected a warning, got %q", out.String())
+		}
+	}
+
+	opts := deployOptions{prune: true}
+	if err := selectServices(new(bytes.Buffer), newProject(), &opts); err != nil {
+		t.Fatalf("selectServices failed: %v", err)
+	}
+	if !opts.prune {
+		t.Error("expected prune to stay on without --only or --skip")
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+type diffOptions struct {
+	composeFiles []string
+	envFiles     []string
+	stack        string
+	server       string
+	scale        []string
+}
+
+func NewDiffCommand() *cobra.Command {
+	opts := diffOptions{}
+	cmd := &cobra.Command{
+		Use:   "diff [STACK]",
+		Short: "Compare the compose file with the deployed stack",
+		Long: `Convert the compose file the way deploy does and print a unified diff
+against the services, networks, secrets and configs the stack runs now.
+Lines starting with - are live, + is what deploy would submit.
+
+Nothing is built or changed. Secret payloads can't be read back from swarm,
+so only their names and labels are compared.
+The command fails when there are differences, for drift checks in CI.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.stack = args[0]
+			}
+			return runDiff(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&opts.composeFiles, "file", "f", []string{}, "compose file path(s)")
+	cmd.Flags().StringArrayVar(&opts.envFiles, "env-file", []string{}, "env file(s) for interpolation, later files win")
+	cmd.Flags().StringVar(&opts.server, "server", "", "query this configured server instead of any manager")
+	completeServerFlag(cmd)
+	cmd.Flags().StringArrayVar(&opts.scale, "scale", []string{}, "compare with a replica override, SERVICE=REPLICAS (repeatable)")
+	return cmd
+}
+
+func runDiff(ctx context.Context, out io.Writer, opts diffOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+
+	scale, err := parseScaleArgs(opts.scale)
+	if err != nil {
+		return err
+	}
+
+	env, err := docker.LoadEnvFiles(opts.envFiles...)
+	if err != nil {
+		return err
+	}
+
+	project, err := docker.LoadCompose(ctx, env, opts.composeFiles...)
+	if err != nil {
+		return fmt.Errorf("failed to load compose file: %w", err)
+	}
+	if err := applyGitContext(ctx, out, true, &project); err != nil {
+		return err
+	}
+	if opts.stack == "" {
+		opts.stack = project.Name
+	}
+
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	manager, err := managerClient(ctx, opts.server)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	diff, err := docker.Diff(ctx, manager, project, docker.DiffOptions{
+		Secrets: secrets,
+		Stack:   opts.stack,
+		Scale:   scale,
+	})
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		fmt.Fprintf(out, "Stack %s matches the compose file\n", opts.stack)
+		return nil
+	}
+
+	fmt.Fprint(out, diff)
+	return fmt.Errorf("stack %s differs from the compose file", opts.stack)
+}
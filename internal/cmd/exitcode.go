@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/moby/moby/client"
+)
+
+// exit codes of the cicdez binary, scripts can branch on the failure class
+const (
+	ExitOK          = 0
+	ExitError       = 1
+	ExitConfig      = 2
+	ExitConnection  = 3
+	ExitConvergence = 4
+	ExitBuild       = 5
+)
+
+// ExitCode maps the error a command returned to its exit code. Failures that
+// fit no class exit with ExitError.
+func ExitCode(err error) int {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, vault.ErrNotInitialized), errors.Is(err, vault.ErrAlreadyInitialized),
+		errors.Is(err, vault.ErrNestedSecret), errors.Is(err, vault.ErrNoDeployState),
+		errors.Is(err, vault.ErrDecrypt), errors.Is(err, docker.ErrLoadProject),
+		errors.Is(err, errNoServers):
+		return ExitConfig
+	// a deploy timeout wins over the build failure it cut short
+	case errors.Is(err, docker.ErrNotConverged), errors.Is(err, errDeployTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		return ExitConvergence
+	case errors.Is(err, docker.ErrBuild), errors.Is(err, docker.ErrPush):
+		return ExitBuild
+	case errors.Is(err, docker.ErrConnect), errors.Is(err, docker.ErrManagerNotFound),
+		client.IsErrConnectionFailed(err), errors.As(err, &netErr):
+		return ExitConnection
+	}
+	return ExitError
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, ExitOK},
+		{"generic", errors.New("boom"), ExitError},
+		{"not initialized", fmt.Errorf("failed to load secrets: %w", vault.ErrNotInitialized), ExitConfig},
+		{"decrypt", fmt.Errorf("failed to load secrets: %w", fmt.Errorf("%w: bad key", vault.ErrDecrypt)), ExitConfig},
+		{"compose", fmt.Errorf("failed to load compose file: %w", docker.ErrLoadProject), ExitConfig},
+		{"no servers", errNoServers, ExitConfig},
+		{"ssh", fmt.Errorf("%w to example.com: refused", docker.ErrConnect), ExitConnection},
+		{"no manager", docker.ErrManagerNotFound, ExitConnection},
+		{"paused", fmt.Errorf("%w: web: update paused", docker.ErrNotConverged), ExitConvergence},
+		{"timeout", fmt.Errorf("deploy timed out: %w", context.DeadlineExceeded), ExitConvergence},
+		{"deploy timeout", fmt.Errorf("%w after 1m0s while building images: %w", errDeployTimeout, fmt.Errorf("%w web: canceled", docker.ErrBuild)), ExitConvergence},
+		{"build", fmt.Errorf("failed to build: %w", fmt.Errorf("%w web: exit 1", docker.ErrBuild)), ExitBuild},
+		{"push", fmt.Errorf("%w web: denied", docker.ErrPush), ExitBuild},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
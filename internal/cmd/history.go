@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+type historyOptions struct {
+	stack  string
+	limit  int
+	output string
+}
+
+func NewHistoryCommand() *cobra.Command {
+	opts := historyOptions{}
+	cmd := &cobra.Command{
+		Use:   "history [STACK]",
+		Short: "List past deploys",
+		Long: `List the deploys recorded in the vault, newest first: when, which stack,
+who ran it from which commit, the images deployed and the servers targeted.
+
+Every deploy appends an encrypted entry to .cicdez/history.age, commit it
+to share the history. deploy --history-limit bounds how many are kept.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.stack = args[0]
+			}
+			return runHistory(cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().IntVarP(&opts.limit, "limit", "n", 0, "show only the newest N deploys (0 shows all)")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputText, "output format: text, json")
+	return cmd
+}
+
+func runHistory(out io.Writer, opts historyOptions) error {
+	if err := checkOutputFormat(opts.output); err != nil {
+		return err
+	}
+
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	history, err := vault.LoadHistory(root)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+
+	entries := make([]vault.HistoryEntry, 0, len(history))
+	for _, entry := range slices.Backward(history) {
+		if opts.stack != "" && entry.Stack != opts.stack {
+			continue
+		}
+		if opts.limit > 0 && len(entries) == opts.limit {
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(out, entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No deploys recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSTACK\tUSER\tCOMMIT\tSERVERS\tIMAGES")
+	for _, e := range entries {
+		images := make([]string, 0, len(e.Images))
+		for _, name := range slices.Sorted(maps.Keys(e.Images)) {
+			images = append(images, name+"="+e.Images[name])
+		}
+		commit := e.Commit
+		if commit == "" {
+			commit = "-"
+		}
+		servers := strings.Join(e.Servers, ",")
+		if servers == "" {
+			servers = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Stack, e.User, commit, servers, strings.Join(images, ","))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+)
+
+func TestHistory(t *testing.T) {
+	dir := setupTestEnv(t)
+	deployedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, entry := range []vault.HistoryEntry{
+		{Time: deployedAt, Stack: "web", User: "alice", Commit: "1a2b3c4", Images: map[string]string{"api": "ghcr.io/acme/api:1.0", "nginx": "nginx"}, Servers: []string{"203.0.113.1"}},
+		{Time: deployedAt.Add(time.Hour), Stack: "jobs", User: "bob"},
+		{Time: deployedAt.Add(2 * time.Hour), Stack: "web", User: "alice", Commit: "5d6e7f8"},
+	} {
+		if err := vault.AppendHistory(dir, entry, vault.DefaultHistoryLimit); err != nil {
+			t.Fatalf("AppendHistory failed: %v", err)
+		}
+	}
+
+	cmd := NewHistoryCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"web"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 deploys of web, got:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[1], "5d6e7f8") || !strings.Contains(lines[2], "1a2b3c4") {
+		t.Errorf("expected the newest deploy first, got:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[2], "api=ghcr.io/acme/api:1.0,nginx=nginx") || !strings.Contains(lines[2], "203.0.113.1") {
+		t.Errorf("expected images and servers, got %q", lines[2])
+	}
+
+	cmd = NewHistoryCommand()
+	buf.Reset()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"-n", "1", "-o", "json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	var entries []vault.HistoryEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(entries) != 1 || entries[0].Commit != "5d6e7f8" {
+		t.Errorf("expected only the newest deploy, got %+v", entries)
+	}
+}
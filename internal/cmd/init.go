@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+type initOptions struct {
+	recipients []string
+	noSelf     bool
+}
+
+func NewInitCommand() *cobra.Command {
+	opts := initOptions{}
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize cicdez in the current directory",
+		Long: `Create the .cicdez vault in the current directory.
+
+The age key at ~/.config/cicdez/age.key (or CICDEZ_AGE_KEY_FILE) is reused
+when present and generated otherwise. Its public key is written to
+.cicdez/recipients.txt together with any --recipient, and empty encrypted
+config and secrets files are created.
+Use --no-self with --recipient to encrypt only to existing team keys.
+
+Teammates can be added to or removed from recipients.txt later. The next
+write to the vault, or "cicdez key rekey", re-encrypts everything to the new
+list; the hash in .cicdez/recipients.sum tells when that is due.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInit(cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().StringArrayVar(&opts.recipients, "recipient", []string{}, "additional age public key to encrypt to (repeatable)")
+	cmd.Flags().BoolVar(&opts.noSelf, "no-self", false, "do not add the local key as a recipient")
+	return cmd
+}
+
+func runInit(out io.Writer, opts initOptions) error {
+	if opts.noSelf && len(opts.recipients) == 0 {
+		return errors.New("--no-self requires at least one --recipient")
+	}
+	// validate up front so a typo doesn't leave a fresh key behind
+	for _, r := range opts.recipients {
+		if _, err := age.ParseX25519Recipient(r); err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", r, err)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	recipients := opts.recipients
+	if !opts.noSelf {
+		identity, err := loadOrGenerateKey(out)
+		if err != nil {
+			return err
+		}
+		recipients = append([]string{identity.Recipient().String()}, recipients...)
+	}
+
+	if err := vault.InitVault(cwd, recipients); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Initialized cicdez in %s with %d recipient(s)\n", cwd, len(recipients))
+	return nil
+}
+
+// loadOrGenerateKey returns the local age identity, generating one when the
+// key file does not exist yet
+func loadOrGenerateKey(out io.Writer) (*age.X25519Identity, error) {
+	keyPath, err := vault.GetKeyPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine key path: %w", err)
+	}
+
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		identity, err := writeNewKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "Key generated at %s\n", keyPath)
+		fmt.Fprintf(out, "Public key: %s\n", identity.Recipient().String())
+		return identity, nil
+	}
+
+	identity, err := vault.ReadIdentity(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Using existing key at %s\n", keyPath)
+	return identity, nil
+}
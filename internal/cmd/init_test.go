@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/blindlobstar/cicdez/internal/vault"
+)
+
+func TestInit(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Chdir(tmpDir)
+	keyPath := filepath.Join(tmpDir, ".keys", "age.key")
+	t.Setenv("CICDEZ_AGE_KEY_FILE", keyPath)
+
+	cmd := NewInitCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Key generated at") {
+		t.Errorf("expected a new key to be generated, got: %s", buf.String())
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("failed to read generated key: %v", err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to parse generated key: %v", err)
+	}
+	public := identities[0].(*age.X25519Identity).Recipient().String()
+
+	recipients, err := os.ReadFile(filepath.Join(tmpDir, vault.Dir, "recipients.txt"))
+	if err != nil {
+		t.Fatalf("failed to read recipients: %v", err)
+	}
+	if strings.TrimSpace(string(recipients)) != public {
+		t.Errorf("expected recipients to hold %s, got %q", public, recipients)
+	}
+	for _, name := range []string{"config.yaml", "secrets.yaml"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, vault.Dir, name)); err != nil {
+			t.Errorf("expected %s to be created: %v", name, err)
+		}
+	}
+
+	// a second run reuses the key and refuses to touch the vault
+	cmd = NewInitCommand()
+	buf = new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); !errors.Is(err, vault.ErrAlreadyInitialized) {
+		t.Errorf("expected ErrAlreadyInitialized, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "Using existing key") {
+		t.Errorf("expected the existing key to be reused, got: %s", buf.String())
+	}
+}
+
+func TestInitRecipients(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	teammate, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+
+	cmd := NewInitCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"--recipient", "age1bogus"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Fatalf("expected invalid recipient error, got %v", err)
+	}
+
+	cmd = NewInitCommand()
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"--no-self"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected --no-self without --recipient to fail")
+	}
+
+	cmd = NewInitCommand()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"--no-self", "--recipient", teammate.Recipient().String()})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	recipients, err := os.ReadFile(filepath.Join(dir, vault.Dir, "recipients.txt"))
+	if err != nil {
+		t.Fatalf("failed to read recipients: %v", err)
+	}
+	if strings.TrimSpace(string(recipients)) != teammate.Recipient().String() {
+		t.Errorf("expected only the teammate recipient, got %q", recipients)
+	}
+}
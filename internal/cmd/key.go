@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"filippo.io/age"
@@ -17,6 +18,16 @@ type keyGenerateOptions struct {
 	outputPath string
 }
 
+type keyExportPublicOptions struct {
+	keyFile string
+}
+
+type keyImportOptions struct {
+	force      bool
+	sourcePath string
+	outputPath string
+}
+
 func NewKeyCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "key",
@@ -39,7 +50,61 @@ The public key is printed after generation for use in encryption.`,
 	genCmd.Flags().BoolVarP(&genOpts.force, "force", "f", false, "overwrite existing key file")
 	genCmd.Flags().StringVarP(&genOpts.outputPath, "output", "o", "", "output path for key file")
 
+	importOpts := keyImportOptions{}
+	importCmd := &cobra.Command{
+		Use:   "import PATH",
+		Short: "Import an existing age key",
+		Long: `Adopt an existing age identity file as the cicdez key.
+
+The file must hold an X25519 age identity (AGE-SECRET-KEY-...). It is copied
+to ~/.config/cicdez/age.key by default, override with --output or the
+CICDEZ_AGE_KEY_FILE environment variable.
+The public key is printed after import.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			importOpts.sourcePath = args[0]
+			return runKeyImport(cmd.OutOrStdout(), importOpts)
+		},
+	}
+	importCmd.Flags().BoolVarP(&importOpts.force, "force", "f", false, "overwrite existing key file")
+	importCmd.Flags().StringVarP(&importOpts.outputPath, "output", "o", "", "output path for key file")
+
+	exportOpts := keyExportPublicOptions{}
+	exportCmd := &cobra.Command{
+		Use:   "export-public",
+		Short: "Print the public key of the age identity",
+		Long: `Print the age1... public key of the local identity, to share with
+teammates for "cicdez init --recipient".
+
+The key is read from ~/.config/cicdez/age.key by default, override with
+--key-file or the CICDEZ_AGE_KEY_FILE environment variable.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyExportPublic(cmd.OutOrStdout(), exportOpts)
+		},
+	}
+	exportCmd.Flags().StringVar(&exportOpts.keyFile, "key-file", "", "path to the age identity file")
+
+	rekeyCmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt the vault to the current recipients",
+		Long: `Re-encrypt every secret, server, registry and history entry to the
+keys listed in .cicdez/recipients.txt.
+
+Any write to the vault does this on its own once recipients.txt changed;
+run rekey right after removing a teammate's key so their access ends
+without waiting for the next change. Values they copied before stay known
+to them, rotate those.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyRekey(cmd.OutOrStdout())
+		},
+	}
+
 	cmd.AddCommand(genCmd)
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(exportCmd)
+	cmd.AddCommand(rekeyCmd)
 	return cmd
 }
 
@@ -58,13 +123,26 @@ func runKeyGenerate(out io.Writer, opts keyGenerateOptions) error {
 		}
 	}
 
+	identity, err := writeNewKey(opts.outputPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Key generated successfully at %s\n", opts.outputPath)
+	fmt.Fprintf(out, "Public key: %s\n", identity.Recipient().String())
+	return nil
+}
+
+// writeNewKey generates an X25519 identity and stores it at path, readable by
+// the owner only
+func writeNewKey(path string) (*age.X25519Identity, error) {
 	identity, err := age.GenerateX25519Identity()
 	if err != nil {
-		return fmt.Errorf("failed to generate age key: %w", err)
+		return nil, fmt.Errorf("failed to generate age key: %w", err)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(opts.outputPath), 0o700); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	keyContent := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
@@ -73,11 +151,88 @@ func runKeyGenerate(out io.Writer, opts keyGenerateOptions) error {
 		identity.String(),
 	)
 
-	if err := os.WriteFile(opts.outputPath, []byte(keyContent), 0o600); err != nil {
+	if err := os.WriteFile(path, []byte(keyContent), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+	return identity, nil
+}
+
+func runKeyImport(out io.Writer, opts keyImportOptions) error {
+	if opts.outputPath == "" {
+		var err error
+		opts.outputPath, err = vault.GetKeyPath()
+		if err != nil {
+			return fmt.Errorf("failed to determine key path: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(opts.outputPath); err == nil {
+		if !opts.force {
+			return fmt.Errorf("key file already exists at %s (use --force to overwrite)", opts.outputPath)
+		}
+	}
+
+	keyContent, err := os.ReadFile(opts.sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(string(keyContent)))
+	if err != nil {
+		return fmt.Errorf("failed to parse age key: %w", err)
+	}
+	// cicdez encrypts with the first identity in the key file
+	identity, ok := identities[0].(*age.X25519Identity)
+	if !ok {
+		return fmt.Errorf("%s does not start with an X25519 age identity", opts.sourcePath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.outputPath), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := os.WriteFile(opts.outputPath, keyContent, 0o600); err != nil {
 		return fmt.Errorf("failed to write key file: %w", err)
 	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(opts.outputPath, 0o600); err != nil {
+		return fmt.Errorf("failed to set key file permissions: %w", err)
+	}
 
-	fmt.Fprintf(out, "Key generated successfully at %s\n", opts.outputPath)
+	fmt.Fprintf(out, "Key imported successfully to %s\n", opts.outputPath)
 	fmt.Fprintf(out, "Public key: %s\n", identity.Recipient().String())
 	return nil
 }
+
+func runKeyExportPublic(out io.Writer, opts keyExportPublicOptions) error {
+	if opts.keyFile == "" {
+		var err error
+		opts.keyFile, err = vault.GetKeyPath()
+		if err != nil {
+			return fmt.Errorf("failed to determine key path: %w", err)
+		}
+	}
+
+	identity, err := vault.ReadIdentity(opts.keyFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, identity.Recipient().String())
+	return nil
+}
+
+func runKeyRekey(out io.Writer) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	if err := vault.Rekey(root); err != nil {
+		return fmt.Errorf("failed to re-encrypt vault: %w", err)
+	}
+	fmt.Fprintln(out, "Vault re-encrypted to the current recipients")
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"filippo.io/age"
 )
 
 func TestKeyGenerate(t *testing.T) {
@@ -88,3 +90,124 @@ func TestKeyGenerateExistingNoForce(t *testing.T) {
 		t.Errorf("expected error message to mention 'already exists', got: %v", err)
 	}
 }
+
+func TestKeyImport(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourcePath := filepath.Join(tmpDir, "existing.key")
+	keyPath := filepath.Join(tmpDir, "imported.key")
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+	if err := os.WriteFile(sourcePath, []byte(identity.String()+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write source key: %v", err)
+	}
+
+	cmd := NewKeyCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"import", sourcePath, "-o", keyPath})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("key import failed: %v", err)
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("failed to read imported key: %v", err)
+	}
+	if !strings.Contains(string(data), identity.String()) {
+		t.Error("expected imported key file to contain the source identity")
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("failed to stat key file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected file permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	if !strings.Contains(buf.String(), "Public key: "+identity.Recipient().String()) {
+		t.Errorf("expected output to contain public key, got: %s", buf.String())
+	}
+
+	// importing again without --force must not overwrite
+	cmd = NewKeyCommand()
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"import", sourcePath, "-o", keyPath})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected 'already exists' error, got: %v", err)
+	}
+}
+
+func TestKeyImportInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourcePath := filepath.Join(tmpDir, "bogus.key")
+	keyPath := filepath.Join(tmpDir, "imported.key")
+
+	if err := os.WriteFile(sourcePath, []byte("not a key\n"), 0o600); err != nil {
+		t.Fatalf("failed to write source key: %v", err)
+	}
+
+	cmd := NewKeyCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"import", sourcePath, "-o", keyPath})
+
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected error for invalid key, got nil")
+	}
+	if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+		t.Error("expected no key file to be written for an invalid key")
+	}
+}
+
+func TestKeyExportPublic(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "test.key")
+
+	cmd := NewKeyCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"generate", "-o", keyPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("key generate failed: %v", err)
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("failed to read generated key: %v", err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to parse generated key: %v", err)
+	}
+	want := identities[0].(*age.X25519Identity).Recipient().String()
+
+	cmd = NewKeyCommand()
+	buf = new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"export-public", "--key-file", keyPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("key export-public failed: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("expected public key %s, got %s", want, got)
+	}
+
+	// the default path follows CICDEZ_AGE_KEY_FILE
+	t.Setenv("CICDEZ_AGE_KEY_FILE", keyPath)
+	cmd = NewKeyCommand()
+	buf = new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"export-public"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("key export-public failed: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("expected public key %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+type logsOptions struct {
+	stack      string
+	service    string
+	server     string
+	since      string
+	until      string
+	task       int
+	follow     bool
+	tail       string
+	timestamps bool
+}
+
+func NewLogsCommand() *cobra.Command {
+	opts := logsOptions{}
+	cmd := &cobra.Command{
+		Use:   "logs STACK SERVICE",
+		Short: "Show the logs of a stack service",
+		Long: `Stream the logs of every task of a stack service, or of one task slot
+with --task.
+
+--since and --until take an RFC3339 timestamp (2026-01-02T15:04:05Z) or a
+duration relative to now (10m, 1h30m). Swarm doesn't filter service logs by
+--until, so cicdez asks for timestamps and drops the lines stamped later.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.stack = args[0]
+			opts.service = args[1]
+			return runLogs(cmd.Context(), cmd.OutOrStdout(), cmd.ErrOrStderr(), opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", "", "query this configured server instead of any manager")
+	completeServerFlag(cmd)
+	cmd.Flags().StringVar(&opts.since, "since", "", "show logs since a timestamp or relative duration")
+	cmd.Flags().StringVar(&opts.until, "until", "", "show logs before a timestamp or relative duration")
+	cmd.Flags().IntVar(&opts.task, "task", 0, "only show logs of the task in this slot")
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "f", false, "follow log output")
+	cmd.Flags().StringVarP(&opts.tail, "tail", "n", "all", "number of lines to show from the end of the logs")
+	cmd.Flags().BoolVarP(&opts.timestamps, "timestamps", "t", false, "show timestamps")
+	return cmd
+}
+
+func runLogs(ctx context.Context, out, errOut io.Writer, opts logsOptions) error {
+	if opts.task < 0 {
+		return fmt.Errorf("invalid --task %d: expected a slot number", opts.task)
+	}
+
+	// resolve relative durations once, before connecting
+	now := time.Now()
+	since, err := docker.ParseLogTime(opts.since, now)
+	if err != nil {
+		return err
+	}
+	until, err := docker.ParseLogTime(opts.until, now)
+	if err != nil {
+		return err
+	}
+
+	manager, err := managerClient(ctx, opts.server)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	return docker.StreamLogs(ctx, manager, opts.stack, opts.service, docker.LogsOptions{
+		Since:      since,
+		Until:      until,
+		Task:       opts.task,
+		Follow:     opts.follow,
+		Tail:       opts.tail,
+		Timestamps: opts.timestamps,
+	}, out, errOut)
+}
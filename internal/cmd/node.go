@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"io"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+type nodeListOptions struct {
+	server string
+}
+
+func NewNodeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "node",
+		Short: "Inspect the nodes of the swarm",
+	}
+
+	listOpts := nodeListOptions{}
+	listCmd := &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List swarm nodes with their role, availability and labels",
+		Long: `List the nodes of the swarm as a manager sees them. The labels are
+the ones placement constraints such as node.labels.zone==east match against.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNodeList(cmd.Context(), cmd.OutOrStdout(), listOpts)
+		},
+	}
+	listCmd.Flags().StringVar(&listOpts.server, "server", "", "query this configured server instead of any manager")
+	completeServerFlag(listCmd)
+
+	cmd.AddCommand(listCmd)
+	return cmd
+}
+
+func runNodeList(ctx context.Context, out io.Writer, opts nodeListOptions) error {
+	manager, err := managerClient(ctx, opts.server)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	nodes, err := docker.ListNodes(ctx, manager)
+	if err != nil {
+		return err
+	}
+	return docker.WriteNodes(out, nodes)
+}
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/spf13/cobra"
+)
+
+func NewRegistryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Manage registry credentials",
+	}
+
+	cmd.AddCommand(newRegistryAddCommand())
+	cmd.AddCommand(newRegistryImportCommand())
+	cmd.AddCommand(newRegistryTestCommand())
+
+	return cmd
+}
+
+type registryTestOptions struct {
+	server    string
+	newClient DockerClientFactory
+}
+
+func newRegistryTestCommand() *cobra.Command {
+	opts := registryTestOptions{newClient: defaultDockerClient}
+	return &cobra.Command{
+		Use:   "test REGISTRY",
+		Short: "Verify the stored credentials of a registry",
+		Long: `Log the local daemon in to REGISTRY with the credentials builds and
+deploys use: the ones imported into the vault, or else what docker login
+stored. When the registry hands back a new identity token for a docker login
+entry it is saved in place of the password.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeRegistries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.server = args[0]
+			return runRegistryTest(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+}
+
+func runRegistryTest(ctx context.Context, out io.Writer, opts registryTestOptions) error {
+	dockerClient, err := opts.newClient()
+	if err != nil {
+		return fmt.Errorf("failed to create local docker client: %w", err)
+	}
+	defer dockerClient.Close()
+
+	authCfg, err := registryAuth(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, refreshed, err := docker.CheckRegistryLogin(ctx, dockerClient, authCfg, opts.server)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s: %s\n", opts.server, status)
+	if refreshed {
+		fmt.Fprintf(out, "Saved a refreshed identity token for %s\n", opts.server)
+	}
+	return nil
+}
+
+// registryAuth returns the docker login credentials with the registries of
+// an initialized vault on top. The vault is only decrypted when it stores
+// registries, so commands keep working without a key otherwise.
+func registryAuth(ctx context.Context) (*configfile.ConfigFile, error) {
+	authCfg := docker.LoadDockerAuth()
+	root, err := vaultRoot()
+	if err != nil {
+		return nil, err
+	}
+	has, err := vault.HasRegistries(root)
+	if err != nil || !has {
+		return authCfg, err
+	}
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return docker.WithRegistries(ctx, authCfg, cfg.Registries)
+}
+
+type registryAddOptions struct {
+	server        string
+	registry      vault.Registry
+	passwordStdin bool
+}
+
+func newRegistryAddCommand() *cobra.Command {
+	var opts registryAddOptions
+	cmd := &cobra.Command{
+		Use:   "add REGISTRY",
+		Short: "Store the credentials of a registry in the vault",
+		Long: `Store the credentials of REGISTRY in the vault, either a user with
+--username and a password read from stdin with --password-stdin, or with
+--type ecr an AWS ECR registry. ECR tokens expire after 12 hours, so none is
+stored: every build and deploy asks for a fresh one with the AWS CLI, using
+--region (taken from the host name by default) and --profile.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.server = args[0]
+			return runRegistryAdd(cmd.InOrStdin(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.registry.Type, "type", "", "Registry type, ecr fetches AWS ECR tokens on demand")
+	cmd.Flags().StringVarP(&opts.registry.Username, "username", "u", "", "Registry user")
+	cmd.Flags().BoolVar(&opts.passwordStdin, "password-stdin", false, "Read the password from stdin")
+	cmd.Flags().StringVar(&opts.registry.Region, "region", "", "AWS region of an ecr registry")
+	cmd.Flags().StringVar(&opts.registry.Profile, "profile", "", "AWS profile of an ecr registry")
+	return cmd
+}
+
+func runRegistryAdd(in io.Reader, out io.Writer, opts registryAddOptions) error {
+	switch opts.registry.Type {
+	case "":
+		if opts.registry.Username == "" || !opts.passwordStdin {
+			return fmt.Errorf("registry %s needs --username and --password-stdin", opts.server)
+		}
+		if opts.registry.Region != "" || opts.registry.Profile != "" {
+			return fmt.Errorf("--region and --profile only apply to --type %s", vault.RegistryECR)
+		}
+		password, err := io.ReadAll(in)
+		if err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		opts.registry.Password = strings.TrimRight(string(password), "\r\n")
+		if opts.registry.Password == "" {
+			return errors.New("password is empty")
+		}
+	case vault.RegistryECR:
+		if opts.registry.Username != "" || opts.passwordStdin {
+			return fmt.Errorf("--type %s takes no credentials, they come from AWS", vault.RegistryECR)
+		}
+	default:
+		return fmt.Errorf("registry type %s is not supported", opts.registry.Type)
+	}
+
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Registries == nil {
+		cfg.Registries = make(map[string]vault.Registry, 1)
+	}
+	cfg.Registries[opts.server] = opts.registry
+	if err := vault.SaveConfig(root, cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Registry '%s' added\n", opts.server)
+	return nil
+}
+
+type registryImportOptions struct {
+	dockerConfig string
+}
+
+func newRegistryImportCommand() *cobra.Command {
+	opts := registryImportOptions{
+		dockerConfig: filepath.Join(config.Dir(), config.ConfigFileName),
+	}
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Store docker login credentials in the vault",
+		Long: `Copy the registry credentials docker login stored in the docker config
+into the vault, so everyone holding a key builds and deploys with them.
+Vault credentials take precedence over docker login ones.
+
+Only credentials kept in the config file itself can be imported. Registries
+backed by credsStore or credHelpers are reported and skipped, their secrets
+live in the helper.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRegistryImport(cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.dockerConfig, "docker-config", opts.dockerConfig, "Docker config file to import from")
+	return cmd
+}
+
+func runRegistryImport(out io.Writer, opts registryImportOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+
+	f, err := os.Open(opts.dockerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open docker config: %w", err)
+	}
+	defer f.Close()
+
+	registries, skipped, err := parseDockerConfig(f)
+	if err != nil {
+		return err
+	}
+	for _, msg := range skipped {
+		fmt.Fprintf(out, "%s %s\n", docker.WarningPrefix(), msg)
+	}
+	if len(registries) == 0 {
+		return fmt.Errorf("no credentials to import in %s", opts.dockerConfig)
+	}
+
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Registries == nil {
+		cfg.Registries = make(map[string]vault.Registry, len(registries))
+	}
+	maps.Copy(cfg.Registries, registries)
+	if err := vault.SaveConfig(root, cfg); err != nil {
+		return err
+	}
+
+	for _, server := range slices.Sorted(maps.Keys(registries)) {
+		fmt.Fprintf(out, "Imported %s\n", server)
+	}
+	return nil
+}
+
+// parseDockerConfig returns the registries of a docker config whose
+// credentials sit in the file, keyed the way images name them, and a note
+// for every registry that had to be skipped
+func parseDockerConfig(r io.Reader) (map[string]vault.Registry, []string, error) {
+	cf := configfile.New("")
+	if err := cf.LoadFromReader(r); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse docker config: %w", err)
+	}
+
+	registries := make(map[string]vault.Registry)
+	var skipped []string
+	for _, server := range slices.Sorted(maps.Keys(cf.AuthConfigs)) {
+		auth := cf.AuthConfigs[server]
+		name := server
+		if name == "https://index.docker.io/v1/" {
+			name = "docker.io"
+		}
+		switch {
+		case cf.CredentialHelpers[server] != "":
+			skipped = append(skipped, fmt.Sprintf("%s uses the credential helper %s, skipped", name, cf.CredentialHelpers[server]))
+		case auth.Username != "" && auth.Password != "":
+			registries[name] = vault.Registry{Username: auth.Username, Password: auth.Password}
+		case auth.IdentityToken != "":
+			skipped = append(skipped, fmt.Sprintf("%s only has an identity token, skipped", name))
+		case cf.CredentialsStore != "":
+			skipped = append(skipped, fmt.Sprintf("%s is kept in the credential store %s, skipped", name, cf.CredentialsStore))
+		}
+	}
+	for _, server := range slices.Sorted(maps.Keys(cf.CredentialHelpers)) {
+		if _, ok := cf.AuthConfigs[server]; !ok && cf.CredentialHelpers[server] != "" {
+			skipped = append(skipped, fmt.Sprintf("%s uses the credential helper %s, skipped", server, cf.CredentialHelpers[server]))
+		}
+	}
+	return registries, skipped, nil
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+)
+
+const testDockerConfig = `{
+	"auths": {
+		"ghcr.io": {"auth": "Ym90OnMzY3JldA=="},
+		"https://index.docker.io/v1/": {"auth": "aHViOmh1Yi1zZWNyZXQ="},
+		"registry.example.com": {},
+		"azurecr.example.io": {"identitytoken": "token"},
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com": {}
+	},
+	"credsStore": "desktop",
+	"credHelpers": {
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login",
+		"europe-docker.pkg.dev": "gcloud"
+	}
+}`
+
+func TestParseDockerConfig(t *testing.T) {
+	registries, skipped, err := parseDockerConfig(strings.NewReader(testDockerConfig))
+	if err != nil {
+		t.Fatalf("parseDockerConfig failed: %v", err)
+	}
+
+	want := map[string]vault.Registry{
+		"ghcr.io":   {Username: "bot", Password: "s3cret"},
+		"docker.io": {Username: "hub", Password: "hub-secret"},
+	}
+	if !reflect.DeepEqual(registries, want) {
+		t.Errorf("expected %v, got %v", want, registries)
+	}
+
+	wantSkipped := []string{
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com uses the credential helper ecr-login, skipped",
+		"azurecr.example.io only has an identity token, skipped",
+		"registry.example.com is kept in the credential store desktop, skipped",
+		"europe-docker.pkg.dev uses the credential helper gcloud, skipped",
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("expected skipped %q, got %q", wantSkipped, skipped)
+	}
+}
+
+func TestRegistryImport(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveConfig(dir, vault.Config{Servers: map[string]vault.Server{
+		"203.0.113.1": {User: "deploy"},
+	}}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	dockerConfig := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(dockerConfig, []byte(testDockerConfig), 0o600); err != nil {
+		t.Fatalf("failed to write docker config: %v", err)
+	}
+
+	cmd := NewRegistryCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"import", "--docker-config", dockerConfig})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("registry import failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Imported docker.io\nImported ghcr.io\n") {
+		t.Errorf("expected the imported registries, got %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "europe-docker.pkg.dev uses the credential helper gcloud") {
+		t.Errorf("expected a warning for the helper backed registry, got %q", buf.String())
+	}
+
+	config, err := vault.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := config.Registries["ghcr.io"]; got != (vault.Registry{Username: "bot", Password: "s3cret"}) {
+		t.Errorf("unexpected ghcr.io credentials %+v", got)
+	}
+	if len(config.Servers) != 1 {
+		t.Errorf("expected the servers to be kept, got %v", config.Servers)
+	}
+}
+
+func TestRegistryAdd(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveConfig(dir, vault.Config{}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	const ecrHost = "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+
+	for _, args := range [][]string{
+		{"add", ecrHost, "--type", "ecr", "--profile", "deploy"},
+		{"add", "ghcr.io", "--username", "bot", "--password-stdin"},
+	} {
+		cmd := NewRegistryCommand()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetIn(strings.NewReader("s3cret\n"))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("registry %v failed: %v", args, err)
+		}
+	}
+
+	config, err := vault.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	want := map[string]vault.Registry{
+		ecrHost:   {Type: vault.RegistryECR, Profile: "deploy"},
+		"ghcr.io": {Username: "bot", Password: "s3cret"},
+	}
+	if !reflect.DeepEqual(config.Registries, want) {
+		t.Errorf("expected %v, got %v", want, config.Registries)
+	}
+
+	for _, args := range [][]string{
+		{"add", "ghcr.io", "--username", "bot"},
+		{"add", ecrHost, "--type", "ecr", "--username", "AWS"},
+		{"add", "ghcr.io", "--type", "gcr"},
+	} {
+		cmd := NewRegistryCommand()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("expected registry %v to fail", args)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+type restartOptions struct {
+	stack    string
+	services []string
+	detach   bool
+	quiet    bool
+	progress bool
+}
+
+func NewRestartCommand() *cobra.Command {
+	opts := restartOptions{}
+	cmd := &cobra.Command{
+		Use:   "restart STACK [SERVICE...]",
+		Short: "Restart the tasks of stack services",
+		Long: `Force a rolling restart of every service in the stack, or only the named ones.
+
+The service spec is left unchanged, tasks are replaced following each
+service's update_config (order, parallelism, delay).`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.stack = args[0]
+			opts.services = args[1:]
+			return runRestart(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.detach, "detach", "d", false, "exit immediately instead of waiting for the services to converge")
+	cmd.Flags().BoolVarP(&opts.quiet, "quiet", "q", false, "suppress progress output")
+	cmd.Flags().BoolVar(&opts.progress, "progress", false, "print per-service task counts and nodes while waiting")
+	return cmd
+}
+
+func runRestart(ctx context.Context, out io.Writer, opts restartOptions) error {
+	manager, err := managerClient(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	services, err := docker.Restart(ctx, manager, opts.stack, opts.services)
+	if err != nil {
+		return err
+	}
+
+	if !opts.quiet {
+		for _, name := range services {
+			fmt.Fprintf(out, "Restarting service %s\n", name)
+		}
+	}
+
+	if opts.detach {
+		return nil
+	}
+	_, err = docker.WaitOnServices(ctx, manager, services, opts.quiet, opts.progress, out)
+	return err
+}
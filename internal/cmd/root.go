@@ -1,20 +1,101 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/log"
+	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/spf13/cobra"
 )
 
+// logLevel is set from --log-level and --verbose before any command runs
+var logLevel = log.LevelInfo
+
 func NewRootCommand() *cobra.Command {
+	var (
+		noColor    bool
+		level      string
+		verbose    bool
+		stackLabel string
+	)
 	cmd := &cobra.Command{
 		Use:   "cicdez",
 		Short: "Manage deployments, configuration, and secrets",
 		Long: `Build images, manage encrypted secrets, and deploy to Docker Swarm.
 Secrets and credentials are encrypted with age and stored locally.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			docker.SetColor(useColor(noColor, cmd.OutOrStdout()))
+			if stackLabel == "" {
+				return errors.New("--label-namespace must not be empty")
+			}
+			docker.SetStackLabel(stackLabel)
+			if verbose {
+				level = "debug"
+			}
+			var err error
+			logLevel, err = log.ParseLevel(level)
+			return err
+		},
 	}
+	cmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "disable colored output")
+	cmd.PersistentFlags().StringVar(&level, "log-level", "info", "log level: debug, info, warn, error")
+	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "log the Docker API calls made, same as --log-level debug")
+	cmd.PersistentFlags().StringVar(&stackLabel, "label-namespace", docker.LabelNamespace, "label tying objects to their stack, change it to keep cicdez and docker stack apart")
+	cmd.AddCommand(NewInitCommand())
 	cmd.AddCommand(NewKeyCommand())
 	cmd.AddCommand(NewSecretCommand())
 	cmd.AddCommand(NewServerCommand())
+	cmd.AddCommand(NewNodeCommand())
+	cmd.AddCommand(NewRegistryCommand())
 	cmd.AddCommand(NewBuildCommand())
 	cmd.AddCommand(NewDeployCommand())
+	cmd.AddCommand(NewValidateCommand())
+	cmd.AddCommand(NewDiffCommand())
+	cmd.AddCommand(NewStatusCommand())
+	cmd.AddCommand(NewWaitCommand())
+	cmd.AddCommand(NewHistoryCommand())
+	cmd.AddCommand(NewScaleCommand())
+	cmd.AddCommand(NewRestartCommand())
+	cmd.AddCommand(NewServiceCommand())
+	cmd.AddCommand(NewLogsCommand())
+	cmd.AddCommand(NewVersionCommand())
 	return cmd
 }
+
+// useColor reports whether status output should be colored: only on a
+// terminal, and never with --no-color or NO_COLOR set (https://no-color.org)
+func useColor(noColor bool, out io.Writer) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(out)
+}
+
+// newLogger logs to out at the level from the root flags, --quiet keeps
+// only warnings and errors
+func newLogger(out io.Writer, quiet bool) *log.Logger {
+	level := logLevel
+	if quiet {
+		level = max(level, log.LevelWarn)
+	}
+	return log.New(out, level)
+}
+
+// vaultRoot returns the closest directory at or above the current one that
+// holds .cicdez. Without one it falls back to the current directory, so the
+// vault gets created there and uninitialized errors keep naming it.
+func vaultRoot() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	root, err := vault.FindRoot(cwd)
+	if errors.Is(err, vault.ErrNotInitialized) {
+		return cwd, nil
+	}
+	return root, err
+}
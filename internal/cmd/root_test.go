@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUseColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+
+	if useColor(false, new(bytes.Buffer)) {
+		t.Error("expected no color when output is not a terminal")
+	}
+	if useColor(true, new(bytes.Buffer)) {
+		t.Error("expected no color with --no-color")
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if useColor(false, new(bytes.Buffer)) {
+		t.Error("expected no color with NO_COLOR set")
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+type scaleOptions struct {
+	stack    string
+	replicas map[string]uint64
+	detach   bool
+	quiet    bool
+	progress bool
+}
+
+func NewScaleCommand() *cobra.Command {
+	opts := scaleOptions{}
+	cmd := &cobra.Command{
+		Use:   "scale STACK SERVICE=REPLICAS...",
+		Short: "Change replica counts of stack services",
+		Long: `Set the replica count of one or more services without redeploying the stack.
+
+Only replicated services can be scaled, global and job services are rejected.
+The change is not written back to the compose file, the next deploy
+restores the replicas it declares.`,
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.stack = args[0]
+			replicas, err := parseScaleArgs(args[1:])
+			if err != nil {
+				return err
+			}
+			opts.replicas = replicas
+			return runScale(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.detach, "detach", "d", false, "exit immediately instead of waiting for the services to converge")
+	cmd.Flags().BoolVarP(&opts.quiet, "quiet", "q", false, "suppress progress output")
+	cmd.Flags().BoolVar(&opts.progress, "progress", false, "print per-service task counts and nodes while waiting")
+	return cmd
+}
+
+func parseScaleArgs(args []string) (map[string]uint64, error) {
+	replicas := make(map[string]uint64, len(args))
+	for _, arg := range args {
+		service, count, ok := strings.Cut(arg, "=")
+		if !ok || service == "" {
+			return nil, fmt.Errorf("invalid scale argument %q, expected SERVICE=REPLICAS", arg)
+		}
+		n, err := strconv.ParseUint(count, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replica count for %s: %q", service, count)
+		}
+		replicas[service] = n
+	}
+	return replicas, nil
+}
+
+func runScale(ctx context.Context, out io.Writer, opts scaleOptions) error {
+	manager, err := managerClient(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	services, err := docker.Scale(ctx, manager, opts.stack, opts.replicas)
+	if err != nil {
+		return err
+	}
+
+	if !opts.quiet {
+		for _, service := range slices.Sorted(maps.Keys(opts.replicas)) {
+			fmt.Fprintf(out, "Scaling service %s to %d\n", docker.ScopeName(opts.stack, service), opts.replicas[service])
+		}
+	}
+
+	if opts.detach {
+		return nil
+	}
+	_, err = docker.WaitOnServices(ctx, manager, services, opts.quiet, opts.progress, out)
+	return err
+}
@@ -1,13 +1,26 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 
+	"github.com/blindlobstar/cicdez/internal/docker"
 	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/dotenv"
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -17,10 +30,53 @@ type secretAddOptions struct {
 	value string
 }
 
+type secretSetFromCommandOptions struct {
+	name    string
+	command []string
+	raw     bool
+	stdin   io.Reader
+}
+
 type secretRemoveOptions struct {
 	name string
 }
 
+type secretRenameOptions struct {
+	oldName string
+	newName string
+	force   bool
+}
+
+type secretGenerateOptions struct {
+	name      string
+	length    int
+	charset   string
+	show      bool
+	overwrite bool
+}
+
+type secretListOptions struct {
+	output string
+	reveal bool
+	force  bool
+}
+
+type secretDiffOptions struct {
+	other string
+	key   string
+}
+
+type secretUnusedOptions struct {
+	composeFiles []string
+	envFiles     []string
+	yes          bool
+}
+
+type secretImportOptions struct {
+	files  []string
+	prefix string
+}
+
 func NewSecretCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "secret",
@@ -39,27 +95,154 @@ func NewSecretCommand() *cobra.Command {
 		},
 	}
 
+	setFromCommandOpts := secretSetFromCommandOptions{}
+	setFromCommandCmd := &cobra.Command{
+		Use:   "set-from-command NAME -- COMMAND [ARG...]",
+		Short: "Store the output of a command as a secret",
+		Long: `Run COMMAND and store what it prints to stdout under NAME, such as
+'op read op://prod/db/password'. The value never lands in shell history or
+a temp file. Stderr and stdin stay attached to the terminal.
+
+A trailing newline is trimmed unless --raw. Fails without saving when the
+command exits non-zero or prints nothing.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			setFromCommandOpts.name = args[0]
+			setFromCommandOpts.command = args[1:]
+			setFromCommandOpts.stdin = cmd.InOrStdin()
+			return runSecretSetFromCommand(cmd.Context(), cmd.OutOrStdout(), cmd.ErrOrStderr(), setFromCommandOpts)
+		},
+	}
+	setFromCommandCmd.Flags().BoolVar(&setFromCommandOpts.raw, "raw", false, "store the output as is, with its trailing newline")
+
 	removeOpts := secretRemoveOptions{}
 	removeCmd := &cobra.Command{
-		Use:     "remove NAME",
-		Aliases: []string{"rm", "delete"},
-		Short:   "Remove a secret",
-		Args:    cobra.ExactArgs(1),
+		Use:               "remove NAME",
+		Aliases:           []string{"rm", "delete"},
+		Short:             "Remove a secret",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSecrets,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			removeOpts.name = args[0]
 			return runSecretRemove(cmd.OutOrStdout(), removeOpts)
 		},
 	}
 
-	cmd.AddCommand(addCmd)
-	cmd.AddCommand(&cobra.Command{
+	renameOpts := secretRenameOptions{}
+	renameCmd := &cobra.Command{
+		Use:     "rename OLD NEW",
+		Aliases: []string{"mv"},
+		Short:   "Rename a secret",
+		Long: `Move the value of secret OLD to NEW.
+
+Fails when NEW already exists unless --force. Compose files in the current
+directory that still mention OLD are listed, since sensitive sources are
+not rewritten.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeSecrets,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			renameOpts.oldName = args[0]
+			renameOpts.newName = args[1]
+			return runSecretRename(cmd.OutOrStdout(), renameOpts)
+		},
+	}
+	renameCmd.Flags().BoolVarP(&renameOpts.force, "force", "f", false, "overwrite NEW if it exists")
+
+	generateOpts := secretGenerateOptions{}
+	generateCmd := &cobra.Command{
+		Use:   "generate NAME",
+		Short: "Generate and store a random secret",
+		Long: `Store a cryptographically random value under NAME.
+
+The value is drawn from --charset (alphanumeric, hex or base64) and is not
+printed unless --show. Fails when NAME already exists unless --overwrite.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			generateOpts.name = args[0]
+			return runSecretGenerate(cmd.OutOrStdout(), generateOpts)
+		},
+	}
+	generateCmd.Flags().IntVar(&generateOpts.length, "length", 32, "number of characters")
+	generateCmd.Flags().StringVar(&generateOpts.charset, "charset", charsetAlphanumeric, "characters to draw from: alphanumeric, hex, base64")
+	generateCmd.Flags().BoolVar(&generateOpts.show, "show", false, "print the generated value")
+	generateCmd.Flags().BoolVar(&generateOpts.overwrite, "overwrite", false, "replace NAME if it exists")
+
+	importOpts := secretImportOptions{}
+	importCmd := &cobra.Command{
+		Use:   "import FILE...",
+		Short: "Import secrets from dotenv files",
+		Long: `Import KEY=VALUE pairs from one or more dotenv files into the vault.
+
+Later files win when the same key appears more than once.
+Use --prefix to namespace imported keys, e.g. --prefix WEB_ turns
+DB_PASSWORD into WEB_DB_PASSWORD.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			importOpts.files = args
+			return runSecretImport(cmd.OutOrStdout(), importOpts)
+		},
+	}
+	importCmd.Flags().StringVar(&importOpts.prefix, "prefix", "", "prefix prepended to each imported key")
+
+	listOpts := secretListOptions{}
+	listCmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List secret names",
+		Long: `List secret names, sorted.
+
+With --reveal the decrypted values are printed as well. To keep them out of
+logs and pipes this only runs when output is a terminal, unless --force.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSecretList(cmd.OutOrStdout())
+			return runSecretList(cmd.OutOrStdout(), listOpts)
 		},
-	})
+	}
+	listCmd.Flags().StringVarP(&listOpts.output, "output", "o", outputText, "output format: text, json")
+	listCmd.Flags().BoolVar(&listOpts.reveal, "reveal", false, "print secret values")
+	listCmd.Flags().BoolVar(&listOpts.force, "force", false, "allow --reveal when output is not a terminal")
+
+	diffOpts := secretDiffOptions{}
+	diffCmd := &cobra.Command{
+		Use:   "diff OTHER_DIR",
+		Short: "Compare secrets with another vault",
+		Long: `Compare the vault with the one of another checkout, such as staging
+against prod, and list the secrets only in either and the ones whose values
+differ. Values are never printed.
+
+The other vault is decrypted with your own age key unless --key points at
+the key of that environment. Fails when anything differs.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diffOpts.other = args[0]
+			return runSecretDiff(cmd.OutOrStdout(), diffOpts)
+		},
+	}
+	diffCmd.Flags().StringVar(&diffOpts.key, "key", "", "age key file for the other vault")
+
+	unusedOpts := secretUnusedOptions{}
+	unusedCmd := &cobra.Command{
+		Use:   "unused",
+		Short: "List secrets no compose file references",
+		Long: `Load the compose files and list the vault secrets that no sensitive
+block uses as a source. Services of every profile count, active or not.
+
+Nothing is removed unless --yes. Secrets used only by compose files that
+are not passed with -f are reported as unused, so pass every file that
+reads from this vault.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSecretUnused(cmd.Context(), cmd.OutOrStdout(), unusedOpts)
+		},
+	}
+	unusedCmd.Flags().StringArrayVarP(&unusedOpts.composeFiles, "file", "f", []string{}, "compose file path(s)")
+	unusedCmd.Flags().StringArrayVar(&unusedOpts.envFiles, "env-file", []string{}, "env file(s) for interpolation, later files win")
+	unusedCmd.Flags().BoolVarP(&unusedOpts.yes, "yes", "y", false, "remove the unused secrets")
+
+	cmd.AddCommand(addCmd)
+	cmd.AddCommand(generateCmd)
+	cmd.AddCommand(setFromCommandCmd)
+	cmd.AddCommand(importCmd)
+	cmd.AddCommand(listCmd)
 	cmd.AddCommand(&cobra.Command{
 		Use:   "edit",
 		Short: "Edit secrets using $EDITOR",
@@ -73,17 +256,20 @@ The temporary file is deleted after the editor exits.`,
 		},
 	})
 	cmd.AddCommand(removeCmd)
+	cmd.AddCommand(renameCmd)
+	cmd.AddCommand(diffCmd)
+	cmd.AddCommand(unusedCmd)
 
 	return cmd
 }
 
 func runSecretAdd(out io.Writer, opts secretAddOptions) error {
-	cwd, err := os.Getwd()
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	secrets, err := vault.LoadSecrets(cwd)
+	secrets, err := vault.LoadSecrets(root)
 	if err != nil {
 		return fmt.Errorf("failed to load secrets: %w", err)
 	}
@@ -94,7 +280,7 @@ func runSecretAdd(out io.Writer, opts secretAddOptions) error {
 
 	secrets[opts.name] = opts.value
 
-	if err := vault.SaveSecrets(cwd, secrets); err != nil {
+	if err := vault.SaveSecrets(root, secrets); err != nil {
 		return fmt.Errorf("failed to save secrets: %w", err)
 	}
 
@@ -102,20 +288,184 @@ func runSecretAdd(out io.Writer, opts secretAddOptions) error {
 	return nil
 }
 
-func runSecretList(out io.Writer) error {
-	cwd, err := os.Getwd()
+func runSecretSetFromCommand(ctx context.Context, out, errOut io.Writer, opts secretSetFromCommandOptions) error {
+	var stdout bytes.Buffer
+	c := exec.CommandContext(ctx, opts.command[0], opts.command[1:]...)
+	c.Stdin = opts.stdin
+	c.Stdout = &stdout
+	c.Stderr = errOut
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", opts.command[0], err)
+	}
+
+	value := stdout.String()
+	if !opts.raw {
+		value = strings.TrimSuffix(value, "\n")
+		value = strings.TrimSuffix(value, "\r")
+	}
+	if value == "" {
+		return fmt.Errorf("%s printed nothing, secret '%s' not saved", opts.command[0], opts.name)
+	}
+
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	secrets, err := vault.LoadSecrets(cwd)
+	secrets, err := vault.LoadSecrets(root)
 	if err != nil {
 		return fmt.Errorf("failed to load secrets: %w", err)
 	}
+	if secrets == nil {
+		secrets = make(vault.Secrets)
+	}
+	secrets[opts.name] = value
 
-	if len(secrets) == 0 {
-		fmt.Fprintln(out, "No secrets found")
-		return nil
+	if err := vault.SaveSecrets(root, secrets); err != nil {
+		return fmt.Errorf("failed to save secrets: %w", err)
+	}
+
+	fmt.Fprintf(out, "Secret '%s' set from %s\n", opts.name, opts.command[0])
+	return nil
+}
+
+func runSecretGenerate(out io.Writer, opts secretGenerateOptions) error {
+	value, err := randomString(opts.length, opts.charset)
+	if err != nil {
+		return err
+	}
+
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+	if secrets == nil {
+		secrets = make(vault.Secrets)
+	}
+
+	if _, exists := secrets[opts.name]; exists && !opts.overwrite {
+		return fmt.Errorf("secret '%s' already exists (use --overwrite to replace it)", opts.name)
+	}
+	secrets[opts.name] = value
+
+	if err := vault.SaveSecrets(root, secrets); err != nil {
+		return fmt.Errorf("failed to save secrets: %w", err)
+	}
+
+	fmt.Fprintf(out, "Secret '%s' generated\n", opts.name)
+	if opts.show {
+		fmt.Fprintln(out, value)
+	}
+	return nil
+}
+
+const (
+	charsetAlphanumeric = "alphanumeric"
+	charsetHex          = "hex"
+	charsetBase64       = "base64"
+)
+
+var charsets = map[string]string{
+	charsetAlphanumeric: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	charsetHex:          "0123456789abcdef",
+	charsetBase64:       "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/",
+}
+
+// randomString draws length characters uniformly from the named charset
+// using crypto/rand
+func randomString(length int, charset string) (string, error) {
+	alphabet, ok := charsets[charset]
+	if !ok {
+		return "", fmt.Errorf("unknown charset %q, expected alphanumeric, hex or base64", charset)
+	}
+	if length <= 0 {
+		return "", fmt.Errorf("invalid length %d: must be positive", length)
+	}
+
+	size := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random value: %w", err)
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func runSecretImport(out io.Writer, opts secretImportOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	imported := make(map[string]string)
+	for _, file := range opts.files {
+		values, err := dotenv.Read(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for k, v := range values {
+			imported[opts.prefix+k] = v
+		}
+	}
+
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	if secrets == nil {
+		secrets = make(vault.Secrets)
+	}
+
+	for name, value := range imported {
+		secrets[name] = value
+	}
+
+	if err := vault.SaveSecrets(root, secrets); err != nil {
+		return fmt.Errorf("failed to save secrets: %w", err)
+	}
+
+	fmt.Fprintf(out, "Imported %d secret(s)\n", len(imported))
+	return nil
+}
+
+// secretEntry is the JSON shape of a listed secret, the value is only
+// included with --reveal, empty values too
+type secretEntry struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value,omitempty"`
+}
+
+func runSecretList(out io.Writer, opts secretListOptions) error {
+	if err := checkOutputFormat(opts.output); err != nil {
+		return err
+	}
+	if opts.force && !opts.reveal {
+		return errors.New("--force only applies to --reveal")
+	}
+	if opts.reveal && !opts.force && !isTerminal(out) {
+		return errors.New("refusing to reveal secrets: output is not a terminal (use --force)")
+	}
+
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
 	}
 
 	names := make([]string, 0, len(secrets))
@@ -124,20 +474,95 @@ func runSecretList(out io.Writer) error {
 	}
 	sort.Strings(names)
 
+	if opts.output == outputJSON {
+		entries := make([]secretEntry, 0, len(names))
+		for _, name := range names {
+			entry := secretEntry{Name: name}
+			if opts.reveal {
+				value := secrets[name]
+				entry.Value = &value
+			}
+			entries = append(entries, entry)
+		}
+		return writeJSON(out, entries)
+	}
+
+	if len(secrets) == 0 {
+		fmt.Fprintln(out, "No secrets found")
+		return nil
+	}
+
 	for _, name := range names {
+		if opts.reveal {
+			fmt.Fprintf(out, "%s: %s\n", name, secrets[name])
+			continue
+		}
 		fmt.Fprintln(out, name)
 	}
 
 	return nil
 }
 
+func runSecretDiff(out io.Writer, opts secretDiffOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	otherRoot, err := vault.FindRoot(opts.other)
+	if err != nil {
+		return err
+	}
+	var other vault.Secrets
+	if opts.key != "" {
+		other, err = vault.LoadSecretsWithKey(otherRoot, opts.key)
+	} else {
+		other, err = vault.LoadSecrets(otherRoot)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load secrets of %s: %w", otherRoot, err)
+	}
+
+	diff := vault.DiffSecrets(secrets, other)
+	if diff.Empty() {
+		fmt.Fprintln(out, "No differences")
+		return nil
+	}
+
+	for _, section := range []struct {
+		title string
+		names []string
+	}{
+		{"Only in " + root, diff.OnlyA},
+		{"Only in " + otherRoot, diff.OnlyB},
+		{"Different values", diff.Changed},
+	} {
+		if len(section.names) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "%s:\n", section.title)
+		for _, name := range section.names {
+			fmt.Fprintf(out, "\t%s\n", name)
+		}
+	}
+	return fmt.Errorf("secrets of %s and %s differ", root, otherRoot)
+}
+
 func runSecretEdit(out io.Writer) error {
-	cwd, err := os.Getwd()
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	secrets, err := vault.LoadSecrets(cwd)
+	secrets, err := vault.LoadSecrets(root)
 	if err != nil {
 		return fmt.Errorf("failed to load secrets: %w", err)
 	}
@@ -188,7 +613,7 @@ func runSecretEdit(out io.Writer) error {
 		return fmt.Errorf("failed to parse edited secrets: %w", err)
 	}
 
-	if err := vault.SaveSecrets(cwd, editedSecrets); err != nil {
+	if err := vault.SaveSecrets(root, editedSecrets); err != nil {
 		return fmt.Errorf("failed to save secrets: %w", err)
 	}
 
@@ -197,12 +622,12 @@ func runSecretEdit(out io.Writer) error {
 }
 
 func runSecretRemove(out io.Writer, opts secretRemoveOptions) error {
-	cwd, err := os.Getwd()
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	secrets, err := vault.LoadSecrets(cwd)
+	secrets, err := vault.LoadSecrets(root)
 	if err != nil {
 		return fmt.Errorf("failed to load secrets: %w", err)
 	}
@@ -213,10 +638,132 @@ func runSecretRemove(out io.Writer, opts secretRemoveOptions) error {
 
 	delete(secrets, opts.name)
 
-	if err := vault.SaveSecrets(cwd, secrets); err != nil {
+	if err := vault.SaveSecrets(root, secrets); err != nil {
 		return fmt.Errorf("failed to save secrets: %w", err)
 	}
 
 	fmt.Fprintf(out, "Secret '%s' removed\n", opts.name)
 	return nil
 }
+
+func runSecretRename(out io.Writer, opts secretRenameOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	value, exists := secrets[opts.oldName]
+	if !exists {
+		return fmt.Errorf("secret '%s' not found", opts.oldName)
+	}
+	if _, exists := secrets[opts.newName]; exists && !opts.force {
+		return fmt.Errorf("secret '%s' already exists (use --force to overwrite)", opts.newName)
+	}
+
+	delete(secrets, opts.oldName)
+	secrets[opts.newName] = value
+
+	if err := vault.SaveSecrets(root, secrets); err != nil {
+		return fmt.Errorf("failed to save secrets: %w", err)
+	}
+
+	fmt.Fprintf(out, "Secret '%s' renamed to '%s'\n", opts.oldName, opts.newName)
+	// compose files are looked up from where the command runs, not the vault root
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	for _, file := range composeFilesMentioning(cwd, opts.oldName) {
+		fmt.Fprintf(out, "%s %s still mentions '%s'\n", docker.WarningPrefix(), file, opts.oldName)
+	}
+	return nil
+}
+
+func runSecretUnused(ctx context.Context, out io.Writer, opts secretUnusedOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	secrets, err := vault.LoadSecrets(root)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	env, err := docker.LoadEnvFiles(opts.envFiles...)
+	if err != nil {
+		return err
+	}
+	project, err := docker.LoadCompose(ctx, env, opts.composeFiles...)
+	if err != nil {
+		return fmt.Errorf("failed to load compose file: %w", err)
+	}
+
+	used := referencedSecrets(project)
+	var unused []string
+	for name := range secrets {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+
+	if len(unused) == 0 {
+		fmt.Fprintln(out, "No unused secrets")
+		return nil
+	}
+	for _, name := range unused {
+		fmt.Fprintln(out, name)
+	}
+	if !opts.yes {
+		return nil
+	}
+
+	for _, name := range unused {
+		delete(secrets, name)
+	}
+	if err := vault.SaveSecrets(root, secrets); err != nil {
+		return fmt.Errorf("failed to save secrets: %w", err)
+	}
+	fmt.Fprintf(out, "Removed %d unused secret(s)\n", len(unused))
+	return nil
+}
+
+// referencedSecrets returns the vault keys used as sensitive sources,
+// including by services whose profile isn't active
+func referencedSecrets(project types.Project) map[string]bool {
+	used := map[string]bool{}
+	for _, services := range []types.Services{project.Services, project.DisabledServices} {
+		for _, svc := range services {
+			for _, sensitive := range svc.Sensitive {
+				for _, secret := range sensitive.Secrets {
+					used[secret.Source] = true
+				}
+			}
+		}
+	}
+	return used
+}
+
+// composeFilesMentioning lists the compose files compose would pick up in
+// dir whose text contains name as a whole word
+func composeFilesMentioning(dir, name string) []string {
+	word := regexp.MustCompile(`(^|[^A-Za-z0-9_.-])` + regexp.QuoteMeta(name) + `($|[^A-Za-z0-9_.-])`)
+
+	var files []string
+	for _, candidate := range append(slices.Clone(cli.DefaultFileNames), cli.DefaultOverrideFileNames...) {
+		data, err := os.ReadFile(filepath.Join(dir, candidate))
+		if err != nil {
+			continue
+		}
+		if word.Match(data) {
+			files = append(files, candidate)
+		}
+	}
+	return files
+}
@@ -2,6 +2,10 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -131,7 +135,10 @@ func TestSecretList(t *testing.T) {
 }
 
 func TestSecretListEmpty(t *testing.T) {
-	setupTestEnv(t)
+	dir := setupTestEnv(t)
+	if err := os.Mkdir(filepath.Join(dir, vault.Dir), 0o755); err != nil {
+		t.Fatalf("failed to create vault dir: %v", err)
+	}
 
 	cmd := NewSecretCommand()
 	buf := new(bytes.Buffer)
@@ -149,6 +156,20 @@ func TestSecretListEmpty(t *testing.T) {
 	}
 }
 
+func TestSecretListNotInitialized(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"list"})
+
+	if err := cmd.Execute(); !errors.Is(err, vault.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized without a .cicdez directory, got %v", err)
+	}
+}
+
 func TestSecretRemove(t *testing.T) {
 	setupTestEnv(t)
 
@@ -199,3 +220,526 @@ func TestSecretRemoveNonExistent(t *testing.T) {
 		t.Error("expected error when removing non-existent secret, got nil")
 	}
 }
+
+func TestSecretImportPrefix(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	envFile := filepath.Join(dir, "web.env")
+	if err := os.WriteFile(envFile, []byte("DB_PASSWORD=db_secret\nAPI_KEY=\"api secret\"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"import", envFile, "--prefix", "WEB_"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret import failed: %v", err)
+	}
+
+	secrets, err := vault.LoadSecrets(".")
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+
+	if secrets["WEB_DB_PASSWORD"] != "db_secret" {
+		t.Errorf("expected WEB_DB_PASSWORD to be 'db_secret', got '%s'", secrets["WEB_DB_PASSWORD"])
+	}
+	if secrets["WEB_API_KEY"] != "api secret" {
+		t.Errorf("expected WEB_API_KEY to be 'api secret', got '%s'", secrets["WEB_API_KEY"])
+	}
+	if _, exists := secrets["DB_PASSWORD"]; exists {
+		t.Error("expected unprefixed key to be absent")
+	}
+
+	if !strings.Contains(buf.String(), "Imported 2 secret(s)") {
+		t.Errorf("expected output to report imported count, got: %s", buf.String())
+	}
+}
+
+func TestSecretListJSON(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"DB_PASSWORD": "db_secret", "API_KEY": "api_secret"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"list", "-o", "json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret list failed: %v", err)
+	}
+
+	var entries []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", buf.String(), err)
+	}
+	if len(entries) != 2 || entries[0]["name"] != "API_KEY" || entries[1]["name"] != "DB_PASSWORD" {
+		t.Errorf("expected sorted name entries, got %v", entries)
+	}
+	for _, value := range []string{"db_secret", "api_secret"} {
+		if strings.Contains(buf.String(), value) {
+			t.Errorf("expected secret values to be omitted, got: %s", buf.String())
+		}
+	}
+}
+
+func TestSecretListReveal(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"DB_PASSWORD": "db_secret", "API_KEY": "api_secret"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"list", "--reveal"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "not a terminal") {
+		t.Fatalf("expected reveal to be refused without a terminal, got %v", err)
+	}
+	if strings.Contains(buf.String(), "db_secret") {
+		t.Errorf("expected no values in output, got: %s", buf.String())
+	}
+
+	cmd = NewSecretCommand()
+	buf = new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"list", "--reveal", "--force"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret list --reveal --force failed: %v", err)
+	}
+	if got, want := buf.String(), "API_KEY: api_secret\nDB_PASSWORD: db_secret\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSecretListRevealJSON(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"EMPTY": "", "TOKEN": "abc"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"list", "-o", "json", "--reveal", "--force"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret list failed: %v", err)
+	}
+	want := `[{"name":"EMPTY","value":""},{"name":"TOKEN","value":"abc"}]`
+	if got := strings.Join(strings.Fields(buf.String()), ""); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestSecretListForceWithoutReveal(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"list", "--force"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--reveal") {
+		t.Errorf("expected --force without --reveal to be rejected, got %v", err)
+	}
+}
+
+func TestSecretRename(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"DB_PASS": "db_secret"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	compose := "services:\n  web:\n    sensitive:\n      db:\n        secrets:\n          - source: DB_PASS\n"
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"rename", "DB_PASS", "DB_PASSWORD"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret rename failed: %v", err)
+	}
+
+	secrets, err := vault.LoadSecrets(".")
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if _, exists := secrets["DB_PASS"]; exists {
+		t.Error("expected DB_PASS to be gone")
+	}
+	if secrets["DB_PASSWORD"] != "db_secret" {
+		t.Errorf("expected DB_PASSWORD to be 'db_secret', got '%s'", secrets["DB_PASSWORD"])
+	}
+	if !strings.Contains(buf.String(), "compose.yaml still mentions 'DB_PASS'") {
+		t.Errorf("expected a warning about compose.yaml, got: %s", buf.String())
+	}
+}
+
+func TestSecretRenameMissing(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"rename", "MISSING", "OTHER"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestSecretRenameConflict(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"OLD": "old_value", "NEW": "new_value"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"rename", "OLD", "NEW"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	cmd = NewSecretCommand()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"rename", "OLD", "NEW", "--force"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret rename --force failed: %v", err)
+	}
+
+	secrets, err := vault.LoadSecrets(".")
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if len(secrets) != 1 || secrets["NEW"] != "old_value" {
+		t.Errorf("expected only NEW=old_value, got %v", secrets)
+	}
+}
+
+func TestSecretGenerate(t *testing.T) {
+	setupTestEnv(t)
+
+	for _, tt := range []struct {
+		charset string
+		valid   string
+	}{
+		{"alphanumeric", "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"},
+		{"hex", "0123456789abcdef"},
+		{"base64", "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"},
+	} {
+		name := "KEY_" + strings.ToUpper(tt.charset)
+		cmd := NewSecretCommand()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetArgs([]string{"generate", name, "--length", "48", "--charset", tt.charset})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("secret generate failed: %v", err)
+		}
+
+		secrets, err := vault.LoadSecrets(".")
+		if err != nil {
+			t.Fatalf("LoadSecrets failed: %v", err)
+		}
+		value := secrets[name]
+		if len(value) != 48 {
+			t.Errorf("%s: expected 48 characters, got %d", tt.charset, len(value))
+		}
+		if strings.Trim(value, tt.valid) != "" {
+			t.Errorf("%s: value %q has characters outside the charset", tt.charset, value)
+		}
+		if strings.Contains(buf.String(), value) {
+			t.Errorf("%s: value printed without --show", tt.charset)
+		}
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"generate", "BAD", "--charset", "emoji"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "unknown charset") {
+		t.Errorf("expected unknown charset error, got %v", err)
+	}
+}
+
+func TestSecretGenerateOverwrite(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"API_KEY": "old"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"generate", "API_KEY"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected already exists error, got %v", err)
+	}
+
+	cmd = NewSecretCommand()
+	buf = new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"generate", "API_KEY", "--overwrite", "--show"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret generate --overwrite failed: %v", err)
+	}
+
+	secrets, err := vault.LoadSecrets(".")
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if secrets["API_KEY"] == "old" || len(secrets["API_KEY"]) != 32 {
+		t.Errorf("expected a new 32 character value, got %q", secrets["API_KEY"])
+	}
+	if !strings.Contains(buf.String(), secrets["API_KEY"]) {
+		t.Errorf("expected --show to print the value, got: %s", buf.String())
+	}
+}
+
+func TestSecretAddFromSubdirectory(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"EXISTING": "value"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	nested := filepath.Join(dir, "services", "api")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("failed to create nested dir: %v", err)
+	}
+	os.Chdir(nested)
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"add", "DB_PASSWORD", "secret123"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret add failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(nested, vault.Dir)); !os.IsNotExist(err) {
+		t.Errorf("expected no vault in the subdirectory, got %v", err)
+	}
+	secrets, err := vault.LoadSecrets(dir)
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if secrets["EXISTING"] != "value" || secrets["DB_PASSWORD"] != "secret123" {
+		t.Errorf("expected both secrets in the root vault, got %v", secrets)
+	}
+}
+
+func TestSecretDiff(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveSecrets(dir, vault.Secrets{"API_KEY": "staging-key", "DB_PASSWORD": "same", "OLD_TOKEN": "x"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	other := t.TempDir()
+	if err := vault.SaveSecrets(other, vault.Secrets{"API_KEY": "prod-key", "DB_PASSWORD": "same", "NEW_TOKEN": "y"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"diff", other})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "differ") {
+		t.Fatalf("expected a differ error, got %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"Only in " + dir + ":\n\tOLD_TOKEN\n",
+		"Only in " + other + ":\n\tNEW_TOKEN\n",
+		"Different values:\n\tAPI_KEY\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	for _, value := range []string{"staging-key", "prod-key", "DB_PASSWORD"} {
+		if strings.Contains(out, value) {
+			t.Errorf("expected %q not to be printed, got:\n%s", value, out)
+		}
+	}
+}
+
+// TestSecretCommandHelper is the command run by the set-from-command tests,
+// the test binary stands in for a tool like op so the test runs everywhere
+func TestSecretCommandHelper(t *testing.T) {
+	out, ok := os.LookupEnv("CICDEZ_TEST_COMMAND_OUTPUT")
+	if !ok {
+		return
+	}
+	fmt.Print(out)
+	if os.Getenv("CICDEZ_TEST_COMMAND_STDIN") != "" {
+		io.Copy(os.Stdout, os.Stdin)
+	}
+	if os.Getenv("CICDEZ_TEST_COMMAND_FAIL") != "" {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestSecretSetFromCommand(t *testing.T) {
+	setupTestEnv(t)
+
+	helper := []string{os.Args[0], "-test.run=^TestSecretCommandHelper$"}
+	for _, tt := range []struct {
+		name   string
+		output string
+		args   []string
+		want   string
+	}{
+		{"DB_PASSWORD", "s3cret\n", nil, "s3cret"},
+		{"TLS_KEY", "line1\nline2\r\n", nil, "line1\nline2"},
+		{"RAW_VALUE", "s3cret\n", []string{"--raw"}, "s3cret\n"},
+	} {
+		t.Setenv("CICDEZ_TEST_COMMAND_OUTPUT", tt.output)
+
+		cmd := NewSecretCommand()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetArgs(append(append([]string{"set-from-command", tt.name}, tt.args...), append([]string{"--"}, helper...)...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%s: secret set-from-command failed: %v", tt.name, err)
+		}
+
+		secrets, err := vault.LoadSecrets(".")
+		if err != nil {
+			t.Fatalf("LoadSecrets failed: %v", err)
+		}
+		if secrets[tt.name] != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, secrets[tt.name])
+		}
+		if strings.Contains(buf.String(), "s3cret") {
+			t.Errorf("%s: value printed: %s", tt.name, buf.String())
+		}
+	}
+
+	// stdin is the command's, so a test or a pipe can feed the tool
+	t.Setenv("CICDEZ_TEST_COMMAND_OUTPUT", "")
+	t.Setenv("CICDEZ_TEST_COMMAND_STDIN", "1")
+	cmd := NewSecretCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetIn(strings.NewReader("piped\n"))
+	cmd.SetArgs(append([]string{"set-from-command", "PIPED", "--"}, helper...))
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret set-from-command with stdin failed: %v", err)
+	}
+	if secrets, err := vault.LoadSecrets("."); err != nil || secrets["PIPED"] != "piped" {
+		t.Errorf("expected the piped value, got %q, %v", secrets["PIPED"], err)
+	}
+	t.Setenv("CICDEZ_TEST_COMMAND_STDIN", "")
+
+	for name, env := range map[string]map[string]string{
+		"exits non-zero": {"CICDEZ_TEST_COMMAND_OUTPUT": "partial", "CICDEZ_TEST_COMMAND_FAIL": "1"},
+		"prints nothing": {"CICDEZ_TEST_COMMAND_OUTPUT": "\n"},
+	} {
+		for k, v := range env {
+			t.Setenv(k, v)
+		}
+
+		cmd := NewSecretCommand()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		cmd.SetArgs(append([]string{"set-from-command", "FAILED", "--"}, helper...))
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		t.Setenv("CICDEZ_TEST_COMMAND_FAIL", "")
+	}
+
+	secrets, err := vault.LoadSecrets(".")
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if _, ok := secrets["FAILED"]; ok {
+		t.Error("expected no secret to be saved when the command fails")
+	}
+}
+
+func TestSecretUnused(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	if err := vault.SaveSecrets(dir, vault.Secrets{"DB_PASSWORD": "db", "API_KEY": "api", "OLD_TOKEN": "old"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	compose := `services:
+  web:
+    image: web
+    sensitive:
+      env:
+        secrets:
+          - source: DB_PASSWORD
+  worker:
+    image: worker
+    profiles: [jobs]
+    sensitive:
+      env:
+        secrets:
+          - source: API_KEY
+`
+	if err := os.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	cmd := NewSecretCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"unused"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret unused failed: %v", err)
+	}
+	if buf.String() != "OLD_TOKEN\n" {
+		t.Errorf("expected only OLD_TOKEN to be unused, got %q", buf.String())
+	}
+	secrets, err := vault.LoadSecrets(dir)
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if len(secrets) != 3 {
+		t.Errorf("expected nothing removed without --yes, got %v", secrets)
+	}
+
+	cmd = NewSecretCommand()
+	buf.Reset()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"unused", "--yes"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("secret unused --yes failed: %v", err)
+	}
+	secrets, err = vault.LoadSecrets(dir)
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if _, exists := secrets["OLD_TOKEN"]; exists || len(secrets) != 2 {
+		t.Errorf("expected only OLD_TOKEN to be removed, got %v", secrets)
+	}
+}
@@ -34,6 +34,7 @@ func NewServerCommand() *cobra.Command {
 	cmd.AddCommand(newServerAddCommand())
 	cmd.AddCommand(newServerListCommand())
 	cmd.AddCommand(newServerRemoveCommand())
+	cmd.AddCommand(newServerRenameCommand())
 
 	return cmd
 }
@@ -43,12 +44,35 @@ func newServerAddCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "add HOST",
 		Short: "Add or update a server",
-		Args:  cobra.ExactArgs(1),
+		Long: `Add or update a server.
+
+With --from-ssh-config ALIAS the host, user, port and identity file are
+read from ~/.ssh/config, following Include directives; HOST may then be
+omitted and explicit flags win.
+
+With --transport tcp cicdez talks to a daemon listening on tcp://HOST:2376
+with TLS instead of going through SSH. --tls-ca verifies the daemon and
+--tls-cert with --tls-key identify cicdez to it; the files are read on
+every connection, so they must stay in place.`,
+		Args: cobra.RangeArgs(0, 1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			opts.host = args[0]
+			if len(args) > 0 {
+				opts.host = args[0]
+			}
+			if opts.fromSSHConfig != "" {
+				if err := applySSHConfig(&opts, cmd.Flags().Changed); err != nil {
+					return err
+				}
+			}
+			if opts.host == "" {
+				return errors.New("requires a HOST argument or --from-ssh-config")
+			}
 			if _, ok := addSwarmMap[opts.role]; !ok {
 				return fmt.Errorf("role %s is not supported", opts.role)
 			}
+			if err := checkTransport(&opts, cmd.Flags().Changed); err != nil {
+				return err
+			}
 			return runServerAdd(cmd.Context(), cmd.InOrStdin().(*os.File), cmd.OutOrStdout(), opts)
 		},
 	}
@@ -58,6 +82,11 @@ func newServerAddCommand() *cobra.Command {
 	cmd.Flags().BoolVar(&opts.setup, "setup", false, "provision fresh server")
 	cmd.Flags().StringVar(&opts.role, "role", AddSwarmManager, "role in swarm")
 	cmd.Flags().BoolVar(&opts.disablePasswordAuth, "disable-password-auth", false, "disable SSH password auth (requires --setup)")
+	cmd.Flags().StringVar(&opts.fromSSHConfig, "from-ssh-config", "", "read connection details for ALIAS from ~/.ssh/config")
+	cmd.Flags().StringVar(&opts.transport, "transport", vault.TransportSSH, "how to reach the docker daemon: ssh, tcp")
+	cmd.Flags().StringVar(&opts.tlsCA, "tls-ca", "", "CA certificate the daemon is verified with (tcp)")
+	cmd.Flags().StringVar(&opts.tlsCert, "tls-cert", "", "client certificate (tcp)")
+	cmd.Flags().StringVar(&opts.tlsKey, "tls-key", "", "client certificate key (tcp)")
 
 	return cmd
 }
@@ -80,6 +109,72 @@ type serverAddOptions struct {
 	role                string
 	setup               bool
 	disablePasswordAuth bool
+	fromSSHConfig       string
+	transport           string
+	tlsCA               string
+	tlsCert             string
+	tlsKey              string
+}
+
+// checkTransport validates the transport flags and moves the port to the
+// TLS port for tcp servers unless it was set explicitly
+func checkTransport(opts *serverAddOptions, changed func(flag string) bool) error {
+	switch opts.transport {
+	case vault.TransportSSH:
+		if opts.tlsCA != "" || opts.tlsCert != "" || opts.tlsKey != "" {
+			return errors.New("--tls-ca, --tls-cert and --tls-key require --transport tcp")
+		}
+	case vault.TransportTCP:
+		if opts.setup {
+			return errors.New("--setup can't be combined with --transport tcp")
+		}
+		if (opts.tlsCert == "") != (opts.tlsKey == "") {
+			return errors.New("--tls-cert and --tls-key must be set together")
+		}
+		if !changed("port") {
+			opts.port = docker.DefaultTLSPort
+		}
+	default:
+		return fmt.Errorf("transport %s is not supported", opts.transport)
+	}
+	return nil
+}
+
+// applySSHConfig fills connection details from the ssh config entry for
+// opts.fromSSHConfig, leaving the HOST argument and flags set explicitly
+func applySSHConfig(opts *serverAddOptions, changed func(flag string) bool) error {
+	configPath, err := ssh.DefaultConfigPath()
+	if err != nil {
+		return err
+	}
+	hostCfg, err := ssh.LookupHostConfig(configPath, opts.fromSSHConfig)
+	if err != nil {
+		return err
+	}
+
+	if opts.host == "" {
+		opts.host = hostCfg.HostName
+		if opts.host == "" {
+			opts.host = opts.fromSSHConfig
+		}
+	}
+	if hostCfg.User != "" && !changed("user") {
+		opts.user = hostCfg.User
+	}
+	if hostCfg.Port != 0 && !changed("port") {
+		opts.port = hostCfg.Port
+	}
+	if hostCfg.IdentityFile != "" && !changed("key-file") {
+		data, err := os.ReadFile(hostCfg.IdentityFile)
+		if err != nil {
+			return fmt.Errorf("failed to read identity file from ssh config: %w", err)
+		}
+		if _, err := gossh.ParsePrivateKey(data); err != nil {
+			return fmt.Errorf("identity file %s from ssh config is not usable: %w", hostCfg.IdentityFile, err)
+		}
+		opts.keyFile = hostCfg.IdentityFile
+	}
+	return nil
 }
 
 // TODO: leave flag - leave cluster to join
@@ -97,6 +192,15 @@ func runServerAdd(ctx context.Context, in *os.File, out io.Writer, opts serverAd
 		server.Key = data
 	}
 
+	if opts.transport == vault.TransportTCP {
+		files, err := tlsFiles(opts)
+		if err != nil {
+			return err
+		}
+		server.Transport = vault.TransportTCP
+		server.TLS = files
+	}
+
 	if opts.setup {
 		homeDir, _ := os.UserHomeDir()
 		rootKeyPath := filepath.Join(homeDir, ".ssh", opts.host+"-"+server.User)
@@ -178,17 +282,17 @@ func runServerAdd(ctx context.Context, in *os.File, out io.Writer, opts serverAd
 		}
 	}
 
-	cwd, err := os.Getwd()
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	config, err := vault.LoadConfig(cwd)
+	config, err := vault.LoadConfig(root)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	node, err := docker.NewClientSSH(opts.host, server.Port, server.User, server.Key)
+	node, err := docker.NewServerClient(opts.host, server)
 	if err != nil {
 		return err
 	}
@@ -203,7 +307,7 @@ func runServerAdd(ctx context.Context, in *os.File, out io.Writer, opts serverAd
 		var clusterId string
 		for host, server := range config.Servers {
 			err = func() error {
-				node, err := docker.NewClientSSH(host, server.Port, server.User, server.Key)
+				node, err := docker.NewServerClient(host, server)
 				if err != nil {
 					return err
 				}
@@ -286,7 +390,7 @@ func runServerAdd(ctx context.Context, in *os.File, out io.Writer, opts serverAd
 		config.Servers = make(map[string]vault.Server)
 	}
 	config.Servers[opts.host] = server
-	if err := vault.SaveConfig(cwd, config); err != nil {
+	if err := vault.SaveConfig(root, config); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
@@ -335,6 +439,9 @@ func transferRegistrylessImages(ctx context.Context, manager client.APIClient, m
 	if len(tags) == 0 {
 		return nil
 	}
+	if mserver.Transport == vault.TransportTCP || server.Transport == vault.TransportTCP {
+		return errors.New("registryless images can only be transferred between ssh servers")
+	}
 
 	sshClient, err := ssh.DialWithKey(mhost, mserver.Port, mserver.User, mserver.Key)
 	if err != nil {
@@ -352,31 +459,80 @@ func transferRegistrylessImages(ctx context.Context, manager client.APIClient, m
 	return nil
 }
 
+// tlsFiles returns the absolute paths of the TLS flags, the files are read
+// on every connection from wherever cicdez runs
+func tlsFiles(opts serverAddOptions) (*vault.TLSFiles, error) {
+	files := vault.TLSFiles{}
+	for _, f := range []struct {
+		dst  *string
+		path string
+	}{
+		{&files.CA, opts.tlsCA},
+		{&files.Cert, opts.tlsCert},
+		{&files.Key, opts.tlsKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", f.path, err)
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return nil, fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		*f.dst = abs
+	}
+	if files == (vault.TLSFiles{}) {
+		return nil, nil
+	}
+	return &files, nil
+}
+
+type serverListOptions struct {
+	output string
+}
+
+// serverEntry is the JSON shape of a listed server, the private key is
+// reduced to whether one is configured
+type serverEntry struct {
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	User      string `json:"user"`
+	HasKey    bool   `json:"has_key"`
+	Transport string `json:"transport"`
+}
+
 func newServerListCommand() *cobra.Command {
-	return &cobra.Command{
+	opts := serverListOptions{}
+	cmd := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List servers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runServerList(cmd.OutOrStdout())
+			return runServerList(cmd.OutOrStdout(), opts)
 		},
 	}
+	cmd.Flags().StringVarP(&opts.output, "output", "o", outputText, "output format: text, json")
+	return cmd
 }
 
-func runServerList(out io.Writer) error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+func runServerList(out io.Writer, opts serverListOptions) error {
+	if err := checkOutputFormat(opts.output); err != nil {
+		return err
 	}
 
-	config, err := vault.LoadConfig(cwd)
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	if len(config.Servers) == 0 {
-		fmt.Fprintln(out, "No servers found")
-		return nil
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	config, err := vault.LoadConfig(root)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
 	}
 
 	hosts := make([]string, 0, len(config.Servers))
@@ -385,15 +541,36 @@ func runServerList(out io.Writer) error {
 	}
 	sort.Strings(hosts)
 
+	if opts.output == outputJSON {
+		entries := make([]serverEntry, 0, len(hosts))
+		for _, host := range hosts {
+			server := config.Servers[host]
+			entries = append(entries, serverEntry{
+				Host:      host,
+				Port:      serverPort(server),
+				User:      server.User,
+				HasKey:    len(server.Key) > 0,
+				Transport: serverTransport(server),
+			})
+		}
+		return writeJSON(out, entries)
+	}
+
+	if len(config.Servers) == 0 {
+		fmt.Fprintln(out, "No servers found")
+		return nil
+	}
+
 	fmt.Fprintln(out, "Servers:")
 	for _, host := range hosts {
 		server := config.Servers[host]
 
-		port := server.Port
-		if port == 0 {
-			port = 22
-		}
+		port := serverPort(server)
 		fmt.Fprintf(out, "\tHost: %s:%d\n", host, port)
+		if server.Transport == vault.TransportTCP {
+			fmt.Fprintln(out, "\tTransport: tcp")
+			continue
+		}
 		fmt.Fprintf(out, "\tUser: %s\n", server.User)
 		if len(server.Key) > 0 {
 			fmt.Fprintln(out, "\tKey: <configured>")
@@ -403,13 +580,31 @@ func runServerList(out io.Writer) error {
 	return nil
 }
 
+func serverPort(server vault.Server) int {
+	if server.Port == 0 {
+		if server.Transport == vault.TransportTCP {
+			return docker.DefaultTLSPort
+		}
+		return 22
+	}
+	return server.Port
+}
+
+func serverTransport(server vault.Server) string {
+	if server.Transport == "" {
+		return vault.TransportSSH
+	}
+	return server.Transport
+}
+
 func newServerRemoveCommand() *cobra.Command {
 	opts := serverRemoveOptions{}
 	cmd := &cobra.Command{
-		Use:     "remove HOST",
-		Aliases: []string{"rm", "delete"},
-		Short:   "Remove a server",
-		Args:    cobra.ExactArgs(1),
+		Use:               "remove HOST",
+		Aliases:           []string{"rm", "delete"},
+		Short:             "Remove a server",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeServers,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.host = args[0]
 			return runServerRemove(cmd.Context(), cmd.OutOrStdout(), opts)
@@ -427,12 +622,12 @@ type serverRemoveOptions struct {
 
 // TODO: force flag
 func runServerRemove(ctx context.Context, out io.Writer, opts serverRemoveOptions) error {
-	cwd, err := os.Getwd()
+	root, err := vaultRoot()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	config, err := vault.LoadConfig(cwd)
+	config, err := vault.LoadConfig(root)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -444,13 +639,13 @@ func runServerRemove(ctx context.Context, out io.Writer, opts serverRemoveOption
 	delete(config.Servers, opts.host)
 
 	if opts.soft {
-		if err := vault.SaveConfig(cwd, config); err != nil {
+		if err := vault.SaveConfig(root, config); err != nil {
 			return err
 		}
 		return nil
 	}
 
-	node, err := docker.NewClientSSH(opts.host, server.Port, server.User, server.Key)
+	node, err := docker.NewServerClient(opts.host, server)
 	if err != nil {
 		return err
 	}
@@ -532,7 +727,7 @@ wait:
 		return err
 	}
 
-	if err := vault.SaveConfig(cwd, config); err != nil {
+	if err := vault.SaveConfig(root, config); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
@@ -540,6 +735,58 @@ wait:
 	return nil
 }
 
+func newServerRenameCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "rename OLD NEW",
+		Aliases: []string{"mv"},
+		Short:   "Rename a server",
+		Long: `Move a server entry to a new host, keeping its user, port and key.
+
+Only the local config changes, the node stays in the swarm as it is. Use it
+when a server got a new address or DNS name.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeServers,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServerRename(cmd.OutOrStdout(), args[0], args[1])
+		},
+	}
+}
+
+func runServerRename(out io.Writer, oldHost, newHost string) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	if err := vault.CheckInitialized(root); err != nil {
+		return err
+	}
+	config, err := vault.LoadConfig(root)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	server, exists := config.Servers[oldHost]
+	if !exists {
+		return fmt.Errorf("server '%s' not found", oldHost)
+	}
+	if oldHost == newHost {
+		return nil
+	}
+	if _, exists := config.Servers[newHost]; exists {
+		return fmt.Errorf("server '%s' already exists", newHost)
+	}
+	delete(config.Servers, oldHost)
+	config.Servers[newHost] = server
+
+	if err := vault.SaveConfig(root, config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Fprintf(out, "Server '%s' renamed to '%s'\n", oldHost, newHost)
+	return nil
+}
+
 const (
 	DockerUser = "cicdez"
 )
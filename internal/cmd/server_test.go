@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+)
+
+func TestServerListJSON(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	config := vault.Config{Servers: map[string]vault.Server{
+		"203.0.113.2": {User: "deploy", Key: vault.PrivateKey("super-private-key")},
+		"203.0.113.1": {Port: 2222, User: "cicdez"},
+		"203.0.113.3": {Transport: vault.TransportTCP, TLS: &vault.TLSFiles{CA: "/etc/cicdez/ca.pem"}},
+	}}
+	if err := vault.SaveConfig(dir, config); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	cmd := NewServerCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"list", "--output", "json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("server list failed: %v", err)
+	}
+
+	var entries []serverEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", buf.String(), err)
+	}
+
+	want := []serverEntry{
+		{Host: "203.0.113.1", Port: 2222, User: "cicdez", Transport: "ssh"},
+		{Host: "203.0.113.2", Port: 22, User: "deploy", HasKey: true, Transport: "ssh"},
+		{Host: "203.0.113.3", Port: 2376, Transport: "tcp"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d servers, got %v", len(want), entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entries[i])
+		}
+	}
+	if strings.Contains(buf.String(), "super-private-key") {
+		t.Errorf("expected private key to be omitted, got: %s", buf.String())
+	}
+}
+
+func TestServerListInvalidOutput(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewServerCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"list", "-o", "xml"})
+
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "unsupported output format") {
+		t.Errorf("expected unsupported output format error, got %v", err)
+	}
+}
+
+func TestServerListNotInitialized(t *testing.T) {
+	setupTestEnv(t)
+
+	cmd := NewServerCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"list"})
+
+	if err := cmd.Execute(); !errors.Is(err, vault.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized without a .cicdez directory, got %v", err)
+	}
+}
+
+func TestServerRename(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveConfig(dir, vault.Config{Servers: map[string]vault.Server{
+		"203.0.113.1": {Port: 2222, User: "cicdez", Key: vault.PrivateKey("private-key")},
+		"203.0.113.2": {User: "deploy"},
+	}}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	cmd := NewServerCommand()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetArgs([]string{"rename", "203.0.113.1", "node1.example.com"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("server rename failed: %v", err)
+	}
+
+	config, err := vault.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if _, ok := config.Servers["203.0.113.1"]; ok {
+		t.Error("expected the old host to be gone")
+	}
+	server := config.Servers["node1.example.com"]
+	if server.Port != 2222 || server.User != "cicdez" || string(server.Key) != "private-key" {
+		t.Errorf("expected user, port and key to move with the entry, got %+v", server)
+	}
+	if len(config.Servers) != 2 {
+		t.Errorf("expected 2 servers, got %d", len(config.Servers))
+	}
+}
+
+func TestServerRenameConflicts(t *testing.T) {
+	dir := setupTestEnv(t)
+	if err := vault.SaveConfig(dir, vault.Config{Servers: map[string]vault.Server{
+		"203.0.113.1": {User: "cicdez"},
+		"203.0.113.2": {User: "deploy"},
+	}}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"rename", "203.0.113.9", "node9"}, "not found"},
+		{[]string{"rename", "203.0.113.1", "203.0.113.2"}, "already exists"},
+	} {
+		cmd := NewServerCommand()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		cmd.SetArgs(tt.args)
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: expected %q error, got %v", tt.args, tt.want, err)
+		}
+	}
+
+	config, err := vault.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.Servers["203.0.113.1"].User != "cicdez" || config.Servers["203.0.113.2"].User != "deploy" {
+		t.Errorf("expected the config to be untouched, got %+v", config.Servers)
+	}
+}
+
+func TestServerAddTransportFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"add", "203.0.113.1", "--tls-ca", "ca.pem"}, "require --transport tcp"},
+		{[]string{"add", "203.0.113.1", "--transport", "tcp", "--setup"}, "--setup can't be combined with --transport tcp"},
+		{[]string{"add", "203.0.113.1", "--transport", "tcp", "--tls-cert", "cert.pem"}, "must be set together"},
+		{[]string{"add", "203.0.113.1", "--transport", "http"}, "transport http is not supported"},
+	} {
+		cmd := NewServerCommand()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		cmd.SetArgs(tc.args)
+
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%v: expected %q error, got %v", tc.args, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"io"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+type serviceInspectOptions struct {
+	stack   string
+	service string
+	server  string
+	output  string
+}
+
+func NewServiceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Inspect deployed services",
+	}
+
+	inspectOpts := serviceInspectOptions{}
+	inspectCmd := &cobra.Command{
+		Use:   "inspect STACK SERVICE",
+		Short: "Show the spec swarm currently runs for a service",
+		Long: `Print the deployed spec of a stack service together with its
+com.docker.stack.image label and running versus desired replicas.
+
+Useful to spot drift between swarm and the compose file.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inspectOpts.stack = args[0]
+			inspectOpts.service = args[1]
+			return runServiceInspect(cmd.Context(), cmd.OutOrStdout(), inspectOpts)
+		},
+	}
+	inspectCmd.Flags().StringVar(&inspectOpts.server, "server", "", "query this configured server instead of any manager")
+	completeServerFlag(inspectCmd)
+	inspectCmd.Flags().StringVarP(&inspectOpts.output, "output", "o", outputText, "output format: text (YAML), json")
+
+	cmd.AddCommand(inspectCmd)
+	return cmd
+}
+
+func runServiceInspect(ctx context.Context, out io.Writer, opts serviceInspectOptions) error {
+	if err := checkOutputFormat(opts.output); err != nil {
+		return err
+	}
+
+	manager, err := managerClient(ctx, opts.server)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	report, err := docker.InspectService(ctx, manager, opts.stack, opts.service)
+	if err != nil {
+		return err
+	}
+
+	data, err := docker.MarshalReport(report, opts.output == outputJSON)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
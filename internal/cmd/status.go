@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/moby/moby/client"
+	"github.com/spf13/cobra"
+)
+
+type stackStateOptions struct {
+	stack    string
+	quiet    bool
+	progress bool
+}
+
+func NewStatusCommand() *cobra.Command {
+	opts := stackStateOptions{}
+	return &cobra.Command{
+		Use:   "status STACK",
+		Short: "Show task counts for a detached deploy",
+		Long: `Reconnect to the servers recorded by "cicdez deploy --detach" and
+print running versus desired tasks for every submitted service.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.stack = args[0]
+			return runStatus(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+}
+
+func NewWaitCommand() *cobra.Command {
+	opts := stackStateOptions{}
+	cmd := &cobra.Command{
+		Use:   "wait STACK",
+		Short: "Wait for a detached deploy to converge",
+		Long: `Reconnect to the servers recorded by "cicdez deploy --detach" and
+block until every submitted service converges or fails.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeStacks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.stack = args[0]
+			return runWait(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.quiet, "quiet", "q", false, "suppress progress output")
+	cmd.Flags().BoolVar(&opts.progress, "progress", false, "print per-service task counts and nodes while waiting")
+	return cmd
+}
+
+// managerClient connects to a manager among the configured servers, or to
+// host alone when it is set
+func managerClient(ctx context.Context, host string) (client.APIClient, error) {
+	root, err := vaultRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Servers) == 0 {
+		return nil, errNoServers
+	}
+
+	servers := cfg.Servers
+	if host != "" {
+		server, ok := cfg.Servers[host]
+		if !ok {
+			return nil, fmt.Errorf("server %s is not configured", host)
+		}
+		servers = map[string]vault.Server{host: server}
+	}
+
+	manager, _, err := docker.GetManagerClient(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// stateManagerClient loads the recorded deploy state and connects to a
+// manager among the servers it targeted
+func stateManagerClient(ctx context.Context, stack string) (client.APIClient, vault.DeployState, error) {
+	root, err := vaultRoot()
+	if err != nil {
+		return nil, vault.DeployState{}, err
+	}
+
+	state, err := vault.LoadDeployState(root, stack)
+	if err != nil {
+		return nil, state, err
+	}
+
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return nil, state, err
+	}
+
+	servers := make(map[string]vault.Server, len(state.Servers))
+	for _, host := range state.Servers {
+		if server, ok := cfg.Servers[host]; ok {
+			servers[host] = server
+		}
+	}
+	if len(servers) == 0 {
+		return nil, state, fmt.Errorf("none of the servers stack %s was deployed to are configured anymore", stack)
+	}
+
+	manager, _, err := docker.GetManagerClient(ctx, servers)
+	if err != nil {
+		return nil, state, err
+	}
+	return manager, state, nil
+}
+
+func runStatus(ctx context.Context, out io.Writer, opts stackStateOptions) error {
+	manager, state, err := stateManagerClient(ctx, opts.stack)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	ids := make([]string, 0, len(state.Services))
+	for id := range state.Services {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return state.Services[ids[i]] < state.Services[ids[j]]
+	})
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tREPLICAS")
+	for _, id := range ids {
+		running, desired, err := docker.ServiceTaskCounts(ctx, manager, id)
+		if err != nil {
+			return fmt.Errorf("failed to inspect service %s: %w", state.Services[id], err)
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\n", state.Services[id], running, desired)
+	}
+	return w.Flush()
+}
+
+func runWait(ctx context.Context, out io.Writer, opts stackStateOptions) error {
+	manager, state, err := stateManagerClient(ctx, opts.stack)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	if len(state.Services) == 0 {
+		return nil
+	}
+	_, err = docker.WaitOnServices(ctx, manager, state.Services, opts.quiet, opts.progress, out)
+	return err
+}
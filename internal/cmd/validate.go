@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/spf13/cobra"
+)
+
+type validateOptions struct {
+	composeFiles []string
+	envFiles     []string
+}
+
+func NewValidateCommand() *cobra.Command {
+	opts := validateOptions{}
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the compose file and cicdez extensions",
+		Long: `Load the compose file and statically check the cicdez extensions
+without contacting a server: sensitive secrets exist in the vault, formats are
+known, templates and local config sources are readable, and images that get
+built have registry credentials to be pushed with.
+Every problem is printed and the command fails if there are any.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runValidate(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&opts.composeFiles, "file", "f", []string{}, "compose file path(s)")
+	cmd.Flags().StringArrayVar(&opts.envFiles, "env-file", []string{}, "env file(s) for interpolation, later files win")
+	return cmd
+}
+
+func runValidate(ctx context.Context, out io.Writer, opts validateOptions) error {
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+
+	env, err := docker.LoadEnvFiles(opts.envFiles...)
+	if err != nil {
+		return err
+	}
+
+	project, err := docker.LoadCompose(ctx, env, opts.composeFiles...)
+	if err != nil {
+		return fmt.Errorf("failed to load compose file: %w", err)
+	}
+	if err := applyGitContext(ctx, out, true, &project); err != nil {
+		return err
+	}
+
+	// the vault is only needed when something reads from it
+	var secrets vault.Secrets
+	if usesSensitive(project) {
+		if secrets, err = vault.LoadSecrets(root); err != nil {
+			return fmt.Errorf("failed to load secrets: %w", err)
+		}
+	}
+
+	authCfg, err := registryAuth(ctx)
+	if err != nil {
+		return err
+	}
+	problems := docker.Validate(project, secrets, authCfg)
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+	}
+	return fmt.Errorf("found %d problem(s)", len(problems))
+}
+
+func usesSensitive(project types.Project) bool {
+	for _, svc := range project.Services {
+		if len(svc.Sensitive) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+
+	"github.com/blindlobstar/cicdez/internal/docker"
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/moby/moby/client"
+	"github.com/spf13/cobra"
+)
+
+// version is set at build time with
+// -ldflags "-X github.com/blindlobstar/cicdez/internal/cmd.version=v1.2.3"
+var version = "dev"
+
+const composeGoModule = "github.com/compose-spec/compose-go/v2"
+
+type versionOptions struct {
+	server string
+}
+
+func NewVersionCommand() *cobra.Command {
+	opts := versionOptions{}
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the cicdez version and Docker API compatibility",
+		Long: `Print the cicdez and compose-go versions and the highest Docker API
+version cicdez speaks. With --server the Docker engine of that configured
+server is asked for its version too, along with the API version both sides
+agree on.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVersion(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", "", "also report the Docker engine of this configured server")
+	completeServerFlag(cmd)
+	return cmd
+}
+
+func runVersion(ctx context.Context, out io.Writer, opts versionOptions) error {
+	cicdez, composeGo := buildVersions()
+	fmt.Fprintf(out, "cicdez:      %s\n", cicdez)
+	fmt.Fprintf(out, "compose-go:  %s\n", composeGo)
+	fmt.Fprintf(out, "Docker API:  %s\n", client.MaxAPIVersion)
+
+	if opts.server == "" {
+		return nil
+	}
+
+	root, err := vaultRoot()
+	if err != nil {
+		return err
+	}
+	cfg, err := vault.LoadConfig(root)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	server, ok := cfg.Servers[opts.server]
+	if !ok {
+		return fmt.Errorf("server %s is not configured", opts.server)
+	}
+
+	node, err := docker.NewServerClient(opts.server, server)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	res, err := node.ServerVersion(ctx, client.ServerVersionOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get docker version of %s: %w", opts.server, err)
+	}
+
+	fmt.Fprintf(out, "\nServer %s:\n", opts.server)
+	fmt.Fprintf(out, "  Engine:      %s (%s/%s)\n", res.Version, res.Os, res.Arch)
+	fmt.Fprintf(out, "  API:         %s (minimum %s)\n", res.APIVersion, res.MinAPIVersion)
+	fmt.Fprintf(out, "  Negotiated:  %s\n", node.ClientVersion())
+	return nil
+}
+
+// buildVersions returns the cicdez version, from -ldflags or else the module
+// version go install recorded, and the compose-go version built in
+func buildVersions() (string, string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version, "unknown"
+	}
+	return versionsFrom(info)
+}
+
+// versionsFrom reads the versions out of info. compose-go is replaced by
+// the fork in external/compose-go, which the report names since the
+// upstream version alone would be misleading.
+func versionsFrom(info *debug.BuildInfo) (string, string) {
+	cicdez, composeGo := version, "unknown"
+	if cicdez == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		cicdez = info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != composeGoModule {
+			continue
+		}
+		composeGo = dep.Version
+		if r := dep.Replace; r != nil {
+			replacement := r.Path
+			if r.Version != "" {
+				replacement += " " + r.Version
+			}
+			composeGo = fmt.Sprintf("%s (replaced by %s)", dep.Version, replacement)
+		}
+	}
+	return cicdez, composeGo
+}
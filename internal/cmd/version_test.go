@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/moby/moby/client"
+)
+
+func TestVersionWithoutServer(t *testing.T) {
+	// no vault or servers: the local versions never need them
+	setupTestEnv(t)
+
+	orig := version
+	version = "v1.2.3"
+	t.Cleanup(func() { version = orig })
+
+	cmd := NewVersionCommand()
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"cicdez:      v1.2.3\n", "compose-go:  ", "Docker API:  " + client.MaxAPIVersion + "\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Server") {
+		t.Errorf("expected no server section without --server, got:\n%s", out)
+	}
+}
+
+func TestVersionsFromReplacedComposeGo(t *testing.T) {
+	info := &debug.BuildInfo{
+		Main: debug.Module{Path: "github.com/blindlobstar/cicdez", Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: "github.com/spf13/cobra", Version: "v1.10.1"},
+			{
+				Path:    composeGoModule,
+				Version: "v2.9.1",
+				Replace: &debug.Module{Path: "./external/compose-go"},
+			},
+		},
+	}
+	cicdez, composeGo := versionsFrom(info)
+	if cicdez != version {
+		t.Errorf("expected the ldflags version for a devel build, got %q", cicdez)
+	}
+	if composeGo != "v2.9.1 (replaced by ./external/compose-go)" {
+		t.Errorf("expected the fork to be reported, got %q", composeGo)
+	}
+
+	info.Deps[1].Replace = &debug.Module{Path: "github.com/example/compose-go/v2", Version: "v2.9.2"}
+	if _, composeGo := versionsFrom(info); composeGo != "v2.9.1 (replaced by github.com/example/compose-go/v2 v2.9.2)" {
+		t.Errorf("expected the replacing module version, got %q", composeGo)
+	}
+
+	info.Deps[1].Replace = nil
+	if _, composeGo := versionsFrom(info); composeGo != "v2.9.1" {
+		t.Errorf("expected the upstream version, got %q", composeGo)
+	}
+}
@@ -1,14 +1,25 @@
 package docker
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"os/exec"
+	"regexp"
+	"strings"
 
+	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/distribution/reference"
 	"github.com/docker/cli/cli/config"
 	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
 	"github.com/moby/moby/api/types/registry"
+	"github.com/moby/moby/client"
 )
 
 // docker hub credentials live under the legacy index server key,
@@ -19,6 +30,89 @@ func LoadDockerAuth() *configfile.ConfigFile {
 	return config.LoadDefaultConfigFile(io.Discard)
 }
 
+// WithRegistries returns a copy of authCfg in which the registries stored
+// in the vault replace what docker login stored for them. The copy has no
+// file behind it, so vault credentials never end up in the docker config.
+// ECR registries get a fresh token here, once per command.
+func WithRegistries(ctx context.Context, authCfg *configfile.ConfigFile, registries map[string]vault.Registry) (*configfile.ConfigFile, error) {
+	if len(registries) == 0 {
+		return authCfg, nil
+	}
+
+	merged := *authCfg
+	merged.Filename = ""
+	merged.AuthConfigs = make(map[string]types.AuthConfig, len(authCfg.AuthConfigs)+len(registries))
+	maps.Copy(merged.AuthConfigs, authCfg.AuthConfigs)
+	merged.CredentialHelpers = make(map[string]string, len(authCfg.CredentialHelpers)+len(registries))
+	maps.Copy(merged.CredentialHelpers, authCfg.CredentialHelpers)
+	for server, creds := range registries {
+		switch creds.Type {
+		case "":
+		case vault.RegistryECR:
+			region := creds.Region
+			if region == "" {
+				region = ecrRegion(server)
+			}
+			if region == "" {
+				return nil, fmt.Errorf("registry %s: no region set and none in the host name", server)
+			}
+			password, err := ecrLoginPassword(ctx, region, creds.Profile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get ECR token for %s: %w", server, err)
+			}
+			creds.Username = "AWS"
+			creds.Password = password
+		default:
+			return nil, fmt.Errorf("registry %s: unknown type %s", server, creds.Type)
+		}
+
+		key := registryKey(server)
+		merged.AuthConfigs[key] = types.AuthConfig{
+			Username:      creds.Username,
+			Password:      creds.Password,
+			ServerAddress: key,
+		}
+		// an empty helper makes docker read the entry above instead of
+		// asking credsStore
+		merged.CredentialHelpers[key] = ""
+	}
+	return &merged, nil
+}
+
+// ecrHost matches private ECR registries, ACCOUNT.dkr.ecr.REGION.amazonaws.com
+var ecrHost = regexp.MustCompile(`^\d+\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ecrRegion returns the region in the host name of an ECR registry
+func ecrRegion(server string) string {
+	if m := ecrHost.FindStringSubmatch(server); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// ecrLoginPassword returns an ECR authorization token, swapped in tests
+var ecrLoginPassword = awsECRLoginPassword
+
+// awsECRLoginPassword asks the AWS CLI for a token, which goes through the
+// same credential chain as the SDK: environment, profiles and SSO
+func awsECRLoginPassword(ctx context.Context, region, profile string) (string, error) {
+	args := []string{"ecr", "get-login-password", "--region", region}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 func resolveAuth(authCfg *configfile.ConfigFile, image string) registry.AuthConfig {
 	if authCfg == nil {
 		return registry.AuthConfig{}
@@ -81,3 +175,50 @@ func encodeAuth(auth registry.AuthConfig) string {
 
 	return base64.URLEncoding.EncodeToString(authBytes)
 }
+
+// registryKey is the key docker login stores the credentials of server under
+func registryKey(server string) string {
+	switch server {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return indexServer
+	}
+	return server
+}
+
+// CheckRegistryLogin has the daemon log in to server with the credentials
+// docker login stored and returns the registry's status. An identity token
+// handed back replaces the stored password, refreshed reports whether that
+// happened.
+func CheckRegistryLogin(ctx context.Context, apiClient client.APIClient, authCfg *configfile.ConfigFile, server string) (status string, refreshed bool, err error) {
+	key := registryKey(server)
+	auth, err := authCfg.GetAuthConfig(key)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read credentials for %s: %w", server, err)
+	}
+	if auth.Username == "" && auth.IdentityToken == "" && auth.RegistryToken == "" {
+		return "", false, fmt.Errorf("no credentials for registry %s, run docker login %s", server, server)
+	}
+
+	res, err := apiClient.RegistryLogin(ctx, client.RegistryLoginOptions{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		ServerAddress: key,
+		IdentityToken: auth.IdentityToken,
+		RegistryToken: auth.RegistryToken,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to log in to %s: %w", server, err)
+	}
+
+	// vault registries come without a file and keep their password
+	if token := res.Auth.IdentityToken; token != "" && token != auth.IdentityToken && authCfg.Filename != "" {
+		auth.ServerAddress = key
+		auth.Password = ""
+		auth.IdentityToken = token
+		if err := authCfg.GetCredentialsStore(key).Store(auth); err != nil {
+			return "", false, fmt.Errorf("failed to save refreshed credentials for %s: %w", server, err)
+		}
+		refreshed = true
+	}
+	return res.Auth.Status, refreshed, nil
+}
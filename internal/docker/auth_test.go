@@ -0,0 +1,169 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/containerd/errdefs"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/moby/moby/api/types/registry"
+)
+
+func testAuthConfig(t *testing.T) *configfile.ConfigFile {
+	t.Helper()
+	authCfg := configfile.New(filepath.Join(t.TempDir(), "config.json"))
+	authCfg.AuthConfigs["registry.example.com"] = types.AuthConfig{
+		Username:      "ci",
+		Password:      "secret",
+		ServerAddress: "registry.example.com",
+	}
+	return authCfg
+}
+
+func TestCheckRegistryLogin(t *testing.T) {
+	authCfg := testAuthConfig(t)
+	fc := &fakeClient{identityToken: "refreshed-token"}
+
+	status, refreshed, err := CheckRegistryLogin(context.Background(), fc, authCfg, "registry.example.com")
+	if err != nil {
+		t.Fatalf("CheckRegistryLogin failed: %v", err)
+	}
+	if status != "Login Succeeded" || !refreshed {
+		t.Errorf("expected a refreshed successful login, got %q, %t", status, refreshed)
+	}
+	if len(fc.logins) != 1 || fc.logins[0].Username != "ci" || fc.logins[0].Password != "secret" {
+		t.Fatalf("expected one login with the stored credentials, got %+v", fc.logins)
+	}
+
+	auth, err := authCfg.GetAuthConfig("registry.example.com")
+	if err != nil {
+		t.Fatalf("GetAuthConfig failed: %v", err)
+	}
+	if auth.IdentityToken != "refreshed-token" || auth.Password != "" {
+		t.Errorf("expected the identity token to replace the password, got %+v", auth)
+	}
+	data, err := os.ReadFile(authCfg.Filename)
+	if err != nil || !strings.Contains(string(data), "refreshed-token") {
+		t.Errorf("expected the refreshed token to be saved, got %q, %v", data, err)
+	}
+}
+
+func TestCheckRegistryLoginFailure(t *testing.T) {
+	authCfg := testAuthConfig(t)
+	fc := &fakeClient{loginErr: errdefs.ErrUnauthenticated}
+
+	_, _, err := CheckRegistryLogin(context.Background(), fc, authCfg, "registry.example.com")
+	if !errdefs.IsUnauthorized(err) {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+	if _, err := os.Stat(authCfg.Filename); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be saved after a failed login, got %v", err)
+	}
+
+	_, _, err = CheckRegistryLogin(context.Background(), fc, authCfg, "ghcr.io")
+	if err == nil || !strings.Contains(err.Error(), "no credentials for registry ghcr.io") {
+		t.Errorf("expected a missing credentials error, got %v", err)
+	}
+}
+
+func TestWithRegistries(t *testing.T) {
+	authCfg := testAuthConfig(t)
+	authCfg.CredentialsStore = "cicdez-missing-helper"
+
+	merged, err := WithRegistries(context.Background(), authCfg, map[string]vault.Registry{
+		"registry.example.com": {Username: "deploy", Password: "vault-secret"},
+		"docker.io":            {Username: "hub", Password: "hub-secret"},
+	})
+	if err != nil {
+		t.Fatalf("WithRegistries failed: %v", err)
+	}
+	if merged.Filename != "" {
+		t.Errorf("expected the merged config to have no file, got %q", merged.Filename)
+	}
+	if authCfg.AuthConfigs["registry.example.com"].Username != "ci" {
+		t.Errorf("expected the docker config to stay untouched, got %+v", authCfg.AuthConfigs)
+	}
+
+	auth := resolveAuth(merged, "registry.example.com/app:latest")
+	if auth.Username != "deploy" || auth.Password != "vault-secret" {
+		t.Errorf("expected the vault credentials, got %+v", auth)
+	}
+	auth = resolveAuth(merged, "nginx:latest")
+	if auth.Username != "hub" || auth.ServerAddress != indexServer {
+		t.Errorf("expected docker hub credentials under the index server, got %+v", auth)
+	}
+
+	fc := &fakeClient{identityToken: "refreshed-token"}
+	_, refreshed, err := CheckRegistryLogin(context.Background(), fc, merged, "registry.example.com")
+	if err != nil || refreshed {
+		t.Fatalf("expected a login without a stored token, got %t, %v", refreshed, err)
+	}
+	if _, err := os.Stat(authCfg.Filename); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be saved for vault credentials, got %v", err)
+	}
+
+	if same, err := WithRegistries(context.Background(), authCfg, nil); err != nil || same != authCfg {
+		t.Errorf("expected the docker config as is without vault registries, got %v", err)
+	}
+}
+
+func TestWithRegistriesECR(t *testing.T) {
+	const host = "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	var calls []string
+	orig := ecrLoginPassword
+	ecrLoginPassword = func(_ context.Context, region, profile string) (string, error) {
+		calls = append(calls, region+"/"+profile)
+		return fmt.Sprintf("token-%d", len(calls)), nil
+	}
+	t.Cleanup(func() { ecrLoginPassword = orig })
+
+	authCfg := testAuthConfig(t)
+	// a stale password docker login stored must not win
+	authCfg.AuthConfigs[host] = types.AuthConfig{Username: "AWS", Password: "stale", ServerAddress: host}
+	registries := map[string]vault.Registry{
+		host: {Type: vault.RegistryECR, Profile: "deploy"},
+	}
+
+	for want := 1; want <= 2; want++ {
+		merged, err := WithRegistries(context.Background(), authCfg, registries)
+		if err != nil {
+			t.Fatalf("WithRegistries failed: %v", err)
+		}
+		data, err := base64.URLEncoding.DecodeString(encodeAuth(resolveAuth(merged, host+"/app:latest")))
+		if err != nil {
+			t.Fatalf("failed to decode auth: %v", err)
+		}
+		var auth registry.AuthConfig
+		if err := json.Unmarshal(data, &auth); err != nil {
+			t.Fatalf("failed to parse auth: %v", err)
+		}
+		if auth.Username != "AWS" || auth.Password != fmt.Sprintf("token-%d", want) {
+			t.Errorf("expected fresh token %d, got %+v", want, auth)
+		}
+	}
+	if !slices.Equal(calls, []string{"eu-west-1/deploy", "eu-west-1/deploy"}) {
+		t.Errorf("expected a token for the host region and profile each time, got %v", calls)
+	}
+
+	ecrLoginPassword = func(context.Context, string, string) (string, error) {
+		return "", errors.New("Unable to locate credentials")
+	}
+	if _, err := WithRegistries(context.Background(), authCfg, registries); err == nil || !strings.Contains(err.Error(), "Unable to locate credentials") {
+		t.Errorf("expected the AWS error, got %v", err)
+	}
+	if _, err := WithRegistries(context.Background(), authCfg, map[string]vault.Registry{
+		"ecr.example.com": {Type: vault.RegistryECR},
+	}); err == nil || !strings.Contains(err.Error(), "no region") {
+		t.Errorf("expected a missing region error, got %v", err)
+	}
+}
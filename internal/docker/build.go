@@ -1,14 +1,19 @@
 package docker
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 
+	"github.com/blindlobstar/cicdez/internal/log"
 	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/containerd/platforms"
@@ -21,6 +26,8 @@ import (
 	"github.com/moby/moby/client/pkg/jsonmessage"
 	"github.com/moby/patternmatcher/ignorefile"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
 )
 
 type BuildOptions struct {
@@ -30,7 +37,65 @@ type BuildOptions struct {
 	NoCache  bool
 	Pull     bool
 	Push     bool
-	Out      io.Writer
+	// Load imports the image into the local daemon, which is where
+	// single-platform builds end up by default
+	Load bool
+	// Output, when set, is a directory each image is written to as an OCI
+	// archive named after its service, instead of the daemon
+	Output string
+	// BuildArgs and Target override the compose build config of every
+	// service built, Exclude adds .dockerignore patterns to its context
+	BuildArgs types.MappingWithEquals
+	Target    string
+	Exclude   []string
+	Log       *log.Logger
+	Out       io.Writer
+	// Parallelism is how many services build at once, one when zero
+	Parallelism int
+	// Quiet drops the build and push progress, failures are still returned
+	Quiet bool
+	// Retries is how often a registryless transfer to a server is retried,
+	// FailFast stops the transfers to the other servers after one failed
+	Retries  int
+	FailFast bool
+}
+
+// exportMode is where a built image goes
+type exportMode int
+
+const (
+	// exportDaemon loads the image into the daemon, a push goes from there
+	exportDaemon exportMode = iota
+	// exportRegistry has BuildKit push a manifest list straight to the
+	// registry, the daemon can't hold a multi-platform image
+	exportRegistry
+	// exportOCI writes an OCI archive to BuildOptions.Output
+	exportOCI
+)
+
+// planExport picks where an image built for the given number of platforms
+// goes, refusing combinations that would silently drop platforms
+func planExport(platforms int, buildKit bool, opt BuildOptions) (exportMode, error) {
+	if opt.Output != "" {
+		if !buildKit {
+			return 0, errors.New("--output requires a daemon with BuildKit")
+		}
+		return exportOCI, nil
+	}
+	if platforms <= 1 {
+		return exportDaemon, nil
+	}
+
+	if !buildKit {
+		return 0, fmt.Errorf("building for %d platforms requires a daemon with BuildKit", platforms)
+	}
+	if opt.Load {
+		return 0, fmt.Errorf("cannot load an image built for %d platforms into the docker daemon, build a single platform or use --push or --output", platforms)
+	}
+	if !opt.Push {
+		return 0, fmt.Errorf("an image built for %d platforms can only be pushed or written with --output", platforms)
+	}
+	return exportRegistry, nil
 }
 
 func Build(ctx context.Context, dockerClient client.APIClient, project types.Project, opt BuildOptions) error {
@@ -39,56 +104,182 @@ func Build(ctx context.Context, dockerClient client.APIClient, project types.Pro
 		var err error
 		bkClient, err = newBuildKitClient(ctx, dockerClient)
 		if err != nil {
+			opt.Log.Debugf("buildkit unavailable, using the classic builder: %v", err)
 			bkClient = nil
 		} else {
 			defer bkClient.Close()
 		}
 	}
 
-	for _, svc := range project.Services {
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(project.Services)) {
+		svc := project.Services[name]
 		if len(opt.Services) > 0 && !opt.Services[svc.Name] {
 			continue
 		}
-
 		if svc.Build == nil {
 			continue
 		}
+		names = append(names, name)
+	}
 
-		if svc.Platform != "" && !slices.Contains(svc.Build.Platforms, svc.Platform) {
-			svc.Build.Platforms = append(svc.Build.Platforms, svc.Platform)
+	if opt.Parallelism <= 1 || len(names) <= 1 {
+		for _, name := range names {
+			if err := buildService(ctx, dockerClient, bkClient, project, project.Services[name], opt); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
 
-		imageName := svc.Image
-		if imageName == "" {
-			imageName = project.Name + "_" + svc.Name
+	// each build writes to its own buffer, flushed in service order once the
+	// build is done, so concurrent progress streams don't interleave
+	outputs := make([]bytes.Buffer, len(names))
+	done := make([]chan struct{}, len(names))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(opt.Parallelism)
+	for i := range names {
+		done[i] = make(chan struct{})
+	}
+	out := streamWriter(opt.Out)
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		for i := range names {
+			<-done[i]
+			out.Write(outputs[i].Bytes())
 		}
+	}()
+	for i, name := range names {
+		svcOpt := opt
+		svcOpt.Out = &outputs[i]
+		eg.Go(func() error {
+			defer close(done[i])
+			if err := egCtx.Err(); err != nil {
+				return err
+			}
+			return buildService(egCtx, dockerClient, bkClient, project, project.Services[name], svcOpt)
+		})
+	}
+	err := eg.Wait()
+	<-flushed
+	return err
+}
 
-		fmt.Fprintf(opt.Out, "Building %s...\n", imageName)
+// buildService builds the image of svc and pushes it when opt.Push
+func buildService(ctx context.Context, dockerClient client.APIClient, bkClient *bkclient.Client, project types.Project, svc types.ServiceConfig, opt BuildOptions) error {
+	if opt.Quiet {
+		opt.Out = io.Discard
+	}
 
-		var id string
-		var err error
-		if bkClient != nil {
-			id, err = buildImageWithBuildKit(ctx, bkClient, imageName, svc.Build, project.WorkingDir, opt)
+	build := withOverrides(*svc.Build, opt)
+	if svc.Platform != "" && !slices.Contains(build.Platforms, svc.Platform) {
+		build.Platforms = append(slices.Clone(build.Platforms), svc.Platform)
+	}
+
+	imageName := svc.Image
+	if imageName == "" {
+		imageName = project.Name + "_" + svc.Name
+	}
+
+	mode, err := planExport(len(build.Platforms), bkClient != nil, opt)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrBuild, svc.Name, err)
+	}
+	if mode == exportRegistry && IsRegistryless(imageName) {
+		return fmt.Errorf("%w %s: registryless images are streamed from the daemon and can't be multi-platform", ErrBuild, svc.Name)
+	}
+
+	fmt.Fprintf(opt.Out, "Building %s...\n", imageName)
+	opt.Log.Debugf("building %s from %s, buildkit %t, platforms %v", imageName, build.Context, bkClient != nil, build.Platforms)
+
+	var id string
+	if bkClient != nil {
+		id, err = buildImageWithBuildKit(ctx, bkClient, imageName, svc.Name, &build, project.WorkingDir, mode, opt)
+	} else {
+		id, err = buildImage(ctx, dockerClient, imageName, &build, project.WorkingDir, opt)
+	}
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrBuild, svc.Name, err)
+	}
+
+	if opt.Push && mode == exportDaemon {
+		fmt.Fprintf(opt.Out, "Pushing %s...\n", imageName)
+		opt.Log.Debugf("pushing %s, image %s", imageName, id)
+		if IsRegistryless(imageName) {
+			err = PushRegistryless(ctx, dockerClient, imageName, id, opt)
 		} else {
-			id, err = buildImage(ctx, dockerClient, imageName, svc.Build, project.WorkingDir, opt)
+			err = PushImage(ctx, dockerClient, imageName, opt.Auth, opt.Out)
 		}
 		if err != nil {
-			return fmt.Errorf("failed to build %s: %w", svc.Name, err)
+			return fmt.Errorf("%w %s: %w", ErrPush, svc.Name, err)
 		}
+	}
+	return nil
+}
 
-		if opt.Push {
-			fmt.Fprintf(opt.Out, "Pushing %s...\n", imageName)
-			if IsRegistryless(imageName) {
-				err = PushRegistryless(ctx, dockerClient, imageName, id, opt.Servers, opt.Out)
-			} else {
-				err = PushImage(ctx, dockerClient, imageName, opt.Auth)
-			}
-			if err != nil {
-				return fmt.Errorf("failed to push %s: %w", svc.Name, err)
-			}
+// withOverrides returns a copy of build with the BuildArgs and Target of opt
+// applied, leaving the project as loaded
+func withOverrides(build types.BuildConfig, opt BuildOptions) types.BuildConfig {
+	if len(opt.BuildArgs) > 0 {
+		args := make(types.MappingWithEquals, len(build.Args)+len(opt.BuildArgs))
+		maps.Copy(args, build.Args)
+		maps.Copy(args, opt.BuildArgs)
+		build.Args = args
+	}
+	if opt.Target != "" {
+		build.Target = opt.Target
+	}
+	return build
+}
+
+// RebaseBuildContexts re-roots local build contexts, and with them their
+// .dockerignore, at base. Only contexts declared relative in the compose file
+// move, declared holds the project as returned by Project.Declared. Absolute
+// and remote contexts are left alone.
+func RebaseBuildContexts(project *types.Project, declared types.Project, base string) error {
+	info, err := os.Stat(base)
+	if err != nil {
+		return fmt.Errorf("invalid context path: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid context path: %s is not a directory", base)
+	}
+	base, err = filepath.Abs(base)
+	if err != nil {
+		return fmt.Errorf("invalid context path: %w", err)
+	}
+
+	// resolved is what compose-go made of the declared value, only local
+	// contexts come out absolute
+	rebase := func(resolved, declared string) string {
+		if !filepath.IsAbs(resolved) || declared == "" || filepath.IsAbs(declared) {
+			return resolved
 		}
+		return filepath.Join(base, declared)
 	}
 
+	for name, svc := range project.Services {
+		if svc.Build == nil {
+			continue
+		}
+		var orig types.BuildConfig
+		if d, ok := declared.Services[name]; ok && d.Build != nil {
+			orig = *d.Build
+		}
+
+		build := *svc.Build
+		build.Context = rebase(build.Context, orig.Context)
+		if len(build.AdditionalContexts) > 0 {
+			contexts := make(types.Mapping, len(build.AdditionalContexts))
+			for k, v := range build.AdditionalContexts {
+				contexts[k] = rebase(v, orig.AdditionalContexts[k])
+			}
+			build.AdditionalContexts = contexts
+		}
+		svc.Build = &build
+		project.Services[name] = svc
+	}
 	return nil
 }
 
@@ -103,6 +294,54 @@ func readIgnorePatterns(buildContext string) []string {
 	return patterns
 }
 
+// compressThreshold is the build context size from which the tar is gzipped
+// before it is sent, below it compressing costs more than it saves
+const compressThreshold = 1 << 20
+
+// compressContext gzips a build context tar unless it ends within
+// compressThreshold bytes, the daemon accepts either form. Over an SSH
+// tunnel the transfer dominates large builds.
+func compressContext(tar io.ReadCloser) (io.ReadCloser, error) {
+	head := make([]byte, compressThreshold)
+	n, err := io.ReadFull(tar, head)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		tar.Close()
+		return io.NopCloser(bytes.NewReader(head[:n])), nil
+	}
+	if err != nil {
+		tar.Close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer tar.Close()
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, io.MultiReader(bytes.NewReader(head), tar))
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// contextTar archives buildContext without the paths matched by its
+// .dockerignore or exclude, the Dockerfile is always kept
+func contextTar(buildContext, dockerfile string, exclude []string) (io.ReadCloser, error) {
+	excludePatterns := readIgnorePatterns(buildContext)
+	excludePatterns = append(excludePatterns, exclude...)
+	excludePatterns = append(excludePatterns, "!"+dockerfile)
+
+	tar, err := archive.TarWithOptions(buildContext, &archive.TarOptions{
+		ExcludePatterns: excludePatterns,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return compressContext(tar)
+}
+
 func buildImage(ctx context.Context, dockerClient client.APIClient, imageName string, build *types.BuildConfig, projectDir string, opt BuildOptions) (string, error) {
 	buildContext := build.Context
 	if buildContext == "" {
@@ -121,12 +360,7 @@ func buildImage(ctx context.Context, dockerClient client.APIClient, imageName st
 		return "", fmt.Errorf("cannot locate Dockerfile: %s", dockerfile)
 	}
 
-	excludePatterns := readIgnorePatterns(buildContext)
-	excludePatterns = append(excludePatterns, "!"+dockerfile)
-
-	buildContextReader, err := archive.TarWithOptions(buildContext, &archive.TarOptions{
-		ExcludePatterns: excludePatterns,
-	})
+	buildContextReader, err := contextTar(buildContext, dockerfile, opt.Exclude)
 	if err != nil {
 		return "", fmt.Errorf("failed to create build context: %w", err)
 	}
@@ -187,7 +421,9 @@ func buildImage(ctx context.Context, dockerClient client.APIClient, imageName st
 	defer resp.Body.Close()
 
 	var id string
-	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, os.Stdout, os.Stdout.Fd(), true, func(msg jsonstream.Message) {
+	out := streamWriter(opt.Out)
+	fd, isTTY := terminalFd(out)
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, out, fd, isTTY, func(msg jsonstream.Message) {
 		var result struct{ ID string }
 		if json.Unmarshal(*msg.Aux, &result) == nil && result.ID != "" {
 			id = result.ID
@@ -196,7 +432,9 @@ func buildImage(ctx context.Context, dockerClient client.APIClient, imageName st
 	return id, err
 }
 
-func PushImage(ctx context.Context, dockerClient client.APIClient, imageName string, authCfg *configfile.ConfigFile) error {
+// PushImage pushes imageName from the daemon, reporting progress to out
+// (stdout when nil)
+func PushImage(ctx context.Context, dockerClient client.APIClient, imageName string, authCfg *configfile.ConfigFile, out io.Writer) error {
 	opts := client.ImagePushOptions{
 		RegistryAuth: encodeAuth(resolveAuth(authCfg, imageName)),
 	}
@@ -207,5 +445,25 @@ func PushImage(ctx context.Context, dockerClient client.APIClient, imageName str
 	}
 	defer resp.Close()
 
-	return jsonmessage.DisplayJSONMessagesStream(resp, os.Stdout, os.Stdout.Fd(), true, nil)
+	out = streamWriter(out)
+	fd, isTTY := terminalFd(out)
+	return jsonmessage.DisplayJSONMessagesStream(resp, out, fd, isTTY, nil)
+}
+
+// streamWriter is where daemon progress streams go, stdout unless set
+func streamWriter(out io.Writer) io.Writer {
+	if out == nil {
+		return os.Stdout
+	}
+	return out
+}
+
+// terminalFd returns the descriptor of out and whether it is a terminal,
+// progress streams only redraw in place on one
+func terminalFd(out io.Writer) (uintptr, bool) {
+	f, ok := out.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	return f.Fd(), term.IsTerminal(int(f.Fd()))
 }
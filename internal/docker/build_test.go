@@ -0,0 +1,333 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestRebaseBuildContexts(t *testing.T) {
+	root := t.TempDir()
+	composeDir := filepath.Join(root, "deploy")
+	sourceDir := filepath.Join(root, "src")
+	for _, dir := range []string{composeDir, sourceDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	project := types.Project{
+		WorkingDir: composeDir,
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Build: &types.BuildConfig{
+					Context:            composeDir,
+					AdditionalContexts: types.Mapping{"assets": filepath.Join(composeDir, "assets"), "base": "docker-image://alpine"},
+				},
+			},
+			"api": types.ServiceConfig{
+				Name:  "api",
+				Build: &types.BuildConfig{Context: filepath.Join(composeDir, "api")},
+			},
+			"tools": types.ServiceConfig{
+				Name:  "tools",
+				Build: &types.BuildConfig{Context: "/opt/src/tools"},
+			},
+			"db": types.ServiceConfig{Name: "db", Image: "postgres"},
+		},
+	}
+	// the same services as written in the compose file
+	declared := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Build: &types.BuildConfig{
+					Context:            ".",
+					AdditionalContexts: types.Mapping{"assets": "./assets", "base": "docker-image://alpine"},
+				},
+			},
+			"api":   types.ServiceConfig{Name: "api", Build: &types.BuildConfig{Context: "api"}},
+			"tools": types.ServiceConfig{Name: "tools", Build: &types.BuildConfig{Context: "/opt/src/tools"}},
+			"db":    types.ServiceConfig{Name: "db", Image: "postgres"},
+		},
+	}
+	original := project.Services["web"].Build
+
+	if err := RebaseBuildContexts(&project, declared, sourceDir); err != nil {
+		t.Fatalf("RebaseBuildContexts failed: %v", err)
+	}
+
+	web := project.Services["web"].Build
+	if web.Context != sourceDir {
+		t.Errorf("expected web context %s, got %s", sourceDir, web.Context)
+	}
+	if got := web.AdditionalContexts["assets"]; got != filepath.Join(sourceDir, "assets") {
+		t.Errorf("expected assets context under %s, got %s", sourceDir, got)
+	}
+	if got := web.AdditionalContexts["base"]; got != "docker-image://alpine" {
+		t.Errorf("expected remote context untouched, got %s", got)
+	}
+	if got := project.Services["api"].Build.Context; got != filepath.Join(sourceDir, "api") {
+		t.Errorf("expected api context under %s, got %s", sourceDir, got)
+	}
+	if got := project.Services["tools"].Build.Context; got != "/opt/src/tools" {
+		t.Errorf("expected absolute context untouched, got %s", got)
+	}
+	if original.Context != composeDir {
+		t.Error("expected the original build config to stay untouched")
+	}
+
+	if err := RebaseBuildContexts(&project, declared, filepath.Join(root, "missing")); err == nil {
+		t.Error("expected error for missing context path, got nil")
+	}
+}
+
+func TestPlanExport(t *testing.T) {
+	tests := []struct {
+		name      string
+		platforms int
+		buildKit  bool
+		opt       BuildOptions
+		want      exportMode
+		wantErr   string
+	}{
+		{name: "single platform loads", platforms: 1, buildKit: true, want: exportDaemon},
+		{name: "no platform without buildkit", platforms: 0, want: exportDaemon},
+		{name: "single platform push goes through the daemon", platforms: 1, buildKit: true, opt: BuildOptions{Push: true}, want: exportDaemon},
+		{name: "multi platform push", platforms: 2, buildKit: true, opt: BuildOptions{Push: true}, want: exportRegistry},
+		{name: "multi platform output", platforms: 3, buildKit: true, opt: BuildOptions{Output: "out"}, want: exportOCI},
+		{name: "multi platform load", platforms: 2, buildKit: true, opt: BuildOptions{Load: true, Push: true}, wantErr: "cannot load"},
+		{name: "multi platform without export", platforms: 2, buildKit: true, wantErr: "can only be pushed"},
+		{name: "multi platform without buildkit", platforms: 2, opt: BuildOptions{Push: true}, wantErr: "requires a daemon with BuildKit"},
+		{name: "output without buildkit", platforms: 1, opt: BuildOptions{Output: "out"}, wantErr: "--output requires"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planExport(tt.platforms, tt.buildKit, tt.opt)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planExport failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected mode %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildStreamsToOut(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	project := types.Project{
+		Name:       "app",
+		WorkingDir: dir,
+		Services: types.Services{
+			"web": types.ServiceConfig{Name: "web", Image: "web:latest", Build: &types.BuildConfig{Context: "."}},
+		},
+	}
+
+	fc := &fakeClient{}
+	var out bytes.Buffer
+	if err := Build(context.Background(), fc, project, BuildOptions{Out: &out}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if len(fc.imageBuilds) != 1 {
+		t.Fatalf("expected one image build, got %d", len(fc.imageBuilds))
+	}
+	if !strings.Contains(out.String(), "Building web:latest...") || !strings.Contains(out.String(), "Step 1/1 : FROM scratch") {
+		t.Errorf("expected build output in the writer, got %q", out.String())
+	}
+}
+
+func TestBuildParallel(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	project := types.Project{Name: "app", WorkingDir: dir, Services: types.Services{}}
+	for _, name := range []string{"api", "web", "worker", "cron"} {
+		project.Services[name] = types.ServiceConfig{Name: name, Image: name + ":latest", Build: &types.BuildConfig{Context: "."}}
+	}
+	project.Services["db"] = types.ServiceConfig{Name: "db", Image: "postgres:17"}
+
+	fc := &fakeClient{}
+	var out bytes.Buffer
+	if err := Build(context.Background(), fc, project, BuildOptions{Parallelism: 3, Out: &out}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var built []string
+	for _, opts := range fc.imageBuilds {
+		built = append(built, opts.Tags[0])
+	}
+	slices.Sort(built)
+	if want := []string{"api:latest", "cron:latest", "web:latest", "worker:latest"}; !slices.Equal(built, want) {
+		t.Errorf("expected %v to be built, got %v", want, built)
+	}
+	// every service's output is flushed in one piece, in name order
+	var building []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "Building ") {
+			building = append(building, line)
+		}
+	}
+	if want := []string{"Building api:latest...", "Building cron:latest...", "Building web:latest...", "Building worker:latest..."}; !slices.Equal(building, want) {
+		t.Errorf("expected the outputs in service order, got %q", out.String())
+	}
+
+	fc = &fakeClient{buildErrs: map[string]error{"web:latest": errors.New("daemon went away")}}
+	err := Build(context.Background(), fc, project, BuildOptions{Parallelism: 3, Out: io.Discard})
+	if !errors.Is(err, ErrBuild) || !strings.Contains(err.Error(), "web") || !strings.Contains(err.Error(), "daemon went away") {
+		t.Errorf("expected the web build failure, got %v", err)
+	}
+}
+
+func TestBuildQuiet(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+	project := types.Project{
+		Name:       "app",
+		WorkingDir: dir,
+		Services: types.Services{
+			"web": types.ServiceConfig{Name: "web", Image: "web:latest", Build: &types.BuildConfig{Context: "."}},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Build(context.Background(), &fakeClient{}, project, BuildOptions{Quiet: true, Out: &out}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output when quiet, got %q", out.String())
+	}
+
+	fc := &fakeClient{buildStreamErrs: map[string]string{"web:latest": "no space left on device"}}
+	err := Build(context.Background(), fc, project, BuildOptions{Quiet: true, Out: &out})
+	if !errors.Is(err, ErrBuild) || !strings.Contains(err.Error(), "no space left on device") {
+		t.Errorf("expected the build error to surface, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output when quiet, got %q", out.String())
+	}
+}
+
+// contextEntries reads a build context produced by contextTar back, gunzipping
+// it when it starts with the gzip magic, and lists the names it contains
+func contextEntries(t *testing.T, data []byte) ([]string, bool) {
+	t.Helper()
+	compressed := bytes.HasPrefix(data, []byte{0x1f, 0x8b})
+	var r io.Reader = bytes.NewReader(data)
+	if compressed {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("failed to open gzip stream: %v", err)
+		}
+		r = gz
+	}
+
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	return names, compressed
+}
+
+func TestContextTar(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":                "FROM scratch\n",
+		".dockerignore":             "node_modules\nDockerfile\n",
+		"main.go":                   "package main\n",
+		"node_modules/dep/index.js": "module.exports = {}\n",
+		"tmp/scratch.txt":           "scratch\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	read := func() ([]string, bool) {
+		t.Helper()
+		rc, err := contextTar(dir, "Dockerfile", []string{"tmp"})
+		if err != nil {
+			t.Fatalf("contextTar failed: %v", err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("failed to read context: %v", err)
+		}
+		return contextEntries(t, data)
+	}
+
+	names, compressed := read()
+	if compressed {
+		t.Error("expected a small context to be sent as plain tar")
+	}
+	for _, name := range []string{"Dockerfile", "main.go"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected %s in the context, got %v", name, names)
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "node_modules") || strings.HasPrefix(name, "tmp") {
+			t.Errorf("expected %s to be excluded, got %v", name, names)
+		}
+	}
+
+	// a file of the threshold size alone pushes the tar over it
+	big := make([]byte, compressThreshold)
+	for i := range big {
+		big[i] = byte(i*7919 + i/251)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets.bin"), big, 0o644); err != nil {
+		t.Fatalf("failed to write assets.bin: %v", err)
+	}
+
+	names, compressed = read()
+	if !compressed {
+		t.Error("expected a large context to be gzipped")
+	}
+	if !slices.Contains(names, "assets.bin") || !slices.Contains(names, "main.go") {
+		t.Errorf("expected the compressed context to round-trip, got %v", names)
+	}
+	if slices.Contains(names, "tmp/scratch.txt") {
+		t.Errorf("expected tmp to be excluded from the compressed context, got %v", names)
+	}
+}
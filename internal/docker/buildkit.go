@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
@@ -55,7 +56,7 @@ func newAuthProvider(authCfg *configfile.ConfigFile) session.Attachable {
 	})
 }
 
-func buildImageWithBuildKit(ctx context.Context, bkClient *bkclient.Client, imageName string, build *types.BuildConfig, projectDir string, opt BuildOptions) (string, error) {
+func buildImageWithBuildKit(ctx context.Context, bkClient *bkclient.Client, imageName, service string, build *types.BuildConfig, projectDir string, mode exportMode, opt BuildOptions) (string, error) {
 	buildContext := build.Context
 	if buildContext == "" {
 		buildContext = "."
@@ -105,23 +106,26 @@ func buildImageWithBuildKit(ctx context.Context, bkClient *bkclient.Client, imag
 	if err != nil {
 		return "", err
 	}
+	// the frontend applies .dockerignore itself, extra excludes filter what
+	// is sent, the Dockerfile comes from its own mount
+	contextFS := fs
+	if len(opt.Exclude) > 0 {
+		if contextFS, err = fsutil.NewFilterFS(fs, &fsutil.FilterOpt{ExcludePatterns: opt.Exclude}); err != nil {
+			return "", fmt.Errorf("failed to filter build context: %w", err)
+		}
+	}
 
 	solveOpt := bkclient.SolveOpt{
 		Frontend:      "dockerfile.v0",
 		FrontendAttrs: frontendAttrs,
 		LocalMounts: map[string]fsutil.FS{
-			"context":    fs,
+			"context":    contextFS,
 			"dockerfile": fs,
 		},
 		Session: []session.Attachable{
 			newAuthProvider(opt.Auth),
 		},
-		Exports: []bkclient.ExportEntry{{
-			Type: "moby",
-			Attrs: map[string]string{
-				"name": strings.Join(tags, ","),
-			},
-		}},
+		Exports: []bkclient.ExportEntry{exportEntry(mode, tags, filepath.Join(opt.Output, service+".tar"))},
 	}
 
 	ch := make(chan *bkclient.SolveStatus)
@@ -151,3 +155,25 @@ func buildImageWithBuildKit(ctx context.Context, bkClient *bkclient.Client, imag
 	}
 	return id, nil
 }
+
+func exportEntry(mode exportMode, tags []string, archive string) bkclient.ExportEntry {
+	attrs := map[string]string{"name": strings.Join(tags, ",")}
+	switch mode {
+	case exportRegistry:
+		attrs["push"] = "true"
+		return bkclient.ExportEntry{Type: bkclient.ExporterImage, Attrs: attrs}
+	case exportOCI:
+		return bkclient.ExportEntry{
+			Type:  bkclient.ExporterOCI,
+			Attrs: attrs,
+			Output: func(map[string]string) (io.WriteCloser, error) {
+				if err := os.MkdirAll(filepath.Dir(archive), 0o755); err != nil {
+					return nil, err
+				}
+				return os.Create(archive)
+			},
+		}
+	default:
+		return bkclient.ExportEntry{Type: "moby", Attrs: attrs}
+	}
+}
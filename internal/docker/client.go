@@ -2,17 +2,44 @@ package docker
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/blindlobstar/cicdez/internal/ssh"
+	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/moby/moby/client"
 )
 
+// DefaultTLSPort is the port dockerd listens on for TLS connections
+const DefaultTLSPort = 2376
+
+// NewServerClient connects to the docker daemon of a configured server over
+// the server's transport
+func NewServerClient(host string, server vault.Server) (client.APIClient, error) {
+	switch server.Transport {
+	case "", vault.TransportSSH:
+		return NewClientSSH(host, server.Port, server.User, server.Key)
+	case vault.TransportTCP:
+		var files vault.TLSFiles
+		if server.TLS != nil {
+			files = *server.TLS
+		}
+		return NewClientTCP(host, server.Port, files)
+	default:
+		return nil, fmt.Errorf("server %s has unknown transport %q", host, server.Transport)
+	}
+}
+
 func NewClientSSH(host string, port int, user string, privateKey []byte) (client.APIClient, error) {
 	sshClient, err := ssh.DialWithKey(host, port, user, privateKey)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w to %s: %w", ErrConnect, host, err)
 	}
 
 	httpClient := &http.Client{
@@ -31,3 +58,57 @@ func NewClientSSH(host string, port int, user string, privateKey []byte) (client
 
 	return client, nil
 }
+
+// NewClientTCP connects to a daemon listening on tcp://host:port with TLS.
+// The daemon is verified against files.CA, or the system roots without it,
+// and files.Cert and files.Key are presented when the daemon asks for a
+// client certificate.
+func NewClientTCP(host string, port int, files vault.TLSFiles) (client.APIClient, error) {
+	if port == 0 {
+		port = DefaultTLSPort
+	}
+
+	tlsConfig, err := clientTLSConfig(files)
+	if err != nil {
+		return nil, fmt.Errorf("%w to %s: %w", ErrConnect, host, err)
+	}
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	// the host goes after the http client, client.New picks https from its
+	// tls config
+	return client.New(
+		client.WithHTTPClient(httpClient),
+		client.WithHost("tcp://"+net.JoinHostPort(host, strconv.Itoa(port))),
+	)
+}
+
+func clientTLSConfig(files vault.TLSFiles) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if files.CA != "" {
+		pem, err := os.ReadFile(files.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", files.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (files.Cert == "") != (files.Key == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	if files.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
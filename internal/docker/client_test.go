@@ -0,0 +1,190 @@
+package docker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/moby/moby/client"
+)
+
+// testCA is a self-signed CA that issues the daemon and client certificates
+// of the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cicdez test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "cicdez test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// newTLSDaemon serves the ping and version endpoints over TLS and only
+// accepts clients with a certificate of ca
+func newTLSDaemon(t *testing.T, ca *testCA) (string, int) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, 2, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load daemon certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.51")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"Version":"28.0.0","ApiVersion":"1.51","Os":"linux","Arch":"amd64"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to split daemon address: %v", err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("failed to parse daemon port: %v", err)
+	}
+	return host, p
+}
+
+func TestNewClientTCP(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	host, port := newTLSDaemon(t, ca)
+
+	certPEM, keyPEM := ca.issue(t, 3, x509.ExtKeyUsageClientAuth)
+	files := vault.TLSFiles{
+		CA:   writeFile(t, dir, "ca.pem", ca.pem),
+		Cert: writeFile(t, dir, "cert.pem", certPEM),
+		Key:  writeFile(t, dir, "key.pem", keyPEM),
+	}
+
+	node, err := NewServerClient(host, vault.Server{Port: port, Transport: vault.TransportTCP, TLS: &files})
+	if err != nil {
+		t.Fatalf("NewServerClient failed: %v", err)
+	}
+	defer node.Close()
+
+	res, err := node.ServerVersion(context.Background(), client.ServerVersionOptions{})
+	if err != nil {
+		t.Fatalf("ServerVersion failed: %v", err)
+	}
+	if res.Version != "28.0.0" {
+		t.Errorf("expected daemon version 28.0.0, got %q", res.Version)
+	}
+
+	// without the client certificate the daemon refuses the handshake
+	anonymous, err := NewClientTCP(host, port, vault.TLSFiles{CA: files.CA})
+	if err != nil {
+		t.Fatalf("NewClientTCP failed: %v", err)
+	}
+	defer anonymous.Close()
+	if _, err := anonymous.ServerVersion(context.Background(), client.ServerVersionOptions{}); err == nil {
+		t.Error("expected the daemon to reject a client without a certificate")
+	}
+
+	// without the CA the daemon certificate isn't trusted
+	untrusted, err := NewClientTCP(host, port, vault.TLSFiles{Cert: files.Cert, Key: files.Key})
+	if err != nil {
+		t.Fatalf("NewClientTCP failed: %v", err)
+	}
+	defer untrusted.Close()
+	if _, err := untrusted.ServerVersion(context.Background(), client.ServerVersionOptions{}); err == nil {
+		t.Error("expected the daemon certificate to be rejected without the CA")
+	}
+
+	if _, err := NewClientTCP(host, port, vault.TLSFiles{Cert: files.Cert}); err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Errorf("expected an error for a certificate without key, got %v", err)
+	}
+}
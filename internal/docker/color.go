@@ -0,0 +1,28 @@
+package docker
+
+const (
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+var colorEnabled bool
+
+// SetColor turns ANSI colors in status output on or off. Colors are off by
+// default, the root command enables them for terminals.
+func SetColor(enabled bool) {
+	colorEnabled = enabled
+}
+
+func colorize(color, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// WarningPrefix returns "Warning:", yellow when colors are enabled
+func WarningPrefix() string {
+	return colorize(ansiYellow, "Warning:")
+}
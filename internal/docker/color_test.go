@@ -0,0 +1,20 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	t.Cleanup(func() { SetColor(false) })
+
+	if got := WarningPrefix(); got != "Warning:" {
+		t.Errorf("expected plain prefix with colors off, got %q", got)
+	}
+
+	SetColor(true)
+	got := colorize(ansiGreen, "✓ converged")
+	if !strings.HasPrefix(got, ansiGreen) || !strings.HasSuffix(got, ansiReset) {
+		t.Errorf("expected green escape codes, got %q", got)
+	}
+}
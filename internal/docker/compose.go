@@ -4,16 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"maps"
+	"math"
 	"net/netip"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/dotenv"
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/distribution/reference"
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/mount"
 	"github.com/moby/moby/api/types/network"
@@ -27,14 +35,49 @@ const (
 	DefaultNetworkDriver = "overlay"
 )
 
-func LoadCompose(ctx context.Context, paths ...string) (types.Project, error) {
-	projectOptions, err := cli.NewProjectOptions(
-		paths,
+// LabelManaged marks services deployed by cicdez, so prune leaves alone
+// services a plain docker stack deploy put in the same namespace
+const LabelManaged = "io.cicdez.managed"
+
+// stackLabel is the label that ties objects to their stack, LabelNamespace
+// unless changed with SetStackLabel
+var stackLabel = LabelNamespace
+
+// SetStackLabel changes the label objects are tied to their stack with.
+// Stacks under another label are invisible to docker stack and to cicdez
+// runs using a different one.
+func SetStackLabel(label string) {
+	stackLabel = label
+}
+
+// LoadCompose loads and interpolates the compose files. Variables in env
+// (KEY=VALUE) take precedence over the OS environment and the default .env.
+func LoadCompose(ctx context.Context, env []string, paths ...string) (types.Project, error) {
+	return loadCompose(ctx, env, "", true, paths)
+}
+
+// loadCompose loads the compose files as the project name, or the name
+// compose-go derives when it is empty
+func loadCompose(ctx context.Context, env []string, name string, resolvePaths bool, paths []string) (types.Project, error) {
+	opts := []cli.ProjectOptionsFn{
+		cli.WithName(name),
+		cli.WithEnv(env),
 		cli.WithOsEnv,
 		cli.WithDotEnv,
 		cli.WithInterpolation(true),
-		cli.WithResolvedPaths(true),
-	)
+		cli.WithResolvedPaths(resolvePaths),
+	}
+	// a compose file from stdin has no directory of its own, relative
+	// paths in it resolve against the current one
+	if len(paths) > 0 && isStdinCompose(paths[0]) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return types.Project{}, fmt.Errorf("failed to get current directory: %w", err)
+		}
+		opts = append(opts, cli.WithWorkingDirectory(cwd))
+	}
+
+	projectOptions, err := cli.NewProjectOptions(paths, opts...)
 	if err != nil {
 		return types.Project{}, fmt.Errorf("failed to create project options: %w", err)
 	}
@@ -45,17 +88,195 @@ func LoadCompose(ctx context.Context, paths ...string) (types.Project, error) {
 
 	composeProject, err := projectOptions.LoadProject(ctx)
 	if err != nil {
-		return types.Project{}, fmt.Errorf("error to load project: %w", err)
+		return types.Project{}, fmt.Errorf("%w: %w", ErrLoadProject, err)
 	}
 
 	return *composeProject, nil
 }
 
+// SelectProfiles enables the services of the given compose profiles next to
+// those without any, compose-go loads only the latter. "*" enables every
+// profile.
+func SelectProfiles(project *types.Project, profiles []string) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	selected, err := project.WithProfiles(profiles)
+	if err != nil {
+		return err
+	}
+	*project = *selected
+	return nil
+}
+
+// SelectServices narrows the project to the only services, or to every
+// service but the skip ones. Services picked with only must come with the
+// services they require through depends_on.
+func SelectServices(project *types.Project, only, skip []string) error {
+	for _, name := range slices.Concat(only, skip) {
+		if _, ok := project.Services[name]; !ok {
+			return fmt.Errorf("no such service: %s", name)
+		}
+	}
+	if len(skip) > 0 {
+		*project = *project.WithServicesDisabled(skip...)
+	}
+	if len(only) == 0 {
+		return nil
+	}
+
+	for _, name := range only {
+		deps := project.Services[name].DependsOn
+		for _, dep := range slices.Sorted(maps.Keys(deps)) {
+			// dependencies outside the project (e.g. other profiles) aren't deployed anyway
+			if _, ok := project.Services[dep]; !ok || !deps[dep].Required || slices.Contains(only, dep) {
+				continue
+			}
+			return fmt.Errorf("service %s depends on %s, add --only %s", name, dep, dep)
+		}
+	}
+	selected, err := project.WithSelectedServices(only, types.IgnoreDependencies)
+	if err != nil {
+		return err
+	}
+	*project = *selected
+	return nil
+}
+
+// OverrideImages replaces the image of services, service name to image
+// reference. An overridden service is deployed with that image as is, so its
+// build section is dropped.
+func OverrideImages(project *types.Project, images map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(images)) {
+		svc, ok := project.Services[name]
+		if !ok {
+			return fmt.Errorf("no such service: %s", name)
+		}
+		if _, err := reference.ParseNormalizedNamed(images[name]); err != nil {
+			return fmt.Errorf("invalid image for service %s: %w", name, err)
+		}
+		svc.Image = images[name]
+		svc.Build = nil
+		project.Services[name] = svc
+	}
+	return nil
+}
+
+// StdinCompose is the compose file path that stands for stdin
+const StdinCompose = "-"
+
+const stdinComposePattern = "cicdez-stdin-*.yaml"
+
+// ReadComposeStdin copies in to a temp file and puts it in place of "-" in
+// paths, compose-go loads files by path and a project may be loaded twice.
+// The returned func removes the file.
+func ReadComposeStdin(in io.Reader, paths []string) ([]string, func(), error) {
+	i := slices.Index(paths, StdinCompose)
+	if i < 0 {
+		return paths, func() {}, nil
+	}
+	if slices.Index(paths[i+1:], StdinCompose) >= 0 {
+		return nil, nil, errors.New("the compose file can be read from stdin only once")
+	}
+
+	f, err := os.CreateTemp("", stdinComposePattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create compose file: %w", err)
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := io.Copy(f, in); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read compose file from stdin: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write compose file: %w", err)
+	}
+
+	paths = slices.Clone(paths)
+	paths[i] = f.Name()
+	return paths, cleanup, nil
+}
+
+func isStdinCompose(path string) bool {
+	matched, _ := filepath.Match(filepath.Join(os.TempDir(), stdinComposePattern), path)
+	return matched
+}
+
+// LoadEnvFiles reads dotenv files for interpolation, later files win. Values
+// may reference the OS environment.
+func LoadEnvFiles(files ...string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	current := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			current[k] = v
+		}
+	}
+
+	vars, err := dotenv.GetEnvFromFile(current, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// SetVariables adds KEY=VALUE assignments to env, replacing variables env
+// already sets, so they win over env files and the OS environment alike
+func SetVariables(env []string, sets []string) ([]string, error) {
+	if len(sets) == 0 {
+		return env, nil
+	}
+
+	vars := make(map[string]string, len(env)+len(sets))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		vars[k] = v
+	}
+	for _, kv := range sets {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid --set value %q, expected KEY=VALUE", kv)
+		}
+		vars[k] = v
+	}
+
+	result := make([]string, 0, len(vars))
+	for k, v := range vars {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
 // ScopeName adds the stack namespace prefix to a name
 func ScopeName(stack, name string) string {
 	return stack + "_" + name
 }
 
+// objectName resolves the swarm name of a top-level secret or config: an
+// explicit (possibly interpolated) name wins, external objects fall back to
+// their key, everything else is scoped to the stack
+func objectName(stack, key, name string, external bool) string {
+	if name != "" {
+		return name
+	}
+	if external {
+		return key
+	}
+	return ScopeName(stack, key)
+}
+
 func GetServicesDeclaredNetworks(serviceConfigs types.Services) map[string]struct{} {
 	serviceNetworks := map[string]struct{}{}
 	for _, serviceConfig := range serviceConfigs {
@@ -70,7 +291,11 @@ func GetServicesDeclaredNetworks(serviceConfigs types.Services) map[string]struc
 	return serviceNetworks
 }
 
-func ConvertNetworks(stack string, networks types.Networks, serviceNetworks map[string]struct{}) (map[string]client.NetworkCreateOptions, []string) {
+// localNetworkDrivers can't be created with swarm scope, services can only
+// join their predefined networks as external ones
+var localNetworkDrivers = map[string]bool{"bridge": true, "host": true, "none": true}
+
+func ConvertNetworks(stack string, networks types.Networks, serviceNetworks map[string]struct{}) (map[string]client.NetworkCreateOptions, []string, error) {
 	result := make(map[string]client.NetworkCreateOptions)
 	var externalNetworks []string
 
@@ -96,20 +321,27 @@ func ConvertNetworks(stack string, networks types.Networks, serviceNetworks map[
 		opts := client.NetworkCreateOptions{
 			Labels:     AddStackLabel(stack, net.Labels),
 			Driver:     net.Driver,
+			Scope:      "swarm",
+			EnableIPv4: net.EnableIPv4,
+			EnableIPv6: net.EnableIPv6,
 			Options:    net.DriverOpts,
 			Internal:   net.Internal,
 			Attachable: net.Attachable,
 		}
+		if localNetworkDrivers[opts.Driver] {
+			return nil, nil, fmt.Errorf("network %s: driver %s only exists on a single node, stack networks need a swarm scoped driver like overlay, or declare it external", name, opts.Driver)
+		}
 
 		if net.Ipam.Driver != "" || len(net.Ipam.Config) > 0 {
 			opts.IPAM = &network.IPAM{
 				Driver: net.Ipam.Driver,
 			}
-			for _, ipamConfig := range net.Ipam.Config {
-				sn, _ := netip.ParsePrefix(ipamConfig.Subnet)
-				opts.IPAM.Config = append(opts.IPAM.Config, network.IPAMConfig{
-					Subnet: sn,
-				})
+			for _, pool := range net.Ipam.Config {
+				ipamConfig, err := convertIPAMPool(pool)
+				if err != nil {
+					return nil, nil, fmt.Errorf("network %s: %w", name, err)
+				}
+				opts.IPAM.Config = append(opts.IPAM.Config, ipamConfig)
 			}
 		}
 
@@ -120,32 +352,85 @@ func ConvertNetworks(stack string, networks types.Networks, serviceNetworks map[
 		result[netName] = opts
 	}
 
-	return result, externalNetworks
+	return result, externalNetworks, nil
 }
 
-func ConvertSecrets(stack string, secrets types.Secrets) ([]swarm.SecretSpec, error) {
+func convertIPAMPool(pool *types.IPAMPool) (network.IPAMConfig, error) {
+	var config network.IPAMConfig
+	if pool == nil {
+		return config, nil
+	}
+
+	var err error
+	if pool.Subnet != "" {
+		if config.Subnet, err = netip.ParsePrefix(pool.Subnet); err != nil {
+			return config, fmt.Errorf("invalid subnet %q: %w", pool.Subnet, err)
+		}
+	}
+	if pool.IPRange != "" {
+		if config.IPRange, err = netip.ParsePrefix(pool.IPRange); err != nil {
+			return config, fmt.Errorf("invalid ip_range %q: %w", pool.IPRange, err)
+		}
+	}
+	if pool.Gateway != "" {
+		if config.Gateway, err = netip.ParseAddr(pool.Gateway); err != nil {
+			return config, fmt.Errorf("invalid gateway %q: %w", pool.Gateway, err)
+		}
+	}
+	if len(pool.AuxiliaryAddresses) > 0 {
+		config.AuxAddress = make(map[string]netip.Addr, len(pool.AuxiliaryAddresses))
+		for host, ip := range pool.AuxiliaryAddresses {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				return config, fmt.Errorf("invalid aux address %q for %s: %w", ip, host, err)
+			}
+			config.AuxAddress[host] = addr
+		}
+	}
+
+	return config, nil
+}
+
+// objectData returns the payload of a file, environment or inline secret or
+// config, environment sources are looked up in env
+func objectData(kind, name string, obj types.FileObjectConfig, env types.Mapping) ([]byte, error) {
+	switch {
+	case obj.File != "":
+		data, err := os.ReadFile(obj.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s file %s: %w", kind, obj.File, err)
+		}
+		return data, nil
+	case obj.Environment != "":
+		value, ok := env[obj.Environment]
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s for %s %s is not set", obj.Environment, kind, name)
+		}
+		return []byte(value), nil
+	case obj.Content != "":
+		return []byte(obj.Content), nil
+	}
+	return nil, nil
+}
+
+// ConvertSecrets builds the specs of the stack's own secrets sorted by name,
+// env holds the variables environment-sourced secrets are read from
+func ConvertSecrets(stack string, secrets types.Secrets, env types.Mapping) ([]swarm.SecretSpec, error) {
 	var result []swarm.SecretSpec
 
-	for name, secret := range secrets {
+	for _, name := range slices.Sorted(maps.Keys(secrets)) {
+		secret := secrets[name]
 		if bool(secret.External) {
 			continue
 		}
 
-		secretName := ScopeName(stack, name)
-		if secret.Name != "" {
-			secretName = secret.Name
-		}
+		secretName := objectName(stack, name, secret.Name, false)
 
 		var data []byte
-		var err error
 		if secret.Driver == "" {
-			if secret.File != "" {
-				data, err = os.ReadFile(secret.File)
-				if err != nil {
-					return nil, fmt.Errorf("failed to read secret file %s: %w", secret.File, err)
-				}
-			} else if secret.Content != "" {
-				data = []byte(secret.Content)
+			var err error
+			if data, err = objectData("secret", name, types.FileObjectConfig(secret), env); err != nil {
+				return nil, err
 			}
 		}
 
@@ -163,41 +448,38 @@ func ConvertSecrets(stack string, secrets types.Secrets) ([]swarm.SecretSpec, er
 				Options: secret.DriverOpts,
 			}
 		}
-		if secret.TemplateDriver != "" {
-			spec.Templating = &swarm.Driver{
-				Name: secret.TemplateDriver,
-			}
+		templating, err := templateDriver("secret", name, secret.TemplateDriver)
+		if err != nil {
+			return nil, err
 		}
+		spec.Templating = templating
 
 		result = append(result, spec)
 	}
 
+	// explicit names can sort differently from the compose keys
+	slices.SortFunc(result, func(a, b swarm.SecretSpec) int { return strings.Compare(a.Name, b.Name) })
 	return result, nil
 }
 
-func ConvertConfigs(stack string, configs types.Configs) ([]swarm.ConfigSpec, error) {
+// ConvertConfigs builds the specs of the stack's own configs sorted by name,
+// env holds the variables environment-sourced configs are read from
+func ConvertConfigs(stack string, configs types.Configs, env types.Mapping) ([]swarm.ConfigSpec, error) {
 	var result []swarm.ConfigSpec
 
-	for name, config := range configs {
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		config := configs[name]
 		if bool(config.External) {
 			continue
 		}
 
-		configName := ScopeName(stack, name)
-		if config.Name != "" {
-			configName = config.Name
-		}
+		configName := objectName(stack, name, config.Name, false)
 
 		var data []byte
-		var err error
 		if config.Driver == "" {
-			if config.File != "" {
-				data, err = os.ReadFile(config.File)
-				if err != nil {
-					return nil, fmt.Errorf("failed to read config file %s: %w", config.File, err)
-				}
-			} else if config.Content != "" {
-				data = []byte(config.Content)
+			var err error
+			if data, err = objectData("config", name, types.FileObjectConfig(config), env); err != nil {
+				return nil, err
 			}
 		}
 
@@ -209,23 +491,170 @@ func ConvertConfigs(stack string, configs types.Configs) ([]swarm.ConfigSpec, er
 			Data: data,
 		}
 
-		if config.TemplateDriver != "" {
-			spec.Templating = &swarm.Driver{
-				Name: config.TemplateDriver,
-			}
+		templating, err := templateDriver("config", name, config.TemplateDriver)
+		if err != nil {
+			return nil, err
 		}
+		spec.Templating = templating
 
 		result = append(result, spec)
 	}
 
+	slices.SortFunc(result, func(a, b swarm.ConfigSpec) int { return strings.Compare(a.Name, b.Name) })
 	return result, nil
 }
 
+// templateDrivers are the templating drivers swarm implements
+var templateDrivers = []string{"golang"}
+
+// templateDriver returns the templating of a secret or config, none for an
+// empty driver. Swarm doesn't reject other names, the object would just
+// not be templated.
+func templateDriver(kind, name, driver string) (*swarm.Driver, error) {
+	if driver == "" {
+		return nil, nil
+	}
+	if !slices.Contains(templateDrivers, driver) {
+		return nil, fmt.Errorf("%s %s: unknown template_driver %q, supported: %s", kind, name, driver, strings.Join(templateDrivers, ", "))
+	}
+	return &swarm.Driver{Name: driver}, nil
+}
+
+// maxObjectSize is the largest secret or config payload swarm accepts, and
+// from objectSizeWarning on deploy warns that one is getting close
+const (
+	maxObjectSize     = 500 * 1024
+	objectSizeWarning = maxObjectSize * 8 / 10
+)
+
+// checkObjectSizes fails on secrets and configs swarm would reject for their
+// size, before any of them is created, and warns about those close to it.
+// Generated sensitive and local_configs objects are checked like the rest.
+func checkObjectSizes(secrets []swarm.SecretSpec, configs []swarm.ConfigSpec, quiet bool, out io.Writer) error {
+	type object struct {
+		kind, name string
+		size       int
+	}
+	var objects []object
+	for _, spec := range secrets {
+		objects = append(objects, object{"secret", spec.Name, len(spec.Data)})
+	}
+	for _, spec := range configs {
+		objects = append(objects, object{"config", spec.Name, len(spec.Data)})
+	}
+
+	var errs []error
+	for _, o := range objects {
+		switch {
+		case o.size > maxObjectSize:
+			errs = append(errs, fmt.Errorf("%s %s is %s, over the %s swarm limit", o.kind, o.name, formatObjectSize(o.size), formatObjectSize(maxObjectSize)))
+		case o.size >= objectSizeWarning && !quiet:
+			fmt.Fprintf(out, "%s %s %s is %s, close to the %s swarm limit\n", WarningPrefix(), o.kind, o.name, formatObjectSize(o.size), formatObjectSize(maxObjectSize))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func formatObjectSize(size int) string {
+	if size%1024 == 0 {
+		return fmt.Sprintf("%dKiB", size/1024)
+	}
+	return fmt.Sprintf("%.1fKiB", float64(size)/1024)
+}
+
+// fileTarget is the mode and owner of a mounted secret or config whose
+// reference leaves them out
+type fileTarget struct {
+	mode os.FileMode
+	uid  string
+	gid  string
+}
+
+// fileTargetDefaults reads x-cicdez.secret_defaults and config_defaults of
+// the project, what they leave out stays 0444 owned by root
+func fileTargetDefaults(extensions types.Extensions) (secrets, configs fileTarget, err error) {
+	secrets = fileTarget{mode: 0o444, uid: "0", gid: "0"}
+	configs = secrets
+
+	ext, ok := extensions[ExtensionKey]
+	if !ok {
+		return secrets, configs, nil
+	}
+	settings, ok := ext.(map[string]any)
+	if !ok {
+		return secrets, configs, fmt.Errorf("%s must be a mapping", ExtensionKey)
+	}
+	if secrets, err = parseFileTarget(settings, "secret_defaults", secrets); err != nil {
+		return secrets, configs, err
+	}
+	if configs, err = parseFileTarget(settings, "config_defaults", configs); err != nil {
+		return secrets, configs, err
+	}
+	return secrets, configs, nil
+}
+
+func parseFileTarget(settings map[string]any, key string, target fileTarget) (fileTarget, error) {
+	value, ok := settings[key]
+	if !ok {
+		return target, nil
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return target, fmt.Errorf("%s.%s must be a mapping", ExtensionKey, key)
+	}
+	for name, v := range fields {
+		switch name {
+		case "mode":
+			// yaml reads 0400 as a number already, "0400" is parsed here
+			var mode uint64
+			var err error
+			switch v := v.(type) {
+			case int:
+				mode = uint64(v)
+			case string:
+				mode, err = strconv.ParseUint(strings.TrimPrefix(v, "0o"), 8, 32)
+			default:
+				err = errors.New("not a number")
+			}
+			if err != nil || mode > 0o777 {
+				return target, fmt.Errorf("invalid %s.%s.mode %v, expected an octal file mode such as 0400", ExtensionKey, key, v)
+			}
+			target.mode = os.FileMode(mode)
+		case "uid", "gid":
+			var id string
+			switch v := v.(type) {
+			case int:
+				id = strconv.Itoa(v)
+			case string:
+				id = v
+			}
+			if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+				return target, fmt.Errorf("invalid %s.%s.%s %v, expected a numeric id", ExtensionKey, key, name, v)
+			}
+			if name == "uid" {
+				target.uid = id
+			} else {
+				target.gid = id
+			}
+		default:
+			return target, fmt.Errorf("unknown %s.%s field %q, expected mode, uid or gid", ExtensionKey, key, name)
+		}
+	}
+	return target, nil
+}
+
+// ConvertServices converts every service of the project. Secret and config
+// references without a mode, uid or gid get the project's x-cicdez defaults.
 func ConvertServices(ctx context.Context, apiClient client.APIClient, stack string, project types.Project) (map[string]swarm.ServiceSpec, error) {
+	secretDefaults, configDefaults, err := fileTargetDefaults(project.Extensions)
+	if err != nil {
+		return nil, err
+	}
+
 	result := make(map[string]swarm.ServiceSpec)
 
 	for _, svc := range project.Services {
-		spec, err := convertService(ctx, apiClient, stack, svc, project.Networks, project.Volumes, project.Secrets, project.Configs)
+		spec, err := convertService(ctx, apiClient, stack, svc, project.Networks, project.Volumes, project.Secrets, project.Configs, secretDefaults, configDefaults)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert service %s: %w", svc.Name, err)
 		}
@@ -235,13 +664,8 @@ func ConvertServices(ctx context.Context, apiClient client.APIClient, stack stri
 	return result, nil
 }
 
-func convertService(ctx context.Context, apiClient client.APIClient, stack string, svc types.ServiceConfig, networks types.Networks, volumes types.Volumes, secrets types.Secrets, configs types.Configs) (swarm.ServiceSpec, error) {
-	var deployLabels types.Labels
-	if svc.Deploy != nil {
-		deployLabels = svc.Deploy.Labels
-	}
-	serviceLabels := AddStackLabel(stack, deployLabels)
-	serviceLabels[LabelImage] = svc.Image
+func convertService(ctx context.Context, apiClient client.APIClient, stack string, svc types.ServiceConfig, networks types.Networks, volumes types.Volumes, secrets types.Secrets, configs types.Configs, secretDefaults, configDefaults fileTarget) (swarm.ServiceSpec, error) {
+	serviceLabels, containerLabels := LabelsFor(stack, svc)
 
 	healthcheck, err := convertHealthcheck(svc.HealthCheck)
 	if err != nil {
@@ -251,21 +675,44 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 	var stopGracePeriod *time.Duration
 	if svc.StopGracePeriod != nil {
 		d := time.Duration(*svc.StopGracePeriod)
+		if d < 0 {
+			return swarm.ServiceSpec{}, fmt.Errorf("stop_grace_period can't be negative, got %s", d)
+		}
 		stopGracePeriod = &d
 	}
 
+	if err := checkStopSignal(svc.StopSignal); err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
+	dnsConfig, err := convertDNSConfig(svc.DNS, svc.DNSSearch, svc.DNSOpts)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
+	sysctls, err := convertSysctls(svc.Sysctls)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
 	capAdd, capDrop := effectiveCapAddCapDrop(svc.CapAdd, svc.CapDrop)
 
+	// container paths are POSIX regardless of the host running cicdez
+	workingDir := svc.WorkingDir
+	if workingDir != "" {
+		workingDir = path.Clean(workingDir)
+	}
+
 	containerSpec := &swarm.ContainerSpec{
 		Image:           svc.Image,
 		Command:         svc.Entrypoint,
 		Args:            svc.Command,
 		Hostname:        svc.Hostname,
 		Hosts:           convertExtraHosts(svc.ExtraHosts),
-		DNSConfig:       convertDNSConfig(svc.DNS, svc.DNSSearch),
+		DNSConfig:       dnsConfig,
 		Healthcheck:     healthcheck,
-		Labels:          AddStackLabel(stack, svc.Labels),
-		Dir:             svc.WorkingDir,
+		Labels:          containerLabels,
+		Dir:             workingDir,
 		User:            svc.User,
 		StopGracePeriod: stopGracePeriod,
 		StopSignal:      svc.StopSignal,
@@ -274,7 +721,7 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 		ReadOnly:        svc.ReadOnly,
 		Isolation:       container.Isolation(svc.Isolation),
 		Init:            svc.Init,
-		Sysctls:         svc.Sysctls,
+		Sysctls:         sysctls,
 		CapabilityAdd:   capAdd,
 		CapabilityDrop:  capDrop,
 		Ulimits:         convertUlimits(svc.Ulimits),
@@ -320,12 +767,7 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 			return swarm.ServiceSpec{}, fmt.Errorf("secret %s not found", secretRef.Source)
 		}
 
-		secretName := ScopeName(stack, secretRef.Source)
-		if secret.Name != "" {
-			secretName = secret.Name
-		} else if secret.External {
-			secretName = secretRef.Source
-		}
+		secretName := objectName(stack, secretRef.Source, secret.Name, bool(secret.External))
 
 		secretID, err := lookupSecretID(ctx, apiClient, secretName)
 		if err != nil {
@@ -337,18 +779,18 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 			target = secretRef.Source
 		}
 
-		var mode os.FileMode = 0o444
+		mode := secretDefaults.mode
 		if secretRef.Mode != nil {
 			mode = os.FileMode(*secretRef.Mode)
 		}
 
 		uid := secretRef.UID
 		if uid == "" {
-			uid = "0"
+			uid = secretDefaults.uid
 		}
 		gid := secretRef.GID
 		if gid == "" {
-			gid = "0"
+			gid = secretDefaults.gid
 		}
 
 		containerSpec.Secrets = append(containerSpec.Secrets, &swarm.SecretReference{
@@ -369,12 +811,7 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 			return swarm.ServiceSpec{}, fmt.Errorf("config %s not found", configRef.Source)
 		}
 
-		configName := ScopeName(stack, configRef.Source)
-		if config.Name != "" {
-			configName = config.Name
-		} else if config.External {
-			configName = configRef.Source
-		}
+		configName := objectName(stack, configRef.Source, config.Name, bool(config.External))
 
 		configID, err := lookupConfigID(ctx, apiClient, configName)
 		if err != nil {
@@ -386,18 +823,18 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 			target = "/" + configRef.Source
 		}
 
-		var mode os.FileMode = 0o444
+		mode := configDefaults.mode
 		if configRef.Mode != nil {
 			mode = os.FileMode(*configRef.Mode)
 		}
 
 		uid := configRef.UID
 		if uid == "" {
-			uid = "0"
+			uid = configDefaults.uid
 		}
 		gid := configRef.GID
 		if gid == "" {
-			gid = "0"
+			gid = configDefaults.gid
 		}
 
 		containerSpec.Configs = append(containerSpec.Configs, &swarm.ConfigReference{
@@ -508,28 +945,24 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 			MaxReplicas: svc.Deploy.Placement.MaxReplicas,
 		}
 	} else {
-		restartPolicy, _ = convertRestartPolicy(svc.Restart, nil)
+		var err error
+		restartPolicy, err = convertRestartPolicy(svc.Restart, nil)
+		if err != nil {
+			return swarm.ServiceSpec{}, err
+		}
+	}
+	if mode.ReplicatedJob != nil || mode.GlobalJob != nil {
+		var err error
+		if restartPolicy, err = jobRestartPolicy(restartPolicy); err != nil {
+			return swarm.ServiceSpec{}, err
+		}
 	}
 	spec.TaskTemplate.RestartPolicy = restartPolicy
 
 	if len(svc.Ports) > 0 || endpointMode != "" {
-		portConfigs := make([]swarm.PortConfig, 0, len(svc.Ports))
-		for _, port := range svc.Ports {
-			var publishedPort uint32
-			if port.Published != "" {
-				p, err := strconv.ParseUint(port.Published, 10, 32)
-				if err == nil {
-					publishedPort = uint32(p)
-				}
-			}
-
-			portConfig := swarm.PortConfig{
-				TargetPort:    port.Target,
-				PublishedPort: publishedPort,
-				Protocol:      network.IPProtocol(port.Protocol),
-				PublishMode:   swarm.PortConfigPublishMode(port.Mode),
-			}
-			portConfigs = append(portConfigs, portConfig)
+		portConfigs, err := convertPorts(svc.Ports)
+		if err != nil {
+			return swarm.ServiceSpec{}, err
 		}
 
 		sort.Slice(portConfigs, func(i, j int) bool {
@@ -548,6 +981,82 @@ func convertService(ctx context.Context, apiClient client.APIClient, stack strin
 	return spec, nil
 }
 
+// convertPorts expands a published range like 8000-8005 into one port per
+// published port, mapped onto consecutive target ports starting at Target
+func convertPorts(ports []types.ServicePortConfig) ([]swarm.PortConfig, error) {
+	portConfigs := make([]swarm.PortConfig, 0, len(ports))
+	for _, port := range ports {
+		start, end, err := parsePublishedPorts(port.Published)
+		if err != nil {
+			return nil, err
+		}
+
+		// compose-go already splits N:N ranges into single ports, a range
+		// left here publishes every port to the one target
+		for published := start; ; published++ {
+			portConfigs = append(portConfigs, swarm.PortConfig{
+				TargetPort:    port.Target,
+				PublishedPort: published,
+				Protocol:      network.IPProtocol(port.Protocol),
+				PublishMode:   swarm.PortConfigPublishMode(port.Mode),
+			})
+			if published >= end {
+				break
+			}
+		}
+	}
+	return portConfigs, nil
+}
+
+func parsePublishedPorts(published string) (uint32, uint32, error) {
+	if published == "" {
+		return 0, 0, nil
+	}
+
+	startStr, endStr, isRange := strings.Cut(published, "-")
+	start, err := strconv.ParseUint(startStr, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid published port %q", published)
+	}
+	if !isRange {
+		return uint32(start), uint32(start), nil
+	}
+
+	end, err := strconv.ParseUint(endStr, 10, 16)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid published port range %q", published)
+	}
+	return uint32(start), uint32(end), nil
+}
+
+// healthcheckTest returns test in the form swarm expects, a command string
+// given as the only element runs in a shell like the docker CLI does
+func healthcheckTest(test types.HealthCheckTest) ([]string, error) {
+	if len(test) == 0 {
+		return nil, nil
+	}
+	switch test[0] {
+	case "NONE", "CMD", "CMD-SHELL":
+		return test, nil
+	}
+	if len(test) == 1 {
+		return []string{"CMD-SHELL", test[0]}, nil
+	}
+	return nil, fmt.Errorf("invalid healthcheck test %q: must start with CMD, CMD-SHELL or NONE", []string(test))
+}
+
+// healthcheckDuration rejects negative durations, 0 leaves docker's default
+func healthcheckDuration(name string, d *types.Duration) (time.Duration, error) {
+	if d == nil {
+		return 0, nil
+	}
+	value := time.Duration(*d)
+	if value < 0 {
+		return 0, fmt.Errorf("invalid healthcheck %s %s: must not be negative", name, value)
+	}
+	return value, nil
+}
+
 func convertHealthcheck(healthcheck *types.HealthCheckConfig) (*container.HealthConfig, error) {
 	if healthcheck == nil {
 		return nil, nil
@@ -562,27 +1071,35 @@ func convertHealthcheck(healthcheck *types.HealthCheckConfig) (*container.Health
 		}, nil
 	}
 
-	var timeout, interval, startPeriod, startInterval time.Duration
-	var retries int
+	test, err := healthcheckTest(healthcheck.Test)
+	if err != nil {
+		return nil, err
+	}
 
-	if healthcheck.Timeout != nil {
-		timeout = time.Duration(*healthcheck.Timeout)
+	timeout, err := healthcheckDuration("timeout", healthcheck.Timeout)
+	if err != nil {
+		return nil, err
 	}
-	if healthcheck.Interval != nil {
-		interval = time.Duration(*healthcheck.Interval)
+	interval, err := healthcheckDuration("interval", healthcheck.Interval)
+	if err != nil {
+		return nil, err
 	}
-	if healthcheck.StartPeriod != nil {
-		startPeriod = time.Duration(*healthcheck.StartPeriod)
+	startPeriod, err := healthcheckDuration("start_period", healthcheck.StartPeriod)
+	if err != nil {
+		return nil, err
 	}
-	if healthcheck.StartInterval != nil {
-		startInterval = time.Duration(*healthcheck.StartInterval)
+	startInterval, err := healthcheckDuration("start_interval", healthcheck.StartInterval)
+	if err != nil {
+		return nil, err
 	}
+
+	var retries int
 	if healthcheck.Retries != nil {
 		retries = int(*healthcheck.Retries)
 	}
 
 	return &container.HealthConfig{
-		Test:          healthcheck.Test,
+		Test:          test,
 		Timeout:       timeout,
 		Interval:      interval,
 		Retries:       retries,
@@ -600,7 +1117,7 @@ func convertResources(source *types.Resources) *swarm.ResourceRequirements {
 
 	if source.Limits != nil {
 		resources.Limits = &swarm.Limit{
-			NanoCPUs:    int64(source.Limits.NanoCPUs * 1e9),
+			NanoCPUs:    nanoCPUs(source.Limits.NanoCPUs),
 			MemoryBytes: int64(source.Limits.MemoryBytes),
 			Pids:        source.Limits.Pids,
 		}
@@ -620,7 +1137,7 @@ func convertResources(source *types.Resources) *swarm.ResourceRequirements {
 		}
 
 		resources.Reservations = &swarm.Resources{
-			NanoCPUs:         int64(source.Reservations.NanoCPUs * 1e9),
+			NanoCPUs:         nanoCPUs(source.Reservations.NanoCPUs),
 			MemoryBytes:      int64(source.Reservations.MemoryBytes),
 			GenericResources: generic,
 		}
@@ -629,31 +1146,107 @@ func convertResources(source *types.Resources) *swarm.ResourceRequirements {
 	return resources
 }
 
-func convertDNSConfig(dns, dnsSearch []string) *swarm.DNSConfig {
-	if len(dns) == 0 && len(dnsSearch) == 0 {
-		return nil
+// nanoCPUs converts compose cpus to nano CPUs. compose-go keeps them as a
+// float32, multiplying that directly turns 0.065 into 64999996, so go through
+// the shortest decimal form of the value first.
+func nanoCPUs(cpus types.NanoCPUs) int64 {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(cpus), 'f', -1, 32), 64)
+	return int64(math.Round(f * 1e9))
+}
+
+func convertDNSConfig(dns, dnsSearch, dnsOpts []string) (*swarm.DNSConfig, error) {
+	if len(dns) == 0 && len(dnsSearch) == 0 && len(dnsOpts) == 0 {
+		return nil, nil
 	}
 
+	nameservers, err := toNetIPAddrs(dns)
+	if err != nil {
+		return nil, err
+	}
 	return &swarm.DNSConfig{
-		Nameservers: toNetIPAddrs(dns),
+		Nameservers: nameservers,
 		Search:      dnsSearch,
-	}
+		Options:     dnsOpts,
+	}, nil
 }
 
-func toNetIPAddrs(ips []string) []netip.Addr {
+func toNetIPAddrs(ips []string) ([]netip.Addr, error) {
 	if len(ips) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	addrs := make([]netip.Addr, 0, len(ips))
 	for _, ip := range ips {
 		addr, err := netip.ParseAddr(ip)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("invalid dns address %q", ip)
 		}
 		addrs = append(addrs, addr)
 	}
-	return addrs
+	return addrs, nil
+}
+
+// namespacedSysctls are the sysctl prefixes a container can set, the rest
+// apply to the whole node and are refused by the daemon
+var namespacedSysctls = []string{"net.", "kernel.msg", "kernel.sem", "kernel.shm", "fs.mqueue."}
+
+var sysctlKeyPattern = regexp.MustCompile(`^[a-z0-9_-]+(\.[a-zA-Z0-9_-]+)+$`)
+
+// convertSysctls checks the sysctls of a service. compose-go decodes both the
+// map and the list form into a mapping, a list entry without "=" ends up with
+// an empty value and spaces around "=" stay in the key.
+func convertSysctls(sysctls types.Mapping) (map[string]string, error) {
+	if len(sysctls) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(sysctls))
+	for _, key := range slices.Sorted(maps.Keys(sysctls)) {
+		name, value := strings.TrimSpace(key), strings.TrimSpace(sysctls[key])
+		if !sysctlKeyPattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid sysctl %q: expected a dotted name like net.core.somaxconn", key)
+		}
+		if !slices.ContainsFunc(namespacedSysctls, func(prefix string) bool { return strings.HasPrefix(name, prefix) }) {
+			return nil, fmt.Errorf("sysctl %s can't be set per container, only net.*, kernel.msg*, kernel.sem, kernel.shm* and fs.mqueue.* are namespaced", name)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("sysctl %s has no value, expected %s=VALUE", name, name)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+// linuxSignals are the signal names the daemon accepts, without the SIG
+// prefix. Tasks run on Linux whatever platform cicdez runs on.
+var linuxSignals = map[string]bool{
+	"ABRT": true, "ALRM": true, "BUS": true, "CHLD": true, "CLD": true, "CONT": true,
+	"FPE": true, "HUP": true, "ILL": true, "INT": true, "IO": true, "IOT": true,
+	"KILL": true, "PIPE": true, "POLL": true, "PROF": true, "PWR": true, "QUIT": true,
+	"SEGV": true, "STKFLT": true, "STOP": true, "SYS": true, "TERM": true, "TRAP": true,
+	"TSTP": true, "TTIN": true, "TTOU": true, "URG": true, "USR1": true, "USR2": true,
+	"VTALRM": true, "WINCH": true, "XCPU": true, "XFSZ": true, "RTMIN": true, "RTMAX": true,
+}
+
+var realtimeSignalPattern = regexp.MustCompile(`^RTMIN\+([1-9]|1[0-5])$|^RTMAX-([1-9]|1[0-4])$`)
+
+// checkStopSignal makes sure stop_signal names a signal, the daemon would
+// otherwise only fail the tasks at stop time. Names are matched like the
+// daemon does, case-insensitive and with or without SIG, numbers from 1 to 64.
+func checkStopSignal(signal string) error {
+	if signal == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(signal); err == nil {
+		if n < 1 || n > 64 {
+			return fmt.Errorf("invalid stop_signal %s: signal numbers go from 1 to 64", signal)
+		}
+		return nil
+	}
+	name := strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if !linuxSignals[name] && !realtimeSignalPattern.MatchString(name) {
+		return fmt.Errorf("invalid stop_signal %q: expected a signal name like SIGTERM or a number", signal)
+	}
+	return nil
 }
 
 func convertUlimits(ulimits map[string]*types.UlimitsConfig) []*container.Ulimit {
@@ -694,6 +1287,24 @@ func convertExtraHosts(extraHosts types.HostsList) []string {
 	return hosts
 }
 
+// jobRestartPolicy adapts a restart policy to the job modes. A job that
+// restarts on any exit never completes, so swarm rejects it, and without a
+// policy a failed job is retried like the docker CLI does.
+func jobRestartPolicy(policy *swarm.RestartPolicy) (*swarm.RestartPolicy, error) {
+	if policy == nil {
+		return &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionOnFailure}, nil
+	}
+	switch policy.Condition {
+	case "":
+		p := *policy
+		p.Condition = swarm.RestartPolicyConditionOnFailure
+		return &p, nil
+	case swarm.RestartPolicyConditionAny:
+		return nil, errors.New("jobs can't restart on any exit, use restart on-failure or no")
+	}
+	return policy, nil
+}
+
 func convertDeployMode(mode string, replicas *int) (swarm.ServiceMode, error) {
 	serviceMode := swarm.ServiceMode{}
 
@@ -731,9 +1342,26 @@ func convertDeployMode(mode string, replicas *int) (swarm.ServiceMode, error) {
 	return serviceMode, nil
 }
 
+// serviceModeName maps a swarm service mode back to its deploy.mode value
+func serviceModeName(mode swarm.ServiceMode) string {
+	switch {
+	case mode.GlobalJob != nil:
+		return "global-job"
+	case mode.Global != nil:
+		return "global"
+	case mode.ReplicatedJob != nil:
+		return "replicated-job"
+	default:
+		return "replicated"
+	}
+}
+
+// convertRestartPolicy maps deploy.restart_policy, or the service level
+// restart when there is none. An unset restart leaves swarm's default of
+// restarting on any exit, "no" has to be spelled out as condition none.
 func convertRestartPolicy(restart string, source *types.RestartPolicy) (*swarm.RestartPolicy, error) {
 	if source == nil {
-		if restart == "" || restart == "no" {
+		if restart == "" {
 			return nil, nil
 		}
 
@@ -748,6 +1376,10 @@ func convertRestartPolicy(restart string, source *types.RestartPolicy) (*swarm.R
 		}
 
 		switch name {
+		case "no", "none":
+			return &swarm.RestartPolicy{
+				Condition: swarm.RestartPolicyConditionNone,
+			}, nil
 		case "always", "unless-stopped":
 			return &swarm.RestartPolicy{
 				Condition: swarm.RestartPolicyConditionAny,
@@ -762,6 +1394,15 @@ func convertRestartPolicy(restart string, source *types.RestartPolicy) (*swarm.R
 		}
 	}
 
+	condition := swarm.RestartPolicyCondition(source.Condition)
+	switch condition {
+	case "", swarm.RestartPolicyConditionNone, swarm.RestartPolicyConditionOnFailure, swarm.RestartPolicyConditionAny:
+	case "no":
+		condition = swarm.RestartPolicyConditionNone
+	default:
+		return nil, fmt.Errorf("unknown restart_policy condition: %s, expected none, on-failure or any", source.Condition)
+	}
+
 	var delay, window *time.Duration
 	if source.Delay != nil {
 		d := time.Duration(*source.Delay)
@@ -773,7 +1414,7 @@ func convertRestartPolicy(restart string, source *types.RestartPolicy) (*swarm.R
 	}
 
 	return &swarm.RestartPolicy{
-		Condition:   swarm.RestartPolicyCondition(source.Condition),
+		Condition:   condition,
 		Delay:       delay,
 		MaxAttempts: source.MaxAttempts,
 		Window:      window,
@@ -875,10 +1516,25 @@ func capabilitiesMap(caps []string) map[string]bool {
 	return normalized
 }
 
+// LabelsFor returns the labels of the swarm service and of its containers.
+// deploy.labels go on the service and labels on the containers, both get the
+// stack namespace, which a user label can't override, and only the service
+// records the image it was deployed with and the cicdez marker.
+func LabelsFor(stack string, svc types.ServiceConfig) (service, container map[string]string) {
+	var deployLabels types.Labels
+	if svc.Deploy != nil {
+		deployLabels = svc.Deploy.Labels
+	}
+	service = AddStackLabel(stack, deployLabels)
+	service[LabelImage] = svc.Image
+	service[LabelManaged] = "true"
+	return service, AddStackLabel(stack, svc.Labels)
+}
+
 func AddStackLabel(stack string, labels types.Labels) map[string]string {
 	result := make(map[string]string)
 	maps.Copy(result, labels)
-	result[LabelNamespace] = stack
+	result[stackLabel] = stack
 	return result
 }
 
@@ -895,7 +1551,8 @@ func convertVolumeToMount(vol types.ServiceVolumeConfig, volumes types.Volumes,
 	case "bind":
 		if vol.Bind != nil {
 			m.BindOptions = &mount.BindOptions{
-				Propagation: mount.Propagation(vol.Bind.Propagation),
+				Propagation:      mount.Propagation(vol.Bind.Propagation),
+				CreateMountpoint: bool(vol.Bind.CreateHostPath),
 			}
 		}
 		return m, nil
@@ -903,6 +1560,7 @@ func convertVolumeToMount(vol types.ServiceVolumeConfig, volumes types.Volumes,
 		if vol.Tmpfs != nil {
 			m.TmpfsOptions = &mount.TmpfsOptions{
 				SizeBytes: int64(vol.Tmpfs.Size),
+				Mode:      os.FileMode(vol.Tmpfs.Mode),
 			}
 		}
 		return m, nil
@@ -1028,12 +1686,7 @@ func convertCredentialSpec(ctx context.Context, apiClient client.APIClient, stac
 		return nil, nil, fmt.Errorf("credential spec config %q not found", spec.Config)
 	}
 
-	configName := ScopeName(stack, spec.Config)
-	if config.Name != "" {
-		configName = config.Name
-	} else if config.External {
-		configName = spec.Config
-	}
+	configName := objectName(stack, spec.Config, config.Name, bool(config.External))
 
 	configID, err := lookupConfigID(ctx, apiClient, configName)
 	if err != nil {
@@ -2,9 +2,20 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/api/types/swarm"
 )
 
 func TestComposeParser(t *testing.T) {
@@ -183,7 +194,7 @@ func TestComposeParser(t *testing.T) {
 				t.Chdir("../../testdata")
 			}
 			ctx := context.Background()
-			project, err := LoadCompose(ctx, tt.files...)
+			project, err := LoadCompose(ctx, nil, tt.files...)
 			if err != nil {
 				t.Fatalf("LoadCompose failed: %v", err)
 			}
@@ -192,3 +203,1171 @@ func TestComposeParser(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertNetworksIPAM(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	err := os.WriteFile(composeFile, []byte(`
+services:
+  web:
+    image: nginx
+    networks:
+      - backend
+networks:
+  backend:
+    ipam:
+      driver: default
+      config:
+        - subnet: 172.28.0.0/16
+          ip_range: 172.28.5.0/24
+          gateway: 172.28.5.254
+          aux_addresses:
+            host1: 172.28.1.5
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	project, err := LoadCompose(context.Background(), nil, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+
+	networks, _, err := ConvertNetworks("stack", project.Networks, GetServicesDeclaredNetworks(project.Services))
+	if err != nil {
+		t.Fatalf("ConvertNetworks failed: %v", err)
+	}
+
+	opts, ok := networks["stack_backend"]
+	if !ok {
+		t.Fatal("stack_backend network not found")
+	}
+	if opts.IPAM == nil || len(opts.IPAM.Config) != 1 {
+		t.Fatalf("expected 1 IPAM config, got %+v", opts.IPAM)
+	}
+	if opts.IPAM.Driver != "default" {
+		t.Errorf("expected IPAM driver 'default', got '%s'", opts.IPAM.Driver)
+	}
+
+	pool := opts.IPAM.Config[0]
+	if pool.Subnet != netip.MustParsePrefix("172.28.0.0/16") {
+		t.Errorf("unexpected subnet %s", pool.Subnet)
+	}
+	if pool.IPRange != netip.MustParsePrefix("172.28.5.0/24") {
+		t.Errorf("unexpected ip range %s", pool.IPRange)
+	}
+	if pool.Gateway != netip.MustParseAddr("172.28.5.254") {
+		t.Errorf("unexpected gateway %s", pool.Gateway)
+	}
+	if pool.AuxAddress["host1"] != netip.MustParseAddr("172.28.1.5") {
+		t.Errorf("unexpected aux addresses %v", pool.AuxAddress)
+	}
+}
+
+func TestConvertNetworksIPv6AndScope(t *testing.T) {
+	enabled := true
+	networks := types.Networks{
+		"backend": types.NetworkConfig{EnableIPv6: &enabled},
+		"macvlan": types.NetworkConfig{Driver: "macvlan"},
+	}
+	used := map[string]struct{}{"backend": {}, "macvlan": {}}
+
+	result, _, err := ConvertNetworks("stack", networks, used)
+	if err != nil {
+		t.Fatalf("ConvertNetworks failed: %v", err)
+	}
+	backend := result["stack_backend"]
+	if backend.EnableIPv6 == nil || !*backend.EnableIPv6 {
+		t.Errorf("expected enable_ipv6 to be set, got %v", backend.EnableIPv6)
+	}
+	for name, opts := range result {
+		if opts.Scope != "swarm" {
+			t.Errorf("%s: expected swarm scope, got %q", name, opts.Scope)
+		}
+	}
+	if result["stack_macvlan"].EnableIPv6 != nil {
+		t.Errorf("expected enable_ipv6 to be left to the daemon, got %v", *result["stack_macvlan"].EnableIPv6)
+	}
+
+	networks["local"] = types.NetworkConfig{Driver: "bridge"}
+	used["local"] = struct{}{}
+	if _, _, err := ConvertNetworks("stack", networks, used); err == nil || !strings.Contains(err.Error(), "network local: driver bridge only exists on a single node") {
+		t.Errorf("expected the bridge driver to be rejected, got %v", err)
+	}
+
+	networks["local"] = types.NetworkConfig{Driver: "bridge", External: true}
+	if _, _, err := ConvertNetworks("stack", networks, used); err != nil {
+		t.Errorf("expected an external bridge network to be accepted, got %v", err)
+	}
+}
+
+func TestConvertNetworksInvalidSubnet(t *testing.T) {
+	networks := types.Networks{
+		"backend": types.NetworkConfig{
+			Ipam: types.IPAMConfig{
+				Config: []*types.IPAMPool{{Subnet: "172.28.0.0/33"}},
+			},
+		},
+	}
+
+	_, _, err := ConvertNetworks("stack", networks, map[string]struct{}{"backend": {}})
+	if err == nil {
+		t.Fatal("expected error for invalid subnet, got nil")
+	}
+	if !strings.Contains(err.Error(), "172.28.0.0/33") {
+		t.Errorf("expected error to name the subnet, got: %v", err)
+	}
+}
+
+func TestConvertServiceExternalSecretName(t *testing.T) {
+	t.Setenv("DB_SECRET_NAME", "prod_db_password")
+
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	err := os.WriteFile(composeFile, []byte(`
+services:
+  web:
+    image: nginx
+    secrets:
+      - db_password
+secrets:
+  db_password:
+    external: true
+    name: ${DB_SECRET_NAME}
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	project, err := LoadCompose(context.Background(), nil, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+
+	secrets, err := ConvertSecrets("stack", project.Secrets, project.Environment)
+	if err != nil {
+		t.Fatalf("ConvertSecrets failed: %v", err)
+	}
+	if len(secrets) != 0 {
+		t.Errorf("expected external secret to be skipped, got %d specs", len(secrets))
+	}
+
+	fake := &fakeClient{secrets: map[string]swarm.Secret{
+		"prod_db_password": {ID: "secret-id"},
+	}}
+	services, err := ConvertServices(context.Background(), fake, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+
+	refs := services["web"].TaskTemplate.ContainerSpec.Secrets
+	if len(refs) != 1 {
+		t.Fatalf("expected 1 secret reference, got %d", len(refs))
+	}
+	if refs[0].SecretName != "prod_db_password" {
+		t.Errorf("expected secret name 'prod_db_password', got '%s'", refs[0].SecretName)
+	}
+	if refs[0].SecretID != "secret-id" {
+		t.Errorf("expected secret id 'secret-id', got '%s'", refs[0].SecretID)
+	}
+	if len(fake.secretInspects) != 1 || fake.secretInspects[0] != "prod_db_password" {
+		t.Errorf("expected lookup by external name, got %v", fake.secretInspects)
+	}
+}
+
+func TestConvertServiceExternalObjectNames(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:    "web",
+				Image:   "nginx",
+				Secrets: []types.ServiceSecretConfig{{Source: "tls_cert"}, {Source: "db_password"}},
+				Configs: []types.ServiceConfigObjConfig{{Source: "nginx_conf"}, {Source: "app_conf"}},
+			},
+		},
+		Secrets: types.Secrets{
+			"tls_cert":    {External: true},
+			"db_password": {External: true, Name: "prod_db_password"},
+		},
+		Configs: types.Configs{
+			"nginx_conf": {External: true},
+			"app_conf":   {External: true, Name: "prod_app_conf"},
+		},
+	}
+
+	fake := &fakeClient{
+		secrets: map[string]swarm.Secret{
+			"tls_cert":         {ID: "tls-id"},
+			"prod_db_password": {ID: "db-id"},
+		},
+		configs: map[string]swarm.Config{
+			"nginx_conf":    {ID: "nginx-id"},
+			"prod_app_conf": {ID: "app-id"},
+		},
+	}
+	services, err := ConvertServices(context.Background(), fake, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+
+	// external objects are never scoped: the name override wins, else the key
+	cs := services["web"].TaskTemplate.ContainerSpec
+	secrets := map[string]string{}
+	for _, ref := range cs.Secrets {
+		secrets[ref.SecretName] = ref.SecretID
+	}
+	configs := map[string]string{}
+	for _, ref := range cs.Configs {
+		configs[ref.ConfigName] = ref.ConfigID
+	}
+	if secrets["tls_cert"] != "tls-id" || secrets["prod_db_password"] != "db-id" || len(secrets) != 2 {
+		t.Errorf("expected secrets by key and by name override, got %v", secrets)
+	}
+	if configs["nginx_conf"] != "nginx-id" || configs["prod_app_conf"] != "app-id" || len(configs) != 2 {
+		t.Errorf("expected configs by key and by name override, got %v", configs)
+	}
+	if !slices.Equal(fake.secretInspects, []string{"tls_cert", "prod_db_password"}) {
+		t.Errorf("expected secret lookups by resolved name, got %v", fake.secretInspects)
+	}
+	if !slices.Equal(fake.configInspects, []string{"nginx_conf", "prod_app_conf"}) {
+		t.Errorf("expected config lookups by resolved name, got %v", fake.configInspects)
+	}
+}
+
+func TestConvertServiceFileTargetDefaults(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "compose.yaml")
+	err := os.WriteFile(composeFile, []byte(`
+x-cicdez:
+  secret_defaults:
+    mode: 0400
+    uid: 1000
+    gid: "1000"
+  config_defaults:
+    mode: "0440"
+services:
+  web:
+    image: nginx
+    secrets:
+      - db_password
+      - source: tls_key
+        mode: 0o600
+        uid: "0"
+    configs:
+      - nginx_conf
+secrets:
+  db_password:
+    external: true
+  tls_key:
+    external: true
+configs:
+  nginx_conf:
+    external: true
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	project, err := LoadCompose(context.Background(), nil, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+
+	fake := &fakeClient{
+		secrets: map[string]swarm.Secret{"db_password": {ID: "db-id"}, "tls_key": {ID: "tls-id"}},
+		configs: map[string]swarm.Config{"nginx_conf": {ID: "nginx-id"}},
+	}
+	services, err := ConvertServices(context.Background(), fake, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+
+	cs := services["web"].TaskTemplate.ContainerSpec
+	secrets := map[string]swarm.SecretReferenceFileTarget{}
+	for _, ref := range cs.Secrets {
+		secrets[ref.SecretName] = *ref.File
+	}
+	if got := secrets["db_password"]; got.Mode != 0o400 || got.UID != "1000" || got.GID != "1000" {
+		t.Errorf("expected the project defaults for db_password, got %+v", got)
+	}
+	// values on the reference win, the rest still comes from the defaults
+	if got := secrets["tls_key"]; got.Mode != 0o600 || got.UID != "0" || got.GID != "1000" {
+		t.Errorf("expected the reference to override the defaults, got %+v", got)
+	}
+	if got := cs.Configs[0].File; got.Mode != 0o440 || got.UID != "0" || got.GID != "0" {
+		t.Errorf("expected the config mode default and root owner, got %+v", got)
+	}
+
+	for _, tt := range []struct {
+		ext  any
+		want string
+	}{
+		{map[string]any{"secret_defaults": map[string]any{"mode": "rw"}}, "invalid x-cicdez.secret_defaults.mode rw"},
+		{map[string]any{"config_defaults": map[string]any{"mode": 0o1777}}, "invalid x-cicdez.config_defaults.mode"},
+		{map[string]any{"secret_defaults": map[string]any{"uid": "www-data"}}, "invalid x-cicdez.secret_defaults.uid www-data"},
+		{map[string]any{"secret_defaults": map[string]any{"owner": 1000}}, `unknown x-cicdez.secret_defaults field "owner"`},
+		{map[string]any{"config_defaults": "0400"}, "x-cicdez.config_defaults must be a mapping"},
+	} {
+		project.Extensions = types.Extensions{ExtensionKey: tt.ext}
+		if _, err := ConvertServices(context.Background(), fake, "stack", project); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected %q error, got %v", tt.want, err)
+		}
+	}
+}
+
+func TestSelectProfiles(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "compose.yaml")
+	err := os.WriteFile(composeFile, []byte(`
+services:
+  web:
+    image: nginx
+  debug:
+    image: busybox
+    profiles: [debug]
+  metrics:
+    image: prom/node-exporter
+    profiles: [monitoring]
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	tests := []struct {
+		profiles []string
+		want     []string
+	}{
+		{nil, []string{"web"}},
+		{[]string{"debug"}, []string{"debug", "web"}},
+		{[]string{"*"}, []string{"debug", "metrics", "web"}},
+	}
+	for _, tt := range tests {
+		project, err := LoadCompose(context.Background(), nil, composeFile)
+		if err != nil {
+			t.Fatalf("LoadCompose failed: %v", err)
+		}
+		if err := SelectProfiles(&project, tt.profiles); err != nil {
+			t.Fatalf("SelectProfiles failed: %v", err)
+		}
+
+		services, err := ConvertServices(context.Background(), nil, "stack", project)
+		if err != nil {
+			t.Fatalf("ConvertServices failed: %v", err)
+		}
+		if got := slices.Sorted(maps.Keys(services)); !slices.Equal(got, tt.want) {
+			t.Errorf("profiles %v: expected services %v, got %v", tt.profiles, tt.want, got)
+		}
+	}
+}
+
+func TestOverrideImages(t *testing.T) {
+	project := types.Project{Services: types.Services{
+		"api": types.ServiceConfig{
+			Name:  "api",
+			Image: "ghcr.io/acme/api:latest",
+			Build: &types.BuildConfig{Context: "./api"},
+		},
+		"web": types.ServiceConfig{Name: "web", Image: "nginx"},
+	}}
+
+	if err := OverrideImages(&project, map[string]string{"api": "ghcr.io/acme/api:1.4.2-hotfix"}); err != nil {
+		t.Fatalf("OverrideImages failed: %v", err)
+	}
+	if project.Services["api"].Build != nil {
+		t.Error("expected the overridden service not to be built")
+	}
+
+	services, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+	api := services["api"]
+	if got := api.TaskTemplate.ContainerSpec.Image; got != "ghcr.io/acme/api:1.4.2-hotfix" {
+		t.Errorf("expected the override in the container spec, got %q", got)
+	}
+	if got := api.Labels[LabelImage]; got != "ghcr.io/acme/api:1.4.2-hotfix" {
+		t.Errorf("expected the override in the image label, got %q", got)
+	}
+	if got := services["web"].TaskTemplate.ContainerSpec.Image; got != "nginx" {
+		t.Errorf("expected web to keep its image, got %q", got)
+	}
+
+	for want, images := range map[string]map[string]string{
+		"no such service: worker":         {"worker": "busybox"},
+		"invalid image for service web":   {"web": "Nginx:Latest"},
+		"invalid image for service api: ": {"api": "ghcr.io/acme/api:"},
+	} {
+		if err := OverrideImages(&project, images); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q error, got %v", want, err)
+		}
+	}
+}
+
+func TestSelectServices(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "compose.yaml")
+	err := os.WriteFile(composeFile, []byte(`
+services:
+  web:
+    image: nginx
+    depends_on: [api]
+  api:
+    image: ghcr.io/acme/api
+    depends_on:
+      db:
+        condition: service_started
+      cache:
+        condition: service_started
+        required: false
+  db:
+    image: postgres:16
+  cache:
+    image: redis:7
+  worker:
+    image: ghcr.io/acme/worker
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	tests := []struct {
+		only    []string
+		skip    []string
+		want    []string
+		wantErr string
+	}{
+		{only: []string{"worker"}, want: []string{"worker"}},
+		{only: []string{"api", "db"}, want: []string{"api", "db"}},
+		{only: []string{"api"}, wantErr: "service api depends on db, add --only db"},
+		{only: []string{"web", "db"}, wantErr: "service web depends on api"},
+		{skip: []string{"worker", "cache"}, want: []string{"api", "db", "web"}},
+		{skip: []string{"db"}, want: []string{"api", "cache", "web", "worker"}},
+		{only: []string{"frontend"}, wantErr: "no such service: frontend"},
+		{skip: []string{"frontend"}, wantErr: "no such service: frontend"},
+	}
+	for _, tt := range tests {
+		project, err := LoadCompose(context.Background(), nil, composeFile)
+		if err != nil {
+			t.Fatalf("LoadCompose failed: %v", err)
+		}
+		err = SelectServices(&project, tt.only, tt.skip)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("only %v skip %v: expected %q error, got %v", tt.only, tt.skip, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("only %v skip %v: SelectServices failed: %v", tt.only, tt.skip, err)
+		}
+
+		if got := slices.Sorted(maps.Keys(project.Services)); !slices.Equal(got, tt.want) {
+			t.Errorf("only %v skip %v: expected services %v, got %v", tt.only, tt.skip, tt.want, got)
+		}
+		// the deploy order must still resolve over the subset
+		if _, err := dependencyOrder(project.Services); err != nil {
+			t.Errorf("only %v skip %v: dependencyOrder failed: %v", tt.only, tt.skip, err)
+		}
+	}
+}
+
+func TestConvertPorts(t *testing.T) {
+	ports, err := convertPorts([]types.ServicePortConfig{
+		{Target: 80, Published: "8000-8002", Protocol: "tcp", Mode: "ingress"},
+		{Target: 53, Published: "5353", Protocol: "udp", Mode: "host"},
+		{Target: 9000},
+	})
+	if err != nil {
+		t.Fatalf("convertPorts failed: %v", err)
+	}
+
+	want := []swarm.PortConfig{
+		{TargetPort: 80, PublishedPort: 8000, Protocol: "tcp", PublishMode: "ingress"},
+		{TargetPort: 80, PublishedPort: 8001, Protocol: "tcp", PublishMode: "ingress"},
+		{TargetPort: 80, PublishedPort: 8002, Protocol: "tcp", PublishMode: "ingress"},
+		{TargetPort: 53, PublishedPort: 5353, Protocol: "udp", PublishMode: "host"},
+		{TargetPort: 9000},
+	}
+	if len(ports) != len(want) {
+		t.Fatalf("expected %d ports, got %d: %+v", len(want), len(ports), ports)
+	}
+	for i := range want {
+		if ports[i] != want[i] {
+			t.Errorf("port %d: expected %+v, got %+v", i, want[i], ports[i])
+		}
+	}
+}
+
+func TestConvertRestartPolicy(t *testing.T) {
+	three := uint64(3)
+	delay, wantDelay := types.Duration(5*time.Second), 5*time.Second
+
+	tests := []struct {
+		name    string
+		restart string
+		deploy  *types.DeployConfig
+		want    *swarm.RestartPolicy
+		wantErr string
+	}{
+		{name: "unset", want: nil},
+		{name: "no", restart: "no", want: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone}},
+		{name: "always", restart: "always", want: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionAny}},
+		{name: "unless-stopped", restart: "unless-stopped", want: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionAny}},
+		{name: "on-failure:3", restart: "on-failure:3", want: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionOnFailure, MaxAttempts: &three}},
+		{name: "unknown", restart: "sometimes", wantErr: "unknown restart policy: sometimes"},
+		{
+			name:    "deploy block wins",
+			restart: "always",
+			deploy:  &types.DeployConfig{RestartPolicy: &types.RestartPolicy{Condition: "on-failure", MaxAttempts: &three, Delay: &delay}},
+			want:    &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionOnFailure, MaxAttempts: &three, Delay: &wantDelay},
+		},
+		{
+			name:   "deploy block no",
+			deploy: &types.DeployConfig{RestartPolicy: &types.RestartPolicy{Condition: "no"}},
+			want:   &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone},
+		},
+		{
+			name:    "deploy block without policy",
+			restart: "no",
+			deploy:  &types.DeployConfig{},
+			want:    &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone},
+		},
+		{
+			name:    "deploy block unknown condition",
+			deploy:  &types.DeployConfig{RestartPolicy: &types.RestartPolicy{Condition: "always"}},
+			wantErr: "unknown restart_policy condition: always",
+		},
+		{
+			name:   "job defaults to on-failure",
+			deploy: &types.DeployConfig{Mode: "replicated-job"},
+			want:   &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionOnFailure},
+		},
+		{
+			name:    "job keeps no",
+			restart: "no",
+			deploy:  &types.DeployConfig{Mode: "global-job"},
+			want:    &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone},
+		},
+		{
+			name:    "job restarting always",
+			restart: "always",
+			deploy:  &types.DeployConfig{Mode: "replicated-job"},
+			wantErr: "jobs can't restart on any exit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := types.Project{Services: types.Services{
+				"web": types.ServiceConfig{Name: "web", Image: "nginx", Restart: tt.restart, Deploy: tt.deploy},
+			}}
+			services, err := ConvertServices(context.Background(), nil, "stack", project)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConvertServices failed: %v", err)
+			}
+			if got := services["web"].TaskTemplate.RestartPolicy; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertSysctls(t *testing.T) {
+	want := map[string]string{"net.core.somaxconn": "1024", "net.ipv4.tcp_syncookies": "0"}
+	for name, sysctls := range map[string]string{
+		"map":  "      net.core.somaxconn: 1024\n      net.ipv4.tcp_syncookies: 0\n",
+		"list": "      - net.core.somaxconn=1024\n      - net.ipv4.tcp_syncookies = 0\n",
+	} {
+		composeFile := filepath.Join(t.TempDir(), "compose.yaml")
+		err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: nginx\n    sysctls:\n"+sysctls), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write compose file: %v", err)
+		}
+		project, err := LoadCompose(context.Background(), nil, composeFile)
+		if err != nil {
+			t.Fatalf("%s: LoadCompose failed: %v", name, err)
+		}
+
+		services, err := ConvertServices(context.Background(), nil, "stack", project)
+		if err != nil {
+			t.Fatalf("%s: ConvertServices failed: %v", name, err)
+		}
+		if got := services["web"].TaskTemplate.ContainerSpec.Sysctls; !maps.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+
+	for _, tt := range []struct {
+		sysctls types.Mapping
+		wantErr string
+	}{
+		{types.Mapping{"somaxconn": "1024"}, `invalid sysctl "somaxconn"`},
+		{types.Mapping{"net.core..somaxconn": "1024"}, `invalid sysctl "net.core..somaxconn"`},
+		{types.Mapping{"vm.swappiness": "10"}, "sysctl vm.swappiness can't be set per container"},
+		{types.Mapping{"net.core.somaxconn": ""}, "sysctl net.core.somaxconn has no value"},
+	} {
+		if _, err := convertSysctls(tt.sysctls); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: expected %q error, got %v", tt.sysctls, tt.wantErr, err)
+		}
+	}
+}
+
+func TestCheckStopSignal(t *testing.T) {
+	for _, signal := range []string{"", "SIGTERM", "sigquit", "USR1", "9", "SIGRTMIN+3"} {
+		if err := checkStopSignal(signal); err != nil {
+			t.Errorf("%q: unexpected error: %v", signal, err)
+		}
+	}
+	for signal, wantErr := range map[string]string{
+		"SIGTERMM":    `invalid stop_signal "SIGTERMM"`,
+		"SIGRTMIN+16": `invalid stop_signal "SIGRTMIN+16"`,
+		"0":           "signal numbers go from 1 to 64",
+		"65":          "signal numbers go from 1 to 64",
+	} {
+		if err := checkStopSignal(signal); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%q: expected %q error, got %v", signal, wantErr, err)
+		}
+	}
+
+	composeFile := filepath.Join(t.TempDir(), "compose.yaml")
+	err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: nginx\n    stop_signal: SIGTERMM\n"), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	project, err := LoadCompose(context.Background(), nil, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+	if _, err := ConvertServices(context.Background(), nil, "stack", project); err == nil || !strings.Contains(err.Error(), "SIGTERMM") {
+		t.Errorf("expected the stop_signal typo to fail the conversion, got %v", err)
+	}
+}
+
+func TestConvertHealthcheck(t *testing.T) {
+	interval, timeout := types.Duration(30*time.Second), types.Duration(5*time.Second)
+	negative, zero := types.Duration(-time.Second), types.Duration(0)
+	retries, noRetries := uint64(3), uint64(0)
+
+	tests := []struct {
+		name     string
+		check    types.HealthCheckConfig
+		wantTest []string
+		wantErr  string
+	}{
+		{
+			name:     "bare string",
+			check:    types.HealthCheckConfig{Test: types.HealthCheckTest{"curl -f http://localhost/ || exit 1"}},
+			wantTest: []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"},
+		},
+		{
+			name:     "CMD form",
+			check:    types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "curl", "-f", "http://localhost/"}, Interval: &interval, Timeout: &timeout, Retries: &retries},
+			wantTest: []string{"CMD", "curl", "-f", "http://localhost/"},
+		},
+		{
+			name:     "CMD-SHELL form",
+			check:    types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD-SHELL", "pg_isready"}, StartPeriod: &zero},
+			wantTest: []string{"CMD-SHELL", "pg_isready"},
+		},
+		{
+			name:    "no prefix",
+			check:   types.HealthCheckConfig{Test: types.HealthCheckTest{"curl", "-f", "http://localhost/"}},
+			wantErr: "must start with CMD, CMD-SHELL or NONE",
+		},
+		{
+			name:     "zero durations and retries keep docker defaults",
+			check:    types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}, Interval: &zero, Timeout: &zero, StartInterval: &zero, Retries: &noRetries},
+			wantTest: []string{"CMD", "true"},
+		},
+		{
+			name:    "negative interval",
+			check:   types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}, Interval: &negative},
+			wantErr: "invalid healthcheck interval -1s: must not be negative",
+		},
+		{
+			name:    "negative timeout",
+			check:   types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}, Timeout: &negative},
+			wantErr: "invalid healthcheck timeout -1s: must not be negative",
+		},
+		{
+			name:    "negative start period",
+			check:   types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}, StartPeriod: &negative},
+			wantErr: "invalid healthcheck start_period -1s",
+		},
+		{
+			name:    "negative start interval",
+			check:   types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}, StartInterval: &negative},
+			wantErr: "invalid healthcheck start_interval -1s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertHealthcheck(&tt.check)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertHealthcheck failed: %v", err)
+			}
+			if !slices.Equal(got.Test, tt.wantTest) {
+				t.Errorf("expected test %q, got %q", tt.wantTest, got.Test)
+			}
+		})
+	}
+}
+
+func TestConvertServiceInvalidPublishedPort(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "nginx",
+				Ports: []types.ServicePortConfig{{Target: 80, Published: "80a"}},
+			},
+		},
+	}
+
+	_, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err == nil {
+		t.Fatal("expected error for invalid published port, got nil")
+	}
+	if !strings.Contains(err.Error(), "web") || !strings.Contains(err.Error(), `"80a"`) {
+		t.Errorf("expected error to name service and port, got: %v", err)
+	}
+}
+
+func TestLoadComposeEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: nginx:${TAG}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	base := filepath.Join(dir, "base.env")
+	if err := os.WriteFile(base, []byte("TAG=1.25\n"), 0o644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	prod := filepath.Join(dir, "prod.env")
+	if err := os.WriteFile(prod, []byte("TAG=1.27\n"), 0o644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	// env files take precedence over the OS environment
+	t.Setenv("TAG", "from-os")
+
+	env, err := LoadEnvFiles(base, prod)
+	if err != nil {
+		t.Fatalf("LoadEnvFiles failed: %v", err)
+	}
+
+	project, err := LoadCompose(context.Background(), env, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+	if got := project.Services["web"].Image; got != "nginx:1.27" {
+		t.Errorf("expected image nginx:1.27, got %s", got)
+	}
+
+	if _, err := LoadEnvFiles(filepath.Join(dir, "missing.env")); err == nil {
+		t.Error("expected error for missing env file, got nil")
+	}
+}
+
+func TestSetVariables(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: ghcr.io/acme/web:${TAG}\n    environment:\n      MODE: ${MODE}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	envFile := filepath.Join(dir, "prod.env")
+	if err := os.WriteFile(envFile, []byte("TAG=1.27\nMODE=prod\n"), 0o644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	t.Setenv("TAG", "from-os")
+
+	env, err := LoadEnvFiles(envFile)
+	if err != nil {
+		t.Fatalf("LoadEnvFiles failed: %v", err)
+	}
+	// --set wins over both the env file and the OS environment
+	env, err = SetVariables(env, []string{"TAG=3f9c2ab", "TAG=4e5d6c7"})
+	if err != nil {
+		t.Fatalf("SetVariables failed: %v", err)
+	}
+
+	project, err := LoadCompose(context.Background(), env, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+	web := project.Services["web"]
+	if web.Image != "ghcr.io/acme/web:4e5d6c7" {
+		t.Errorf("expected the tag from the last --set, got %s", web.Image)
+	}
+	if mode := web.Environment["MODE"]; mode == nil || *mode != "prod" {
+		t.Errorf("expected MODE from the env file, got %v", mode)
+	}
+
+	for _, set := range []string{"TAG", "=1.0"} {
+		if _, err := SetVariables(nil, []string{set}); err == nil || !strings.Contains(err.Error(), "expected KEY=VALUE") {
+			t.Errorf("%q: expected an invalid --set error, got %v", set, err)
+		}
+	}
+}
+
+func TestLoadComposeStdin(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	compose := "services:\n  web:\n    image: web:latest\n    build: ./web\n    env_file: web.env\n"
+	if err := os.WriteFile(filepath.Join(dir, "web.env"), []byte("MODE=prod\n"), 0o644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	paths, cleanup, err := ReadComposeStdin(strings.NewReader(compose), []string{StdinCompose})
+	if err != nil {
+		t.Fatalf("ReadComposeStdin failed: %v", err)
+	}
+
+	project, err := LoadCompose(context.Background(), nil, paths...)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+	if project.WorkingDir != dir {
+		t.Errorf("expected working dir %s, got %s", dir, project.WorkingDir)
+	}
+	web := project.Services["web"]
+	if web.Build == nil || web.Build.Context != filepath.Join(dir, "web") {
+		t.Errorf("expected the build context to resolve against the current directory, got %+v", web.Build)
+	}
+	if mode := web.Environment["MODE"]; mode == nil || *mode != "prod" {
+		t.Errorf("expected the env file next to the current directory to load, got %v", web.Environment)
+	}
+
+	cleanup()
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the temp compose file to be removed, got %v", err)
+	}
+
+	if _, _, err := ReadComposeStdin(strings.NewReader(compose), []string{StdinCompose, StdinCompose}); err == nil {
+		t.Error("expected reading stdin twice to fail")
+	}
+}
+
+func TestConvertServiceContainerFields(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:       "web",
+				Image:      "nginx",
+				Hostname:   "web-host",
+				WorkingDir: "/srv/app/../www/",
+				User:       "1000:1000",
+				Tty:        true,
+				StdinOpen:  true,
+				ReadOnly:   true,
+				StopSignal: "SIGQUIT",
+			},
+		},
+	}
+
+	services, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+
+	spec := services["web"].TaskTemplate.ContainerSpec
+	if spec.Hostname != "web-host" {
+		t.Errorf("expected hostname web-host, got %q", spec.Hostname)
+	}
+	if spec.Dir != "/srv/www" {
+		t.Errorf("expected working dir /srv/www, got %q", spec.Dir)
+	}
+	if spec.User != "1000:1000" {
+		t.Errorf("expected user 1000:1000, got %q", spec.User)
+	}
+	if !spec.TTY || !spec.OpenStdin || !spec.ReadOnly {
+		t.Errorf("expected tty, stdin_open and read_only to be set, got %+v", spec)
+	}
+	if spec.StopSignal != "SIGQUIT" {
+		t.Errorf("expected stop signal SIGQUIT, got %q", spec.StopSignal)
+	}
+}
+
+func TestConvertServiceDNS(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:      "web",
+				Image:     "nginx",
+				DNS:       types.StringList{"10.0.0.53", "2001:db8::53"},
+				DNSSearch: types.StringList{"svc.internal"},
+				DNSOpts:   []string{"ndots:2", "timeout:1"},
+			},
+		},
+	}
+
+	services, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+
+	dns := services["web"].TaskTemplate.ContainerSpec.DNSConfig
+	if dns == nil {
+		t.Fatal("expected a DNS config")
+	}
+	want := []netip.Addr{netip.MustParseAddr("10.0.0.53"), netip.MustParseAddr("2001:db8::53")}
+	if !slices.Equal(dns.Nameservers, want) {
+		t.Errorf("expected nameservers %v, got %v", want, dns.Nameservers)
+	}
+	if !slices.Equal(dns.Search, []string{"svc.internal"}) {
+		t.Errorf("expected search svc.internal, got %v", dns.Search)
+	}
+	if !slices.Equal(dns.Options, []string{"ndots:2", "timeout:1"}) {
+		t.Errorf("expected options ndots:2 timeout:1, got %v", dns.Options)
+	}
+}
+
+func TestConvertServiceInvalidDNS(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "nginx",
+				DNS:   types.StringList{"10.0.0.53", "10.0.0.300"},
+			},
+		},
+	}
+
+	_, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err == nil || !strings.Contains(err.Error(), `"10.0.0.300"`) {
+		t.Fatalf("expected error naming the invalid address, got %v", err)
+	}
+}
+
+func TestConvertEnvironmentSourcedObjects(t *testing.T) {
+	env := types.Mapping{"DB_PASSWORD": "secret123", "APP_CONF": "debug=false"}
+
+	secrets, err := ConvertSecrets("stack", types.Secrets{
+		"db_password": {Name: "db_password", Environment: "DB_PASSWORD"},
+	}, env)
+	if err != nil {
+		t.Fatalf("ConvertSecrets failed: %v", err)
+	}
+	if len(secrets) != 1 || string(secrets[0].Data) != "secret123" {
+		t.Errorf("expected secret data from DB_PASSWORD, got %+v", secrets)
+	}
+
+	configs, err := ConvertConfigs("stack", types.Configs{
+		"app_conf": {Name: "app_conf", Environment: "APP_CONF"},
+	}, env)
+	if err != nil {
+		t.Fatalf("ConvertConfigs failed: %v", err)
+	}
+	if len(configs) != 1 || string(configs[0].Data) != "debug=false" {
+		t.Errorf("expected config data from APP_CONF, got %+v", configs)
+	}
+}
+
+func TestConvertEnvironmentSourcedObjectsUnset(t *testing.T) {
+	_, err := ConvertSecrets("stack", types.Secrets{
+		"db_password": {Name: "db_password", Environment: "MISSING_SECRET"},
+	}, types.Mapping{})
+	if err == nil || !strings.Contains(err.Error(), "MISSING_SECRET") {
+		t.Errorf("expected unset variable error for the secret, got %v", err)
+	}
+
+	_, err = ConvertConfigs("stack", types.Configs{
+		"app_conf": {Name: "app_conf", Environment: "MISSING_CONFIG"},
+	}, types.Mapping{})
+	if err == nil || !strings.Contains(err.Error(), "MISSING_CONFIG") {
+		t.Errorf("expected unset variable error for the config, got %v", err)
+	}
+}
+
+func TestConvertTemplateDriver(t *testing.T) {
+	secrets, err := ConvertSecrets("stack", types.Secrets{
+		"app_env": {Name: "app_env", Content: "{{ .Service.Name }}", TemplateDriver: "golang"},
+		"plain":   {Name: "plain", Content: "x"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ConvertSecrets failed: %v", err)
+	}
+	if secrets[0].Templating == nil || secrets[0].Templating.Name != "golang" {
+		t.Errorf("expected golang templating for the secret, got %+v", secrets[0].Templating)
+	}
+	if secrets[1].Templating != nil {
+		t.Errorf("expected no templating without template_driver, got %+v", secrets[1].Templating)
+	}
+
+	configs, err := ConvertConfigs("stack", types.Configs{
+		"app_conf": {Name: "app_conf", Content: "{{ .Node.Hostname }}", TemplateDriver: "golang"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ConvertConfigs failed: %v", err)
+	}
+	if configs[0].Templating == nil || configs[0].Templating.Name != "golang" {
+		t.Errorf("expected golang templating for the config, got %+v", configs[0].Templating)
+	}
+
+	_, err = ConvertSecrets("stack", types.Secrets{
+		"app_env": {Name: "app_env", Content: "x", TemplateDriver: "go"},
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), `secret app_env: unknown template_driver "go"`) {
+		t.Errorf("expected unknown driver error for the secret, got %v", err)
+	}
+
+	_, err = ConvertConfigs("stack", types.Configs{
+		"app_conf": {Name: "app_conf", Content: "x", TemplateDriver: "jinja"},
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), `config app_conf: unknown template_driver "jinja"`) {
+		t.Errorf("expected unknown driver error for the config, got %v", err)
+	}
+}
+
+func TestConvertVolumeToMountOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		vol  types.ServiceVolumeConfig
+		want mount.Mount
+	}{
+		{
+			name: "tmpfs with mode",
+			vol: types.ServiceVolumeConfig{
+				Type:   "tmpfs",
+				Target: "/run/cache",
+				Tmpfs:  &types.ServiceVolumeTmpfs{Size: 64 * 1024 * 1024, Mode: 0o1777},
+			},
+			want: mount.Mount{
+				Type:         mount.TypeTmpfs,
+				Target:       "/run/cache",
+				TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 64 * 1024 * 1024, Mode: os.FileMode(0o1777)},
+			},
+		},
+		{
+			name: "bind with create host path",
+			vol: types.ServiceVolumeConfig{
+				Type:   "bind",
+				Source: "/srv/data",
+				Target: "/data",
+				Bind:   &types.ServiceVolumeBind{Propagation: "rshared", CreateHostPath: true},
+			},
+			want: mount.Mount{
+				Type:        mount.TypeBind,
+				Source:      "/srv/data",
+				Target:      "/data",
+				BindOptions: &mount.BindOptions{Propagation: mount.PropagationRShared, CreateMountpoint: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertVolumeToMount(tt.vol, nil, "stack")
+			if err != nil {
+				t.Fatalf("convertVolumeToMount failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertServiceLabels(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:   "web",
+				Image:  "nginx:1.27",
+				Labels: types.Labels{"app.role": "frontend", LabelNamespace: "spoofed"},
+				Deploy: &types.DeployConfig{
+					Labels: types.Labels{"traefik.enable": "true"},
+				},
+			},
+		},
+	}
+
+	services, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+	spec := services["web"]
+
+	wantService := map[string]string{
+		"traefik.enable": "true",
+		LabelNamespace:   "stack",
+		LabelImage:       "nginx:1.27",
+		LabelManaged:     "true",
+	}
+	if !maps.Equal(spec.Labels, wantService) {
+		t.Errorf("expected service labels %v, got %v", wantService, spec.Labels)
+	}
+
+	wantContainer := map[string]string{
+		"app.role":     "frontend",
+		LabelNamespace: "stack",
+	}
+	if !maps.Equal(spec.TaskTemplate.ContainerSpec.Labels, wantContainer) {
+		t.Errorf("expected container labels %v, got %v", wantContainer, spec.TaskTemplate.ContainerSpec.Labels)
+	}
+
+	service, container := LabelsFor("stack", project.Services["web"])
+	if !maps.Equal(service, spec.Labels) || !maps.Equal(container, spec.TaskTemplate.ContainerSpec.Labels) {
+		t.Errorf("expected LabelsFor to match the converted spec, got %v and %v", service, container)
+	}
+}
+
+func TestConvertResourcesUnits(t *testing.T) {
+	tests := []struct {
+		cpus       string
+		memory     string
+		wantCPUs   int64
+		wantMemory int64
+	}{
+		{`"0.5"`, `"512M"`, 500_000_000, 512 << 20},
+		{`"0.065"`, `"512Mi"`, 65_000_000, 512 << 20},
+		{`1.25`, `"1G"`, 1_250_000_000, 1 << 30},
+		{`"2"`, `"1Gi"`, 2_000_000_000, 1 << 30},
+		{`0.001`, `"1.5G"`, 1_000_000, 3 << 29},
+		{`"0.3"`, `268435456`, 300_000_000, 256 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cpus+"/"+tt.memory, func(t *testing.T) {
+			dir := t.TempDir()
+			composeFile := filepath.Join(dir, "docker-compose.yml")
+			compose := fmt.Sprintf(`
+services:
+  web:
+    image: nginx
+    deploy:
+      resources:
+        limits:
+          cpus: %[1]s
+          memory: %[2]s
+        reservations:
+          cpus: %[1]s
+          memory: %[2]s
+`, tt.cpus, tt.memory)
+			if err := os.WriteFile(composeFile, []byte(compose), 0o644); err != nil {
+				t.Fatalf("failed to write compose file: %v", err)
+			}
+
+			project, err := LoadCompose(context.Background(), nil, composeFile)
+			if err != nil {
+				t.Fatalf("LoadCompose failed: %v", err)
+			}
+
+			resources := convertResources(&project.Services["web"].Deploy.Resources)
+			if resources.Limits.NanoCPUs != tt.wantCPUs || resources.Reservations.NanoCPUs != tt.wantCPUs {
+				t.Errorf("expected %d nano CPUs, got limit %d and reservation %d", tt.wantCPUs, resources.Limits.NanoCPUs, resources.Reservations.NanoCPUs)
+			}
+			if resources.Limits.MemoryBytes != tt.wantMemory || resources.Reservations.MemoryBytes != tt.wantMemory {
+				t.Errorf("expected %d bytes, got limit %d and reservation %d", tt.wantMemory, resources.Limits.MemoryBytes, resources.Reservations.MemoryBytes)
+			}
+		})
+	}
+}
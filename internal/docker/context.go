@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/moby/moby/client"
+)
+
+// DefaultContext is the Docker CLI context that stands for DOCKER_HOST or
+// the platform's default socket
+const DefaultContext = "default"
+
+// contextMeta is the part of a Docker CLI context's meta.json cicdez reads
+type contextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host string `json:"Host"`
+	} `json:"Endpoints"`
+}
+
+// NewContextClient connects to the daemon of the Docker CLI context name.
+// An empty name falls back to DOCKER_CONTEXT, and the default context to
+// DOCKER_HOST, like the docker CLI does.
+func NewContextClient(name string) (client.APIClient, error) {
+	if name == "" {
+		name = os.Getenv("DOCKER_CONTEXT")
+	}
+	if name == "" || name == DefaultContext {
+		return client.New(client.WithHostFromEnv())
+	}
+
+	host, err := ContextHost(config.Dir(), name)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(client.WithHost(host))
+}
+
+// ContextHost returns the docker endpoint of context name from the context
+// store under configDir. Contexts are stored by the SHA-256 of their name.
+func ContextHost(configDir, name string) (string, error) {
+	digest := sha256.Sum256([]byte(name))
+	path := filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(digest[:]), "meta.json")
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("docker context %q not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read docker context %q: %w", name, err)
+	}
+
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", fmt.Errorf("failed to parse docker context %q: %w", name, err)
+	}
+
+	host := meta.Endpoints["docker"].Host
+	if host == "" {
+		return "", fmt.Errorf("docker context %q has no docker endpoint", name)
+	}
+	scheme, _, _ := strings.Cut(host, "://")
+	switch scheme {
+	case "unix", "npipe", "tcp":
+	default:
+		return "", fmt.Errorf("docker context %q uses %s, only unix, npipe and tcp endpoints are supported", name, host)
+	}
+	return host, nil
+}
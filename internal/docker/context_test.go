@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeContext(t *testing.T, configDir, name, host string) {
+	t.Helper()
+	digest := sha256.Sum256([]byte(name))
+	dir := filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(digest[:]))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create context dir: %v", err)
+	}
+	meta := `{"Name":"` + name + `","Metadata":{},"Endpoints":{"docker":{"Host":"` + host + `","SkipTLSVerify":false}}}`
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0o644); err != nil {
+		t.Fatalf("failed to write context: %v", err)
+	}
+}
+
+func TestContextHost(t *testing.T) {
+	configDir := t.TempDir()
+	writeContext(t, configDir, "desktop-linux", "unix:///home/dev/.docker/run/docker.sock")
+	writeContext(t, configDir, "remote", "ssh://deploy@example.com")
+
+	host, err := ContextHost(configDir, "desktop-linux")
+	if err != nil {
+		t.Fatalf("ContextHost failed: %v", err)
+	}
+	if host != "unix:///home/dev/.docker/run/docker.sock" {
+		t.Errorf("expected the context socket, got %q", host)
+	}
+
+	for name, want := range map[string]string{
+		"missing": `docker context "missing" not found`,
+		"remote":  "only unix, npipe and tcp endpoints are supported",
+	} {
+		if _, err := ContextHost(configDir, name); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q error, got %v", name, want, err)
+		}
+	}
+}
@@ -7,11 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
+	"github.com/blindlobstar/cicdez/internal/log"
 	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/containerd/errdefs"
@@ -28,28 +31,111 @@ const (
 	ResolveImageNever   = "never"
 )
 
+var resolveImageModes = []string{ResolveImageAlways, ResolveImageChanged, ResolveImageNever}
+
+// ExtensionKey is the service and project extension holding cicdez
+// settings compose has no field for
+const ExtensionKey = "x-cicdez"
+
+// CheckResolveImage rejects a --resolve-image value deployServices would
+// otherwise treat as never
+func CheckResolveImage(mode string) error {
+	if !slices.Contains(resolveImageModes, mode) {
+		return fmt.Errorf("invalid --resolve-image value %q, expected one of: %s", mode, strings.Join(resolveImageModes, ", "))
+	}
+	return nil
+}
+
+// resolveImageOverrides reads x-cicdez.resolve_image of every service, which
+// replaces --resolve-image for that service
+func resolveImageOverrides(services types.Services) (map[string]string, error) {
+	overrides := map[string]string{}
+	for name, svc := range services {
+		ext, ok := svc.Extensions[ExtensionKey]
+		if !ok {
+			continue
+		}
+		settings, ok := ext.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("service %s: %s must be a mapping", name, ExtensionKey)
+		}
+		value, ok := settings["resolve_image"]
+		if !ok {
+			continue
+		}
+		mode, ok := value.(string)
+		if !ok || !slices.Contains(resolveImageModes, mode) {
+			return nil, fmt.Errorf("service %s: invalid %s.resolve_image value %v, expected one of: %s", name, ExtensionKey, value, strings.Join(resolveImageModes, ", "))
+		}
+		overrides[name] = mode
+	}
+	return overrides, nil
+}
+
 type DeployOptions struct {
-	Secrets      vault.Secrets
-	Stack        string
-	Prune        bool
-	ResolveImage string
-	Quiet        bool
-	Detach       bool
-	Auth         *configfile.ConfigFile
-	Out          io.Writer
+	Secrets         vault.Secrets
+	Stack           string
+	Prune           bool
+	ResolveImage    string
+	Quiet           bool
+	Progress        bool
+	Detach          bool
+	Scale           map[string]uint64
+	StrictResources bool
+	StrictPlacement bool
+	CheckImages     bool
+	RecreateMode    bool
+	ForceRecreate   bool
+	NetworkRecreate bool
+	PruneNetworks   bool
+	PruneSecrets    bool
+	PruneConfigs    bool
+	Auth            *configfile.ConfigFile
+	Log             *log.Logger
+	Out             io.Writer
 }
 
-func Deploy(ctx context.Context, dockerClient client.APIClient, project types.Project, opts DeployOptions) error {
-	if err := processLocalConfigs(&project); err != nil {
-		return fmt.Errorf("failed to process local configs: %w", err)
+// Deploy converges the stack and returns the deployed services, ID to
+// scoped name, so a detached caller can wait on them later
+func Deploy(ctx context.Context, dockerClient client.APIClient, compose *Project, opts DeployOptions) (map[string]string, error) {
+	project, err := compose.Processed(opts.Secrets)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := processSensitiveSecrets(&project, opts.Secrets); err != nil {
-		return fmt.Errorf("failed to process sensitive secrets: %w", err)
+	order, err := dependencyOrder(project.Services)
+	if err != nil {
+		return nil, err
+	}
+	opts.Log.Debugf("service order: %s", strings.Join(order, ", "))
+
+	overrides, err := resolveImageOverrides(project.Services)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := checkDaemonIsSwarmManager(ctx, dockerClient); err != nil {
-		return err
+		return nil, err
+	}
+
+	if opts.CheckImages {
+		if err := checkImages(ctx, dockerClient, project, opts.Auth, opts.Quiet, opts.Out); err != nil {
+			return nil, err
+		}
+	}
+
+	// swarm rejects oversized objects only once they are created, check
+	// before the stack is touched
+	secrets, err := ConvertSecrets(opts.Stack, project.Secrets, project.Environment)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := ConvertConfigs(opts.Stack, project.Configs, project.Environment)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObjectSizes(secrets, configs, opts.Quiet, opts.Out); err != nil {
+		return nil, err
 	}
 
 	if opts.Prune {
@@ -58,52 +144,80 @@ func Deploy(ctx context.Context, dockerClient client.APIClient, project types.Pr
 			services[svc.Name] = struct{}{}
 		}
 		if err := pruneServices(ctx, dockerClient, opts.Stack, services, opts.Quiet, opts.Out); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	serviceNetworks := GetServicesDeclaredNetworks(project.Services)
-	networks, externalNetworks := ConvertNetworks(opts.Stack, project.Networks, serviceNetworks)
+	networks, externalNetworks, err := ConvertNetworks(opts.Stack, project.Networks, serviceNetworks)
+	if err != nil {
+		return nil, err
+	}
 	if err := validateExternalNetworks(ctx, dockerClient, externalNetworks); err != nil {
-		return err
+		return nil, err
 	}
-	if err := createNetworks(ctx, dockerClient, opts.Stack, networks, opts.Quiet, opts.Out); err != nil {
-		return err
+	if err := validateExternalObjects(ctx, dockerClient, opts.Stack, project); err != nil {
+		return nil, err
 	}
 
-	secrets, err := ConvertSecrets(opts.Stack, project.Secrets)
-	if err != nil {
-		return err
+	if err := createNetworks(ctx, dockerClient, opts.Stack, networks, opts.NetworkRecreate, opts.Quiet, opts.Out); err != nil {
+		return nil, err
 	}
 	if err := createSecrets(ctx, dockerClient, secrets, opts.Quiet, opts.Out); err != nil {
-		return err
-	}
-
-	configs, err := ConvertConfigs(opts.Stack, project.Configs)
-	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := createConfigs(ctx, dockerClient, configs, opts.Quiet, opts.Out); err != nil {
-		return err
+		return nil, err
 	}
 
 	services, err := ConvertServices(ctx, dockerClient, opts.Stack, project)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := applyScale(services, opts.Scale); err != nil {
+		return nil, err
+	}
+	if err := checkReservations(ctx, dockerClient, services, opts.StrictResources, opts.Quiet, opts.Out); err != nil {
+		return nil, err
+	}
+	if err := checkPlacement(ctx, dockerClient, services, opts.StrictPlacement, opts.Quiet, opts.Out); err != nil {
+		return nil, err
 	}
 
-	serviceNames, err := deployServices(ctx, dockerClient, services, opts.Stack, opts.ResolveImage, opts.Auth, opts.Quiet, opts.Out)
+	serviceNames, err := deployServices(ctx, dockerClient, services, order, opts.Stack, opts.ResolveImage, overrides, opts.RecreateMode, opts.ForceRecreate, opts.Auth, opts.Quiet, opts.Out, opts.Log)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if opts.Prune {
+		if err := pruneGeneratedObjects(ctx, dockerClient, opts.Stack, project, services, opts.Quiet, opts.Out); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PruneNetworks || opts.PruneSecrets || opts.PruneConfigs {
+		declared := make(map[string]struct{})
+		for name := range networks {
+			declared["network/"+name] = struct{}{}
+		}
+		for _, spec := range secrets {
+			declared["secret/"+spec.Name] = struct{}{}
+		}
+		for _, spec := range configs {
+			declared["config/"+spec.Name] = struct{}{}
+		}
+		kinds := orphanKinds{networks: opts.PruneNetworks, secrets: opts.PruneSecrets, configs: opts.PruneConfigs}
+		if err := pruneOrphans(ctx, dockerClient, opts.Stack, kinds, declared, services, opts.Quiet, opts.Out); err != nil {
+			return nil, err
+		}
 	}
 
 	if !opts.Detach && len(serviceNames) > 0 {
-		if err := waitOnServices(ctx, dockerClient, serviceNames, opts.Quiet, opts.Out); err != nil {
-			return err
+		if _, err := WaitOnServices(ctx, dockerClient, serviceNames, opts.Quiet, opts.Progress, opts.Out); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return serviceNames, nil
 }
 
 func checkDaemonIsSwarmManager(ctx context.Context, dockerClient client.APIClient) error {
@@ -118,9 +232,30 @@ func checkDaemonIsSwarmManager(ctx context.Context, dockerClient client.APIClien
 }
 
 func getStackFilter(stack string) client.Filters {
-	return make(client.Filters).Add("label", LabelNamespace+"="+stack)
+	return make(client.Filters).Add("label", stackLabel+"="+stack)
+}
+
+// ListStacks returns the sorted names of the stacks with services on the
+// swarm, any tool's stacks as long as they share the stack label
+func ListStacks(ctx context.Context, apiClient client.APIClient) ([]string, error) {
+	res, err := apiClient.ServiceList(ctx, client.ServiceListOptions{Filters: make(client.Filters).Add("label", stackLabel)})
+	if err != nil {
+		return nil, err
+	}
+	var stacks []string
+	for _, svc := range res.Items {
+		stack := svc.Spec.Labels[stackLabel]
+		if stack != "" && !slices.Contains(stacks, stack) {
+			stacks = append(stacks, stack)
+		}
+	}
+	slices.Sort(stacks)
+	return stacks, nil
 }
 
+// pruneServices removes the stack's cicdez-managed services missing from
+// services. A service without the marker was deployed by another tool, or
+// by a cicdez from before the marker existed, and is only warned about.
 func pruneServices(ctx context.Context, dockerClient client.APIClient, stack string, services map[string]struct{}, quiet bool, out io.Writer) error {
 	res, err := dockerClient.ServiceList(ctx, client.ServiceListOptions{Filters: getStackFilter(stack)})
 	if err != nil {
@@ -128,11 +263,24 @@ func pruneServices(ctx context.Context, dockerClient client.APIClient, stack str
 	}
 
 	toRemove := make([]swarm.Service, 0, len(res.Items))
+	var unmarked []string
 	for _, svc := range res.Items {
+		if svc.Spec.Labels[stackLabel] != stack {
+			continue
+		}
 		name := strings.TrimPrefix(svc.Spec.Name, stack+"_")
-		if _, exists := services[name]; !exists {
-			toRemove = append(toRemove, svc)
+		if _, exists := services[name]; exists {
+			continue
+		}
+		if svc.Spec.Labels[LabelManaged] != "true" {
+			unmarked = append(unmarked, svc.Spec.Name)
+			continue
 		}
+		toRemove = append(toRemove, svc)
+	}
+	slices.Sort(unmarked)
+	for _, name := range unmarked {
+		fmt.Fprintf(out, "%s service %s has no %s label and is not pruned, remove it with docker service rm if cicdez deployed it\n", WarningPrefix(), name, LabelManaged)
 	}
 	sort.Slice(toRemove, func(i, j int) bool {
 		return toRemove[i].Spec.Name < toRemove[j].Spec.Name
@@ -150,6 +298,288 @@ func pruneServices(ctx context.Context, dockerClient client.APIClient, stack str
 	return pruneErr
 }
 
+// pruneGeneratedObjects removes the content-addressed secrets and configs
+// (sensitive and local_configs output) that earlier deploys of the stack left
+// behind. An object goes only when its name is a generated base plus a hash
+// that is no longer declared, and no service references it: the stack's
+// services by their just deployed specs, any other service by its current one.
+func pruneGeneratedObjects(ctx context.Context, apiClient client.APIClient, stack string, project types.Project, deployed map[string]swarm.ServiceSpec, quiet bool, out io.Writer) error {
+	secretBases := make(map[string]struct{})
+	configBases := make(map[string]struct{})
+	for _, svc := range project.Services {
+		for name, sensitive := range svc.Sensitive {
+			if sensitive.Type == vault.SensitiveTypeConfig {
+				configBases[name] = struct{}{}
+			} else {
+				secretBases[name] = struct{}{}
+			}
+		}
+		for name := range svc.LocalConfigs {
+			configBases[name] = struct{}{}
+		}
+	}
+	if len(secretBases) == 0 && len(configBases) == 0 {
+		return nil
+	}
+
+	referenced, err := serviceReferences(ctx, apiClient, deployed)
+	if err != nil {
+		return err
+	}
+
+	orphaned := func(kind, name string, bases map[string]struct{}, declared map[string]struct{}) bool {
+		if _, ok := declared[name]; ok {
+			return false
+		}
+		if _, ok := referenced[kind+"/"+name]; ok {
+			return false
+		}
+		for base := range bases {
+			hash, ok := strings.CutPrefix(name, ScopeName(stack, base)+"_")
+			if ok && isContentHash(hash) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var pruneErr error
+
+	declaredSecrets := make(map[string]struct{}, len(project.Secrets))
+	for key := range project.Secrets {
+		declaredSecrets[ScopeName(stack, key)] = struct{}{}
+	}
+	secrets, err := apiClient.SecretList(ctx, client.SecretListOptions{Filters: getStackFilter(stack)})
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, secret := range secrets.Items {
+		if !orphaned("secret", secret.Spec.Name, secretBases, declaredSecrets) {
+			continue
+		}
+		if !quiet {
+			fmt.Fprintf(out, "Removing secret %s\n", secret.Spec.Name)
+		}
+		if _, err := apiClient.SecretRemove(ctx, secret.ID, client.SecretRemoveOptions{}); err != nil {
+			pruneErr = errors.Join(pruneErr, fmt.Errorf("failed to remove secret %s: %w", secret.Spec.Name, err))
+		}
+	}
+
+	declaredConfigs := make(map[string]struct{}, len(project.Configs))
+	for key := range project.Configs {
+		declaredConfigs[ScopeName(stack, key)] = struct{}{}
+	}
+	configs, err := apiClient.ConfigList(ctx, client.ConfigListOptions{Filters: getStackFilter(stack)})
+	if err != nil {
+		return fmt.Errorf("failed to list configs: %w", err)
+	}
+	for _, config := range configs.Items {
+		if !orphaned("config", config.Spec.Name, configBases, declaredConfigs) {
+			continue
+		}
+		if !quiet {
+			fmt.Fprintf(out, "Removing config %s\n", config.Spec.Name)
+		}
+		if _, err := apiClient.ConfigRemove(ctx, config.ID, client.ConfigRemoveOptions{}); err != nil {
+			pruneErr = errors.Join(pruneErr, fmt.Errorf("failed to remove config %s: %w", config.Spec.Name, err))
+		}
+	}
+
+	return pruneErr
+}
+
+// serviceReferences collects the networks, secrets and configs services use,
+// as "kind/name" and "kind/ID" keys: the stack's services by their just
+// deployed specs, any other service by its current one
+func serviceReferences(ctx context.Context, apiClient client.APIClient, deployed map[string]swarm.ServiceSpec) (map[string]struct{}, error) {
+	referenced := make(map[string]struct{})
+	addRefs := func(spec swarm.ServiceSpec) {
+		for _, nw := range spec.TaskTemplate.Networks {
+			referenced["network/"+nw.Target] = struct{}{}
+		}
+		cs := spec.TaskTemplate.ContainerSpec
+		if cs == nil {
+			return
+		}
+		for _, ref := range cs.Secrets {
+			referenced["secret/"+ref.SecretName] = struct{}{}
+			referenced["secret/"+ref.SecretID] = struct{}{}
+		}
+		for _, ref := range cs.Configs {
+			referenced["config/"+ref.ConfigName] = struct{}{}
+			referenced["config/"+ref.ConfigID] = struct{}{}
+		}
+	}
+	deployedNames := make(map[string]struct{}, len(deployed))
+	for _, spec := range deployed {
+		deployedNames[spec.Name] = struct{}{}
+		addRefs(spec)
+	}
+	res, err := apiClient.ServiceList(ctx, client.ServiceListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range res.Items {
+		if _, ok := deployedNames[svc.Spec.Name]; !ok {
+			addRefs(svc.Spec)
+		}
+	}
+	return referenced, nil
+}
+
+// orphanKinds are the object kinds pruneOrphans looks at
+type orphanKinds struct {
+	networks bool
+	secrets  bool
+	configs  bool
+}
+
+// pruneOrphans removes the stack's networks, secrets and configs of the
+// selected kinds that aren't in declared, as "kind/name" keys, and that no
+// service uses. A network that can't be removed yet, because tasks leaving
+// it are still shutting down, is only warned about.
+func pruneOrphans(ctx context.Context, apiClient client.APIClient, stack string, kinds orphanKinds, declared map[string]struct{}, deployed map[string]swarm.ServiceSpec, quiet bool, out io.Writer) error {
+	referenced, err := serviceReferences(ctx, apiClient, deployed)
+	if err != nil {
+		return err
+	}
+	orphaned := func(kind, id, name string, labels map[string]string) bool {
+		if labels[stackLabel] != stack {
+			return false
+		}
+		for _, key := range []string{kind + "/" + name, kind + "/" + id} {
+			if _, ok := declared[key]; ok {
+				return false
+			}
+			if _, ok := referenced[key]; ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	var pruneErr error
+
+	if kinds.secrets {
+		res, err := apiClient.SecretList(ctx, client.SecretListOptions{Filters: getStackFilter(stack)})
+		if err != nil {
+			return fmt.Errorf("failed to list secrets: %w", err)
+		}
+		slices.SortFunc(res.Items, func(a, b swarm.Secret) int { return strings.Compare(a.Spec.Name, b.Spec.Name) })
+		for _, secret := range res.Items {
+			if !orphaned("secret", secret.ID, secret.Spec.Name, secret.Spec.Labels) {
+				continue
+			}
+			if !quiet {
+				fmt.Fprintf(out, "Removing secret %s\n", secret.Spec.Name)
+			}
+			if _, err := apiClient.SecretRemove(ctx, secret.ID, client.SecretRemoveOptions{}); err != nil {
+				pruneErr = errors.Join(pruneErr, fmt.Errorf("failed to remove secret %s: %w", secret.Spec.Name, err))
+			}
+		}
+	}
+
+	if kinds.configs {
+		res, err := apiClient.ConfigList(ctx, client.ConfigListOptions{Filters: getStackFilter(stack)})
+		if err != nil {
+			return fmt.Errorf("failed to list configs: %w", err)
+		}
+		slices.SortFunc(res.Items, func(a, b swarm.Config) int { return strings.Compare(a.Spec.Name, b.Spec.Name) })
+		for _, config := range res.Items {
+			if !orphaned("config", config.ID, config.Spec.Name, config.Spec.Labels) {
+				continue
+			}
+			if !quiet {
+				fmt.Fprintf(out, "Removing config %s\n", config.Spec.Name)
+			}
+			if _, err := apiClient.ConfigRemove(ctx, config.ID, client.ConfigRemoveOptions{}); err != nil {
+				pruneErr = errors.Join(pruneErr, fmt.Errorf("failed to remove config %s: %w", config.Spec.Name, err))
+			}
+		}
+	}
+
+	if kinds.networks {
+		res, err := apiClient.NetworkList(ctx, client.NetworkListOptions{Filters: getStackFilter(stack)})
+		if err != nil {
+			return fmt.Errorf("failed to list networks: %w", err)
+		}
+		slices.SortFunc(res.Items, func(a, b network.Summary) int { return strings.Compare(a.Name, b.Name) })
+		for _, nw := range res.Items {
+			if !orphaned("network", nw.ID, nw.Name, nw.Labels) {
+				continue
+			}
+			if !quiet {
+				fmt.Fprintf(out, "Removing network %s\n", nw.Name)
+			}
+			if _, err := apiClient.NetworkRemove(ctx, nw.ID, client.NetworkRemoveOptions{}); err != nil {
+				fmt.Fprintf(out, "%s failed to remove network %s, run the deploy again once its tasks are gone: %v\n", WarningPrefix(), nw.Name, err)
+			}
+		}
+	}
+
+	return pruneErr
+}
+
+// isContentHash reports whether s looks like the suffix hashedName appends
+func isContentHash(s string) bool {
+	if len(s) != 8 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// validateExternalObjects checks that every external secret and config a
+// service references exists, reporting all missing ones at once instead of
+// failing on the first during service conversion
+func validateExternalObjects(ctx context.Context, apiClient client.APIClient, stack string, project types.Project) error {
+	secretRefs := make(map[string]struct{})
+	configRefs := make(map[string]struct{})
+	for _, svc := range project.Services {
+		for _, ref := range svc.Secrets {
+			secretRefs[ref.Source] = struct{}{}
+		}
+		for _, ref := range svc.Configs {
+			configRefs[ref.Source] = struct{}{}
+		}
+	}
+
+	var missing []string
+	for _, key := range slices.Sorted(maps.Keys(secretRefs)) {
+		secret, ok := project.Secrets[key]
+		if !ok || !secret.External {
+			continue
+		}
+		name := objectName(stack, key, secret.Name, true)
+		_, err := apiClient.SecretInspect(ctx, name, client.SecretInspectOptions{})
+		switch {
+		case errdefs.IsNotFound(err):
+			missing = append(missing, fmt.Sprintf("secret %q", name))
+		case err != nil:
+			return fmt.Errorf("failed to inspect external secret %s: %w", name, err)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(configRefs)) {
+		config, ok := project.Configs[key]
+		if !ok || !config.External {
+			continue
+		}
+		name := objectName(stack, key, config.Name, true)
+		_, err := apiClient.ConfigInspect(ctx, name, client.ConfigInspectOptions{})
+		switch {
+		case errdefs.IsNotFound(err):
+			missing = append(missing, fmt.Sprintf("config %q", name))
+		case err != nil:
+			return fmt.Errorf("failed to inspect external config %s: %w", name, err)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("external objects not found, create them on the swarm before deploying: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 func validateExternalNetworks(ctx context.Context, apiClient client.APIClient, externalNetworks []string) error {
 	for _, networkName := range externalNetworks {
 		if !container.NetworkMode(networkName).IsUserDefined() {
@@ -168,7 +598,10 @@ func validateExternalNetworks(ctx context.Context, apiClient client.APIClient, e
 	return nil
 }
 
-func createNetworks(ctx context.Context, apiClient client.APIClient, stack string, networks map[string]client.NetworkCreateOptions, quiet bool, out io.Writer) error {
+// createNetworks creates the stack networks that don't exist yet. With
+// recreate, existing networks whose settings changed are removed and created
+// again, unless a service is still attached to them.
+func createNetworks(ctx context.Context, apiClient client.APIClient, stack string, networks map[string]client.NetworkCreateOptions, recreate, quiet bool, out io.Writer) error {
 	res, err := apiClient.NetworkList(ctx, client.NetworkListOptions{Filters: getStackFilter(stack)})
 	if err != nil {
 		return err
@@ -179,17 +612,37 @@ func createNetworks(ctx context.Context, apiClient client.APIClient, stack strin
 		existingNetworkMap[nw.Name] = nw
 	}
 
-	for name, createOpts := range networks {
-		if _, exists := existingNetworkMap[name]; exists {
-			continue
-		}
-
+	var services []swarm.Service
+	for _, name := range slices.Sorted(maps.Keys(networks)) {
+		createOpts := networks[name]
 		if createOpts.Driver == "" {
 			createOpts.Driver = DefaultNetworkDriver
 		}
 
+		action := "Creating"
+		if existing, exists := existingNetworkMap[name]; exists {
+			if !recreate || !networkChanged(existing, createOpts) {
+				continue
+			}
+			if services == nil {
+				list, err := apiClient.ServiceList(ctx, client.ServiceListOptions{})
+				if err != nil {
+					return fmt.Errorf("failed to list services: %w", err)
+				}
+				services = list.Items
+			}
+			if users := networkUsers(services, existing); len(users) > 0 {
+				fmt.Fprintf(out, "%s network %s changed but is still used by %s, leaving it as is\n", WarningPrefix(), name, strings.Join(users, ", "))
+				continue
+			}
+			if _, err := apiClient.NetworkRemove(ctx, existing.ID, client.NetworkRemoveOptions{}); err != nil {
+				return fmt.Errorf("failed to remove network %s: %w", name, err)
+			}
+			action = "Recreating"
+		}
+
 		if !quiet {
-			fmt.Fprintf(out, "Creating network %s\n", name)
+			fmt.Fprintf(out, "%s network %s\n", action, name)
 		}
 		if _, err := apiClient.NetworkCreate(ctx, name, createOpts); err != nil {
 			return fmt.Errorf("failed to create network %s: %w", name, err)
@@ -198,6 +651,41 @@ func createNetworks(ctx context.Context, apiClient client.APIClient, stack strin
 	return nil
 }
 
+// networkChanged compares the settings deploy creates a network with. Options
+// the daemon adds on its own, such as the overlay vxlan ids, are ignored.
+func networkChanged(existing network.Summary, desired client.NetworkCreateOptions) bool {
+	if existing.Driver != desired.Driver || existing.Internal != desired.Internal || existing.Attachable != desired.Attachable {
+		return true
+	}
+	if desired.EnableIPv6 != nil && existing.EnableIPv6 != *desired.EnableIPv6 {
+		return true
+	}
+	if !maps.Equal(existing.Labels, desired.Labels) {
+		return true
+	}
+	for key, value := range desired.Options {
+		if current, ok := existing.Options[key]; !ok || current != value {
+			return true
+		}
+	}
+	return false
+}
+
+// networkUsers lists the services attached to nw, by network ID or name
+func networkUsers(services []swarm.Service, nw network.Summary) []string {
+	var users []string
+	for _, svc := range services {
+		for _, attachment := range svc.Spec.TaskTemplate.Networks {
+			if attachment.Target == nw.ID || attachment.Target == nw.Name {
+				users = append(users, svc.Spec.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
 func createSecrets(ctx context.Context, apiClient client.APIClient, secrets []swarm.SecretSpec, quiet bool, out io.Writer) error {
 	for _, secretSpec := range secrets {
 		res, err := apiClient.SecretInspect(ctx, secretSpec.Name, client.SecretInspectOptions{})
@@ -262,7 +750,10 @@ func createConfigs(ctx context.Context, apiClient client.APIClient, configs []sw
 	return nil
 }
 
-func deployServices(ctx context.Context, apiClient client.APIClient, services map[string]swarm.ServiceSpec, stack string, resolveImage string, authCfg *configfile.ConfigFile, quiet bool, out io.Writer) (map[string]string, error) {
+// deployServices creates or updates services in the given order, so
+// depends_on targets exist before their dependents. overrides replaces
+// resolveImage per compose service.
+func deployServices(ctx context.Context, apiClient client.APIClient, services map[string]swarm.ServiceSpec, order []string, stack string, resolveImage string, overrides map[string]string, recreate, force bool, authCfg *configfile.ConfigFile, quiet bool, out io.Writer, logger *log.Logger) (map[string]string, error) {
 	res, err := apiClient.ServiceList(ctx, client.ServiceListOptions{Filters: getStackFilter(stack)})
 	if err != nil {
 		return nil, err
@@ -275,24 +766,47 @@ func deployServices(ctx context.Context, apiClient client.APIClient, services ma
 
 	serviceNames := make(map[string]string, len(services))
 
-	for internalName, serviceSpec := range services {
+	for _, internalName := range order {
+		serviceSpec := services[internalName]
 		name := ScopeName(stack, internalName)
 		image := serviceSpec.TaskTemplate.ContainerSpec.Image
 
 		encodedAuth := encodeAuth(resolveAuth(authCfg, image))
 
-		// loaded images have no registry manifest to resolve
+		// loaded images have no registry manifest to resolve, the override
+		// must not leak into the services after this one
+		mode := resolveImage
+		if override, ok := overrides[internalName]; ok {
+			mode = override
+		}
 		if IsRegistryless(image) {
-			resolveImage = ResolveImageNever
+			mode = ResolveImageNever
 		}
 
-		if svc, exists := existingServiceMap[name]; exists {
+		svc, exists := existingServiceMap[name]
+		if from, to := serviceModeName(svc.Spec.Mode), serviceModeName(serviceSpec.Mode); exists && from != to {
+			if !recreate {
+				return nil, fmt.Errorf("service %s changes mode from %s to %s, which swarm can't update in place, remove it first or deploy with --recreate-on-mode-change", name, from, to)
+			}
+			if !quiet {
+				fmt.Fprintf(out, "Removing service %s to change its mode from %s to %s\n", name, from, to)
+			}
+			// published ports are freed with the service and claimed again
+			// by the create right after
+			logger.Debugf("removing service %s at version %d", name, svc.Version.Index)
+			if _, err := apiClient.ServiceRemove(ctx, svc.ID, client.ServiceRemoveOptions{}); err != nil {
+				return nil, fmt.Errorf("failed to remove service %s: %w", name, err)
+			}
+			exists = false
+		}
+
+		if exists {
 			updateOpts := client.ServiceUpdateOptions{
 				Version:             svc.Version,
 				EncodedRegistryAuth: encodedAuth,
 			}
 
-			switch resolveImage {
+			switch mode {
 			case ResolveImageAlways:
 				updateOpts.QueryRegistry = true
 			case ResolveImageChanged:
@@ -307,9 +821,15 @@ func deployServices(ctx context.Context, apiClient client.APIClient, services ma
 				}
 			}
 
+			// swarm leaves the tasks alone when the spec is unchanged, a
+			// bumped ForceUpdate replaces them anyway
 			serviceSpec.TaskTemplate.ForceUpdate = svc.Spec.TaskTemplate.ForceUpdate
+			if force {
+				serviceSpec.TaskTemplate.ForceUpdate++
+			}
 			updateOpts.Spec = serviceSpec
 
+			logger.Debugf("updating service %s at version %d, image %s, query registry %t", name, svc.Version.Index, serviceSpec.TaskTemplate.ContainerSpec.Image, updateOpts.QueryRegistry)
 			_, err := apiClient.ServiceUpdate(ctx, svc.ID, updateOpts)
 			if err != nil {
 				return nil, fmt.Errorf("failed to update service %s: %w", name, err)
@@ -325,8 +845,9 @@ func deployServices(ctx context.Context, apiClient client.APIClient, services ma
 				fmt.Fprintf(out, "Creating service %s\n", name)
 			}
 
-			queryRegistry := resolveImage == ResolveImageAlways || resolveImage == ResolveImageChanged
+			queryRegistry := mode == ResolveImageAlways || mode == ResolveImageChanged
 
+			logger.Debugf("creating service %s, image %s, query registry %t", name, image, queryRegistry)
 			response, err := apiClient.ServiceCreate(ctx, client.ServiceCreateOptions{
 				Spec:                serviceSpec,
 				EncodedRegistryAuth: encodedAuth,
@@ -343,6 +864,61 @@ func deployServices(ctx context.Context, apiClient client.APIClient, services ma
 	return serviceNames, nil
 }
 
+// dependencyOrder sorts services so every service comes after the ones it
+// depends_on. Only creation order is affected, not runtime readiness. Ties
+// are broken by name to keep deploys deterministic.
+func dependencyOrder(services types.Services) ([]string, error) {
+	dependents := make(map[string][]string, len(services))
+	pending := make(map[string]int, len(services))
+	for name := range services {
+		pending[name] = 0
+	}
+	for name, svc := range services {
+		for dep := range svc.DependsOn {
+			// dependencies outside the project (e.g. other profiles) don't constrain
+			if _, ok := services[dep]; !ok {
+				continue
+			}
+			dependents[dep] = append(dependents[dep], name)
+			pending[name]++
+		}
+	}
+
+	var ready []string
+	for name, n := range pending {
+		if n == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	order := make([]string, 0, len(services))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) < len(services) {
+		var cycle []string
+		for name, n := range pending {
+			if n > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("depends_on cycle involving services: %s", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
 func HasBuildConfig(project types.Project) bool {
 	for _, svc := range project.Services {
 		if svc.Build != nil {
@@ -394,6 +970,9 @@ func processSensitiveSecrets(project *types.Project, allSecrets vault.Secrets) e
 	if project.Secrets == nil {
 		project.Secrets = make(types.Secrets)
 	}
+	if project.Configs == nil {
+		project.Configs = make(types.Configs)
+	}
 
 	for svcName, svc := range project.Services {
 		for name, sensitive := range svc.Sensitive {
@@ -402,18 +981,33 @@ func processSensitiveSecrets(project *types.Project, allSecrets vault.Secrets) e
 				return fmt.Errorf("failed to format sensitive secrets for service %s target %s: %w", svc.Name, sensitive.Target, err)
 			}
 
-			secretName := hashedName(name, content)
-			project.Secrets[secretName] = types.SecretConfig{
-				Content: string(content),
+			objName := hashedName(name, content)
+			switch sensitive.Type {
+			case vault.SensitiveTypeSecret, "":
+				project.Secrets[objName] = types.SecretConfig{
+					Content: string(content),
+				}
+				svc.Secrets = append(svc.Secrets, types.ServiceSecretConfig{
+					Source: objName,
+					Target: sensitive.Target,
+					UID:    sensitive.UID,
+					GID:    sensitive.GID,
+					Mode:   sensitive.Mode,
+				})
+			case vault.SensitiveTypeConfig:
+				project.Configs[objName] = types.ConfigObjConfig{
+					Content: string(content),
+				}
+				svc.Configs = append(svc.Configs, types.ServiceConfigObjConfig{
+					Source: objName,
+					Target: sensitive.Target,
+					UID:    sensitive.UID,
+					GID:    sensitive.GID,
+					Mode:   sensitive.Mode,
+				})
+			default:
+				return fmt.Errorf("unknown sensitive type %q for service %s target %s", sensitive.Type, svc.Name, sensitive.Target)
 			}
-
-			svc.Secrets = append(svc.Secrets, types.ServiceSecretConfig{
-				Source: secretName,
-				Target: sensitive.Target,
-				UID:    sensitive.UID,
-				GID:    sensitive.GID,
-				Mode:   sensitive.Mode,
-			})
 		}
 		project.Services[svcName] = svc
 	}
@@ -1,10 +1,23 @@
 package docker
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
 )
 
 func TestProcessSensitiveSecrets_ExplicitTarget(t *testing.T) {
@@ -43,3 +56,862 @@ func TestProcessSensitiveSecrets_ExplicitTarget(t *testing.T) {
 		t.Errorf("expected target '/app/secrets/password', got '%s'", webService.Secrets[0].Target)
 	}
 }
+
+func TestProcessSensitiveSecrets_ConfigType(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Sensitive: map[string]types.SensitiveConfig{
+					"app_conf": {
+						Type:    vault.SensitiveTypeConfig,
+						Target:  "/etc/app.conf",
+						Format:  "env",
+						Secrets: []types.SensitiveSecret{{Source: "db_host"}},
+					},
+				},
+			},
+		},
+	}
+
+	if err := processSensitiveSecrets(&project, vault.Secrets{"db_host": "db.internal"}); err != nil {
+		t.Fatalf("processSensitiveSecrets failed: %v", err)
+	}
+
+	web := project.Services["web"]
+	if len(web.Secrets) != 0 || len(project.Secrets) != 0 {
+		t.Errorf("expected no secret for a config-typed entry, got %v", web.Secrets)
+	}
+	if len(web.Configs) != 1 || web.Configs[0].Target != "/etc/app.conf" {
+		t.Fatalf("expected a config reference at /etc/app.conf, got %v", web.Configs)
+	}
+	source := web.Configs[0].Source
+	if !strings.HasPrefix(source, "app_conf_") {
+		t.Errorf("expected content-addressed config name, got %s", source)
+	}
+	if got := project.Configs[source].Content; got != "db_host=db.internal\n" {
+		t.Errorf("unexpected config content %q", got)
+	}
+}
+
+func TestDeployDetachAndWait(t *testing.T) {
+	newProject := func() types.Project {
+		return types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name:  "web",
+					Image: "nginx",
+					Deploy: &types.DeployConfig{
+						// keep the convergence monitor window short for the test
+						UpdateConfig: &types.UpdateConfig{Monitor: types.Duration(time.Millisecond)},
+					},
+				},
+			},
+		}
+	}
+	newClient := func() *fakeClient {
+		return &fakeClient{
+			tasks: []swarm.Task{{
+				Slot:         1,
+				NodeID:       "node-1",
+				DesiredState: swarm.TaskStateRunning,
+				Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+			}},
+			nodes: []swarm.Node{{ID: "node-1", Status: swarm.NodeStatus{State: swarm.NodeStateReady}}},
+		}
+	}
+
+	t.Run("detach", func(t *testing.T) {
+		fc := newClient()
+		services, err := Deploy(context.Background(), fc, LoadedProject(newProject()), DeployOptions{
+			Stack:        "stack",
+			ResolveImage: ResolveImageNever,
+			Quiet:        true,
+			Detach:       true,
+			Out:          io.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Deploy failed: %v", err)
+		}
+		if services["stack_web-id"] != "stack_web" {
+			t.Errorf("expected created service to be returned, got %v", services)
+		}
+		if fc.taskLists != 0 {
+			t.Errorf("expected detached deploy not to wait, got %d task lists", fc.taskLists)
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		fc := newClient()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		services, err := Deploy(ctx, fc, LoadedProject(newProject()), DeployOptions{
+			Stack:        "stack",
+			ResolveImage: ResolveImageNever,
+			Quiet:        true,
+			Out:          io.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Deploy failed: %v", err)
+		}
+		if len(services) != 1 {
+			t.Errorf("expected 1 service, got %v", services)
+		}
+		if fc.taskLists == 0 {
+			t.Error("expected deploy to wait on the service tasks")
+		}
+		if ctx.Err() != nil {
+			t.Error("expected convergence before the timeout")
+		}
+	})
+}
+
+func TestDependencyOrder(t *testing.T) {
+	dependsOn := func(deps ...string) types.DependsOnConfig {
+		cfg := types.DependsOnConfig{}
+		for _, d := range deps {
+			cfg[d] = types.ServiceDependency{Condition: types.ServiceConditionStarted, Required: true}
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name     string
+		services types.Services
+		want     []string
+		wantErr  string
+	}{
+		{
+			name: "linear chain",
+			services: types.Services{
+				"web": {Name: "web", DependsOn: dependsOn("api")},
+				"api": {Name: "api", DependsOn: dependsOn("db")},
+				"db":  {Name: "db"},
+			},
+			want: []string{"db", "api", "web"},
+		},
+		{
+			name: "diamond",
+			services: types.Services{
+				"web":    {Name: "web", DependsOn: dependsOn("api", "worker")},
+				"api":    {Name: "api", DependsOn: dependsOn("db")},
+				"worker": {Name: "worker", DependsOn: dependsOn("db")},
+				"db":     {Name: "db"},
+			},
+			want: []string{"db", "api", "worker", "web"},
+		},
+		{
+			name: "cycle",
+			services: types.Services{
+				"a":   {Name: "a", DependsOn: dependsOn("b")},
+				"b":   {Name: "b", DependsOn: dependsOn("a")},
+				"ok":  {Name: "ok"},
+				"web": {Name: "web", DependsOn: dependsOn("ok")},
+			},
+			wantErr: "depends_on cycle involving services: a, b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dependencyOrder(tt.services)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected order %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDeployServicesCreateOrUpdate(t *testing.T) {
+	spec := func(name, image string) swarm.ServiceSpec {
+		return swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: name, Labels: map[string]string{LabelImage: image}},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{Image: image},
+			},
+		}
+	}
+	existing := func() swarm.Service {
+		svc := swarm.Service{
+			ID:   "web-id",
+			Meta: swarm.Meta{Version: swarm.Version{Index: 9}},
+			Spec: spec("stack_web", "nginx:1.25"),
+		}
+		svc.Spec.TaskTemplate.ContainerSpec.Image = "nginx:1.25@sha256:abc"
+		svc.Spec.TaskTemplate.ForceUpdate = 5
+		return svc
+	}
+
+	tests := []struct {
+		name          string
+		resolveImage  string
+		image         string
+		wantImage     string
+		queryRegistry bool
+	}{
+		{"always resolves", ResolveImageAlways, "nginx:1.25", "nginx:1.25", true},
+		{"changed keeps pinned digest", ResolveImageChanged, "nginx:1.25", "nginx:1.25@sha256:abc", false},
+		{"changed resolves new image", ResolveImageChanged, "nginx:1.27", "nginx:1.27", true},
+		{"never keeps pinned digest", ResolveImageNever, "nginx:1.25", "nginx:1.25@sha256:abc", false},
+		{"never takes new image as is", ResolveImageNever, "nginx:1.27", "nginx:1.27", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := &fakeClient{services: map[string]swarm.Service{"stack_web": existing()}}
+			services := map[string]swarm.ServiceSpec{
+				"web": spec("stack_web", tt.image),
+				"api": spec("stack_api", "api:latest"),
+			}
+
+			names, err := deployServices(context.Background(), fc, services, []string{"api", "web"}, "stack", tt.resolveImage, nil, false, false, nil, true, io.Discard, nil)
+			if err != nil {
+				t.Fatalf("deployServices failed: %v", err)
+			}
+			if names["web-id"] != "stack_web" || names["stack_api-id"] != "stack_api" {
+				t.Errorf("unexpected service names: %v", names)
+			}
+
+			if len(fc.serviceCreates) != 1 || fc.serviceCreates[0].Spec.TaskTemplate.ContainerSpec.Image != "api:latest" {
+				t.Fatalf("expected api to be created, got %+v", fc.serviceCreates)
+			}
+			if len(fc.serviceUpdates) != 1 {
+				t.Fatalf("expected web to be updated, got %d updates", len(fc.serviceUpdates))
+			}
+
+			update := fc.serviceUpdates[0]
+			if update.Version.Index != 9 {
+				t.Errorf("expected update at version 9, got %d", update.Version.Index)
+			}
+			if got := update.Spec.TaskTemplate.ContainerSpec.Image; got != tt.wantImage {
+				t.Errorf("expected image %s, got %s", tt.wantImage, got)
+			}
+			if update.QueryRegistry != tt.queryRegistry {
+				t.Errorf("expected QueryRegistry %v, got %v", tt.queryRegistry, update.QueryRegistry)
+			}
+			if update.Spec.TaskTemplate.ForceUpdate != 5 {
+				t.Errorf("expected ForceUpdate to be carried over, got %d", update.Spec.TaskTemplate.ForceUpdate)
+			}
+		})
+	}
+}
+
+func TestDeployServicesNeverQueriesRegistry(t *testing.T) {
+	spec := func(name, image string) swarm.ServiceSpec {
+		return swarm.ServiceSpec{
+			Annotations:  swarm.Annotations{Name: name, Labels: map[string]string{LabelImage: image}},
+			TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: image}},
+		}
+	}
+	fc := &fakeClient{services: map[string]swarm.Service{
+		"stack_web": {ID: "web-id", Spec: spec("stack_web", "nginx:1.25")},
+	}}
+	services := map[string]swarm.ServiceSpec{
+		"api": spec("stack_api", "api:latest"),
+		"web": spec("stack_web", "nginx:1.27"),
+	}
+
+	if _, err := deployServices(context.Background(), fc, services, []string{"api", "web"}, "stack", ResolveImageNever, nil, false, false, nil, true, io.Discard, nil); err != nil {
+		t.Fatalf("deployServices failed: %v", err)
+	}
+
+	if len(fc.serviceCreates) != 1 || len(fc.serviceUpdates) != 1 {
+		t.Fatalf("expected one create and one update, got %d and %d", len(fc.serviceCreates), len(fc.serviceUpdates))
+	}
+	for _, c := range fc.serviceCreates {
+		if c.QueryRegistry {
+			t.Errorf("expected no registry query creating %s", c.Spec.Name)
+		}
+	}
+	for _, u := range fc.serviceUpdates {
+		if u.QueryRegistry {
+			t.Errorf("expected no registry query updating %s", u.Spec.Name)
+		}
+	}
+}
+
+func TestDeployServicesResolveImageOverride(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "compose.yaml")
+	err := os.WriteFile(composeFile, []byte(`
+services:
+  web:
+    image: ghcr.io/acme/web:latest
+    x-cicdez:
+      resolve_image: always
+  db:
+    image: postgres:16
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	project, err := LoadCompose(context.Background(), nil, composeFile)
+	if err != nil {
+		t.Fatalf("LoadCompose failed: %v", err)
+	}
+
+	overrides, err := resolveImageOverrides(project.Services)
+	if err != nil {
+		t.Fatalf("resolveImageOverrides failed: %v", err)
+	}
+	if !maps.Equal(overrides, map[string]string{"web": ResolveImageAlways}) {
+		t.Fatalf("expected only web to override, got %v", overrides)
+	}
+
+	services, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+	fc := &fakeClient{}
+	if _, err := deployServices(context.Background(), fc, services, []string{"db", "web"}, "stack", ResolveImageNever, overrides, false, false, nil, true, io.Discard, nil); err != nil {
+		t.Fatalf("deployServices failed: %v", err)
+	}
+
+	query := map[string]bool{}
+	for _, c := range fc.serviceCreates {
+		query[c.Spec.Name] = c.QueryRegistry
+	}
+	if !query["stack_web"] || query["stack_db"] {
+		t.Errorf("expected only web to query the registry, got %v", query)
+	}
+}
+
+func TestResolveImageOverridesInvalid(t *testing.T) {
+	services := types.Services{
+		"web": {Name: "web", Extensions: types.Extensions{ExtensionKey: map[string]any{"resolve_image": "sometimes"}}},
+	}
+	_, err := resolveImageOverrides(services)
+	if err == nil || !strings.Contains(err.Error(), "service web: invalid x-cicdez.resolve_image value sometimes") {
+		t.Fatalf("expected an invalid value error, got %v", err)
+	}
+}
+
+func TestDeployServicesRegistrylessDoesNotLeak(t *testing.T) {
+	fc := &fakeClient{}
+	services := map[string]swarm.ServiceSpec{
+		"local": {
+			Annotations:  swarm.Annotations{Name: "stack_local"},
+			TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "registryless/local:latest"}},
+		},
+		"web": {
+			Annotations:  swarm.Annotations{Name: "stack_web"},
+			TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "nginx:1.27"}},
+		},
+	}
+
+	if _, err := deployServices(context.Background(), fc, services, []string{"local", "web"}, "stack", ResolveImageAlways, nil, false, false, nil, true, io.Discard, nil); err != nil {
+		t.Fatalf("deployServices failed: %v", err)
+	}
+
+	if len(fc.serviceCreates) != 2 {
+		t.Fatalf("expected two creates, got %d", len(fc.serviceCreates))
+	}
+	if fc.serviceCreates[0].QueryRegistry {
+		t.Error("expected the registryless image not to be resolved")
+	}
+	if !fc.serviceCreates[1].QueryRegistry {
+		t.Error("expected web to still be resolved after a registryless service")
+	}
+}
+
+func TestDeployServicesModeChange(t *testing.T) {
+	replicas := uint64(2)
+	spec := func(name string, mode swarm.ServiceMode) swarm.ServiceSpec {
+		return swarm.ServiceSpec{
+			Annotations:  swarm.Annotations{Name: name},
+			Mode:         mode,
+			TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "nginx:1.27"}},
+		}
+	}
+	replicated := swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}
+	global := swarm.ServiceMode{Global: &swarm.GlobalService{}}
+	existing := func() *fakeClient {
+		return &fakeClient{services: map[string]swarm.Service{
+			"stack_agent": {ID: "agent-id", Spec: spec("stack_agent", replicated)},
+			"stack_web":   {ID: "web-id", Spec: spec("stack_web", replicated)},
+		}}
+	}
+	services := map[string]swarm.ServiceSpec{
+		"agent": spec("stack_agent", global),
+		"web":   spec("stack_web", replicated),
+	}
+	order := []string{"agent", "web"}
+
+	fc := existing()
+	_, err := deployServices(context.Background(), fc, services, order, "stack", ResolveImageNever, nil, false, false, nil, true, io.Discard, nil)
+	if err == nil || !strings.Contains(err.Error(), "changes mode from replicated to global") {
+		t.Fatalf("expected a mode change error, got %v", err)
+	}
+	if len(fc.serviceRemoves) != 0 || len(fc.serviceCreates) != 0 || len(fc.serviceUpdates) != 0 {
+		t.Errorf("expected nothing to change without recreate, got %v removes, %d creates, %d updates", fc.serviceRemoves, len(fc.serviceCreates), len(fc.serviceUpdates))
+	}
+
+	fc = existing()
+	names, err := deployServices(context.Background(), fc, services, order, "stack", ResolveImageNever, nil, true, false, nil, true, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("deployServices failed: %v", err)
+	}
+	if !slices.Equal(fc.serviceRemoves, []string{"agent-id"}) {
+		t.Errorf("expected only agent to be removed, got %v", fc.serviceRemoves)
+	}
+	if len(fc.serviceCreates) != 1 || fc.serviceCreates[0].Spec.Name != "stack_agent" || fc.serviceCreates[0].Spec.Mode.Global == nil {
+		t.Errorf("expected agent to be recreated as global, got %+v", fc.serviceCreates)
+	}
+	if len(fc.serviceUpdates) != 1 || fc.serviceUpdates[0].Spec.Name != "stack_web" {
+		t.Errorf("expected web to be updated in place, got %+v", fc.serviceUpdates)
+	}
+	if names["stack_agent-id"] != "stack_agent" || names["web-id"] != "stack_web" {
+		t.Errorf("expected the recreated service's new ID, got %v", names)
+	}
+}
+
+func TestDeployServicesForceRecreate(t *testing.T) {
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: "stack_web", Labels: map[string]string{LabelImage: "nginx:1.27"}},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{Image: "nginx:1.27"},
+			ForceUpdate:   4,
+		},
+	}
+	services := map[string]swarm.ServiceSpec{"web": spec}
+
+	for _, tt := range []struct {
+		force bool
+		want  uint64
+	}{
+		{false, 4},
+		{true, 5},
+	} {
+		fc := &fakeClient{services: map[string]swarm.Service{"stack_web": {ID: "web-id", Spec: spec}}}
+		if _, err := deployServices(context.Background(), fc, services, []string{"web"}, "stack", ResolveImageNever, nil, false, tt.force, nil, true, io.Discard, nil); err != nil {
+			t.Fatalf("deployServices failed: %v", err)
+		}
+		if len(fc.serviceUpdates) != 1 {
+			t.Fatalf("force %t: expected an update of the identical spec, got %d", tt.force, len(fc.serviceUpdates))
+		}
+		update := fc.serviceUpdates[0].Spec
+		if update.TaskTemplate.ForceUpdate != tt.want {
+			t.Errorf("force %t: expected ForceUpdate %d, got %d", tt.force, tt.want, update.TaskTemplate.ForceUpdate)
+		}
+		update.TaskTemplate.ForceUpdate = spec.TaskTemplate.ForceUpdate
+		if !reflect.DeepEqual(update, spec) {
+			t.Errorf("force %t: expected the spec to be applied otherwise unchanged, got %+v", tt.force, update)
+		}
+	}
+}
+
+func TestValidateExternalObjects(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:    "web",
+				Secrets: []types.ServiceSecretConfig{{Source: "tls_cert"}, {Source: "db_password"}, {Source: "local"}},
+				Configs: []types.ServiceConfigObjConfig{{Source: "nginx_conf"}},
+			},
+		},
+		Secrets: types.Secrets{
+			"tls_cert":    types.SecretConfig{External: true},
+			"db_password": types.SecretConfig{External: true, Name: "prod_db_password"},
+			"local":       types.SecretConfig{File: "./local.txt"},
+			"unused":      types.SecretConfig{External: true},
+		},
+		Configs: types.Configs{
+			"nginx_conf": types.ConfigObjConfig{External: true},
+		},
+	}
+	fc := &fakeClient{secrets: map[string]swarm.Secret{"tls_cert": {ID: "tls-id"}}}
+
+	err := validateExternalObjects(context.Background(), fc, "stack", project)
+	if err == nil {
+		t.Fatal("expected missing external objects error, got nil")
+	}
+	for _, want := range []string{`secret "prod_db_password"`, `config "nginx_conf"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to list %s, got: %v", want, err)
+		}
+	}
+	for _, unwanted := range []string{"tls_cert", "local", "unused"} {
+		if strings.Contains(err.Error(), unwanted) {
+			t.Errorf("expected error not to list %s, got: %v", unwanted, err)
+		}
+	}
+
+	fc.secrets["prod_db_password"] = swarm.Secret{ID: "db-id"}
+	fc.configs = map[string]swarm.Config{"nginx_conf": {ID: "nginx-id"}}
+	if err := validateExternalObjects(context.Background(), fc, "stack", project); err != nil {
+		t.Errorf("expected all externals to be found, got %v", err)
+	}
+}
+
+func TestDeployPrunesStaleGeneratedSecrets(t *testing.T) {
+	newProject := func() types.Project {
+		return types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name:  "web",
+					Image: "nginx",
+					Sensitive: map[string]types.SensitiveConfig{
+						"app_env": {
+							Target:  "/run/secrets/app.env",
+							Secrets: []types.SensitiveSecret{{Source: "DB_PASSWORD"}},
+						},
+					},
+				},
+			},
+		}
+	}
+	fc := &fakeClient{
+		secrets: map[string]swarm.Secret{
+			// same stack, but not generated from app_env
+			"stack_tls_cert": {ID: "tls-id", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "stack_tls_cert"}}},
+		},
+	}
+	deploy := func(password string) {
+		t.Helper()
+		_, err := Deploy(context.Background(), fc, LoadedProject(newProject()), DeployOptions{
+			Secrets:      vault.Secrets{"DB_PASSWORD": password},
+			Stack:        "stack",
+			Prune:        true,
+			ResolveImage: ResolveImageNever,
+			Quiet:        true,
+			Detach:       true,
+			Out:          io.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Deploy failed: %v", err)
+		}
+	}
+
+	deploy("first")
+	var first string
+	for name := range fc.secrets {
+		if strings.HasPrefix(name, "stack_app_env_") {
+			first = name
+		}
+	}
+	if first == "" {
+		t.Fatalf("expected a generated secret, got %v", slices.Collect(maps.Keys(fc.secrets)))
+	}
+	if len(fc.secretRemoves) != 0 {
+		t.Fatalf("expected nothing to prune on the first deploy, got %v", fc.secretRemoves)
+	}
+
+	deploy("second")
+	if !slices.Equal(fc.secretRemoves, []string{first}) {
+		t.Errorf("expected only %s to be removed, got %v", first, fc.secretRemoves)
+	}
+	if _, ok := fc.secrets["stack_tls_cert"]; !ok {
+		t.Error("expected unrelated stack secret to be kept")
+	}
+	generated := 0
+	for name := range fc.secrets {
+		if strings.HasPrefix(name, "stack_app_env_") {
+			generated++
+		}
+	}
+	if generated != 1 {
+		t.Errorf("expected the current generated secret to remain, got %d", generated)
+	}
+}
+
+func TestPruneServicesOnlyManaged(t *testing.T) {
+	service := func(id, name string, managed bool) swarm.Service {
+		labels := map[string]string{LabelNamespace: "stack"}
+		if managed {
+			labels[LabelManaged] = "true"
+		}
+		return swarm.Service{ID: id, Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: name, Labels: labels}}}
+	}
+	fc := &fakeClient{services: map[string]swarm.Service{
+		"stack_web":    service("web-id", "stack_web", true),
+		"stack_old":    service("old-id", "stack_old", true),
+		"stack_manual": service("manual-id", "stack_manual", false),
+	}}
+
+	var out bytes.Buffer
+	if err := pruneServices(context.Background(), fc, "stack", map[string]struct{}{"web": {}}, true, &out); err != nil {
+		t.Fatalf("pruneServices failed: %v", err)
+	}
+	if !slices.Equal(fc.serviceRemoves, []string{"old-id"}) {
+		t.Errorf("expected only the stale cicdez service to be removed, got %v", fc.serviceRemoves)
+	}
+	if !strings.Contains(out.String(), "service stack_manual has no io.cicdez.managed label and is not pruned") {
+		t.Errorf("expected a warning for the unmarked service, got %q", out.String())
+	}
+}
+
+func TestPruneServicesLabelNamespace(t *testing.T) {
+	SetStackLabel("io.cicdez.stack")
+	t.Cleanup(func() { SetStackLabel(LabelNamespace) })
+
+	labels := AddStackLabel("stack", types.Labels{"team": "web"})
+	if labels["io.cicdez.stack"] != "stack" || labels[LabelNamespace] != "" || labels["team"] != "web" {
+		t.Errorf("expected only the configured stack label, got %v", labels)
+	}
+	if filter := getStackFilter("stack"); !reflect.DeepEqual(filter, make(client.Filters).Add("label", "io.cicdez.stack=stack")) {
+		t.Errorf("expected a filter on the configured label, got %v", filter)
+	}
+
+	service := func(id, name, label string) swarm.Service {
+		return swarm.Service{ID: id, Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: name, Labels: map[string]string{
+			label:        "stack",
+			LabelManaged: "true",
+		}}}}
+	}
+	fc := &fakeClient{services: map[string]swarm.Service{
+		"stack_old":   service("old-id", "stack_old", "io.cicdez.stack"),
+		"stack_other": service("other-id", "stack_other", LabelNamespace),
+	}}
+	if err := pruneServices(context.Background(), fc, "stack", nil, true, io.Discard); err != nil {
+		t.Fatalf("pruneServices failed: %v", err)
+	}
+	if !slices.Equal(fc.serviceRemoves, []string{"old-id"}) {
+		t.Errorf("expected only the service under the configured label to be removed, got %v", fc.serviceRemoves)
+	}
+}
+
+func TestCreateNetworksRecreate(t *testing.T) {
+	labels := map[string]string{LabelNamespace: "stack"}
+	existing := func(id, name string) network.Summary {
+		var nw network.Summary
+		nw.ID, nw.Name, nw.Driver, nw.Labels = id, name, "overlay", labels
+		nw.Options = map[string]string{"com.docker.network.driver.overlay.vxlanid_list": "4097"}
+		return nw
+	}
+	desired := map[string]client.NetworkCreateOptions{
+		"stack_backend":  {Driver: "overlay", Labels: labels, Options: map[string]string{"encrypted": "true"}},
+		"stack_frontend": {Driver: "overlay", Labels: labels, Options: map[string]string{"encrypted": "true"}},
+		"stack_default":  {Driver: "overlay", Labels: labels},
+	}
+	fc := &fakeClient{
+		networks: []network.Summary{
+			existing("backend-id", "stack_backend"),
+			existing("frontend-id", "stack_frontend"),
+			existing("default-id", "stack_default"),
+		},
+		services: map[string]swarm.Service{"stack_web": {ID: "web-id", Spec: swarm.ServiceSpec{
+			Annotations:  swarm.Annotations{Name: "stack_web"},
+			TaskTemplate: swarm.TaskSpec{Networks: []swarm.NetworkAttachmentConfig{{Target: "frontend-id"}}},
+		}}},
+	}
+
+	// without the flag existing networks are left alone
+	if err := createNetworks(context.Background(), fc, "stack", desired, false, true, io.Discard); err != nil {
+		t.Fatalf("createNetworks failed: %v", err)
+	}
+	if len(fc.networkRemoves) != 0 || len(fc.networkCreates) != 0 {
+		t.Fatalf("expected no changes, got removes %v and creates %v", fc.networkRemoves, fc.networkCreates)
+	}
+
+	out := new(bytes.Buffer)
+	if err := createNetworks(context.Background(), fc, "stack", desired, true, true, out); err != nil {
+		t.Fatalf("createNetworks failed: %v", err)
+	}
+	if !slices.Equal(fc.networkRemoves, []string{"backend-id"}) || !slices.Equal(fc.networkCreates, []string{"stack_backend"}) {
+		t.Errorf("expected only the unused changed network to be recreated, got removes %v and creates %v", fc.networkRemoves, fc.networkCreates)
+	}
+	if !strings.Contains(out.String(), "network stack_frontend changed but is still used by stack_web") {
+		t.Errorf("expected a warning about the network in use, got %q", out.String())
+	}
+}
+
+func TestCreationOrder(t *testing.T) {
+	fc := &fakeClient{}
+
+	secrets, err := ConvertSecrets("stack", types.Secrets{
+		"zeta":  {Content: "z"},
+		"alpha": {Content: "a"},
+		"mid":   {Content: "m", Name: "beta"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ConvertSecrets failed: %v", err)
+	}
+	if err := createSecrets(context.Background(), fc, secrets, true, io.Discard); err != nil {
+		t.Fatalf("createSecrets failed: %v", err)
+	}
+	if want := []string{"beta", "stack_alpha", "stack_zeta"}; !slices.Equal(fc.secretInspects, want) {
+		t.Errorf("expected secrets in order %v, got %v", want, fc.secretInspects)
+	}
+
+	configs, err := ConvertConfigs("stack", types.Configs{
+		"nginx":   {Content: "n"},
+		"app":     {Content: "a"},
+		"haproxy": {Content: "h"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ConvertConfigs failed: %v", err)
+	}
+	if err := createConfigs(context.Background(), fc, configs, true, io.Discard); err != nil {
+		t.Fatalf("createConfigs failed: %v", err)
+	}
+	if want := []string{"stack_app", "stack_haproxy", "stack_nginx"}; !slices.Equal(fc.configInspects, want) {
+		t.Errorf("expected configs in order %v, got %v", want, fc.configInspects)
+	}
+
+	networks := map[string]client.NetworkCreateOptions{"stack_web": {}, "stack_backend": {}, "stack_default": {}}
+	if err := createNetworks(context.Background(), fc, "stack", networks, false, true, io.Discard); err != nil {
+		t.Fatalf("createNetworks failed: %v", err)
+	}
+	if want := []string{"stack_backend", "stack_default", "stack_web"}; !slices.Equal(fc.networkCreates, want) {
+		t.Errorf("expected networks in order %v, got %v", want, fc.networkCreates)
+	}
+}
+
+func TestPruneOrphans(t *testing.T) {
+	stackLabels := map[string]string{LabelNamespace: "stack"}
+	secret := func(name string, labels map[string]string) swarm.Secret {
+		return swarm.Secret{ID: name + "-id", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: name, Labels: labels}}}
+	}
+	config := func(name string) swarm.Config {
+		return swarm.Config{ID: name + "-id", Spec: swarm.ConfigSpec{Annotations: swarm.Annotations{Name: name, Labels: stackLabels}}}
+	}
+	nw := func(name string) network.Summary {
+		var n network.Summary
+		n.ID, n.Name, n.Labels = name+"-id", name, stackLabels
+		return n
+	}
+
+	fc := &fakeClient{
+		secrets: map[string]swarm.Secret{
+			"stack_db":     secret("stack_db", stackLabels),
+			"stack_old":    secret("stack_old", stackLabels),
+			"stack_shared": secret("stack_shared", stackLabels),
+			"other_old":    secret("other_old", map[string]string{LabelNamespace: "other"}),
+		},
+		configs: map[string]swarm.Config{
+			"stack_nginx": config("stack_nginx"),
+			"stack_stale": config("stack_stale"),
+		},
+		networks: []network.Summary{nw("stack_default"), nw("stack_backend"), nw("stack_legacy")},
+		// a service outside the stack still uses a secret and a network
+		services: map[string]swarm.Service{"other_app": {ID: "app-id", Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: "other_app"},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{Secrets: []*swarm.SecretReference{{SecretID: "stack_shared-id"}}},
+				Networks:      []swarm.NetworkAttachmentConfig{{Target: "stack_backend-id"}},
+			},
+		}}},
+	}
+	deployed := map[string]swarm.ServiceSpec{"web": {
+		Annotations: swarm.Annotations{Name: "stack_web"},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{Configs: []*swarm.ConfigReference{{ConfigName: "stack_nginx"}}},
+			Networks:      []swarm.NetworkAttachmentConfig{{Target: "stack_default"}},
+		},
+	}}
+	declared := map[string]struct{}{"secret/stack_db": {}, "network/stack_default": {}}
+
+	// only the selected kinds are pruned
+	err := pruneOrphans(context.Background(), fc, "stack", orphanKinds{secrets: true}, declared, deployed, true, io.Discard)
+	if err != nil {
+		t.Fatalf("pruneOrphans failed: %v", err)
+	}
+	if !slices.Equal(fc.secretRemoves, []string{"stack_old"}) || len(fc.configRemoves) != 0 || len(fc.networkRemoves) != 0 {
+		t.Fatalf("expected only stack_old removed, got secrets %v, configs %v, networks %v", fc.secretRemoves, fc.configRemoves, fc.networkRemoves)
+	}
+
+	err = pruneOrphans(context.Background(), fc, "stack", orphanKinds{networks: true, secrets: true, configs: true}, declared, deployed, true, io.Discard)
+	if err != nil {
+		t.Fatalf("pruneOrphans failed: %v", err)
+	}
+	if !slices.Equal(fc.secretRemoves, []string{"stack_old"}) {
+		t.Errorf("expected the used and declared secrets to stay, removed %v", fc.secretRemoves)
+	}
+	if !slices.Equal(fc.configRemoves, []string{"stack_stale"}) {
+		t.Errorf("expected only stack_stale removed, got %v", fc.configRemoves)
+	}
+	if !slices.Equal(fc.networkRemoves, []string{"stack_legacy-id"}) {
+		t.Errorf("expected only stack_legacy removed, got %v", fc.networkRemoves)
+	}
+}
+
+func TestListStacks(t *testing.T) {
+	service := func(stack string) swarm.Service {
+		var spec swarm.ServiceSpec
+		if stack != "" {
+			spec.Labels = map[string]string{LabelNamespace: stack}
+		}
+		return swarm.Service{Spec: spec}
+	}
+	fc := &fakeClient{services: map[string]swarm.Service{
+		"web_app":    service("web"),
+		"web_worker": service("web"),
+		"api_app":    service("api"),
+		"standalone": service(""),
+	}}
+
+	stacks, err := ListStacks(context.Background(), fc)
+	if err != nil {
+		t.Fatalf("ListStacks failed: %v", err)
+	}
+	if !slices.Equal(stacks, []string{"api", "web"}) {
+		t.Errorf("expected each stack once and sorted, got %v", stacks)
+	}
+}
+
+func TestObjectSizeLimits(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:    "web",
+				Image:   "nginx",
+				Secrets: []types.ServiceSecretConfig{{Source: "tls"}},
+				Configs: []types.ServiceConfigObjConfig{{Source: "nginx"}, {Source: "small"}},
+			},
+		},
+		Secrets: types.Secrets{"tls": {Content: strings.Repeat("x", 512*1024)}},
+		Configs: types.Configs{
+			"nginx": {Content: strings.Repeat("x", 600*1024)},
+			"small": {Content: "events {}"},
+		},
+	}
+
+	fc := &fakeClient{}
+	_, err := Deploy(context.Background(), fc, LoadedProject(project), DeployOptions{
+		Stack:        "stack",
+		ResolveImage: ResolveImageNever,
+		Quiet:        true,
+		Detach:       true,
+		Out:          io.Discard,
+	})
+	for _, want := range []string{
+		"secret stack_tls is 512KiB, over the 500KiB swarm limit",
+		"config stack_nginx is 600KiB, over the 500KiB swarm limit",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q, got %v", want, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "small") {
+		t.Errorf("expected the small config to pass, got %v", err)
+	}
+	if len(fc.networkCreates) > 0 || len(fc.secretInspects) > 0 || len(fc.configInspects) > 0 {
+		t.Error("expected nothing to be created once an object is too large")
+	}
+
+	// close to the limit only warns
+	secrets, err := ConvertSecrets("stack", types.Secrets{"tls": {Content: strings.Repeat("x", 450*1024)}}, nil)
+	if err != nil {
+		t.Fatalf("ConvertSecrets failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := checkObjectSizes(secrets, nil, false, &out); err != nil {
+		t.Fatalf("expected a warning only, got %v", err)
+	}
+	if !strings.Contains(out.String(), "secret stack_tls is 450KiB, close to the 500KiB swarm limit") {
+		t.Errorf("expected a size warning, got %q", out.String())
+	}
+	out.Reset()
+	if err := checkObjectSizes(secrets, nil, true, &out); err != nil || out.Len() != 0 {
+		t.Errorf("expected --quiet to silence the warning, got %q %v", out.String(), err)
+	}
+}
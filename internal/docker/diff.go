@@ -0,0 +1,352 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+const diffContext = 3
+
+type DiffOptions struct {
+	Secrets vault.Secrets
+	Stack   string
+	Scale   map[string]uint64
+}
+
+// networks are only ever created by deploy, so only the fields set at
+// creation are compared
+type networkView struct {
+	Driver     string            `json:"Driver"`
+	Internal   bool              `json:"Internal,omitempty"`
+	Attachable bool              `json:"Attachable,omitempty"`
+	EnableIPv6 bool              `json:"EnableIPv6,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+}
+
+// Diff converts project through the deploy pipeline and compares the specs
+// with what the stack runs on the manager. The result is a unified diff with
+// the live side first, empty when nothing drifted. Secret payloads can't be
+// read back from swarm and are left out.
+func Diff(ctx context.Context, apiClient client.APIClient, project types.Project, opts DiffOptions) (string, error) {
+	specs, err := convertStack(ctx, project, opts.Stack, opts.Secrets, opts.Scale)
+	if err != nil {
+		return "", err
+	}
+
+	live, err := liveObjects(ctx, apiClient, opts.Stack)
+	if err != nil {
+		return "", err
+	}
+
+	desired := map[string]any{}
+	for _, spec := range specs.services {
+		desired["service/"+spec.Name] = clearObjectIDs(spec)
+	}
+	for name, nw := range specs.networks {
+		desired["network/"+name] = networkView{
+			Driver:     nw.Driver,
+			Internal:   nw.Internal,
+			Attachable: nw.Attachable,
+			EnableIPv6: nw.EnableIPv6 != nil && *nw.EnableIPv6,
+			Labels:     nw.Labels,
+		}
+	}
+	for _, spec := range specs.secrets {
+		spec.Data = nil
+		desired["secret/"+spec.Name] = renderedSecret{SecretSpec: spec}
+	}
+	for _, spec := range specs.configs {
+		data := string(spec.Data)
+		spec.Data = nil
+		desired["config/"+spec.Name] = renderedConfig{ConfigSpec: spec, Data: data}
+	}
+
+	// services deploy carries state over from, align before comparing
+	for key, spec := range live {
+		liveSpec, ok := spec.(swarm.ServiceSpec)
+		if !ok {
+			continue
+		}
+		desiredSpec, _ := desired[key].(swarm.ServiceSpec)
+		live[key] = normalizeLiveService(liveSpec, desiredSpec)
+	}
+
+	var diff strings.Builder
+	keys := maps.Clone(live)
+	maps.Copy(keys, desired)
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		from, err := diffText(live[key])
+		if err != nil {
+			return "", err
+		}
+		to, err := diffText(desired[key])
+		if err != nil {
+			return "", err
+		}
+
+		fromName, toName := "live/"+key, "compose/"+key
+		if _, ok := live[key]; !ok {
+			fromName = "/dev/null"
+		}
+		if _, ok := desired[key]; !ok {
+			toName = "/dev/null"
+		}
+		diff.WriteString(unifiedDiff(fromName, toName, from, to))
+	}
+	return diff.String(), nil
+}
+
+// liveObjects lists the stack's services, networks, secrets and configs
+// keyed by kind and name, in the same shapes Diff builds from the project
+func liveObjects(ctx context.Context, apiClient client.APIClient, stack string) (map[string]any, error) {
+	filter := getStackFilter(stack)
+	objects := map[string]any{}
+
+	services, err := apiClient.ServiceList(ctx, client.ServiceListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range services.Items {
+		objects["service/"+svc.Spec.Name] = clearObjectIDs(svc.Spec)
+	}
+
+	networks, err := apiClient.NetworkList(ctx, client.NetworkListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	for _, nw := range networks.Items {
+		objects["network/"+nw.Name] = networkView{
+			Driver:     nw.Driver,
+			Internal:   nw.Internal,
+			Attachable: nw.Attachable,
+			EnableIPv6: nw.EnableIPv6,
+			Labels:     nw.Labels,
+		}
+	}
+
+	secrets, err := apiClient.SecretList(ctx, client.SecretListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, s := range secrets.Items {
+		spec := s.Spec
+		spec.Data = nil
+		objects["secret/"+spec.Name] = renderedSecret{SecretSpec: spec}
+	}
+
+	configs, err := apiClient.ConfigList(ctx, client.ConfigListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configs: %w", err)
+	}
+	for _, c := range configs.Items {
+		spec := c.Spec
+		data := string(spec.Data)
+		spec.Data = nil
+		objects["config/"+spec.Name] = renderedConfig{ConfigSpec: spec, Data: data}
+	}
+
+	return objects, nil
+}
+
+// normalizeLiveService undoes what swarm and deploy add to a running spec:
+// the digest pinned image, the restart counter and daemon defaults
+func normalizeLiveService(live, desired swarm.ServiceSpec) swarm.ServiceSpec {
+	live.TaskTemplate.ForceUpdate = desired.TaskTemplate.ForceUpdate
+	if live.TaskTemplate.Runtime == swarm.RuntimeContainer && desired.TaskTemplate.Runtime == "" {
+		live.TaskTemplate.Runtime = ""
+	}
+
+	// swarm runs a single replica when none is given
+	if r := live.Mode.Replicated; r != nil && r.Replicas != nil && *r.Replicas == 1 &&
+		desired.Mode.Replicated != nil && desired.Mode.Replicated.Replicas == nil {
+		live.Mode.Replicated = &swarm.ReplicatedService{}
+	}
+
+	if live.TaskTemplate.ContainerSpec != nil {
+		cs := *live.TaskTemplate.ContainerSpec
+		if image := live.Labels[LabelImage]; image != "" {
+			cs.Image = image
+		}
+		if cs.Isolation == container.IsolationDefault {
+			cs.Isolation = ""
+		}
+		live.TaskTemplate.ContainerSpec = &cs
+	}
+
+	if desired.EndpointSpec == nil && live.EndpointSpec != nil &&
+		live.EndpointSpec.Mode == swarm.ResolutionModeVIP && len(live.EndpointSpec.Ports) == 0 {
+		live.EndpointSpec = nil
+	}
+	return live
+}
+
+// clearObjectIDs drops secret and config IDs from the references, they differ
+// per cluster and the names already identify the objects
+func clearObjectIDs(spec swarm.ServiceSpec) swarm.ServiceSpec {
+	if spec.TaskTemplate.ContainerSpec == nil {
+		return spec
+	}
+	cs := *spec.TaskTemplate.ContainerSpec
+	cs.Secrets = nil
+	for _, ref := range spec.TaskTemplate.ContainerSpec.Secrets {
+		r := *ref
+		r.SecretID = ""
+		cs.Secrets = append(cs.Secrets, &r)
+	}
+	cs.Configs = nil
+	for _, ref := range spec.TaskTemplate.ContainerSpec.Configs {
+		r := *ref
+		r.ConfigID = ""
+		cs.Configs = append(cs.Configs, &r)
+	}
+	spec.TaskTemplate.ContainerSpec = &cs
+	return spec
+}
+
+// diffText renders an object as YAML with the Docker API field names, nil
+// renders as no lines at all
+func diffText(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal spec: %w", err)
+	}
+	data, err = jsonToYAML(data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// diffLines computes a line diff of a and b from their longest common
+// subsequence, removals before additions
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// unifiedDiff formats the differences between a and b as a unified diff with
+// diffContext lines of context, empty when they are equal
+func unifiedDiff(fromName, toName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// aLine[i] and bLine[i] count the lines of a and b before lines[i]
+	aLine := make([]int, len(lines)+1)
+	bLine := make([]int, len(lines)+1)
+	for i, l := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.op != '+' {
+			aLine[i+1]++
+		}
+		if l.op != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for pos := 0; pos < len(lines); {
+		first := pos
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		// a hunk runs on while unchanged stretches are short enough to
+		// share their context
+		end := first
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].op == ' ' {
+				run++
+			}
+			if run == len(lines) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+
+		lo := max(first-diffContext, pos)
+		hi := min(end+diffContext, len(lines))
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine[lo], aLine[hi]-aLine[lo]), hunkRange(bLine[lo], bLine[hi]-bLine[lo]))
+		for _, l := range lines[lo:hi] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			out.WriteByte('\n')
+		}
+		pos = hi
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk side as start,count with 1-based lines, an empty
+// side points at the line before it
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,96 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+
+	want := `--- live/x
++++ compose/x
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if got := unifiedDiff("live/x", "compose/x", a, b); got != want {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+	if got := unifiedDiff("live/x", "compose/x", a, a); got != "" {
+		t.Errorf("expected no diff for equal input, got:\n%s", got)
+	}
+
+	want = "--- /dev/null\n+++ compose/x\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got := unifiedDiff("/dev/null", "compose/x", "", "a\nb\n"); got != want {
+		t.Errorf("unexpected diff for a new object:\n%s", got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	two := 2
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{Name: "web", Image: "nginx:1.27", Deploy: &types.DeployConfig{Replicas: &two}},
+			"api": types.ServiceConfig{Name: "api", Image: "api:1"},
+		},
+	}
+
+	specs, err := ConvertServices(ctx, noLookupClient{}, "app", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+
+	// api runs exactly what compose says, apart from what swarm and earlier
+	// restarts put on it
+	api := specs["api"]
+	apiContainer := *api.TaskTemplate.ContainerSpec
+	apiContainer.Image = "api:1@sha256:0123"
+	api.TaskTemplate.ContainerSpec = &apiContainer
+	api.TaskTemplate.ForceUpdate = 3
+
+	// web was scaled by hand
+	web := specs["web"]
+	replicas := uint64(5)
+	web.Mode = swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}
+
+	fake := &fakeClient{services: map[string]swarm.Service{
+		"app_api": {ID: "api-id", Spec: api},
+		"app_web": {ID: "web-id", Spec: web},
+		"app_old": {ID: "old-id", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "app_old"}}},
+	}}
+
+	diff, err := Diff(ctx, fake, project, DiffOptions{Stack: "app"})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	if strings.Contains(diff, "app_api") {
+		t.Errorf("expected no diff for api, got:\n%s", diff)
+	}
+	for _, want := range []string{
+		"--- live/service/app_old\n+++ /dev/null\n",
+		"--- live/service/app_web\n+++ compose/service/app_web\n",
+		"-        Replicas: 5\n",
+		"+        Replicas: 2\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package docker
+
+import "errors"
+
+// failure classes wrapped into the errors of this package, so callers can
+// tell them apart with errors.Is. The texts read as the start of the
+// wrapping message.
+var (
+	ErrConnect      = errors.New("failed to connect")
+	ErrLoadProject  = errors.New("error to load project")
+	ErrBuild        = errors.New("failed to build")
+	ErrPush         = errors.New("failed to push")
+	ErrNotConverged = errors.New("service did not converge")
+)
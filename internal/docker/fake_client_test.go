@@ -0,0 +1,282 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/containerd/errdefs"
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/api/types/registry"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// fakeClient implements the parts of client.APIClient the deploy path uses;
+// calling anything else panics on the nil embedded interface
+type fakeClient struct {
+	client.APIClient
+
+	// mu guards the recorded calls of the methods called concurrently
+	mu sync.Mutex
+
+	secrets map[string]swarm.Secret
+	configs map[string]swarm.Config
+
+	// services are looked up by name or ID
+	services map[string]swarm.Service
+	tasks    []swarm.Task
+	// taskRounds, when set, replaces tasks: each TaskList call returns the
+	// next round and the last one repeats
+	taskRounds [][]swarm.Task
+	nodes      []swarm.Node
+	networks   []network.Summary
+	// distributions maps an image to the error its registry lookup fails
+	// with, images not listed resolve
+	distributions map[string]error
+	// serviceLogs is what ServiceLogs streams on stdout
+	serviceLogs string
+	// images are present in the daemon's image store
+	images map[string]bool
+	// loginErr fails RegistryLogin, otherwise it hands back identityToken
+	loginErr      error
+	identityToken string
+	// buildErrs fails the builds of an image, by its first tag, and
+	// buildStreamErrs fails them with an error message in the stream
+	buildErrs       map[string]error
+	buildStreamErrs map[string]string
+
+	secretInspects []string
+	configInspects []string
+	serviceUpdates []client.ServiceUpdateOptions
+	serviceCreates []client.ServiceCreateOptions
+	serviceRemoves []string
+	secretRemoves  []string
+	configRemoves  []string
+	taskLists      int
+	imageBuilds    []client.ImageBuildOptions
+	imageTags      []string
+	logOptions     []client.ServiceLogsOptions
+	networkCreates []string
+	networkRemoves []string
+	logins         []client.RegistryLoginOptions
+}
+
+func (f *fakeClient) SecretInspect(_ context.Context, id string, _ client.SecretInspectOptions) (client.SecretInspectResult, error) {
+	f.secretInspects = append(f.secretInspects, id)
+	s, ok := f.secrets[id]
+	if !ok {
+		return client.SecretInspectResult{}, errdefs.ErrNotFound
+	}
+	return client.SecretInspectResult{Secret: s}, nil
+}
+
+func (f *fakeClient) ConfigInspect(_ context.Context, id string, _ client.ConfigInspectOptions) (client.ConfigInspectResult, error) {
+	f.configInspects = append(f.configInspects, id)
+	c, ok := f.configs[id]
+	if !ok {
+		return client.ConfigInspectResult{}, errdefs.ErrNotFound
+	}
+	return client.ConfigInspectResult{Config: c}, nil
+}
+
+// SecretCreate registers the secret under its name, with ID "<name>-id"
+func (f *fakeClient) SecretCreate(_ context.Context, opts client.SecretCreateOptions) (client.SecretCreateResult, error) {
+	if f.secrets == nil {
+		f.secrets = make(map[string]swarm.Secret)
+	}
+	id := opts.Spec.Name + "-id"
+	f.secrets[opts.Spec.Name] = swarm.Secret{ID: id, Spec: opts.Spec}
+	return client.SecretCreateResult{ID: id}, nil
+}
+
+// SecretList ignores filters, tests hold a single stack
+func (f *fakeClient) SecretList(_ context.Context, _ client.SecretListOptions) (client.SecretListResult, error) {
+	var items []swarm.Secret
+	for _, s := range f.secrets {
+		items = append(items, s)
+	}
+	return client.SecretListResult{Items: items}, nil
+}
+
+func (f *fakeClient) SecretRemove(_ context.Context, id string, _ client.SecretRemoveOptions) (client.SecretRemoveResult, error) {
+	for name, s := range f.secrets {
+		if s.ID == id {
+			f.secretRemoves = append(f.secretRemoves, name)
+			delete(f.secrets, name)
+			return client.SecretRemoveResult{}, nil
+		}
+	}
+	return client.SecretRemoveResult{}, errdefs.ErrNotFound
+}
+
+// ConfigCreate registers the config under its name, with ID "<name>-id"
+func (f *fakeClient) ConfigCreate(_ context.Context, opts client.ConfigCreateOptions) (client.ConfigCreateResult, error) {
+	if f.configs == nil {
+		f.configs = make(map[string]swarm.Config)
+	}
+	id := opts.Spec.Name + "-id"
+	f.configs[opts.Spec.Name] = swarm.Config{ID: id, Spec: opts.Spec}
+	return client.ConfigCreateResult{ID: id}, nil
+}
+
+// ConfigList ignores filters, tests hold a single stack
+func (f *fakeClient) ConfigList(_ context.Context, _ client.ConfigListOptions) (client.ConfigListResult, error) {
+	var items []swarm.Config
+	for _, c := range f.configs {
+		items = append(items, c)
+	}
+	return client.ConfigListResult{Items: items}, nil
+}
+
+func (f *fakeClient) ConfigRemove(_ context.Context, id string, _ client.ConfigRemoveOptions) (client.ConfigRemoveResult, error) {
+	for name, c := range f.configs {
+		if c.ID == id {
+			f.configRemoves = append(f.configRemoves, name)
+			delete(f.configs, name)
+			return client.ConfigRemoveResult{}, nil
+		}
+	}
+	return client.ConfigRemoveResult{}, errdefs.ErrNotFound
+}
+
+func (f *fakeClient) ServiceInspect(_ context.Context, id string, _ client.ServiceInspectOptions) (client.ServiceInspectResult, error) {
+	for name, svc := range f.services {
+		if name == id || svc.ID == id {
+			return client.ServiceInspectResult{Service: svc}, nil
+		}
+	}
+	return client.ServiceInspectResult{}, errdefs.ErrNotFound
+}
+
+func (f *fakeClient) ServiceUpdate(_ context.Context, _ string, opts client.ServiceUpdateOptions) (client.ServiceUpdateResult, error) {
+	f.serviceUpdates = append(f.serviceUpdates, opts)
+	return client.ServiceUpdateResult{}, nil
+}
+
+func (f *fakeClient) TaskList(_ context.Context, _ client.TaskListOptions) (client.TaskListResult, error) {
+	f.taskLists++
+	if len(f.taskRounds) > 0 {
+		round := min(f.taskLists, len(f.taskRounds)) - 1
+		return client.TaskListResult{Items: f.taskRounds[round]}, nil
+	}
+	return client.TaskListResult{Items: f.tasks}, nil
+}
+
+func (f *fakeClient) NodeList(_ context.Context, _ client.NodeListOptions) (client.NodeListResult, error) {
+	return client.NodeListResult{Items: f.nodes}, nil
+}
+
+// ServiceList ignores filters, tests hold a single stack
+func (f *fakeClient) ServiceList(_ context.Context, _ client.ServiceListOptions) (client.ServiceListResult, error) {
+	var items []swarm.Service
+	for _, svc := range f.services {
+		items = append(items, svc)
+	}
+	return client.ServiceListResult{Items: items}, nil
+}
+
+func (f *fakeClient) Info(_ context.Context, _ client.InfoOptions) (client.SystemInfoResult, error) {
+	var res client.SystemInfoResult
+	res.Info.Swarm.ControlAvailable = true
+	return res, nil
+}
+
+func (f *fakeClient) NetworkList(_ context.Context, _ client.NetworkListOptions) (client.NetworkListResult, error) {
+	return client.NetworkListResult{Items: f.networks}, nil
+}
+
+func (f *fakeClient) NetworkCreate(_ context.Context, name string, _ client.NetworkCreateOptions) (client.NetworkCreateResult, error) {
+	f.networkCreates = append(f.networkCreates, name)
+	return client.NetworkCreateResult{ID: name}, nil
+}
+
+func (f *fakeClient) NetworkRemove(_ context.Context, id string, _ client.NetworkRemoveOptions) (client.NetworkRemoveResult, error) {
+	f.networkRemoves = append(f.networkRemoves, id)
+	return client.NetworkRemoveResult{}, nil
+}
+
+// ServiceCreate registers the service so later inspects find it
+func (f *fakeClient) ServiceRemove(_ context.Context, id string, _ client.ServiceRemoveOptions) (client.ServiceRemoveResult, error) {
+	f.serviceRemoves = append(f.serviceRemoves, id)
+	for name, svc := range f.services {
+		if name == id || svc.ID == id {
+			delete(f.services, name)
+		}
+	}
+	return client.ServiceRemoveResult{}, nil
+}
+
+func (f *fakeClient) ServiceCreate(_ context.Context, opts client.ServiceCreateOptions) (client.ServiceCreateResult, error) {
+	f.serviceCreates = append(f.serviceCreates, opts)
+	id := opts.Spec.Name + "-id"
+	if f.services == nil {
+		f.services = make(map[string]swarm.Service)
+	}
+	f.services[opts.Spec.Name] = swarm.Service{ID: id, Spec: opts.Spec}
+	return client.ServiceCreateResult{ID: id}, nil
+}
+
+// Ping reports a daemon without BuildKit, so builds take the classic path
+func (f *fakeClient) Ping(_ context.Context, _ client.PingOptions) (client.PingResult, error) {
+	return client.PingResult{}, nil
+}
+
+func (f *fakeClient) ImageBuild(_ context.Context, buildContext io.Reader, opts client.ImageBuildOptions) (client.ImageBuildResult, error) {
+	if _, err := io.Copy(io.Discard, buildContext); err != nil {
+		return client.ImageBuildResult{}, err
+	}
+	f.mu.Lock()
+	f.imageBuilds = append(f.imageBuilds, opts)
+	f.mu.Unlock()
+	if err := f.buildErrs[opts.Tags[0]]; err != nil {
+		return client.ImageBuildResult{}, err
+	}
+	body := `{"stream":"Step 1/1 : FROM scratch\n"}` + "\n" + `{"aux":{"ID":"sha256:0123"}}` + "\n"
+	if msg, ok := f.buildStreamErrs[opts.Tags[0]]; ok {
+		body = `{"stream":"Step 1/1 : FROM scratch\n"}` + "\n" + `{"errorDetail":{"message":"` + msg + `"},"error":"` + msg + `"}` + "\n"
+	}
+	return client.ImageBuildResult{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (f *fakeClient) DistributionInspect(_ context.Context, image string, _ client.DistributionInspectOptions) (client.DistributionInspectResult, error) {
+	return client.DistributionInspectResult{}, f.distributions[image]
+}
+
+func (f *fakeClient) ImageInspect(_ context.Context, image string, _ ...client.ImageInspectOption) (client.ImageInspectResult, error) {
+	if !f.images[image] {
+		return client.ImageInspectResult{}, errdefs.ErrNotFound
+	}
+	return client.ImageInspectResult{}, nil
+}
+
+// ImageTag records the target tag
+func (f *fakeClient) ImageTag(_ context.Context, opts client.ImageTagOptions) (client.ImageTagResult, error) {
+	f.imageTags = append(f.imageTags, opts.Target)
+	return client.ImageTagResult{}, nil
+}
+
+// ServiceLogs streams serviceLogs multiplexed as stdout, like the daemon
+func (f *fakeClient) ServiceLogs(_ context.Context, _ string, opts client.ServiceLogsOptions) (client.ServiceLogsResult, error) {
+	f.logOptions = append(f.logOptions, opts)
+	var buf bytes.Buffer
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(f.serviceLogs)); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func (f *fakeClient) RegistryLogin(_ context.Context, opts client.RegistryLoginOptions) (client.RegistryLoginResult, error) {
+	f.logins = append(f.logins, opts)
+	if f.loginErr != nil {
+		return client.RegistryLoginResult{}, f.loginErr
+	}
+	return client.RegistryLoginResult{Auth: registry.AuthResponse{Status: "Login Succeeded", IdentityToken: f.identityToken}}, nil
+}
@@ -0,0 +1,132 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+const (
+	gitTagToken    = "{git.tag}"
+	gitSHAToken    = "{git.sha}"
+	gitBranchToken = "{git.branch}"
+)
+
+// GitContext describes the checkout a stack is built and deployed from
+type GitContext struct {
+	Tag    string
+	SHA    string
+	Branch string
+	Dirty  bool
+}
+
+// LoadGitContext resolves the exact tag, short SHA and branch of HEAD in dir.
+// Tag and Branch stay empty for an untagged commit or a detached HEAD.
+func LoadGitContext(ctx context.Context, dir string) (GitContext, error) {
+	var gc GitContext
+	var err error
+
+	if gc.SHA, err = git(ctx, dir, "rev-parse", "--short", "HEAD"); err != nil {
+		return gc, fmt.Errorf("failed to resolve git commit: %w", err)
+	}
+	// both fail when there is nothing to report
+	gc.Tag, _ = git(ctx, dir, "describe", "--tags", "--exact-match", "HEAD")
+	gc.Branch, _ = git(ctx, dir, "symbolic-ref", "--short", "-q", "HEAD")
+
+	status, err := git(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return gc, fmt.Errorf("failed to read git status: %w", err)
+	}
+	gc.Dirty = status != ""
+
+	return gc, nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// UsesGitContext reports whether any service image, build arg or
+// environment value holds a {git.*} token
+func UsesGitContext(project types.Project) bool {
+	hasToken := func(m types.MappingWithEquals) bool {
+		for _, v := range m {
+			if v != nil && strings.Contains(*v, "{git.") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, svc := range project.Services {
+		if strings.Contains(svc.Image, "{git.") || hasToken(svc.Environment) {
+			return true
+		}
+		if svc.Build != nil && hasToken(svc.Build.Args) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyGitContext substitutes {git.tag}, {git.sha} and {git.branch} in
+// service images, build args and environment values
+func ApplyGitContext(project *types.Project, gc GitContext) error {
+	var missing []string
+	replacer := strings.NewReplacer(
+		gitTagToken, gc.Tag,
+		gitSHAToken, gc.SHA,
+		gitBranchToken, gc.Branch,
+	)
+
+	walkGitValues(project, func(s string) string {
+		if strings.Contains(s, gitTagToken) && gc.Tag == "" {
+			missing = append(missing, "{git.tag} is used but HEAD has no tag")
+		}
+		if strings.Contains(s, gitBranchToken) && gc.Branch == "" {
+			missing = append(missing, "{git.branch} is used but HEAD is detached")
+		}
+		return replacer.Replace(s)
+	})
+
+	if len(missing) > 0 {
+		return errors.New(missing[0])
+	}
+	return nil
+}
+
+func walkGitValues(project *types.Project, fn func(string) string) {
+	mapping := func(m types.MappingWithEquals) {
+		for k, v := range m {
+			if v != nil {
+				s := fn(*v)
+				m[k] = &s
+			}
+		}
+	}
+
+	for name, svc := range project.Services {
+		svc.Image = fn(svc.Image)
+		if svc.Build != nil {
+			mapping(svc.Build.Args)
+		}
+		mapping(svc.Environment)
+		project.Services[name] = svc
+	}
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	run("init", "-q", "-b", "main")
+	run("commit", "-q", "--allow-empty", "-m", "initial")
+	run("tag", "v1.2.3")
+	return dir
+}
+
+func TestGitContext(t *testing.T) {
+	dir := initGitRepo(t)
+
+	gc, err := LoadGitContext(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadGitContext failed: %v", err)
+	}
+	if gc.Tag != "v1.2.3" || gc.Branch != "main" || len(gc.SHA) < 7 || gc.Dirty {
+		t.Fatalf("unexpected git context: %+v", gc)
+	}
+
+	arg := "{git.sha}"
+	commit := "{git.sha}"
+	branch := "release/{git.branch}"
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:        "web",
+				Image:       "registry.example.com/web:{git.tag}",
+				Build:       &types.BuildConfig{Args: types.MappingWithEquals{"REVISION": &arg}},
+				Environment: types.MappingWithEquals{"COMMIT": &commit, "BRANCH": &branch},
+			},
+		},
+	}
+	if !UsesGitContext(project) {
+		t.Fatal("expected project to use git context")
+	}
+	if err := ApplyGitContext(&project, gc); err != nil {
+		t.Fatalf("ApplyGitContext failed: %v", err)
+	}
+
+	web := project.Services["web"]
+	if web.Image != "registry.example.com/web:v1.2.3" {
+		t.Errorf("expected tagged image, got %s", web.Image)
+	}
+	if got := *web.Build.Args["REVISION"]; got != gc.SHA {
+		t.Errorf("expected build arg %s, got %s", gc.SHA, got)
+	}
+	if got := *web.Environment["COMMIT"]; got != gc.SHA {
+		t.Errorf("expected environment COMMIT=%s, got %s", gc.SHA, got)
+	}
+	if got := *web.Environment["BRANCH"]; got != "release/main" {
+		t.Errorf("expected environment BRANCH=release/main, got %s", got)
+	}
+	if UsesGitContext(project) {
+		t.Error("expected no tokens left after substitution")
+	}
+}
+
+func TestGitContextUntagged(t *testing.T) {
+	dir := initGitRepo(t)
+	cmd := exec.Command("git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "next")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git commit failed: %v\n%s", err, out)
+	}
+
+	gc, err := LoadGitContext(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadGitContext failed: %v", err)
+	}
+	if gc.Tag != "" {
+		t.Fatalf("expected no tag on HEAD, got %s", gc.Tag)
+	}
+
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{Name: "web", Image: "web:{git.tag}"},
+		},
+	}
+	err = ApplyGitContext(&project, gc)
+	if err == nil || !strings.Contains(err.Error(), "HEAD has no tag") {
+		t.Errorf("expected missing tag error, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/containerd/errdefs"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/moby/moby/client"
+)
+
+// checkImages confirms that the image of every service cicdez doesn't build
+// can be pulled, by having the manager ask the registry for its manifest.
+// Built images were just pushed and registryless ones live on the nodes.
+// When the registry can't answer the lookup, an image the manager has a
+// copy of passes and any other only gets a warning.
+func checkImages(ctx context.Context, apiClient client.APIClient, project types.Project, authCfg *configfile.ConfigFile, quiet bool, out io.Writer) error {
+	var unpullable []string
+	for _, name := range slices.Sorted(maps.Keys(project.Services)) {
+		svc := project.Services[name]
+		if svc.Build != nil || svc.Image == "" || IsRegistryless(svc.Image) {
+			continue
+		}
+
+		_, err := apiClient.DistributionInspect(ctx, svc.Image, client.DistributionInspectOptions{
+			EncodedRegistryAuth: encodeAuth(resolveAuth(authCfg, svc.Image)),
+		})
+		switch {
+		case err == nil:
+		case errdefs.IsNotFound(err), errdefs.IsUnauthorized(err), errdefs.IsPermissionDenied(err):
+			// registries answer unauthorized for repositories that don't exist
+			unpullable = append(unpullable, fmt.Sprintf("%s (service %s): %v", svc.Image, name, err))
+		default:
+			if _, inspectErr := apiClient.ImageInspect(ctx, svc.Image); inspectErr == nil {
+				continue
+			}
+			if !quiet {
+				fmt.Fprintf(out, "%s could not verify image %s of service %s: %v\n", WarningPrefix(), svc.Image, name, err)
+			}
+		}
+	}
+
+	if len(unpullable) > 0 {
+		return fmt.Errorf("images can't be pulled from their registry:\n  %s", strings.Join(unpullable, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/containerd/errdefs"
+)
+
+func TestCheckImages(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web":    types.ServiceConfig{Name: "web", Image: "nginx:1.27"},
+			"api":    types.ServiceConfig{Name: "api", Image: "registry.example.com/api:typo"},
+			"built":  types.ServiceConfig{Name: "built", Image: "registry.example.com/built:new", Build: &types.BuildConfig{Context: "."}},
+			"local":  types.ServiceConfig{Name: "local", Image: "registryless/local:latest"},
+			"mirror": types.ServiceConfig{Name: "mirror", Image: "mirror.example.com/cache:1"},
+			"cached": types.ServiceConfig{Name: "cached", Image: "mirror.example.com/cache:2"},
+		},
+	}
+	unsupported := errors.New("registry does not support manifest HEAD")
+	fc := &fakeClient{
+		distributions: map[string]error{
+			"registry.example.com/api:typo":  errdefs.ErrNotFound.WithMessage("manifest unknown"),
+			"registry.example.com/built:new": errdefs.ErrNotFound,
+			"registryless/local:latest":      errdefs.ErrNotFound,
+			"mirror.example.com/cache:1":     unsupported,
+			"mirror.example.com/cache:2":     unsupported,
+		},
+		images: map[string]bool{"mirror.example.com/cache:2": true},
+	}
+
+	var out bytes.Buffer
+	err := checkImages(context.Background(), fc, project, nil, false, &out)
+	if err == nil {
+		t.Fatal("expected the missing api image to fail the check")
+	}
+	if !strings.Contains(err.Error(), "registry.example.com/api:typo (service api)") {
+		t.Errorf("expected the api image to be listed, got %v", err)
+	}
+	for _, skipped := range []string{"built", "local", "mirror", "cached", "web"} {
+		if strings.Contains(err.Error(), "(service "+skipped+")") {
+			t.Errorf("expected %s not to be listed, got %v", skipped, err)
+		}
+	}
+
+	// a registry that can't answer is a warning, unless the daemon has the image
+	if !strings.Contains(out.String(), "could not verify image mirror.example.com/cache:1") {
+		t.Errorf("expected a warning for the unverifiable image, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "cache:2") {
+		t.Errorf("expected no warning for an image the daemon holds, got %q", out.String())
+	}
+}
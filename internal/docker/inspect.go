@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// ServiceReport is what swarm currently runs for a stack service
+type ServiceReport struct {
+	Name    string            `json:"name"`
+	ID      string            `json:"id"`
+	Image   string            `json:"image"`
+	Running int               `json:"running"`
+	Desired int               `json:"desired"`
+	Spec    swarm.ServiceSpec `json:"spec"`
+}
+
+// InspectService looks up a compose service of the stack by its scoped name
+func InspectService(ctx context.Context, apiClient client.APIClient, stack, service string) (ServiceReport, error) {
+	name := ScopeName(stack, service)
+	res, err := apiClient.ServiceInspect(ctx, name, client.ServiceInspectOptions{})
+	if err != nil {
+		return ServiceReport{}, fmt.Errorf("failed to inspect service %s: %w", name, err)
+	}
+
+	running, desired, err := taskCounts(ctx, apiClient, res.Service)
+	if err != nil {
+		return ServiceReport{}, fmt.Errorf("failed to list tasks of service %s: %w", name, err)
+	}
+
+	return ServiceReport{
+		Name:    name,
+		ID:      res.Service.ID,
+		Image:   res.Service.Spec.Labels[LabelImage],
+		Running: running,
+		Desired: desired,
+		Spec:    res.Service.Spec,
+	}, nil
+}
+
+// MarshalReport encodes a report as indented JSON, or as YAML
+func MarshalReport(report ServiceReport, asJSON bool) ([]byte, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal service: %w", err)
+	}
+	if asJSON {
+		return append(data, '\n'), nil
+	}
+	return jsonToYAML(data)
+}
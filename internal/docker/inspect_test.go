@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestInspectService(t *testing.T) {
+	replicas := uint64(3)
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_web": {
+				ID: "web-id",
+				Spec: swarm.ServiceSpec{
+					Annotations: swarm.Annotations{
+						Name:   "stack_web",
+						Labels: map[string]string{LabelImage: "nginx:1.27"},
+					},
+					Mode: swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+				},
+			},
+		},
+		tasks: []swarm.Task{
+			{Status: swarm.TaskStatus{State: swarm.TaskStateRunning}},
+			{Status: swarm.TaskStatus{State: swarm.TaskStateStarting}},
+		},
+	}
+
+	report, err := InspectService(context.Background(), fc, "stack", "web")
+	if err != nil {
+		t.Fatalf("InspectService failed: %v", err)
+	}
+	if report.Name != "stack_web" || report.ID != "web-id" || report.Image != "nginx:1.27" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Running != 1 || report.Desired != 3 {
+		t.Errorf("expected 1/3 replicas, got %d/%d", report.Running, report.Desired)
+	}
+
+	out, err := MarshalReport(report, false)
+	if err != nil {
+		t.Fatalf("MarshalReport failed: %v", err)
+	}
+	for _, want := range []string{"name: stack_web", "image: nginx:1.27", "running: 1", "desired: 3", "Replicas: 3"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected YAML to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	out, err = MarshalReport(report, true)
+	if err != nil {
+		t.Fatalf("MarshalReport failed: %v", err)
+	}
+	var decoded ServiceReport
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("expected JSON output: %v", err)
+	}
+	if decoded.Spec.Name != "stack_web" {
+		t.Errorf("expected spec in JSON output, got %+v", decoded)
+	}
+
+	if _, err := InspectService(context.Background(), fc, "stack", "missing"); err == nil || !strings.Contains(err.Error(), "stack_missing") {
+		t.Errorf("expected error naming stack_missing, got %v", err)
+	}
+}
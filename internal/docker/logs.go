@@ -0,0 +1,175 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// LogsOptions selects which log lines of a stack service are streamed
+type LogsOptions struct {
+	Since      time.Time
+	Until      time.Time
+	Task       int // task slot, 0 streams every task of the service
+	Follow     bool
+	Tail       string
+	Timestamps bool
+}
+
+// ParseLogTime accepts an RFC3339 timestamp or a duration such as 10m, which
+// is taken relative to now. An empty value yields the zero time.
+func ParseLogTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC3339 or a duration like 10m", value)
+	}
+	return now.Add(-d), nil
+}
+
+// StreamLogs writes the logs of a compose service of the stack to stdout and
+// stderr, from a single task slot when opts.Task is set
+func StreamLogs(ctx context.Context, apiClient client.APIClient, stack, service string, opts LogsOptions, stdout, stderr io.Writer) error {
+	name := ScopeName(stack, service)
+	res, err := apiClient.ServiceInspect(ctx, name, client.ServiceInspectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to inspect service %s: %w", name, err)
+	}
+
+	// neither the daemon nor the client pass until on for service and task
+	// logs, so the lines are stamped and those after it dropped here
+	timestamps := opts.Timestamps || !opts.Until.IsZero()
+
+	var logs io.ReadCloser
+	if opts.Task > 0 {
+		task, err := taskInSlot(ctx, apiClient, res.Service.ID, opts.Task)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		logs, err = apiClient.TaskLogs(ctx, task.ID, client.TaskLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Since:      logTimestamp(opts.Since),
+			Timestamps: timestamps,
+			Follow:     opts.Follow,
+			Tail:       opts.Tail,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get logs of task %s: %w", task.ID, err)
+		}
+	} else {
+		logs, err = apiClient.ServiceLogs(ctx, res.Service.ID, client.ServiceLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Since:      logTimestamp(opts.Since),
+			Timestamps: timestamps,
+			Follow:     opts.Follow,
+			Tail:       opts.Tail,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get logs of service %s: %w", name, err)
+		}
+	}
+	defer logs.Close()
+
+	if !opts.Until.IsZero() {
+		out := &untilWriter{w: stdout, until: opts.Until, timestamps: opts.Timestamps}
+		errOut := &untilWriter{w: stderr, until: opts.Until, timestamps: opts.Timestamps}
+		defer out.Flush()
+		defer errOut.Flush()
+		stdout, stderr = out, errOut
+	}
+
+	// service specs never allocate a tty, so the stream is always multiplexed
+	_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	return err
+}
+
+// untilWriter drops the log lines stamped after until and, unless
+// timestamps is set, cuts the stamp off the others. Lines without a stamp
+// are passed through.
+type untilWriter struct {
+	w          io.Writer
+	until      time.Time
+	timestamps bool
+	buf        []byte
+}
+
+func (u *untilWriter) Write(p []byte) (int, error) {
+	u.buf = append(u.buf, p...)
+	for {
+		i := bytes.IndexByte(u.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := u.writeLine(u.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		u.buf = u.buf[i+1:]
+	}
+}
+
+// Flush writes a last line that didn't end in a newline
+func (u *untilWriter) Flush() error {
+	if len(u.buf) == 0 {
+		return nil
+	}
+	err := u.writeLine(u.buf)
+	u.buf = nil
+	return err
+}
+
+func (u *untilWriter) writeLine(line []byte) error {
+	if stamp, rest, ok := bytes.Cut(line, []byte(" ")); ok {
+		if t, err := time.Parse(time.RFC3339Nano, string(stamp)); err == nil {
+			if t.After(u.until) {
+				return nil
+			}
+			if !u.timestamps {
+				line = rest
+			}
+		}
+	}
+	_, err := u.w.Write(line)
+	return err
+}
+
+// taskInSlot returns the most recent task of a service in the given slot
+func taskInSlot(ctx context.Context, apiClient client.APIClient, serviceID string, slot int) (swarm.Task, error) {
+	res, err := apiClient.TaskList(ctx, client.TaskListOptions{
+		Filters: make(client.Filters).Add("service", serviceID),
+	})
+	if err != nil {
+		return swarm.Task{}, err
+	}
+
+	var latest swarm.Task
+	for _, task := range res.Items {
+		if task.Slot == slot && task.Meta.CreatedAt.After(latest.Meta.CreatedAt) {
+			latest = task
+		}
+	}
+	if latest.ID == "" {
+		return swarm.Task{}, fmt.Errorf("no task in slot %d", slot)
+	}
+	return latest, nil
+}
+
+// logTimestamp formats t the way the daemon expects, seconds.nanoseconds
+func logTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"10m", now.Add(-10 * time.Minute)},
+		{"1h30m", now.Add(-90 * time.Minute)},
+		{"2026-02-28T08:00:00Z", time.Date(2026, 2, 28, 8, 0, 0, 0, time.UTC)},
+		{"2026-02-28T08:00:00+02:00", time.Date(2026, 2, 28, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseLogTime(tt.value, now)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.value, tt.want, got)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "-5m", "2026-02-28"} {
+		if _, err := ParseLogTime(value, now); err == nil || !strings.Contains(err.Error(), "invalid time") {
+			t.Errorf("%q: expected invalid time error, got %v", value, err)
+		}
+	}
+}
+
+func TestLogTimestamp(t *testing.T) {
+	if got := logTimestamp(time.Time{}); got != "" {
+		t.Errorf("expected empty timestamp for zero time, got %q", got)
+	}
+	if got := logTimestamp(time.Unix(1700000000, 5)); got != "1700000000.000000005" {
+		t.Errorf("unexpected timestamp %q", got)
+	}
+}
+
+func TestStreamLogsUntil(t *testing.T) {
+	fc := &fakeClient{
+		services: map[string]swarm.Service{"app_api": {ID: "svc1"}},
+		serviceLogs: "2026-03-01T11:59:00.000000001Z started\n" +
+			"2026-03-01T12:00:00Z ready\n" +
+			"2026-03-01T12:00:00.5Z too late\n" +
+			"2026-03-01T12:05:00Z later still",
+	}
+	until := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	if err := StreamLogs(context.Background(), fc, "app", "api", LogsOptions{Until: until}, &out, io.Discard); err != nil {
+		t.Fatalf("StreamLogs failed: %v", err)
+	}
+	if out.String() != "started\nready\n" {
+		t.Errorf("expected the lines up to until without stamps, got %q", out.String())
+	}
+	if len(fc.logOptions) != 1 || !fc.logOptions[0].Timestamps {
+		t.Errorf("expected timestamps to be requested for the filter, got %+v", fc.logOptions)
+	}
+
+	out.Reset()
+	if err := StreamLogs(context.Background(), fc, "app", "api", LogsOptions{Until: until, Timestamps: true}, &out, io.Discard); err != nil {
+		t.Fatalf("StreamLogs failed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "2026-03-01T11:59:00.000000001Z started\n") || strings.Contains(out.String(), "too late") {
+		t.Errorf("expected stamped lines up to until, got %q", out.String())
+	}
+}
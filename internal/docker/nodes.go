@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// ListNodes returns the nodes of the swarm sorted by hostname
+func ListNodes(ctx context.Context, apiClient client.APIClient) ([]swarm.Node, error) {
+	res, err := apiClient.NodeList(ctx, client.NodeListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes := slices.Clone(res.Items)
+	slices.SortFunc(nodes, func(a, b swarm.Node) int {
+		return strings.Compare(a.Description.Hostname, b.Description.Hostname)
+	})
+	return nodes, nil
+}
+
+// WriteNodes prints one row per node with the labels placement constraints
+// match against as node.labels
+func WriteNodes(out io.Writer, nodes []swarm.Node) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tHOSTNAME\tROLE\tAVAILABILITY\tLABELS")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", node.ID, node.Description.Hostname, node.Spec.Role, node.Spec.Availability, nodeLabels(node.Spec.Labels))
+	}
+	return w.Flush()
+}
+
+func nodeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestWriteNodes(t *testing.T) {
+	fake := &fakeClient{nodes: []swarm.Node{
+		{
+			ID:          "n2",
+			Description: swarm.NodeDescription{Hostname: "worker-1"},
+			Spec: swarm.NodeSpec{
+				Annotations:  swarm.Annotations{Labels: map[string]string{"zone": "east", "disk": "ssd"}},
+				Role:         swarm.NodeRoleWorker,
+				Availability: swarm.NodeAvailabilityDrain,
+			},
+		},
+		{
+			ID:          "n1",
+			Description: swarm.NodeDescription{Hostname: "manager-1"},
+			Spec:        swarm.NodeSpec{Role: swarm.NodeRoleManager, Availability: swarm.NodeAvailabilityActive},
+		},
+	}}
+
+	nodes, err := ListNodes(context.Background(), fake)
+	if err != nil {
+		t.Fatalf("ListNodes failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := WriteNodes(&out, nodes); err != nil {
+		t.Fatalf("WriteNodes failed: %v", err)
+	}
+
+	want := "ID  HOSTNAME   ROLE     AVAILABILITY  LABELS\n" +
+		"n1  manager-1  manager  active        -\n" +
+		"n2  worker-1   worker   drain         disk=ssd,zone=east\n"
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
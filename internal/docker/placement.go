@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// labelConstraint is a node.labels placement constraint, key==value or
+// key!=value
+type labelConstraint struct {
+	raw   string
+	key   string
+	value string
+	equal bool
+}
+
+// parseLabelConstraint picks the node.labels constraints out of a service's
+// placement, the others (node.role, node.hostname, ...) aren't checked
+func parseLabelConstraint(constraint string) (labelConstraint, bool) {
+	op, equal := "==", true
+	if strings.Contains(constraint, "!=") {
+		op, equal = "!=", false
+	}
+	left, right, ok := strings.Cut(constraint, op)
+	if !ok {
+		return labelConstraint{}, false
+	}
+	key, ok := strings.CutPrefix(strings.TrimSpace(left), "node.labels.")
+	if !ok || key == "" {
+		return labelConstraint{}, false
+	}
+	return labelConstraint{raw: constraint, key: key, value: strings.TrimSpace(right), equal: equal}, true
+}
+
+// matches tells whether a node with labels satisfies c, values compare
+// case-insensitively like swarm does
+func (c labelConstraint) matches(labels map[string]string) bool {
+	value, ok := labels[c.key]
+	found := ok && strings.EqualFold(value, c.value)
+	return found == c.equal
+}
+
+// checkPlacement makes sure every service's node.labels constraints are met
+// together by at least one node that can run tasks. Swarm accepts constraints
+// no node satisfies and leaves the tasks pending, so the deploy would never
+// converge. Offenders are reported as warnings, or as an error when strict is
+// set.
+func checkPlacement(ctx context.Context, apiClient client.APIClient, services map[string]swarm.ServiceSpec, strict, quiet bool, out io.Writer) error {
+	var names []string
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		if placement := services[name].TaskTemplate.Placement; placement != nil && len(placement.Constraints) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	res, err := apiClient.NodeList(ctx, client.NodeListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var nodes []map[string]string
+	for _, node := range res.Items {
+		if node.Status.State == swarm.NodeStateDown || node.Spec.Availability == swarm.NodeAvailabilityDrain {
+			continue
+		}
+		nodes = append(nodes, node.Spec.Labels)
+	}
+
+	var problems []error
+	for _, name := range names {
+		var constraints []labelConstraint
+		for _, raw := range services[name].TaskTemplate.Placement.Constraints {
+			if c, ok := parseLabelConstraint(raw); ok {
+				constraints = append(constraints, c)
+			}
+		}
+		if len(constraints) == 0 {
+			continue
+		}
+
+		fits := slices.ContainsFunc(nodes, func(labels map[string]string) bool {
+			for _, c := range constraints {
+				if !c.matches(labels) {
+					return false
+				}
+			}
+			return true
+		})
+		if !fits {
+			raws := make([]string, len(constraints))
+			for i, c := range constraints {
+				raws[i] = c.raw
+			}
+			problems = append(problems, fmt.Errorf("service %s is constrained to %s but no available node has matching labels, see cicdez node ls",
+				name, strings.Join(raws, " and ")))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if strict {
+		return errors.Join(problems...)
+	}
+	if !quiet {
+		for _, p := range problems {
+			fmt.Fprintf(out, "%s %v\n", WarningPrefix(), p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestParseLabelConstraint(t *testing.T) {
+	c, ok := parseLabelConstraint("node.labels.zone == east")
+	if !ok || c.key != "zone" || c.value != "east" || !c.equal {
+		t.Errorf("expected zone==east, got %+v, %t", c, ok)
+	}
+	c, ok = parseLabelConstraint("node.labels.disk!=hdd")
+	if !ok || c.key != "disk" || c.value != "hdd" || c.equal {
+		t.Errorf("expected disk!=hdd, got %+v, %t", c, ok)
+	}
+	for _, constraint := range []string{"node.role==manager", "node.hostname!=db-1", "engine.labels.os==linux", "node.labels.zone"} {
+		if _, ok := parseLabelConstraint(constraint); ok {
+			t.Errorf("expected %q to be skipped", constraint)
+		}
+	}
+}
+
+func TestCheckPlacement(t *testing.T) {
+	fc := &fakeClient{nodes: []swarm.Node{
+		{
+			ID:     "east",
+			Spec:   swarm.NodeSpec{Annotations: swarm.Annotations{Labels: map[string]string{"zone": "east", "disk": "hdd"}}},
+			Status: swarm.NodeStatus{State: swarm.NodeStateReady},
+		},
+		{
+			ID:     "west",
+			Spec:   swarm.NodeSpec{Annotations: swarm.Annotations{Labels: map[string]string{"zone": "west", "disk": "ssd"}}},
+			Status: swarm.NodeStatus{State: swarm.NodeStateReady},
+		},
+		{
+			ID: "drained",
+			Spec: swarm.NodeSpec{
+				Annotations:  swarm.Annotations{Labels: map[string]string{"zone": "north"}},
+				Availability: swarm.NodeAvailabilityDrain,
+			},
+			Status: swarm.NodeStatus{State: swarm.NodeStateReady},
+		},
+	}}
+
+	constrained := func(constraints ...string) swarm.ServiceSpec {
+		return swarm.ServiceSpec{TaskTemplate: swarm.TaskSpec{Placement: &swarm.Placement{Constraints: constraints}}}
+	}
+	services := map[string]swarm.ServiceSpec{
+		"web":   constrained("node.labels.zone==East", "node.role==worker"),
+		"cache": constrained("node.labels.disk!=hdd"),
+		// each constraint matches a node, but not the same one
+		"db": constrained("node.labels.zone==east", "node.labels.disk==ssd"),
+		// only a drained node carries the label
+		"queue": constrained("node.labels.zone==north"),
+	}
+
+	var out bytes.Buffer
+	if err := checkPlacement(context.Background(), fc, services, false, false, &out); err != nil {
+		t.Fatalf("checkPlacement failed: %v", err)
+	}
+	warning := out.String()
+	for _, want := range []string{
+		"Warning: service db is constrained to node.labels.zone==east and node.labels.disk==ssd",
+		"Warning: service queue is constrained to node.labels.zone==north",
+	} {
+		if !strings.Contains(warning, want) {
+			t.Errorf("expected %q, got: %q", want, warning)
+		}
+	}
+	if strings.Contains(warning, "service web") || strings.Contains(warning, "service cache") {
+		t.Errorf("expected no warning for satisfiable constraints, got: %q", warning)
+	}
+
+	out.Reset()
+	err := checkPlacement(context.Background(), fc, services, true, false, &out)
+	if err == nil || !strings.Contains(err.Error(), "service db") || !strings.Contains(err.Error(), "service queue") {
+		t.Fatalf("expected strict mode to fail naming db and queue, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no warnings in strict mode, got: %q", out.String())
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"sort"
+	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/moby/moby/api/types/swarm"
@@ -15,7 +16,6 @@ import (
 	"github.com/moby/moby/client/pkg/jsonmessage"
 	"github.com/moby/moby/client/pkg/progress"
 	"github.com/moby/moby/client/pkg/streamformatter"
-	"golang.org/x/term"
 )
 
 var numberedStates = map[swarm.TaskState]int64{
@@ -40,7 +40,59 @@ func terminalState(state swarm.TaskState) bool {
 
 var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
 
-func waitOnServices(ctx context.Context, apiClient client.APIClient, services map[string]string, quiet bool, out io.Writer) error {
+// progressHeartbeat repeats an unchanged progress line so long waits still
+// show signs of life
+var progressHeartbeat = 10 * time.Second
+
+// how waiting on a service ended
+const (
+	OutcomeConverged = "converged"
+	OutcomeTimedOut  = "timed out"
+	OutcomeFailed    = "failed"
+)
+
+// WaitResult is how waiting on one service ended, Err is set when it failed
+type WaitResult struct {
+	Service string
+	Outcome string
+	Err     error
+}
+
+// WaitSummary holds the result of every service waited on, by name
+type WaitSummary []WaitResult
+
+// TimedOut returns the services that were still converging when the wait
+// ended
+func (s WaitSummary) TimedOut() []string {
+	var names []string
+	for _, r := range s {
+		if r.Outcome == OutcomeTimedOut {
+			names = append(names, r.Service)
+		}
+	}
+	return names
+}
+
+// Write prints a line per service with its outcome, and the error of those
+// that failed
+func (s WaitSummary) Write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range s {
+		status := r.Outcome
+		if r.Err != nil {
+			status += ": " + r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\n", r.Service, status)
+	}
+	return w.Flush()
+}
+
+// WaitOnServices blocks until every service (ID to display name) converges,
+// fails, or ctx is done, and reports how each one ended. The error joins the
+// failures, services still converging when ctx is done are only reported.
+// With verbose set, a plain "service X: 2/5 tasks running" line is printed
+// whenever a service's task counts change.
+func WaitOnServices(ctx context.Context, apiClient client.APIClient, services map[string]string, quiet, verbose bool, out io.Writer) (WaitSummary, error) {
 	ids := make([]string, 0, len(services))
 	for id := range services {
 		ids = append(ids, id)
@@ -49,13 +101,18 @@ func waitOnServices(ctx context.Context, apiClient client.APIClient, services ma
 		return services[ids[i]] < services[ids[j]]
 	})
 
+	var report func(string)
+	if verbose && !quiet {
+		// the verbose form is line oriented, so share the writer with the
+		// display stream and skip the in-place spinner
+		out = &syncWriter{w: out}
+		report = func(line string) { fmt.Fprintln(out, line) }
+	}
+
 	isTTY := false
 	var fd uintptr
-	if !quiet {
-		if f, ok := out.(*os.File); ok {
-			fd = f.Fd()
-			isTTY = term.IsTerminal(int(fd))
-		}
+	if !quiet && report == nil {
+		fd, isTTY = terminalFd(out)
 	}
 
 	pipeReader, pipeWriter := io.Pipe()
@@ -71,23 +128,27 @@ func waitOnServices(ctx context.Context, apiClient client.APIClient, services ma
 
 	progressOut := streamformatter.NewJSONProgressOutput(pipeWriter, false)
 
-	errCh := make(chan error, len(ids))
+	summary := make(WaitSummary, len(ids))
 	var wg sync.WaitGroup
-	for _, id := range ids {
-		id := id
+	for i, id := range ids {
 		name := services[id]
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			errCh <- serviceProgress(ctx, apiClient, id, name, progressOut, isTTY)
+			outcome, err := serviceProgress(ctx, apiClient, id, name, progressOut, isTTY, report)
+			// a request cut short by ctx means the wait ran out, not that
+			// the service failed
+			if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				outcome, err = OutcomeTimedOut, nil
+			}
+			summary[i] = WaitResult{Service: name, Outcome: outcome, Err: err}
 		}()
 	}
 	wg.Wait()
-	close(errCh)
 
 	var runErr error
-	for err := range errCh {
-		runErr = errors.Join(runErr, err)
+	for _, r := range summary {
+		runErr = errors.Join(runErr, r.Err)
 	}
 
 	pipeWriter.Close()
@@ -98,155 +159,326 @@ func waitOnServices(ctx context.Context, apiClient client.APIClient, services ma
 	}
 
 	if runErr != nil {
-		return runErr
+		return summary, runErr
+	}
+	return summary, displayErr
+}
+
+// the first and the longest wait between two polls of a service
+var (
+	pollInterval    = 500 * time.Millisecond
+	pollIntervalMax = 5 * time.Second
+)
+
+// pollBackoff spaces the polls of a service, the wait doubles after every
+// poll up to max and drops back to min once the service makes progress
+type pollBackoff struct {
+	min, max time.Duration
+	next     time.Duration
+}
+
+func newPollBackoff() *pollBackoff {
+	return &pollBackoff{min: pollInterval, max: pollIntervalMax}
+}
+
+// Next returns how long to wait before the next poll
+func (b *pollBackoff) Next() time.Duration {
+	if b.next == 0 {
+		b.next = b.min
+	}
+	d := b.next
+	b.next = min(b.next*2, b.max)
+	return d
+}
+
+// Reset starts the schedule over from min
+func (b *pollBackoff) Reset() {
+	b.next = 0
+}
+
+// updateError is an update swarm stopped short of converging, one that is
+// paused or was rolled back
+type updateError struct {
+	state   string
+	message string
+}
+
+func (e *updateError) Error() string {
+	return e.state + ": " + e.message
+}
+
+// servicePoll is what one poll of a service found
+type servicePoll struct {
+	service     swarm.Service
+	tasks       []swarm.Task
+	activeNodes map[string]string
+	// updated is set once swarm reports the last update completed
+	updated  bool
+	rollback bool
+	total    int
+	running  int
+	starting int
+	failed   int
+}
+
+// ready reports whether every expected task runs, a service scaled to zero
+// is ready once its last task is gone
+func (p servicePoll) ready() bool {
+	return p.running == p.total && (p.total > 0 || p.starting+p.failed == 0)
+}
+
+// pollService inspects the service and tallies its up-to-date tasks. An
+// update that is paused or was rolled back is an error, waiting longer
+// won't make it converge.
+func pollService(ctx context.Context, apiClient client.APIClient, serviceID string) (servicePoll, error) {
+	res, err := apiClient.ServiceInspect(ctx, serviceID, client.ServiceInspectOptions{})
+	if err != nil {
+		return servicePoll{}, err
+	}
+	poll := servicePoll{service: res.Service}
+
+	if status := res.Service.UpdateStatus; status != nil {
+		switch status.State {
+		case swarm.UpdateStateCompleted:
+			poll.updated = true
+		case swarm.UpdateStatePaused:
+			return poll, &updateError{state: "update paused", message: status.Message}
+		case swarm.UpdateStateRollbackStarted:
+			poll.rollback = true
+		case swarm.UpdateStateRollbackPaused:
+			return poll, &updateError{state: "rollback paused", message: status.Message}
+		case swarm.UpdateStateRollbackCompleted:
+			return poll, &updateError{state: "update rolled back", message: status.Message}
+		}
+	}
+
+	updater := initializeUpdater(res.Service)
+	if updater == nil {
+		// jobs are not tracked, there is nothing to wait for
+		poll.updated = true
+		return poll, nil
+	}
+
+	tasksRes, err := apiClient.TaskList(ctx, client.TaskListOptions{
+		Filters: make(client.Filters).Add("service", res.Service.ID).Add("_up-to-date", "true"),
+	})
+	if err != nil {
+		return poll, err
+	}
+	poll.tasks = tasksRes.Items
+	poll.activeNodes, err = getActiveNodes(ctx, apiClient)
+	if err != nil {
+		return poll, err
+	}
+
+	total, states, err := updater.update(res.Service, poll.tasks, poll.activeNodes)
+	if err != nil {
+		return poll, err
+	}
+	poll.total = total
+	for s, n := range states {
+		switch s {
+		case swarm.TaskStateRunning, swarm.TaskStateComplete:
+			poll.running += n
+		case swarm.TaskStateFailed, swarm.TaskStateRejected:
+			poll.failed += n
+		default:
+			poll.starting += n
+		}
 	}
-	return displayErr
+	return poll, nil
 }
 
-func serviceProgress(ctx context.Context, apiClient client.APIClient, serviceID, displayName string, progressOut progress.Output, tty bool) error {
+func serviceProgress(ctx context.Context, apiClient client.APIClient, serviceID, displayName string, progressOut progress.Output, tty bool, report func(string)) (string, error) {
 	var (
-		updater     progressUpdater
-		converged   bool
 		convergedAt time.Time
 		monitor     = 5 * time.Second
-		rollback    bool
+		backoff     = newPollBackoff()
 		frame       int
+		lastTally   [4]int
+		lastReport  string
+		reportedAt  time.Time
 	)
 
 	for {
 		select {
 		case <-ctx.Done():
 			progress.Update(progressOut, displayName, "continuing in background")
-			return nil
+			return OutcomeTimedOut, nil
 		default:
 		}
 
-		res, err := apiClient.ServiceInspect(ctx, serviceID, client.ServiceInspectOptions{})
-		if err != nil {
-			return err
-		}
-
-		if res.Service.Spec.UpdateConfig != nil && res.Service.Spec.UpdateConfig.Monitor != 0 {
-			monitor = res.Service.Spec.UpdateConfig.Monitor
-		}
-
-		if updater == nil {
-			updater = initializeUpdater(res.Service)
-			if updater == nil {
-				progress.Update(progressOut, displayName, "✓ converged")
-				return nil
-			}
-		}
-
-		if res.Service.UpdateStatus != nil {
-			switch res.Service.UpdateStatus.State {
-			case swarm.UpdateStateUpdating:
-				rollback = false
-			case swarm.UpdateStateCompleted:
-				if !converged {
-					progress.Update(progressOut, displayName, "✓ converged")
-					return nil
-				}
-			case swarm.UpdateStatePaused:
-				msg := fmt.Sprintf("update paused: %s", res.Service.UpdateStatus.Message)
-				progress.Update(progressOut, displayName, "✗ "+msg)
-				return fmt.Errorf("%s: %s", displayName, msg)
-			case swarm.UpdateStateRollbackStarted:
-				rollback = true
-			case swarm.UpdateStateRollbackPaused:
-				msg := fmt.Sprintf("rollback paused: %s", res.Service.UpdateStatus.Message)
-				progress.Update(progressOut, displayName, "✗ "+msg)
-				return fmt.Errorf("%s: %s", displayName, msg)
-			case swarm.UpdateStateRollbackCompleted:
-				rollback = true
-			}
-		}
-		if converged && time.Since(convergedAt) >= monitor {
-			progress.Update(progressOut, displayName, "✓ converged")
-			return nil
-		}
-
-		tasksRes, err := apiClient.TaskList(ctx, client.TaskListOptions{
-			Filters: make(client.Filters).Add("service", res.Service.ID).Add("_up-to-date", "true"),
-		})
-		if err != nil {
-			return err
+		poll, err := pollService(ctx, apiClient, serviceID)
+		var updateErr *updateError
+		if errors.As(err, &updateErr) {
+			progress.Update(progressOut, displayName, colorize(ansiRed, "✗ "+err.Error()))
+			return OutcomeFailed, fmt.Errorf("%w: %s: %w", ErrNotConverged, displayName, err)
 		}
-		activeNodes, err := getActiveNodes(ctx, apiClient)
 		if err != nil {
-			return err
+			return OutcomeFailed, err
 		}
 
-		total, states, uErr := updater.update(res.Service, tasksRes.Items, activeNodes)
-		if uErr != nil {
-			progress.Update(progressOut, displayName, "✗ failed: "+uErr.Error())
-			return uErr
+		if poll.service.Spec.UpdateConfig != nil && poll.service.Spec.UpdateConfig.Monitor != 0 {
+			monitor = poll.service.Spec.UpdateConfig.Monitor
 		}
-
-		var running, starting, failed int
-		for s, n := range states {
-			switch s {
-			case swarm.TaskStateRunning, swarm.TaskStateComplete:
-				running += n
-			case swarm.TaskStateFailed, swarm.TaskStateRejected:
-				failed += n
-			default:
-				starting += n
-			}
+		if poll.updated && convergedAt.IsZero() {
+			progress.Update(progressOut, displayName, colorize(ansiGreen, "✓ converged"))
+			return OutcomeConverged, nil
+		}
+		if !convergedAt.IsZero() && time.Since(convergedAt) >= monitor {
+			progress.Update(progressOut, displayName, colorize(ansiGreen, "✓ converged"))
+			return OutcomeConverged, nil
 		}
 
 		if tty {
 			prefix := ""
-			if rollback {
+			if poll.rollback {
 				prefix = "rolling back: "
 			}
 			progress.Update(progressOut, displayName, fmt.Sprintf("%s %s%d/%d (%d starting / %d running / %d failed)",
-				spinnerFrames[frame%len(spinnerFrames)], prefix, running, total, starting, running, failed))
+				spinnerFrames[frame%len(spinnerFrames)], prefix, poll.running, poll.total, poll.starting, poll.running, poll.failed))
 			frame++
 		}
 
-		if total > 0 && running == total {
+		if report != nil {
+			line := fmt.Sprintf("service %s: %d/%d tasks running", displayName, poll.running, poll.total)
+			if nodes := runningNodes(poll.tasks, poll.activeNodes); len(nodes) > 0 {
+				line += " on " + strings.Join(nodes, ", ")
+			}
+			if poll.rollback {
+				line += " (rolling back)"
+			}
+			if line != lastReport || time.Since(reportedAt) >= progressHeartbeat {
+				report(line)
+				lastReport = line
+				reportedAt = time.Now()
+			}
+		}
+
+		if poll.ready() {
 			if convergedAt.IsZero() {
 				convergedAt = time.Now()
 			}
-			converged = true
 		} else {
 			convergedAt = time.Time{}
-			converged = false
+		}
+
+		// poll again soon while tasks are changing, back off while they
+		// are not, and don't overshoot the end of the monitor window
+		tally := [4]int{poll.total, poll.running, poll.starting, poll.failed}
+		if tally != lastTally {
+			backoff.Reset()
+			lastTally = tally
+		}
+		wait := backoff.Next()
+		if !convergedAt.IsZero() {
+			wait = min(wait, max(monitor-time.Since(convergedAt), 0))
 		}
 
 		select {
-		case <-time.After(200 * time.Millisecond):
+		case <-time.After(wait):
 		case <-ctx.Done():
 			progress.Update(progressOut, displayName, "continuing in background")
-			return nil
+			return OutcomeTimedOut, nil
 		}
 	}
 }
 
-func getActiveNodes(ctx context.Context, apiClient client.APIClient) (map[string]struct{}, error) {
+// ServiceTaskCounts returns the running and desired task counts of a service
+func ServiceTaskCounts(ctx context.Context, apiClient client.APIClient, serviceID string) (running, desired int, err error) {
+	res, err := apiClient.ServiceInspect(ctx, serviceID, client.ServiceInspectOptions{})
+	if err != nil {
+		return 0, 0, err
+	}
+	return taskCounts(ctx, apiClient, res.Service)
+}
+
+func taskCounts(ctx context.Context, apiClient client.APIClient, service swarm.Service) (running, desired int, err error) {
+	tasks, err := apiClient.TaskList(ctx, client.TaskListOptions{
+		Filters: make(client.Filters).Add("service", service.ID).Add("desired-state", "running"),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, task := range tasks.Items {
+		if task.Status.State == swarm.TaskStateRunning {
+			running++
+		}
+	}
+
+	mode := service.Spec.Mode
+	switch {
+	case mode.Replicated != nil && mode.Replicated.Replicas != nil:
+		desired = int(*mode.Replicated.Replicas)
+	case mode.Replicated != nil:
+		desired = 1
+	default:
+		desired = len(tasks.Items)
+	}
+	return running, desired, nil
+}
+
+// runningNodes returns the sorted, distinct names of the nodes running the
+// service's up-to-date tasks
+func runningNodes(tasks []swarm.Task, activeNodes map[string]string) []string {
+	seen := make(map[string]bool)
+	var nodes []string
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning || terminalState(task.DesiredState) {
+			continue
+		}
+		name, ok := activeNodes[task.NodeID]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// getActiveNodes maps the IDs of nodes that are not down to their hostnames
+func getActiveNodes(ctx context.Context, apiClient client.APIClient) (map[string]string, error) {
 	res, err := apiClient.NodeList(ctx, client.NodeListOptions{})
 	if err != nil {
 		return nil, err
 	}
-	active := make(map[string]struct{})
+	active := make(map[string]string)
 	for _, n := range res.Items {
-		if n.Status.State != swarm.NodeStateDown {
-			active[n.ID] = struct{}{}
+		if n.Status.State == swarm.NodeStateDown {
+			continue
 		}
+		name := n.Description.Hostname
+		if name == "" {
+			name = n.ID
+		}
+		active[n.ID] = name
 	}
 	return active, nil
 }
 
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
 // progressUpdater dedups tasks per slot/node and returns the total expected
 // plus a histogram of the live tasks' Status.State. Tasks whose DesiredState
 // is terminal (being torn down) are excluded from the histogram.
 type progressUpdater interface {
-	update(service swarm.Service, tasks []swarm.Task, activeNodes map[string]struct{}) (total int, states map[swarm.TaskState]int, err error)
+	update(service swarm.Service, tasks []swarm.Task, activeNodes map[string]string) (total int, states map[swarm.TaskState]int, err error)
 }
 
 func initializeUpdater(service swarm.Service) progressUpdater {
-	if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
+	if service.Spec.Mode.Replicated != nil {
 		return &replicatedUpdater{}
 	}
 	if service.Spec.Mode.Global != nil {
@@ -257,11 +489,15 @@ func initializeUpdater(service swarm.Service) progressUpdater {
 
 type replicatedUpdater struct{}
 
-func (u *replicatedUpdater) update(service swarm.Service, tasks []swarm.Task, activeNodes map[string]struct{}) (int, map[swarm.TaskState]int, error) {
-	if service.Spec.Mode.Replicated == nil || service.Spec.Mode.Replicated.Replicas == nil {
+func (u *replicatedUpdater) update(service swarm.Service, tasks []swarm.Task, activeNodes map[string]string) (int, map[swarm.TaskState]int, error) {
+	if service.Spec.Mode.Replicated == nil {
 		return 0, nil, fmt.Errorf("no replica count")
 	}
-	replicas := int(*service.Spec.Mode.Replicated.Replicas)
+	// services without a deploy block leave replicas unset, swarm runs one
+	replicas := 1
+	if service.Spec.Mode.Replicated.Replicas != nil {
+		replicas = int(*service.Spec.Mode.Replicated.Replicas)
+	}
 
 	tasksBySlot := make(map[int]swarm.Task)
 	for _, task := range tasks {
@@ -290,7 +526,7 @@ func (u *replicatedUpdater) update(service swarm.Service, tasks []swarm.Task, ac
 
 type globalUpdater struct{}
 
-func (u *globalUpdater) update(_ swarm.Service, tasks []swarm.Task, activeNodes map[string]struct{}) (int, map[swarm.TaskState]int, error) {
+func (u *globalUpdater) update(_ swarm.Service, tasks []swarm.Task, activeNodes map[string]string) (int, map[swarm.TaskState]int, error) {
 	tasksByNode := make(map[string]swarm.Task)
 	for _, task := range tasks {
 		if numberedStates[task.DesiredState] == 0 || numberedStates[task.Status.State] == 0 {
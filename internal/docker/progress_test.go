@@ -0,0 +1,368 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client/pkg/streamformatter"
+)
+
+func TestWaitOnServicesRestartWithoutDeploy(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"worker": types.ServiceConfig{
+				Name:    "worker",
+				Image:   "busybox",
+				Restart: "on-failure:3",
+			},
+		},
+	}
+
+	services, err := ConvertServices(context.Background(), nil, "stack", project)
+	if err != nil {
+		t.Fatalf("ConvertServices failed: %v", err)
+	}
+	spec := services["worker"]
+
+	policy := spec.TaskTemplate.RestartPolicy
+	if policy == nil || policy.Condition != swarm.RestartPolicyConditionOnFailure {
+		t.Fatalf("expected on-failure restart policy, got %+v", policy)
+	}
+	if policy.MaxAttempts == nil || *policy.MaxAttempts != 3 {
+		t.Errorf("expected 3 max attempts, got %v", policy.MaxAttempts)
+	}
+	if spec.Mode.Replicated == nil || spec.Mode.Replicated.Replicas != nil {
+		t.Fatalf("expected replicated mode without replica count, got %+v", spec.Mode)
+	}
+
+	// keep the convergence monitor window short for the test
+	spec.UpdateConfig = &swarm.UpdateConfig{Monitor: time.Millisecond}
+
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_worker": {ID: "worker-id", Spec: spec},
+		},
+		tasks: []swarm.Task{{
+			Slot:         1,
+			NodeID:       "node-1",
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		}},
+		nodes: []swarm.Node{{ID: "node-1", Status: swarm.NodeStatus{State: swarm.NodeStateReady}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := WaitOnServices(ctx, fc, map[string]string{"worker-id": "stack_worker"}, true, false, io.Discard); err != nil {
+		t.Fatalf("WaitOnServices failed: %v", err)
+	}
+	if fc.taskLists == 0 {
+		t.Error("expected the service tasks to be checked before reporting convergence")
+	}
+	if ctx.Err() != nil {
+		t.Error("expected convergence before the timeout")
+	}
+
+	total, _, err := initializeUpdater(fc.services["stack_worker"]).update(fc.services["stack_worker"], fc.tasks, map[string]string{"node-1": "node-1"})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("expected nil replicas to default to 1, got %d", total)
+	}
+}
+
+func TestWaitOnServicesPollsUntilRunning(t *testing.T) {
+	replicas := uint64(2)
+	task := func(slot int, state swarm.TaskState) swarm.Task {
+		return swarm.Task{
+			Slot:         slot,
+			NodeID:       "node-1",
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: state},
+		}
+	}
+
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_web": {ID: "web-id", Spec: swarm.ServiceSpec{
+				Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+				UpdateConfig: &swarm.UpdateConfig{Monitor: time.Millisecond},
+			}},
+		},
+		taskRounds: [][]swarm.Task{
+			{task(1, swarm.TaskStatePending)},
+			{task(1, swarm.TaskStateRunning), task(2, swarm.TaskStateStarting)},
+			{task(1, swarm.TaskStateRunning), task(2, swarm.TaskStateRunning)},
+		},
+		nodes: []swarm.Node{{ID: "node-1", Status: swarm.NodeStatus{State: swarm.NodeStateReady}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := WaitOnServices(ctx, fc, map[string]string{"web-id": "stack_web"}, true, false, io.Discard); err != nil {
+		t.Fatalf("WaitOnServices failed: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected convergence before the timeout")
+	}
+	if fc.taskLists < len(fc.taskRounds) {
+		t.Errorf("expected polling through every round, got %d task lists", fc.taskLists)
+	}
+}
+
+func TestWaitOnServicesVerboseProgress(t *testing.T) {
+	replicas := uint64(2)
+	task := func(slot int, node string, state swarm.TaskState) swarm.Task {
+		return swarm.Task{
+			Slot:         slot,
+			NodeID:       node,
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: state},
+		}
+	}
+	node := func(id, hostname string) swarm.Node {
+		return swarm.Node{
+			ID:          id,
+			Description: swarm.NodeDescription{Hostname: hostname},
+			Status:      swarm.NodeStatus{State: swarm.NodeStateReady},
+		}
+	}
+
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_web": {ID: "web-id", Spec: swarm.ServiceSpec{
+				Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+				UpdateConfig: &swarm.UpdateConfig{Monitor: time.Millisecond},
+			}},
+		},
+		taskRounds: [][]swarm.Task{
+			{task(1, "n1", swarm.TaskStatePending)},
+			{task(1, "n1", swarm.TaskStatePending)},
+			{task(1, "n1", swarm.TaskStateRunning), task(2, "n2", swarm.TaskStateStarting)},
+			{task(1, "n1", swarm.TaskStateRunning), task(2, "n2", swarm.TaskStateRunning)},
+		},
+		nodes: []swarm.Node{node("n1", "manager-1"), node("n2", "worker-1")},
+	}
+
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := WaitOnServices(ctx, fc, map[string]string{"web-id": "stack_web"}, false, true, &out); err != nil {
+		t.Fatalf("WaitOnServices failed: %v", err)
+	}
+
+	// unchanged ticks are not repeated
+	var got []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "service ") {
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		"service stack_web: 0/2 tasks running",
+		"service stack_web: 1/2 tasks running on manager-1",
+		"service stack_web: 2/2 tasks running on manager-1, worker-1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected progress lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.Contains(out.String(), "converged") {
+		t.Errorf("expected the converged status in output, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	fc.taskLists = 0
+	if _, err := WaitOnServices(ctx, fc, map[string]string{"web-id": "stack_web"}, true, true, &out); err != nil {
+		t.Fatalf("WaitOnServices failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected --quiet to silence progress, got:\n%s", out.String())
+	}
+}
+
+func TestWaitOnServicesScaledToZero(t *testing.T) {
+	zero := uint64(0)
+	task := func(desired swarm.TaskState) swarm.Task {
+		return swarm.Task{
+			Slot:         1,
+			NodeID:       "node-1",
+			DesiredState: desired,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		}
+	}
+
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_web": {ID: "web-id", Spec: swarm.ServiceSpec{
+				Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &zero}},
+				UpdateConfig: &swarm.UpdateConfig{Monitor: time.Millisecond},
+			}},
+		},
+		taskRounds: [][]swarm.Task{
+			{task(swarm.TaskStateRunning)},
+			{task(swarm.TaskStateShutdown)},
+		},
+		nodes: []swarm.Node{{ID: "node-1", Status: swarm.NodeStatus{State: swarm.NodeStateReady}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := WaitOnServices(ctx, fc, map[string]string{"web-id": "stack_web"}, true, false, io.Discard); err != nil {
+		t.Fatalf("WaitOnServices failed: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected a service scaled to zero to converge before the timeout")
+	}
+	if fc.taskLists < len(fc.taskRounds) {
+		t.Errorf("expected to wait for the last task to stop, got %d task lists", fc.taskLists)
+	}
+}
+
+func TestWaitOnServicesSummary(t *testing.T) {
+	replicas := uint64(1)
+	spec := swarm.ServiceSpec{
+		Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+		UpdateConfig: &swarm.UpdateConfig{Monitor: time.Millisecond},
+	}
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_api": {ID: "api-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStateCompleted}},
+			"stack_db":  {ID: "db-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStatePaused, Message: "task failed"}},
+			// the only task never leaves pending
+			"stack_web": {ID: "web-id", Spec: spec},
+		},
+		tasks: []swarm.Task{{
+			Slot:         1,
+			NodeID:       "node-1",
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStatePending},
+		}},
+		nodes: []swarm.Node{{ID: "node-1", Status: swarm.NodeStatus{State: swarm.NodeStateReady}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	summary, err := WaitOnServices(ctx, fc, map[string]string{
+		"api-id": "stack_api",
+		"db-id":  "stack_db",
+		"web-id": "stack_web",
+	}, true, false, io.Discard)
+	if !errors.Is(err, ErrNotConverged) || !strings.Contains(err.Error(), "stack_db") {
+		t.Fatalf("expected only the paused update to fail the wait, got %v", err)
+	}
+
+	want := WaitSummary{
+		{Service: "stack_api", Outcome: OutcomeConverged},
+		{Service: "stack_db", Outcome: OutcomeFailed},
+		{Service: "stack_web", Outcome: OutcomeTimedOut},
+	}
+	if len(summary) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), summary)
+	}
+	for i, r := range summary {
+		if r.Service != want[i].Service || r.Outcome != want[i].Outcome {
+			t.Errorf("result %d: expected %s %s, got %s %s", i, want[i].Service, want[i].Outcome, r.Service, r.Outcome)
+		}
+	}
+	if got := summary.TimedOut(); len(got) != 1 || got[0] != "stack_web" {
+		t.Errorf("expected stack_web to time out, got %v", got)
+	}
+
+	var out bytes.Buffer
+	if err := summary.Write(&out); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	wantOut := "stack_api  converged\n" +
+		"stack_db   failed: service did not converge: stack_db: update paused: task failed\n" +
+		"stack_web  timed out\n"
+	if out.String() != wantOut {
+		t.Errorf("unexpected summary:\n%s\nwant:\n%s", out.String(), wantOut)
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	b := &pollBackoff{min: 500 * time.Millisecond, max: 5 * time.Second}
+	want := []time.Duration{
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for i, w := range want {
+		if got := b.Next(); got != w {
+			t.Errorf("poll %d: expected %s, got %s", i, w, got)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); got != 500*time.Millisecond {
+		t.Errorf("expected a reset to start over at 500ms, got %s", got)
+	}
+}
+
+func TestServiceProgressOutcome(t *testing.T) {
+	replicas := uint64(1)
+	spec := swarm.ServiceSpec{
+		Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+		UpdateConfig: &swarm.UpdateConfig{Monitor: 10 * time.Millisecond},
+	}
+	fc := &fakeClient{
+		services: map[string]swarm.Service{
+			"stack_api":      {ID: "api-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStateCompleted}},
+			"stack_web":      {ID: "web-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStateUpdating}},
+			"stack_db":       {ID: "db-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStatePaused, Message: "update paused due to failure or early termination of task x"}},
+			"stack_worker":   {ID: "worker-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStateRollbackCompleted, Message: "rollback completed"}},
+			"stack_rollback": {ID: "rollback-id", Spec: spec, UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStateRollbackPaused, Message: "task failed"}},
+		},
+		tasks: []swarm.Task{{
+			Slot:         1,
+			NodeID:       "node-1",
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateStarting},
+		}},
+		nodes: []swarm.Node{{ID: "node-1", Status: swarm.NodeStatus{State: swarm.NodeStateReady}}},
+	}
+	progressOut := streamformatter.NewJSONProgressOutput(io.Discard, false)
+	wait := func(id string, timeout time.Duration) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return serviceProgress(ctx, fc, id, id, progressOut, false, nil)
+	}
+
+	if outcome, err := wait("api-id", time.Second); err != nil || outcome != OutcomeConverged {
+		t.Errorf("expected a completed update to converge, got %s %v", outcome, err)
+	}
+	if outcome, err := wait("web-id", 50*time.Millisecond); err != nil || outcome != OutcomeTimedOut {
+		t.Errorf("expected an update with a starting task to keep waiting, got %s %v", outcome, err)
+	}
+
+	taskLists := fc.taskLists
+	for id, want := range map[string]string{
+		"db-id":       "update paused: update paused due to failure",
+		"worker-id":   "update rolled back: rollback completed",
+		"rollback-id": "rollback paused: task failed",
+	} {
+		outcome, err := wait(id, time.Second)
+		if outcome != OutcomeFailed || !errors.Is(err, ErrNotConverged) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q error, got %s %v", id, want, outcome, err)
+		}
+	}
+	if fc.taskLists != taskLists {
+		t.Errorf("expected stuck updates to fail without listing tasks, got %d task lists", fc.taskLists-taskLists)
+	}
+
+	// a running task converges once the monitor window has passed
+	fc.tasks[0].Status.State = swarm.TaskStateRunning
+	if outcome, err := wait("web-id", time.Second); err != nil || outcome != OutcomeConverged {
+		t.Errorf("expected the running task to converge the update, got %s %v", outcome, err)
+	}
+}
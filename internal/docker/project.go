@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// composeLoader parses compose files, tests count its calls
+var composeLoader = loadCompose
+
+// Project is the compose project of one command. The files are parsed on
+// first use and every stage shares the result, and the local configs and
+// sensitive secrets are processed only once for all of them.
+type Project struct {
+	env   []string
+	paths []string
+	name  string
+
+	loaded    *types.Project
+	declared  *types.Project
+	processed *types.Project
+}
+
+// NewProject returns a project of the compose files at paths, interpolated
+// with env like LoadCompose. Nothing is read until Load.
+func NewProject(env []string, paths ...string) *Project {
+	return &Project{env: env, paths: paths}
+}
+
+// SetName overrides the project name compose-go would take from the name
+// attribute, COMPOSE_PROJECT_NAME or the directory. It must be called before
+// Load.
+func (p *Project) SetName(name string) {
+	p.name = name
+}
+
+// LoadedProject wraps a project that is already loaded
+func LoadedProject(project types.Project) *Project {
+	return &Project{loaded: &project}
+}
+
+// Load parses the compose files once. Changes made through the returned
+// project, such as selected profiles, are seen by the later stages.
+func (p *Project) Load(ctx context.Context) (*types.Project, error) {
+	if p.loaded == nil {
+		project, err := composeLoader(ctx, p.env, p.name, true, p.paths)
+		if err != nil {
+			return nil, err
+		}
+		p.loaded = &project
+	}
+	return p.loaded, nil
+}
+
+// Declared parses the compose files once more with relative paths kept as
+// written, so callers can tell how a path was declared
+func (p *Project) Declared(ctx context.Context) (types.Project, error) {
+	if p.declared == nil {
+		project, err := composeLoader(ctx, p.env, p.name, false, p.paths)
+		if err != nil {
+			return types.Project{}, err
+		}
+		p.declared = &project
+	}
+	return *p.declared, nil
+}
+
+// Processed returns the loaded project with local configs and sensitive
+// secrets turned into compose configs and secrets. It is computed on the
+// first call, so the project must not change after that.
+func (p *Project) Processed(secrets vault.Secrets) (types.Project, error) {
+	if p.processed == nil {
+		if p.loaded == nil {
+			return types.Project{}, errors.New("project is not loaded")
+		}
+		project, err := processProject(*p.loaded, secrets)
+		if err != nil {
+			return types.Project{}, err
+		}
+		p.processed = &project
+	}
+	return *p.processed, nil
+}
+
+// processProject writes the generated secrets and configs into copies of
+// the project maps, the caller's project stays untouched
+func processProject(project types.Project, secrets vault.Secrets) (types.Project, error) {
+	project.Services = maps.Clone(project.Services)
+	project.Secrets = maps.Clone(project.Secrets)
+	project.Configs = maps.Clone(project.Configs)
+
+	if err := processLocalConfigs(&project); err != nil {
+		return types.Project{}, fmt.Errorf("failed to process local configs: %w", err)
+	}
+	if err := processSensitiveSecrets(&project, secrets); err != nil {
+		return types.Project{}, fmt.Errorf("failed to process sensitive secrets: %w", err)
+	}
+	return project, nil
+}
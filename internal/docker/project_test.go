@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestProjectLoadsOncePerDeploy(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "compose.yaml")
+	err := os.WriteFile(composeFile, []byte(`
+services:
+  nginx:
+    image: nginx
+    local_configs:
+      nginx-conf:
+        source: ./nginx.conf
+        target: /etc/nginx/nginx.conf
+`), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	confFile := filepath.Join(dir, "nginx.conf")
+	if err := os.WriteFile(confFile, []byte("events {}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write nginx.conf: %v", err)
+	}
+
+	loads := 0
+	orig := composeLoader
+	composeLoader = func(ctx context.Context, env []string, name string, resolvePaths bool, paths []string) (types.Project, error) {
+		loads++
+		return orig(ctx, env, name, resolvePaths, paths)
+	}
+	t.Cleanup(func() { composeLoader = orig })
+
+	compose := NewProject(nil, composeFile)
+	project, err := compose.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, err := compose.Load(context.Background()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := Build(context.Background(), &fakeClient{}, *project, BuildOptions{Out: io.Discard}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if _, err := Deploy(context.Background(), &fakeClient{}, compose, DeployOptions{
+		Stack:        "stack",
+		ResolveImage: ResolveImageNever,
+		Quiet:        true,
+		Detach:       true,
+		Out:          io.Discard,
+	}); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("expected the compose files to be loaded once, got %d loads", loads)
+	}
+
+	// the processed project is kept, the config source isn't read again
+	if err := os.Remove(confFile); err != nil {
+		t.Fatalf("failed to remove nginx.conf: %v", err)
+	}
+	processed, err := compose.Processed(nil)
+	if err != nil {
+		t.Fatalf("Processed failed: %v", err)
+	}
+	if len(processed.Configs) != 1 {
+		t.Errorf("expected the generated config, got %v", processed.Configs)
+	}
+	if len(project.Configs) != 0 {
+		t.Errorf("expected the loaded project to stay unprocessed, got %v", project.Configs)
+	}
+}
+
+func TestProjectSetName(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "checkout")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("failed to create %s: %v", dir, err)
+	}
+	composeFile := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    build: .\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	compose := NewProject(nil, composeFile)
+	compose.SetName("shop")
+	project, err := compose.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if project.Name != "shop" {
+		t.Errorf("expected the overridden project name, got %q", project.Name)
+	}
+
+	// a service without an image is built as <project>_<service>
+	fc := &fakeClient{}
+	if err := Build(context.Background(), fc, *project, BuildOptions{Out: io.Discard}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if len(fc.imageBuilds) != 1 || fc.imageBuilds[0].Tags[0] != "shop_web" {
+		t.Errorf("expected shop_web to be built, got %v", fc.imageBuilds)
+	}
+
+	compose = NewProject(nil, composeFile)
+	compose.SetName("Shop!")
+	if _, err := compose.Load(context.Background()); err == nil {
+		t.Error("expected an invalid project name to fail the load")
+	}
+}
@@ -5,14 +5,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/distribution/reference"
 	"github.com/moby/moby/client"
 	"github.com/moby/moby/client/pkg/jsonmessage"
-	"golang.org/x/sync/errgroup"
 )
 
 const RegistrylessPrefix = "registryless/"
@@ -69,9 +72,43 @@ func PinServices(ctx context.Context, dockerClient client.APIClient, project *ty
 	return nil
 }
 
+// serverClient connects to a server, tests replace it
+var serverClient = NewServerClient
+
+// transferRetryDelay is the pause before a failed transfer is retried
+var transferRetryDelay = 2 * time.Second
+
+// ServerError reports a transfer that failed on some servers. The
+// Succeeded ones already hold the image.
+type ServerError struct {
+	Failed    map[string]error
+	Succeeded []string
+}
+
+func (e *ServerError) Error() string {
+	failed := make([]string, 0, len(e.Failed))
+	for _, host := range slices.Sorted(maps.Keys(e.Failed)) {
+		failed = append(failed, fmt.Sprintf("%s: %v", host, e.Failed[host]))
+	}
+	msg := fmt.Sprintf("failed on %d of %d servers: %s", len(e.Failed), len(e.Failed)+len(e.Succeeded), strings.Join(failed, "; "))
+	if len(e.Succeeded) > 0 {
+		msg += fmt.Sprintf(" (succeeded on %s)", strings.Join(e.Succeeded, ", "))
+	}
+	return msg
+}
+
+func (e *ServerError) Unwrap() []error {
+	return slices.Collect(maps.Values(e.Failed))
+}
+
+// PushRegistryless loads image into the daemon of every server in
+// opt.Servers. A failed server is retried opt.Retries times and doesn't stop
+// the others unless opt.FailFast is set; the servers that still failed are
+// returned as a *ServerError.
+//
 // id seeds the pinned tag name; the build reports it (config digest — the one
 // store-independent identity, same value for every daemon holding the artifact)
-func PushRegistryless(ctx context.Context, dockerClient client.APIClient, image, id string, servers map[string]vault.Server, out io.Writer) error {
+func PushRegistryless(ctx context.Context, dockerClient client.APIClient, image, id string, opt BuildOptions) error {
 	if id == "" {
 		return fmt.Errorf("build did not report an image id for %s", image)
 	}
@@ -81,61 +118,119 @@ func PushRegistryless(ctx context.Context, dockerClient client.APIClient, image,
 		return err
 	}
 
-	eg, ctx := errgroup.WithContext(ctx)
-	for host, server := range servers {
-		eg.Go(func() error {
-			node, err := NewClientSSH(host, server.Port, server.User, server.Key)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = ServerError{Failed: map[string]error{}}
+	)
+	// the servers are loaded concurrently, report serializes their output
+	report := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(opt.Out, format, args...)
+	}
+	for _, host := range slices.Sorted(maps.Keys(opt.Servers)) {
+		wg.Go(func() {
+			err := retryTransfer(ctx, host, opt.Retries, report, func() error {
+				return loadOnServer(ctx, dockerClient, host, opt.Servers[host], image, pinned, report)
+			})
 			if err != nil {
-				return fmt.Errorf("%s: %w", host, err)
+				report("%s: failed: %v\n", host, err)
 			}
-			defer node.Close()
-
-			// pinned tag is content-addressed: tag exists = content exists.
-			// still move the user tag, like a registry push that skips
-			// every layer but writes the manifest
-			if _, err := node.ImageInspect(ctx, pinned); err == nil {
-				if _, err := node.ImageTag(ctx, client.ImageTagOptions{Source: pinned, Target: image}); err != nil {
-					return fmt.Errorf("%s: %w", host, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed[host] = err
+				if opt.FailFast {
+					cancel()
 				}
-				fmt.Fprintf(out, "%s: image already exists\n", host)
-				return nil
+				return
 			}
+			result.Succeeded = append(result.Succeeded, host)
+		})
+	}
+	wg.Wait()
 
-			pr, pw := io.Pipe()
-			go func() {
-				img, err := dockerClient.ImageSave(ctx, []string{image})
-				if err != nil {
-					pw.CloseWithError(err)
-					return
-				}
-				defer img.Close()
+	if len(result.Failed) == 0 {
+		return nil
+	}
+	slices.Sort(result.Succeeded)
+	return &result
+}
 
-				gz := gzip.NewWriter(pw)
-				if _, err := io.Copy(gz, img); err != nil {
-					pw.CloseWithError(err)
-					return
-				}
-				pw.CloseWithError(gz.Close())
-			}()
+// retryTransfer runs transfer until it succeeds, the retries are used up or
+// ctx is done
+func retryTransfer(ctx context.Context, host string, retries int, report func(string, ...any), transfer func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := transfer()
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		report("%s: %v, retrying\n", host, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(transferRetryDelay):
+		}
+	}
+}
 
-			res, err := node.ImageLoad(ctx, pr)
-			if err != nil {
-				pr.CloseWithError(err)
-				return fmt.Errorf("%s: %w", host, err)
-			}
-			defer res.Close()
+// loadOnServer streams image from dockerClient into the daemon of one
+// server and tags it pinned there
+func loadOnServer(ctx context.Context, dockerClient client.APIClient, host string, server vault.Server, image, pinned string, report func(string, ...any)) error {
+	node, err := serverClient(host, server)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
 
-			if err := jsonmessage.DisplayJSONMessagesStream(res, io.Discard, 0, false, nil); err != nil {
-				return fmt.Errorf("%s: %w", host, err)
-			}
+	// pinned tag is content-addressed: tag exists = content exists.
+	// still move the user tag, like a registry push that skips
+	// every layer but writes the manifest
+	if _, err := node.ImageInspect(ctx, pinned); err == nil {
+		if _, err := node.ImageTag(ctx, client.ImageTagOptions{Source: pinned, Target: image}); err != nil {
+			return err
+		}
+		report("%s: image already exists\n", host)
+		return nil
+	}
 
-			if _, err := node.ImageTag(ctx, client.ImageTagOptions{Source: image, Target: pinned}); err != nil {
-				return fmt.Errorf("%s: %w", host, err)
-			}
+	pr, pw := io.Pipe()
+	go func() {
+		img, err := dockerClient.ImageSave(ctx, []string{image})
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		defer img.Close()
 
-			fmt.Fprintf(out, "%s: image loaded\n", host)
-			return nil
-		})
+		gz := gzip.NewWriter(pw)
+		if _, err := io.Copy(gz, img); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(gz.Close())
+	}()
+
+	res, err := node.ImageLoad(ctx, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	defer res.Close()
+
+	if err := jsonmessage.DisplayJSONMessagesStream(res, io.Discard, 0, false, nil); err != nil {
+		return err
+	}
+
+	if _, err := node.ImageTag(ctx, client.ImageTagOptions{Source: image, Target: pinned}); err != nil {
+		return err
 	}
-	return eg.Wait()
+
+	report("%s: image loaded\n", host)
+	return nil
 }
@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/moby/moby/client"
+)
+
+// fakeServers makes serverClient hand out the given nodes and fail to
+// connect to any other host, counting the connection attempts per host
+func fakeServers(t *testing.T, nodes map[string]*fakeClient) map[string]int {
+	t.Helper()
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	origClient, origDelay := serverClient, transferRetryDelay
+	serverClient = func(host string, _ vault.Server) (client.APIClient, error) {
+		mu.Lock()
+		attempts[host]++
+		mu.Unlock()
+		if node, ok := nodes[host]; ok {
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w to %s: connection refused", ErrConnect, host)
+	}
+	transferRetryDelay = 0
+	t.Cleanup(func() { serverClient, transferRetryDelay = origClient, origDelay })
+	return attempts
+}
+
+func TestPushRegistrylessPartialFailure(t *testing.T) {
+	const image = "registryless/web:latest"
+	const id = "sha256:0123456789abcdef0123456789abcdef"
+	pinned, err := pinRef(image, id)
+	if err != nil {
+		t.Fatalf("pinRef failed: %v", err)
+	}
+
+	nodes := map[string]*fakeClient{
+		"203.0.113.1": {images: map[string]bool{pinned: true}},
+		"203.0.113.3": {images: map[string]bool{pinned: true}},
+	}
+	attempts := fakeServers(t, nodes)
+
+	var out bytes.Buffer
+	err = PushRegistryless(t.Context(), &fakeClient{}, image, id, BuildOptions{
+		Servers: map[string]vault.Server{"203.0.113.1": {}, "203.0.113.2": {}, "203.0.113.3": {}},
+		Retries: 1,
+		Out:     &out,
+	})
+
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("expected a ServerError, got %v", err)
+	}
+	if _, ok := serverErr.Failed["203.0.113.2"]; !ok || len(serverErr.Failed) != 1 {
+		t.Errorf("expected only 203.0.113.2 to fail, got %v", serverErr.Failed)
+	}
+	if !slices.Equal(serverErr.Succeeded, []string{"203.0.113.1", "203.0.113.3"}) {
+		t.Errorf("expected the other servers to succeed, got %v", serverErr.Succeeded)
+	}
+	if !errors.Is(err, ErrConnect) {
+		t.Errorf("expected the connection error to be wrapped, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed on 1 of 3 servers") {
+		t.Errorf("expected a summary in the error, got %v", err)
+	}
+	if attempts["203.0.113.2"] != 2 {
+		t.Errorf("expected the failed server to be retried once, got %d attempts", attempts["203.0.113.2"])
+	}
+	for host, node := range nodes {
+		if !slices.Equal(node.imageTags, []string{image}) {
+			t.Errorf("%s: expected the image to be tagged, got %v", host, node.imageTags)
+		}
+	}
+	if !strings.Contains(out.String(), "203.0.113.2: failed:") {
+		t.Errorf("expected the failure to be reported, got %q", out.String())
+	}
+}
+
+func TestGetManagerClientSkipsUnreachable(t *testing.T) {
+	fakeServers(t, map[string]*fakeClient{"203.0.113.2": {}})
+
+	_, host, err := GetManagerClient(t.Context(), map[string]vault.Server{"203.0.113.1": {}, "203.0.113.2": {}})
+	if err != nil || host != "203.0.113.2" {
+		t.Errorf("expected the reachable manager, got %q %v", host, err)
+	}
+
+	_, _, err = GetManagerClient(t.Context(), map[string]vault.Server{"203.0.113.1": {}})
+	if !errors.Is(err, ErrManagerNotFound) || !errors.Is(err, ErrConnect) {
+		t.Errorf("expected no manager with the connection error, got %v", err)
+	}
+}
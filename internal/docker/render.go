@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "<redacted>"
+
+type RenderOptions struct {
+	Secrets     vault.Secrets
+	Stack       string
+	ShowSecrets bool
+	JSON        bool
+	Scale       map[string]uint64
+}
+
+// secret and config payloads render as text instead of base64
+type renderedSecret struct {
+	swarm.SecretSpec
+	Data string `json:"Data,omitempty"`
+}
+
+type renderedConfig struct {
+	swarm.ConfigSpec
+	Data string `json:"Data,omitempty"`
+}
+
+type renderedStack struct {
+	Services map[string]swarm.ServiceSpec           `json:"services"`
+	Networks map[string]client.NetworkCreateOptions `json:"networks,omitempty"`
+	Secrets  []renderedSecret                       `json:"secrets,omitempty"`
+	Configs  []renderedConfig                       `json:"configs,omitempty"`
+}
+
+// noLookupClient answers the secret and config lookups of the conversion
+// with empty objects, anything else would need a daemon
+type noLookupClient struct {
+	client.APIClient
+}
+
+func (noLookupClient) SecretInspect(context.Context, string, client.SecretInspectOptions) (client.SecretInspectResult, error) {
+	return client.SecretInspectResult{}, nil
+}
+
+func (noLookupClient) ConfigInspect(context.Context, string, client.ConfigInspectOptions) (client.ConfigInspectResult, error) {
+	return client.ConfigInspectResult{}, nil
+}
+
+// stackSpecs is everything the deploy conversion pipeline produces
+type stackSpecs struct {
+	services map[string]swarm.ServiceSpec
+	networks map[string]client.NetworkCreateOptions
+	secrets  []swarm.SecretSpec
+	configs  []swarm.ConfigSpec
+}
+
+// convertStack runs the deploy conversion pipeline without a daemon. Object
+// IDs stay empty since nothing is looked up.
+func convertStack(ctx context.Context, project types.Project, stack string, allSecrets vault.Secrets, scale map[string]uint64) (stackSpecs, error) {
+	project, err := processProject(project, allSecrets)
+	if err != nil {
+		return stackSpecs{}, err
+	}
+
+	networks, _, err := ConvertNetworks(stack, project.Networks, GetServicesDeclaredNetworks(project.Services))
+	if err != nil {
+		return stackSpecs{}, err
+	}
+	secrets, err := ConvertSecrets(stack, project.Secrets, project.Environment)
+	if err != nil {
+		return stackSpecs{}, err
+	}
+	configs, err := ConvertConfigs(stack, project.Configs, project.Environment)
+	if err != nil {
+		return stackSpecs{}, err
+	}
+	if err := checkObjectSizes(secrets, configs, true, io.Discard); err != nil {
+		return stackSpecs{}, err
+	}
+	services, err := ConvertServices(ctx, noLookupClient{}, stack, project)
+	if err != nil {
+		return stackSpecs{}, err
+	}
+	if err := applyScale(services, scale); err != nil {
+		return stackSpecs{}, err
+	}
+
+	return stackSpecs{services: services, networks: networks, secrets: secrets, configs: configs}, nil
+}
+
+// Render runs the deploy conversion pipeline without a daemon and marshals
+// the resulting swarm specs.
+func Render(ctx context.Context, project types.Project, opts RenderOptions) ([]byte, error) {
+	specs, err := convertStack(ctx, project, opts.Stack, opts.Secrets, opts.Scale)
+	if err != nil {
+		return nil, err
+	}
+
+	stack := renderedStack{
+		Services: specs.services,
+		Networks: specs.networks,
+	}
+	for _, spec := range specs.secrets {
+		data := string(spec.Data)
+		if !opts.ShowSecrets && data != "" {
+			data = redacted
+		}
+		spec.Data = nil
+		stack.Secrets = append(stack.Secrets, renderedSecret{SecretSpec: spec, Data: data})
+	}
+	for _, spec := range specs.configs {
+		data := string(spec.Data)
+		spec.Data = nil
+		stack.Configs = append(stack.Configs, renderedConfig{ConfigSpec: spec, Data: data})
+	}
+
+	data, err := json.MarshalIndent(stack, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stack: %w", err)
+	}
+	if opts.JSON {
+		return data, nil
+	}
+
+	return jsonToYAML(data)
+}
+
+// jsonToYAML re-encodes JSON so YAML keys match the Docker API field names
+func jsonToYAML(data []byte) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestRender(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:    "web",
+				Image:   "nginx",
+				Secrets: []types.ServiceSecretConfig{{Source: "api_key"}},
+			},
+		},
+		Secrets: types.Secrets{
+			"api_key": types.SecretConfig{Content: "plaintext-value"},
+		},
+	}
+
+	out, err := Render(context.Background(), project, RenderOptions{Stack: "stack"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	rendered := string(out)
+	for _, want := range []string{"stack_web", "stack_api_key", redacted} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("expected rendered stack to contain %q, got:\n%s", want, rendered)
+		}
+	}
+	if strings.Contains(rendered, "plaintext-value") {
+		t.Errorf("expected secret data to be redacted, got:\n%s", rendered)
+	}
+
+	out, err = Render(context.Background(), project, RenderOptions{Stack: "stack", ShowSecrets: true, JSON: true})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(string(out), `"Data": "plaintext-value"`) {
+		t.Errorf("expected secret data with --show-secrets, got:\n%s", out)
+	}
+}
@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// checkReservations makes sure every service reservation fits on at least
+// one available node, CPU and memory together. Swarm accepts a reservation no
+// node can satisfy and leaves the tasks pending, so the deploy would never
+// converge. Offenders are reported as warnings, or as an error when strict is
+// set.
+func checkReservations(ctx context.Context, apiClient client.APIClient, services map[string]swarm.ServiceSpec, strict, quiet bool, out io.Writer) error {
+	res, err := apiClient.NodeList(ctx, client.NodeListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var nodes []swarm.Resources
+	for _, node := range res.Items {
+		if node.Status.State == swarm.NodeStateDown {
+			continue
+		}
+		nodes = append(nodes, node.Description.Resources)
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []error
+	for _, name := range names {
+		resources := services[name].TaskTemplate.Resources
+		if resources == nil || resources.Reservations == nil {
+			continue
+		}
+		reserved := resources.Reservations
+
+		fits := false
+		for _, node := range nodes {
+			if reserved.NanoCPUs <= node.NanoCPUs && reserved.MemoryBytes <= node.MemoryBytes {
+				fits = true
+				break
+			}
+		}
+		if !fits {
+			problems = append(problems, fmt.Errorf("service %s reserves %s CPUs and %s of memory but no available node has both",
+				name, formatCPUs(reserved.NanoCPUs), formatMemory(reserved.MemoryBytes)))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if strict {
+		return errors.Join(problems...)
+	}
+	if !quiet {
+		for _, p := range problems {
+			fmt.Fprintf(out, "%s %v\n", WarningPrefix(), p)
+		}
+	}
+	return nil
+}
+
+func formatCPUs(nano int64) string {
+	return fmt.Sprintf("%.2f", float64(nano)/1e9)
+}
+
+func formatMemory(bytes int64) string {
+	return fmt.Sprintf("%.1fMiB", float64(bytes)/(1<<20))
+}
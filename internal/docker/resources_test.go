@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestCheckReservations(t *testing.T) {
+	fc := &fakeClient{nodes: []swarm.Node{
+		{
+			ID:          "small",
+			Description: swarm.NodeDescription{Resources: swarm.Resources{NanoCPUs: 2e9, MemoryBytes: 2 << 30}},
+			Status:      swarm.NodeStatus{State: swarm.NodeStateReady},
+		},
+		{
+			ID:          "fat",
+			Description: swarm.NodeDescription{Resources: swarm.Resources{NanoCPUs: 1e9, MemoryBytes: 16 << 30}},
+			Status:      swarm.NodeStatus{State: swarm.NodeStateReady},
+		},
+		{
+			ID:          "gone",
+			Description: swarm.NodeDescription{Resources: swarm.Resources{NanoCPUs: 64e9, MemoryBytes: 64 << 30}},
+			Status:      swarm.NodeStatus{State: swarm.NodeStateDown},
+		},
+	}}
+
+	services := map[string]swarm.ServiceSpec{
+		"web": {TaskTemplate: swarm.TaskSpec{Resources: &swarm.ResourceRequirements{
+			Reservations: &swarm.Resources{NanoCPUs: 1e9, MemoryBytes: 512 << 20},
+		}}},
+		"cache": {TaskTemplate: swarm.TaskSpec{Resources: &swarm.ResourceRequirements{
+			Reservations: &swarm.Resources{MemoryBytes: 10 << 30},
+		}}},
+		// each resource fits some node, but no node has both
+		"db": {TaskTemplate: swarm.TaskSpec{Resources: &swarm.ResourceRequirements{
+			Reservations: &swarm.Resources{NanoCPUs: 2e9, MemoryBytes: 4 << 30},
+		}}},
+	}
+
+	var out bytes.Buffer
+	if err := checkReservations(context.Background(), fc, services, false, false, &out); err != nil {
+		t.Fatalf("checkReservations failed: %v", err)
+	}
+	warning := out.String()
+	if !strings.Contains(warning, "Warning: service db reserves 2.00 CPUs and 4096.0MiB") {
+		t.Errorf("expected warning naming db and its reservation, got: %q", warning)
+	}
+	if strings.Contains(warning, "service web") || strings.Contains(warning, "service cache") {
+		t.Errorf("expected no warning for services that fit a node, got: %q", warning)
+	}
+
+	out.Reset()
+	if err := checkReservations(context.Background(), fc, services, false, true, &out); err != nil {
+		t.Fatalf("checkReservations failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no warnings when quiet, got: %q", out.String())
+	}
+
+	out.Reset()
+	err := checkReservations(context.Background(), fc, services, true, false, &out)
+	if err == nil || !strings.Contains(err.Error(), "service db reserves") {
+		t.Fatalf("expected strict error for db, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no warnings in strict mode, got: %q", out.String())
+	}
+}
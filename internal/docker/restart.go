@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// Restart bumps ForceUpdate on the stack's services, or only on the named
+// compose services, so swarm rolls their tasks with the spec unchanged. The
+// rollout follows each service's own UpdateConfig. Returns the restarted
+// service IDs mapped to their scoped names.
+func Restart(ctx context.Context, apiClient client.APIClient, stack string, services []string) (map[string]string, error) {
+	res, err := apiClient.ServiceList(ctx, client.ServiceListOptions{Filters: getStackFilter(stack)})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Items) == 0 {
+		return nil, fmt.Errorf("no services found in stack %s", stack)
+	}
+
+	existing := make(map[string]swarm.Service, len(res.Items))
+	for _, svc := range res.Items {
+		existing[svc.Spec.Name] = svc
+	}
+
+	targets := res.Items
+	if len(services) > 0 {
+		// check every name before touching anything
+		targets = make([]swarm.Service, 0, len(services))
+		for _, service := range services {
+			name := ScopeName(stack, service)
+			svc, ok := existing[name]
+			if !ok {
+				return nil, fmt.Errorf("service %s not found in stack %s", service, stack)
+			}
+			targets = append(targets, svc)
+		}
+	}
+
+	serviceNames := make(map[string]string, len(targets))
+	for _, svc := range targets {
+		spec := svc.Spec
+		spec.TaskTemplate.ForceUpdate++
+
+		if _, err := apiClient.ServiceUpdate(ctx, svc.ID, client.ServiceUpdateOptions{
+			Version: svc.Version,
+			Spec:    spec,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to update service %s: %w", svc.Spec.Name, err)
+		}
+
+		serviceNames[svc.ID] = svc.Spec.Name
+	}
+
+	return serviceNames, nil
+}
@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestRestart(t *testing.T) {
+	fc := &fakeClient{services: map[string]swarm.Service{
+		"stack_web": {
+			ID:   "web-id",
+			Meta: swarm.Meta{Version: swarm.Version{Index: 4}},
+			Spec: swarm.ServiceSpec{
+				Annotations:  swarm.Annotations{Name: "stack_web"},
+				TaskTemplate: swarm.TaskSpec{ForceUpdate: 2},
+				UpdateConfig: &swarm.UpdateConfig{Order: swarm.UpdateOrderStartFirst, Delay: time.Second},
+			},
+		},
+		"stack_db": {
+			ID:   "db-id",
+			Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "stack_db"}},
+		},
+	}}
+
+	services, err := Restart(context.Background(), fc, "stack", []string{"web"})
+	if err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	if len(services) != 1 || services["web-id"] != "stack_web" {
+		t.Errorf("expected only stack_web to restart, got %v", services)
+	}
+	if len(fc.serviceUpdates) != 1 {
+		t.Fatalf("expected 1 service update, got %d", len(fc.serviceUpdates))
+	}
+
+	update := fc.serviceUpdates[0]
+	if update.Spec.TaskTemplate.ForceUpdate != 3 {
+		t.Errorf("expected ForceUpdate 3, got %d", update.Spec.TaskTemplate.ForceUpdate)
+	}
+	if update.Version.Index != 4 {
+		t.Errorf("expected update at version 4, got %d", update.Version.Index)
+	}
+	if update.Spec.UpdateConfig == nil || update.Spec.UpdateConfig.Order != swarm.UpdateOrderStartFirst {
+		t.Errorf("expected update config to be kept, got %+v", update.Spec.UpdateConfig)
+	}
+
+	fc.serviceUpdates = nil
+	if _, err := Restart(context.Background(), fc, "stack", []string{"web", "missing"}); err == nil {
+		t.Fatal("expected error for unknown service, got nil")
+	}
+	if len(fc.serviceUpdates) != 0 {
+		t.Errorf("expected no updates when a service is unknown, got %d", len(fc.serviceUpdates))
+	}
+
+	services, err = Restart(context.Background(), fc, "stack", nil)
+	if err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	if len(services) != 2 {
+		t.Errorf("expected whole stack to restart, got %v", services)
+	}
+}
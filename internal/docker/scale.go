@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// Scale sets the replica count of stack services, keyed by compose service
+// name, and returns the updated service IDs mapped to their scoped names.
+func Scale(ctx context.Context, apiClient client.APIClient, stack string, replicas map[string]uint64) (map[string]string, error) {
+	// inspect and check every service before touching anything
+	order := slices.Sorted(maps.Keys(replicas))
+	targets := make([]swarm.Service, 0, len(order))
+	for _, service := range order {
+		name := ScopeName(stack, service)
+
+		res, err := apiClient.ServiceInspect(ctx, name, client.ServiceInspectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect service %s: %w", name, err)
+		}
+		if mode := serviceModeName(res.Service.Spec.Mode); mode != "replicated" {
+			return nil, fmt.Errorf("service %s runs in %s mode, only replicated services can be scaled", name, mode)
+		}
+		targets = append(targets, res.Service)
+	}
+
+	serviceNames := make(map[string]string, len(targets))
+	for i, svc := range targets {
+		name := ScopeName(stack, order[i])
+		count := replicas[order[i]]
+
+		// the mode is a pointer into the inspected spec, replace rather than mutate
+		spec := svc.Spec
+		spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &count}
+
+		if _, err := apiClient.ServiceUpdate(ctx, svc.ID, client.ServiceUpdateOptions{
+			Version: svc.Version,
+			Spec:    spec,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to update service %s: %w", name, err)
+		}
+
+		serviceNames[svc.ID] = name
+	}
+
+	return serviceNames, nil
+}
+
+// applyScale overrides the replica counts of converted services, keyed by
+// compose service name
+func applyScale(services map[string]swarm.ServiceSpec, replicas map[string]uint64) error {
+	for service, count := range replicas {
+		spec, ok := services[service]
+		if !ok {
+			return fmt.Errorf("cannot scale %s: no such service", service)
+		}
+		if mode := serviceModeName(spec.Mode); mode != "replicated" {
+			return fmt.Errorf("cannot scale %s: service runs in %s mode, only replicated services can be scaled", service, mode)
+		}
+		spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &count}
+		services[service] = spec
+	}
+	return nil
+}
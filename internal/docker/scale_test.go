@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/moby/api/types/swarm"
+)
+
+func TestScale(t *testing.T) {
+	one := uint64(1)
+	fc := &fakeClient{services: map[string]swarm.Service{
+		"stack_web": {
+			ID:   "web-id",
+			Meta: swarm.Meta{Version: swarm.Version{Index: 7}},
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{Name: "stack_web"},
+				Mode:        swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &one}},
+			},
+		},
+		"stack_agent": {
+			ID: "agent-id",
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{Name: "stack_agent"},
+				Mode:        swarm.ServiceMode{Global: &swarm.GlobalService{}},
+			},
+		},
+	}}
+
+	services, err := Scale(context.Background(), fc, "stack", map[string]uint64{"web": 3})
+	if err != nil {
+		t.Fatalf("Scale failed: %v", err)
+	}
+	if services["web-id"] != "stack_web" {
+		t.Errorf("expected web-id to map to stack_web, got %v", services)
+	}
+	if len(fc.serviceUpdates) != 1 {
+		t.Fatalf("expected 1 service update, got %d", len(fc.serviceUpdates))
+	}
+	update := fc.serviceUpdates[0]
+	if update.Version.Index != 7 {
+		t.Errorf("expected update at version 7, got %d", update.Version.Index)
+	}
+	if got := update.Spec.Mode.Replicated.Replicas; got == nil || *got != 3 {
+		t.Errorf("expected 3 replicas, got %v", got)
+	}
+	if *fc.services["stack_web"].Spec.Mode.Replicated.Replicas != 1 {
+		t.Error("expected inspected spec to stay untouched")
+	}
+
+	fc.serviceUpdates = nil
+	_, err = Scale(context.Background(), fc, "stack", map[string]uint64{"agent": 2})
+	if err == nil || !strings.Contains(err.Error(), "global mode") {
+		t.Fatalf("expected global mode error, got %v", err)
+	}
+	if len(fc.serviceUpdates) != 0 {
+		t.Errorf("expected no update for global service, got %d", len(fc.serviceUpdates))
+	}
+	// a bad target in the batch leaves the valid ones untouched too
+	_, err = Scale(context.Background(), fc, "stack", map[string]uint64{"web": 3, "agent": 2})
+	if err == nil {
+		t.Fatal("expected global mode error, got nil")
+	}
+	if len(fc.serviceUpdates) != 0 {
+		t.Errorf("expected no update when any target is invalid, got %d", len(fc.serviceUpdates))
+	}
+}
+
+func TestApplyScale(t *testing.T) {
+	one := uint64(1)
+	services := map[string]swarm.ServiceSpec{
+		"web":   {Mode: swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &one}}},
+		"agent": {Mode: swarm.ServiceMode{Global: &swarm.GlobalService{}}},
+	}
+
+	if err := applyScale(services, map[string]uint64{"web": 3}); err != nil {
+		t.Fatalf("applyScale failed: %v", err)
+	}
+	if got := services["web"].Mode.Replicated.Replicas; got == nil || *got != 3 {
+		t.Errorf("expected 3 replicas, got %v", got)
+	}
+
+	if err := applyScale(services, map[string]uint64{"agent": 2}); err == nil || !strings.Contains(err.Error(), "global mode") {
+		t.Errorf("expected global mode error, got %v", err)
+	}
+	if err := applyScale(services, map[string]uint64{"missing": 2}); err == nil {
+		t.Error("expected error for unknown service, got nil")
+	}
+}
@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/blindlobstar/cicdez/internal/vault"
 	"github.com/moby/moby/client"
@@ -10,17 +11,23 @@ import (
 
 var ErrManagerNotFound = errors.New("manager not found")
 
+// GetManagerClient returns a client for the first reachable manager among
+// servers. An unreachable server is skipped; when no manager is found the
+// connection errors are joined to ErrManagerNotFound.
 func GetManagerClient(ctx context.Context, servers map[string]vault.Server) (client.APIClient, string, error) {
+	var errs []error
 	for host, server := range servers {
-		manager, err := NewClientSSH(host, server.Port, server.User, server.Key)
+		manager, err := serverClient(host, server)
 		if err != nil {
-			return nil, "", err
+			errs = append(errs, err)
+			continue
 		}
 
 		info, err := manager.Info(ctx, client.InfoOptions{})
 		if err != nil {
 			manager.Close()
-			return nil, "", err
+			errs = append(errs, fmt.Errorf("%w to %s: %w", ErrConnect, host, err))
+			continue
 		}
 		if !info.Info.Swarm.ControlAvailable {
 			manager.Close()
@@ -28,5 +35,8 @@ func GetManagerClient(ctx context.Context, servers map[string]vault.Server) (cli
 		}
 		return manager, host, nil
 	}
+	if len(errs) > 0 {
+		return nil, "", fmt.Errorf("%w: %w", ErrManagerNotFound, errors.Join(errs...))
+	}
 	return nil, "", ErrManagerNotFound
 }
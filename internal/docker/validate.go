@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/distribution/reference"
+	"github.com/docker/cli/cli/config/configfile"
+)
+
+var sensitiveFormats = []string{vault.SecretOutputEnv, vault.SecretOutputJSON, vault.SecretOutputRaw, vault.SecretOutputTemplate}
+
+// Validate statically checks the cicdez extensions of project without
+// touching a daemon and returns one line per problem, sorted by service,
+// followed by unknown template drivers of secrets and configs. Images that
+// get built are expected to have credentials in authCfg, since deploy pushes
+// them.
+func Validate(project types.Project, secrets vault.Secrets, authCfg *configfile.ConfigFile) []string {
+	var problems []string
+	for _, name := range slices.Sorted(maps.Keys(project.Services)) {
+		svc := project.Services[name]
+		problems = append(problems, validateSensitive(svc, secrets, project.WorkingDir)...)
+		problems = append(problems, validateLocalConfigs(svc, project.WorkingDir)...)
+		if p := validateRegistry(svc, authCfg); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(project.Secrets)) {
+		if _, err := templateDriver("secret", name, project.Secrets[name].TemplateDriver); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(project.Configs)) {
+		if _, err := templateDriver("config", name, project.Configs[name].TemplateDriver); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+func validateSensitive(svc types.ServiceConfig, secrets vault.Secrets, workingDir string) []string {
+	var problems []string
+	for _, name := range slices.Sorted(maps.Keys(svc.Sensitive)) {
+		sensitive := svc.Sensitive[name]
+		prefix := fmt.Sprintf("service %s: sensitive %s", svc.Name, name)
+
+		switch sensitive.Type {
+		case "", vault.SensitiveTypeSecret, vault.SensitiveTypeConfig:
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown type %q, expected %s or %s", prefix, sensitive.Type, vault.SensitiveTypeSecret, vault.SensitiveTypeConfig))
+		}
+
+		if len(sensitive.Secrets) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no secrets listed", prefix))
+		}
+		for _, s := range sensitive.Secrets {
+			if _, ok := secrets[s.Source]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: secret %q not found in cicdez secrets", prefix, s.Source))
+			}
+		}
+
+		switch {
+		case sensitive.Format == "":
+		case !slices.Contains(sensitiveFormats, sensitive.Format):
+			problems = append(problems, fmt.Sprintf("%s: unknown format %q, expected one of %v", prefix, sensitive.Format, sensitiveFormats))
+		case sensitive.Format == vault.SecretOutputRaw && len(sensitive.Secrets) > 1:
+			problems = append(problems, fmt.Sprintf("%s: raw format requires exactly one secret, got %d", prefix, len(sensitive.Secrets)))
+		case sensitive.Format == vault.SecretOutputTemplate:
+			if sensitive.Template == "" {
+				problems = append(problems, fmt.Sprintf("%s: template format requires a template path", prefix))
+			} else if err := readable(sensitive.Template, workingDir); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: template %s is not readable: %v", prefix, sensitive.Template, err))
+			}
+		}
+	}
+	return problems
+}
+
+func validateLocalConfigs(svc types.ServiceConfig, workingDir string) []string {
+	var problems []string
+	for _, name := range slices.Sorted(maps.Keys(svc.LocalConfigs)) {
+		source := svc.LocalConfigs[name].Source
+		if err := readable(source, workingDir); err != nil {
+			problems = append(problems, fmt.Sprintf("service %s: local config %s: source %s is not readable: %v", svc.Name, name, source, err))
+		}
+	}
+	return problems
+}
+
+// validateRegistry reports a built image whose registry has no credentials,
+// registryless images never touch a registry
+func validateRegistry(svc types.ServiceConfig, authCfg *configfile.ConfigFile) string {
+	if svc.Build == nil || svc.Image == "" || IsRegistryless(svc.Image) {
+		return ""
+	}
+
+	ref, err := reference.ParseNormalizedNamed(svc.Image)
+	if err != nil {
+		return fmt.Sprintf("service %s: invalid image %q: %v", svc.Name, svc.Image, err)
+	}
+
+	auth := resolveAuth(authCfg, svc.Image)
+	if auth.Username == "" && auth.Auth == "" && auth.IdentityToken == "" && auth.RegistryToken == "" {
+		return fmt.Sprintf("service %s: no credentials for registry %s, run docker login %s", svc.Name, reference.Domain(ref), reference.Domain(ref))
+	}
+	return ""
+}
+
+func readable(path, workingDir string) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
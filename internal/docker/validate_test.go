@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blindlobstar/cicdez/internal/vault"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/config/configfile"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.tmpl"), []byte("{{ .DB_PASSWORD }}"), 0o600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	project := types.Project{
+		WorkingDir: dir,
+		Services: types.Services{
+			"api": types.ServiceConfig{
+				Name: "api",
+				Sensitive: map[string]types.SensitiveConfig{
+					"env": {
+						Format:  "yaml",
+						Secrets: []types.SensitiveSecret{{Source: "DB_PASSWORD"}},
+					},
+				},
+				LocalConfigs: map[string]types.LocalConfigConfig{
+					"nginx": {Source: "missing.conf", Target: "/etc/nginx.conf"},
+				},
+			},
+			"web": types.ServiceConfig{
+				Name: "web",
+				Sensitive: map[string]types.SensitiveConfig{
+					"app": {
+						Format:   "template",
+						Template: "app.tmpl",
+						Secrets:  []types.SensitiveSecret{{Source: "DB_PASSWORD"}, {Source: "API_KEY"}},
+					},
+				},
+			},
+		},
+	}
+
+	problems := Validate(project, vault.Secrets{"DB_PASSWORD": "secret"}, configfile.New(""))
+	if len(problems) != 3 {
+		t.Fatalf("expected 3 problems, got %d: %v", len(problems), problems)
+	}
+	for i, want := range []string{
+		`service api: sensitive env: unknown format "yaml"`,
+		"service api: local config nginx: source missing.conf is not readable",
+		`service web: sensitive app: secret "API_KEY" not found`,
+	} {
+		if !strings.HasPrefix(problems[i], want) {
+			t.Errorf("problem %d: expected prefix %q, got %q", i, want, problems[i])
+		}
+	}
+}
+
+func TestValidateRegistryCredentials(t *testing.T) {
+	project := types.Project{
+		Services: types.Services{
+			"app": types.ServiceConfig{
+				Name:  "app",
+				Image: "registry.example.com/app:latest",
+				Build: &types.BuildConfig{Context: "."},
+			},
+			"local": types.ServiceConfig{
+				Name:  "local",
+				Image: "registryless/local:latest",
+				Build: &types.BuildConfig{Context: "."},
+			},
+		},
+	}
+
+	problems := Validate(project, nil, configfile.New(""))
+	if len(problems) != 1 || !strings.Contains(problems[0], "no credentials for registry registry.example.com") {
+		t.Fatalf("expected a missing credentials problem for app only, got %v", problems)
+	}
+}
+
+func TestValidateTemplateDriver(t *testing.T) {
+	project := types.Project{
+		Secrets: types.Secrets{
+			"app_env": {Content: "x", TemplateDriver: "golang"},
+			"tls":     {Content: "x", TemplateDriver: "Golang"},
+		},
+		Configs: types.Configs{"nginx": {Content: "x", TemplateDriver: "go"}},
+	}
+
+	problems := Validate(project, nil, configfile.New(""))
+	want := []string{
+		`secret tls: unknown template_driver "Golang", supported: golang`,
+		`config nginx: unknown template_driver "go", supported: golang`,
+	}
+	if !slices.Equal(problems, want) {
+		t.Errorf("expected %q, got %q", want, problems)
+	}
+}
@@ -0,0 +1,72 @@
+// Package log is a minimal leveled logger for command output. A nil *Logger
+// discards everything, so callers that don't care can leave it unset.
+package log
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+// ParseLevel maps debug, info, warn or error to its level
+func ParseLevel(name string) (Level, error) {
+	level, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q: expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// Logger writes lines at or above its level to out
+type Logger struct {
+	out   io.Writer
+	level Level
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{out: out, level: level}
+}
+
+// Enabled reports whether lines at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, "debug: ", format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LevelInfo, "", format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LevelWarn, "Warning: ", format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LevelError, "Error: ", format, args...)
+}
+
+func (l *Logger) logf(level Level, prefix, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	fmt.Fprintf(l.out, prefix+strings.TrimSuffix(format, "\n")+"\n", args...)
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	for _, tt := range []struct {
+		level Level
+		want  string
+	}{
+		{LevelDebug, "debug: updating service web at version 7\ncreated\nWarning: slow\n"},
+		{LevelInfo, "created\nWarning: slow\n"},
+		{LevelWarn, "Warning: slow\n"},
+		{LevelError, ""},
+	} {
+		var out bytes.Buffer
+		l := New(&out, tt.level)
+		l.Debugf("updating service %s at version %d", "web", 7)
+		l.Infof("created")
+		l.Warnf("slow\n")
+		if out.String() != tt.want {
+			t.Errorf("level %d: expected %q, got %q", tt.level, tt.want, out.String())
+		}
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Infof("dropped")
+	if l.Enabled(LevelError) {
+		t.Error("expected a nil logger to be disabled")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("DEBUG"); err != nil || level != LevelDebug {
+		t.Errorf("expected debug, got %d, %v", level, err)
+	}
+	if _, err := ParseLevel("trace"); err == nil || !strings.Contains(err.Error(), "invalid log level") {
+		t.Errorf("expected an invalid level error, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrHostNotFound = errors.New("host not found in ssh config")
+
+// HostConfig is the subset of an ssh_config host entry cicdez uses. Unset
+// options are left zero.
+type HostConfig struct {
+	HostName     string
+	User         string
+	Port         int
+	IdentityFile string
+}
+
+// DefaultConfigPath returns ~/.ssh/config
+func DefaultConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".ssh", "config"), nil
+}
+
+// LookupHostConfig resolves alias in the ssh config file at configPath
+func LookupHostConfig(configPath, alias string) (HostConfig, error) {
+	f, err := os.Open(configPath)
+	if err != nil {
+		return HostConfig{}, fmt.Errorf("failed to open ssh config: %w", err)
+	}
+	defer f.Close()
+
+	homeDir, _ := os.UserHomeDir()
+	return ParseHostConfig(f, alias, homeDir)
+}
+
+// maxIncludeDepth bounds nested Include directives, as ssh does
+const maxIncludeDepth = 16
+
+// ParseHostConfig resolves alias the way ssh does: every matching Host block
+// contributes and the first value seen for an option wins. Match blocks are
+// skipped. Include reads the named files in place, relative paths are taken
+// from homeDir/.ssh. ErrHostNotFound is returned when only the catch-all
+// "Host *" matches.
+func ParseHostConfig(r io.Reader, alias, homeDir string) (HostConfig, error) {
+	p := configParser{alias: alias, homeDir: homeDir}
+	if err := p.parse(r, "ssh config", 0); err != nil {
+		return HostConfig{}, err
+	}
+	if !p.found {
+		return HostConfig{}, fmt.Errorf("%w: %s", ErrHostNotFound, alias)
+	}
+	return p.cfg, nil
+}
+
+type configParser struct {
+	alias   string
+	homeDir string
+	cfg     HostConfig
+	found   bool
+}
+
+// parse reads one config file. Errors name the file and line, name is
+// "ssh config" for the top-level one.
+func (p *configParser) parse(r io.Reader, name string, depth int) error {
+	matching := true // options before the first Host apply to all hosts
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, value := splitConfigLine(line)
+
+		switch keyword {
+		case "host":
+			var specific bool
+			matching, specific = matchHost(p.alias, strings.Fields(value))
+			p.found = p.found || specific
+			continue
+		case "match":
+			matching = false
+			continue
+		}
+		if !matching {
+			continue
+		}
+
+		switch keyword {
+		case "include":
+			if err := p.include(value, depth); err != nil {
+				return fmt.Errorf("%s line %d: %w", name, lineNo, err)
+			}
+		case "hostname":
+			if p.cfg.HostName == "" {
+				p.cfg.HostName = value
+			}
+		case "user":
+			if p.cfg.User == "" {
+				p.cfg.User = value
+			}
+		case "port":
+			if p.cfg.Port == 0 {
+				port, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("%s line %d: invalid port %q", name, lineNo, value)
+				}
+				p.cfg.Port = port
+			}
+		case "identityfile":
+			if p.cfg.IdentityFile == "" {
+				p.cfg.IdentityFile = expandHome(value, p.homeDir)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
+
+// include parses the files matching each pattern in turn. Patterns that
+// match nothing are ignored, like ssh does.
+func (p *configParser) include(value string, depth int) error {
+	if depth >= maxIncludeDepth {
+		return errors.New("too many nested Include directives")
+	}
+	for _, pattern := range strings.Fields(value) {
+		pattern = expandHome(pattern, p.homeDir)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(p.homeDir, ".ssh", pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid Include pattern %q: %w", pattern, err)
+		}
+		for _, file := range files {
+			if err := p.parseFile(file, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *configParser) parseFile(file string, depth int) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open included ssh config: %w", err)
+	}
+	defer f.Close()
+	return p.parse(f, file, depth)
+}
+
+// splitConfigLine splits a line into its lowercased keyword and unquoted
+// value. The keyword ends at the first whitespace or "=", which may itself be
+// surrounded by whitespace.
+func splitConfigLine(line string) (keyword, value string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	keyword, value = line[:i], strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimLeft(strings.TrimPrefix(value, "="), " \t")
+	return strings.ToLower(keyword), strings.Trim(strings.TrimSpace(value), `"`)
+}
+
+// matchHost reports whether alias matches the Host patterns, and whether it
+// matched a pattern other than the catch-all "*". A negated match excludes
+// the block.
+func matchHost(alias string, patterns []string) (matched, specific bool) {
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+
+		ok, err := path.Match(p, alias)
+		if err != nil || !ok {
+			continue
+		}
+		if negated {
+			return false, false
+		}
+		matched = true
+		specific = specific || p != "*"
+	}
+	return matched, specific
+}
+
+func expandHome(p, homeDir string) string {
+	p = strings.ReplaceAll(p, "%d", homeDir)
+	if p == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(p, "~/") {
+		return filepath.Join(homeDir, p[2:])
+	}
+	return p
+}
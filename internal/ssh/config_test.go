@@ -0,0 +1,179 @@
+package ssh
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSSHConfig = `
+# global defaults
+ServerAliveInterval 30
+
+Host prod
+    HostName 203.0.113.10
+    User deploy
+    Port 2222
+    IdentityFile ~/.ssh/prod_ed25519
+
+Host staging*
+    HostName=203.0.113.20
+    IdentityFile "%d/.ssh/staging key"
+
+Host ci
+	HostName	203.0.113.30
+	Port = 2200
+
+Host * !bastion
+    User fallback
+    Port 22
+
+Match host bastion
+    User ignored
+`
+
+func TestParseHostConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		want    HostConfig
+		wantErr error
+	}{
+		{
+			name:  "exact host",
+			alias: "prod",
+			want: HostConfig{
+				HostName:     "203.0.113.10",
+				User:         "deploy",
+				Port:         2222,
+				IdentityFile: "/home/me/.ssh/prod_ed25519",
+			},
+		},
+		{
+			name:  "wildcard host falls through to defaults",
+			alias: "staging-eu",
+			want: HostConfig{
+				HostName:     "203.0.113.20",
+				User:         "fallback",
+				Port:         22,
+				IdentityFile: "/home/me/.ssh/staging key",
+			},
+		},
+		{
+			name:  "tab and spaced equals separators",
+			alias: "ci",
+			want: HostConfig{
+				HostName: "203.0.113.30",
+				User:     "fallback",
+				Port:     2200,
+			},
+		},
+		{
+			name:    "only wildcard matches",
+			alias:   "unknown",
+			wantErr: ErrHostNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHostConfig(strings.NewReader(testSSHConfig), tt.alias, "/home/me")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseHostConfigInvalidPort(t *testing.T) {
+	_, err := ParseHostConfig(strings.NewReader("Host prod\n  Port abc\n"), "prod", "/home/me")
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected invalid port error with line number, got %v", err)
+	}
+}
+
+func TestParseHostConfigInclude(t *testing.T) {
+	home := t.TempDir()
+	includeDir := filepath.Join(home, ".ssh", "config.d")
+	if err := os.MkdirAll(includeDir, 0o700); err != nil {
+		t.Fatalf("failed to create include dir: %v", err)
+	}
+	files := map[string]string{
+		"10-prod":     "Host prod app\n    HostName 203.0.113.10\n    User deploy\n",
+		"20-defaults": "Host *\n    Port 2222\n    User fallback\n",
+		"staging":     "Host prod\n    HostName 203.0.113.99\n",
+		"nested":      "Include " + filepath.Join(includeDir, "10-prod") + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(includeDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	config := `
+Include config.d/1* ~/.ssh/config.d/2*
+
+Host staging
+    Include config.d/staging
+
+Host ci
+    Include config.d/nested
+    Include config.d/missing*
+`
+	tests := []struct {
+		name  string
+		alias string
+		want  HostConfig
+	}{
+		{
+			name:  "alias from an included file",
+			alias: "app",
+			want:  HostConfig{HostName: "203.0.113.10", User: "deploy", Port: 2222},
+		},
+		{
+			// the include under Host staging does not apply to prod
+			name:  "include inside a non-matching host block",
+			alias: "prod",
+			want:  HostConfig{HostName: "203.0.113.10", User: "deploy", Port: 2222},
+		},
+		{
+			name:  "nested include",
+			alias: "ci",
+			want:  HostConfig{User: "fallback", Port: 2222},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHostConfig(strings.NewReader(config), tt.alias, home)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseHostConfigIncludeLoop(t *testing.T) {
+	home := t.TempDir()
+	loop := filepath.Join(home, "loop")
+	if err := os.WriteFile(loop, []byte("Include "+loop+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	_, err := ParseHostConfig(strings.NewReader("Include "+loop+"\n"), "prod", home)
+	if err == nil || !strings.Contains(err.Error(), "too many nested Include") {
+		t.Errorf("expected nested Include error, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"sort"
 
+	"filippo.io/age"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,13 +17,46 @@ const Dir = ".cicdez"
 var configPath = filepath.Join(Dir, "config.yaml")
 
 type Config struct {
-	Servers map[string]Server `yaml:"servers"`
+	Servers    map[string]Server   `yaml:"servers"`
+	Registries map[string]Registry `yaml:"registries,omitempty"`
 }
 
+// Transports a server can be reached over
+const (
+	TransportSSH = "ssh"
+	TransportTCP = "tcp"
+)
+
 type Server struct {
-	Port int        `yaml:"port,omitempty"`
-	User string     `yaml:"user"`
-	Key  PrivateKey `yaml:"key"`
+	Port      int        `yaml:"port,omitempty"`
+	User      string     `yaml:"user"`
+	Key       PrivateKey `yaml:"key"`
+	Transport string     `yaml:"transport,omitempty"` // empty means ssh
+	TLS       *TLSFiles  `yaml:"tls,omitempty"`
+}
+
+// TLSFiles are the PEM files a tcp server is reached with: CA verifies the
+// daemon, Cert and Key identify cicdez to it
+type TLSFiles struct {
+	CA   string `yaml:"ca,omitempty" json:"ca,omitempty"`
+	Cert string `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty" json:"key,omitempty"`
+}
+
+// RegistryECR marks an AWS ECR registry, whose 12 hour tokens are fetched
+// on every build and deploy instead of being stored
+const RegistryECR = "ecr"
+
+// Registry holds the credentials of a container registry stored in the
+// vault, used instead of those of docker login for the same registry.
+// Registries of type ecr keep no password, only the region and the AWS
+// profile to ask for a token with.
+type Registry struct {
+	Type     string `yaml:"type,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Region   string `yaml:"region,omitempty"`
+	Profile  string `yaml:"profile,omitempty"`
 }
 
 type PrivateKey []byte
@@ -39,20 +73,63 @@ func (k *PrivateKey) UnmarshalYAML(node *yaml.Node) error {
 // whole record is encrypted per entry, one line per server, so hosts stay
 // private while entries remain mergeable line by line
 type serverRecord struct {
-	Host string `json:"host"`
-	Port int    `json:"port,omitempty"`
-	User string `json:"user"`
-	Key  []byte `json:"key,omitempty"`
+	Host      string    `json:"host"`
+	Port      int       `json:"port,omitempty"`
+	User      string    `json:"user"`
+	Key       []byte    `json:"key,omitempty"`
+	Transport string    `json:"transport,omitempty"`
+	TLS       *TLSFiles `json:"tls,omitempty"`
+}
+
+// registryRecord is the encrypted line of one registry, like serverRecord
+type registryRecord struct {
+	Server   string `json:"server"`
+	Type     string `json:"type,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Profile  string `json:"profile,omitempty"`
 }
 
 type configFile struct {
-	Servers []string `yaml:"servers"`
+	Servers    []string `yaml:"servers"`
+	Registries []string `yaml:"registries,omitempty"`
 }
 
-type serverEntry struct {
+// entry is one encrypted line of the config with its decrypted record
+type entry[R any] struct {
 	cipher string
 	plain  []byte
-	record serverRecord
+	record R
+}
+
+// CheckInitialized returns ErrNotInitialized when path has no .cicdez
+// directory or the age key is missing, for commands that only read the vault
+// and would otherwise report an empty project.
+func CheckInitialized(path string) error {
+	if _, err := os.Stat(filepath.Join(path, Dir)); os.IsNotExist(err) {
+		return fmt.Errorf("%w (no %s directory in %s)", ErrNotInitialized, Dir, path)
+	}
+	return loadIdentity()
+}
+
+// FindRoot walks up from startDir to the closest directory holding .cicdez,
+// the way git finds .git, and returns ErrNotInitialized when there is none.
+func FindRoot(startDir string) (string, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, Dir)); err == nil && info.IsDir() {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%w (no %s directory in %s or any parent)", ErrNotInitialized, Dir, startDir)
+		}
+		dir = parent
+	}
 }
 
 func LoadConfig(path string) (Config, error) {
@@ -66,73 +143,108 @@ func LoadConfig(path string) (Config, error) {
 		return config, fmt.Errorf("failed to read config: %w", err)
 	}
 
-	entries, err := parseServerEntries(data)
+	servers, registries, err := parseConfigEntries(data)
 	if err != nil {
 		return config, err
 	}
 
 	// duplicate hosts can appear after a merge; last one wins
-	config.Servers = make(map[string]Server, len(entries))
-	for _, e := range entries {
-		config.Servers[e.record.Host] = Server{Port: e.record.Port, User: e.record.User, Key: e.record.Key}
+	config.Servers = make(map[string]Server, len(servers))
+	for _, e := range servers {
+		config.Servers[e.record.Host] = Server{
+			Port:      e.record.Port,
+			User:      e.record.User,
+			Key:       e.record.Key,
+			Transport: e.record.Transport,
+			TLS:       e.record.TLS,
+		}
+	}
+	if len(registries) > 0 {
+		config.Registries = make(map[string]Registry, len(registries))
+		for _, e := range registries {
+			config.Registries[e.record.Server] = Registry{
+				Type:     e.record.Type,
+				Username: e.record.Username,
+				Password: e.record.Password,
+				Region:   e.record.Region,
+				Profile:  e.record.Profile,
+			}
+		}
 	}
 
 	return config, nil
 }
 
+// HasRegistries reports whether the vault at path stores registry
+// credentials. Entries are counted, not decrypted, so no key is needed.
+func HasRegistries(path string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(path, configPath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read config: %w", err)
+	}
+	var cf configFile
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		return false, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return len(cf.Registries) > 0, nil
+}
+
 func SaveConfig(path string, config Config) error {
-	var existing []serverEntry
+	if err := loadIdentity(); err != nil {
+		return err
+	}
+
+	recipients, err := LoadRecipients(path)
+	if err != nil {
+		return err
+	}
+	if err := syncRecipients(path, recipients); err != nil {
+		return err
+	}
+
+	var (
+		servers    []entry[serverRecord]
+		registries []entry[registryRecord]
+	)
 	if data, err := os.ReadFile(filepath.Join(path, configPath)); err == nil {
-		if existing, err = parseServerEntries(data); err != nil {
+		if servers, registries, err = parseConfigEntries(data); err != nil {
 			return err
 		}
 	}
 
-	// keep existing entries in file order with unchanged ciphertext intact,
-	// so a save only touches the lines that actually changed
-	cf := configFile{Servers: make([]string, 0, len(config.Servers))}
-	saved := make(map[string]bool, len(config.Servers))
-	for _, e := range existing {
-		server, ok := config.Servers[e.record.Host]
-		if !ok || saved[e.record.Host] {
-			continue
-		}
-		saved[e.record.Host] = true
-
-		plain, err := marshalServerRecord(e.record.Host, server)
-		if err != nil {
+	serverPlain := make(map[string][]byte, len(config.Servers))
+	for host, server := range config.Servers {
+		if serverPlain[host], err = marshalServerRecord(host, server); err != nil {
 			return err
 		}
-		if bytes.Equal(e.plain, plain) {
-			cf.Servers = append(cf.Servers, e.cipher)
-			continue
-		}
-
-		cipher, err := EncryptValue(plain)
+	}
+	registryPlain := make(map[string][]byte, len(config.Registries))
+	for server, registry := range config.Registries {
+		plain, err := json.Marshal(registryRecord{
+			Server:   server,
+			Type:     registry.Type,
+			Username: registry.Username,
+			Password: registry.Password,
+			Region:   registry.Region,
+			Profile:  registry.Profile,
+		})
 		if err != nil {
-			return fmt.Errorf("failed to encrypt server %q: %w", e.record.Host, err)
+			return fmt.Errorf("failed to marshal registry %q: %w", server, err)
 		}
-		cf.Servers = append(cf.Servers, cipher)
+		registryPlain[server] = plain
 	}
 
-	added := make([]string, 0, len(config.Servers))
-	for host := range config.Servers {
-		if !saved[host] {
-			added = append(added, host)
-		}
+	var cf configFile
+	cf.Servers, err = encryptEntries("server", servers, func(r serverRecord) string { return r.Host }, serverPlain, recipients)
+	if err != nil {
+		return err
 	}
-	sort.Strings(added)
-
-	for _, host := range added {
-		plain, err := marshalServerRecord(host, config.Servers[host])
-		if err != nil {
-			return err
-		}
-		cipher, err := EncryptValue(plain)
-		if err != nil {
-			return fmt.Errorf("failed to encrypt server %q: %w", host, err)
-		}
-		cf.Servers = append(cf.Servers, cipher)
+	cf.Registries, err = encryptEntries("registry", registries, func(r registryRecord) string { return r.Server }, registryPlain, recipients)
+	if err != nil {
+		return err
 	}
 
 	data, err := yaml.Marshal(cf)
@@ -144,31 +256,99 @@ func SaveConfig(path string, config Config) error {
 }
 
 func marshalServerRecord(host string, server Server) ([]byte, error) {
-	plain, err := json.Marshal(serverRecord{Host: host, Port: server.Port, User: server.User, Key: server.Key})
+	plain, err := json.Marshal(serverRecord{
+		Host:      host,
+		Port:      server.Port,
+		User:      server.User,
+		Key:       server.Key,
+		Transport: server.Transport,
+		TLS:       server.TLS,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal server %q: %w", host, err)
 	}
 	return plain, nil
 }
 
-func parseServerEntries(data []byte) ([]serverEntry, error) {
+// encryptEntries returns the config lines of records, the plain JSON of each
+// record by its key. Existing entries keep their file order and, when
+// unchanged, their ciphertext, so a save only touches the lines that
+// actually changed; new records follow sorted by key.
+func encryptEntries[R any](kind string, existing []entry[R], key func(R) string, records map[string][]byte, recipients []age.Recipient) ([]string, error) {
+	lines := make([]string, 0, len(records))
+	saved := make(map[string]bool, len(records))
+	for _, e := range existing {
+		name := key(e.record)
+		plain, ok := records[name]
+		if !ok || saved[name] {
+			continue
+		}
+		saved[name] = true
+
+		if bytes.Equal(e.plain, plain) {
+			lines = append(lines, e.cipher)
+			continue
+		}
+		cipher, err := EncryptValue(plain, recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s %q: %w", kind, name, err)
+		}
+		lines = append(lines, cipher)
+	}
+
+	added := make([]string, 0, len(records))
+	for name := range records {
+		if !saved[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+
+	for _, name := range added {
+		cipher, err := EncryptValue(records[name], recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s %q: %w", kind, name, err)
+		}
+		lines = append(lines, cipher)
+	}
+	return lines, nil
+}
+
+func parseConfigEntries(data []byte) ([]entry[serverRecord], []entry[registryRecord], error) {
 	var cf configFile
 	if err := yaml.Unmarshal(data, &cf); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if len(cf.Servers)+len(cf.Registries) > 0 {
+		if err := loadIdentity(); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	entries := make([]serverEntry, 0, len(cf.Servers))
-	for i, cipher := range cf.Servers {
+	servers, err := decryptEntries[serverRecord]("server", cf.Servers)
+	if err != nil {
+		return nil, nil, err
+	}
+	registries, err := decryptEntries[registryRecord]("registry", cf.Registries)
+	if err != nil {
+		return nil, nil, err
+	}
+	return servers, registries, nil
+}
+
+func decryptEntries[R any](kind string, ciphers []string) ([]entry[R], error) {
+	entries := make([]entry[R], 0, len(ciphers))
+	for i, cipher := range ciphers {
 		plain, err := DecryptValue(cipher)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decrypt server entry %d: %w", i, err)
+			return nil, fmt.Errorf("failed to decrypt %s entry %d: %w", kind, i, err)
 		}
-		var record serverRecord
+		var record R
 		if err := json.Unmarshal(plain, &record); err != nil {
-			return nil, fmt.Errorf("failed to parse server entry %d: %w", i, err)
+			return nil, fmt.Errorf("failed to parse %s entry %d: %w", kind, i, err)
 		}
-		entries = append(entries, serverEntry{cipher: cipher, plain: plain, record: record})
+		entries = append(entries, entry[R]{cipher: cipher, plain: plain, record: record})
 	}
-
 	return entries, nil
 }
@@ -2,8 +2,10 @@ package vault
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -41,6 +43,27 @@ func TestConfigRoundTrip(t *testing.T) {
 	}
 }
 
+func TestConfigRoundTripTLS(t *testing.T) {
+	dir := setupTestKey(t)
+
+	files := &TLSFiles{CA: "/certs/ca.pem", Cert: "/certs/cert.pem", Key: "/certs/key.pem"}
+	config := Config{Servers: map[string]Server{
+		"203.0.113.1": {Port: 2376, Transport: TransportTCP, TLS: files},
+	}}
+	if err := SaveConfig(dir, config); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	got, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	server := got.Servers["203.0.113.1"]
+	if server.Transport != TransportTCP || server.TLS == nil || *server.TLS != *files {
+		t.Errorf("expected tcp transport with %+v, got %+v", files, server)
+	}
+}
+
 func TestConfigFileHidesHosts(t *testing.T) {
 	dir := setupTestKey(t)
 
@@ -92,7 +115,7 @@ func TestSaveConfigPreservesCiphertext(t *testing.T) {
 		if err != nil {
 			t.Fatalf("failed to read config file: %v", err)
 		}
-		entries, err := parseServerEntries(data)
+		entries, _, err := parseConfigEntries(data)
 		if err != nil {
 			t.Fatalf("failed to parse config file: %v", err)
 		}
@@ -205,3 +228,104 @@ func TestLoadConfigMissing(t *testing.T) {
 		t.Errorf("expected no servers, got %d", len(config.Servers))
 	}
 }
+
+func TestFindRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, Dir), 0o755); err != nil {
+		t.Fatalf("failed to create vault dir: %v", err)
+	}
+	nested := filepath.Join(dir, "services", "api")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("failed to create nested dir: %v", err)
+	}
+
+	for _, start := range []string{dir, nested} {
+		root, err := FindRoot(start)
+		if err != nil {
+			t.Fatalf("FindRoot(%s) failed: %v", start, err)
+		}
+		if root != dir {
+			t.Errorf("FindRoot(%s): expected %s, got %s", start, dir, root)
+		}
+	}
+}
+
+func TestFindRootNotFound(t *testing.T) {
+	// a file named .cicdez doesn't count, the walk goes on up to the root
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, Dir), nil, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := FindRoot(dir); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestConfigRegistries(t *testing.T) {
+	dir := setupTestKey(t)
+
+	config := Config{
+		Servers: map[string]Server{"203.0.113.1": {Port: 22, User: "deploy"}},
+		Registries: map[string]Registry{
+			"ghcr.io": {Username: "bot", Password: "s3cret"},
+			"123456789012.dkr.ecr.eu-west-1.amazonaws.com": {Type: RegistryECR, Region: "eu-west-1", Profile: "deploy"},
+		},
+	}
+	if err := SaveConfig(dir, config); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, configPath))
+	if err != nil {
+		t.Fatalf("failed to read config file: %v", err)
+	}
+	if bytes.Contains(data, []byte("ghcr.io")) || bytes.Contains(data, []byte("s3cret")) {
+		t.Errorf("expected registries to be encrypted, got %s", data)
+	}
+
+	// a server change leaves the registry line alone
+	config.Servers["203.0.113.2"] = Server{Port: 22, User: "deploy"}
+	if err := SaveConfig(dir, config); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	after, err := os.ReadFile(filepath.Join(dir, configPath))
+	if err != nil {
+		t.Fatalf("failed to read config file: %v", err)
+	}
+	var cfBefore, cfAfter configFile
+	if err := yaml.Unmarshal(data, &cfBefore); err != nil {
+		t.Fatalf("failed to parse config file: %v", err)
+	}
+	if err := yaml.Unmarshal(after, &cfAfter); err != nil {
+		t.Fatalf("failed to parse config file: %v", err)
+	}
+	if !slices.Equal(cfBefore.Registries, cfAfter.Registries) {
+		t.Error("expected the unchanged registry to keep its ciphertext")
+	}
+
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := loaded.Registries["ghcr.io"]; got != (Registry{Username: "bot", Password: "s3cret"}) {
+		t.Errorf("unexpected registry %+v", got)
+	}
+	ecr := loaded.Registries["123456789012.dkr.ecr.eu-west-1.amazonaws.com"]
+	if ecr != (Registry{Type: RegistryECR, Region: "eu-west-1", Profile: "deploy"}) {
+		t.Errorf("unexpected ecr registry %+v", ecr)
+	}
+	if len(loaded.Servers) != 2 {
+		t.Errorf("expected 2 servers, got %v", loaded.Servers)
+	}
+
+	if has, err := HasRegistries(dir); err != nil || !has {
+		t.Errorf("expected stored registries, got %t, %v", has, err)
+	}
+	clear(config.Registries)
+	if err := SaveConfig(dir, config); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if has, err := HasRegistries(dir); err != nil || has {
+		t.Errorf("expected no registries after removing the last one, got %t, %v", has, err)
+	}
+}
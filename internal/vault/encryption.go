@@ -3,10 +3,12 @@ package vault
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"filippo.io/age"
@@ -16,15 +18,26 @@ const EnvAgeKeyPath = "CICDEZ_AGE_KEY_FILE"
 
 const valuePrefix = "age:"
 
+// ErrNotInitialized is returned when the vault is used before a key exists.
+var ErrNotInitialized = errors.New("cicdez is not initialized, run `cicdez init` first")
+
+// ErrDecrypt is returned when a value can't be decrypted with the local key.
+var ErrDecrypt = errors.New("failed to decrypt")
+
 var identity *age.X25519Identity
 
-func EncryptValue(data []byte) (string, error) {
-	if err := loadIdentity(); err != nil {
-		return "", fmt.Errorf("failed to load identity: %w", err)
+// EncryptValue encrypts data to recipients, or to the local key when none are
+// given.
+func EncryptValue(data []byte, recipients ...age.Recipient) (string, error) {
+	if len(recipients) == 0 {
+		if err := loadIdentity(); err != nil {
+			return "", err
+		}
+		recipients = []age.Recipient{identity.Recipient()}
 	}
 
 	var encrypted bytes.Buffer
-	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	w, err := age.Encrypt(&encrypted, recipients...)
 	if err != nil {
 		return "", fmt.Errorf("failed to create encrypt: %w", err)
 	}
@@ -40,9 +53,12 @@ func EncryptValue(data []byte) (string, error) {
 
 func DecryptValue(value string) ([]byte, error) {
 	if err := loadIdentity(); err != nil {
-		return nil, fmt.Errorf("failed to load identity: %w", err)
+		return nil, err
 	}
+	return decryptValue(value, identity)
+}
 
+func decryptValue(value string, identity age.Identity) ([]byte, error) {
 	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, valuePrefix))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode encrypted value: %w", err)
@@ -50,7 +66,7 @@ func DecryptValue(value string) ([]byte, error) {
 
 	r, err := age.Decrypt(bytes.NewReader(raw), identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
 	}
 
 	decrypted, err := io.ReadAll(r)
@@ -61,16 +77,43 @@ func DecryptValue(value string) ([]byte, error) {
 	return decrypted, nil
 }
 
+// writeVaultFile writes data readable by the owner only. Modes are tightened
+// on every write since WriteFile and MkdirAll keep those of existing paths.
 func writeVaultFile(path string, data []byte) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return fmt.Errorf("failed to create directory %s: %w", path, err)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", dir, err)
 	}
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
 		return fmt.Errorf("failed to write file %s: %w", path, err)
 	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
 	return nil
 }
 
+// warnOut receives warnings about the local key, such as loose permissions
+var warnOut io.Writer = os.Stderr
+
+// warnKeyPermissions warns when the key file at path can be read or written
+// by anyone but its owner. Windows has no such mode bits.
+func warnKeyPermissions(path string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		fmt.Fprintf(warnOut, "Warning: age key %s has permissions %04o, other users may read it, run chmod 600 %s\n", path, mode, path)
+	}
+}
+
 func loadIdentity() error {
 	if identity != nil {
 		return nil
@@ -81,23 +124,39 @@ func loadIdentity() error {
 		return fmt.Errorf("failed to get key path: %w", err)
 	}
 
-	kd, err := os.ReadFile(kp)
+	identity, err = ReadIdentity(kp)
 	if err != nil {
-		return fmt.Errorf("failed to read age key from %s: %w", kp, err)
+		return err
+	}
+	warnKeyPermissions(kp)
+	return nil
+}
+
+// ReadIdentity loads the X25519 identity cicdez encrypts with, the first one
+// in the key file at path.
+func ReadIdentity(path string) (*age.X25519Identity, error) {
+	kd, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w (no age key at %s)", ErrNotInitialized, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age key from %s: %w", path, err)
 	}
 
 	identities, err := age.ParseIdentities(strings.NewReader(string(kd)))
 	if err != nil {
-		return fmt.Errorf("failed to parse age key: %w", err)
+		return nil, fmt.Errorf("failed to parse age key: %w", err)
 	}
 
 	if len(identities) == 0 {
-		return fmt.Errorf("no valid age identity found in %s", kp)
+		return nil, fmt.Errorf("no valid age identity found in %s", path)
 	}
 
-	identity = identities[0].(*age.X25519Identity)
-
-	return nil
+	x, ok := identities[0].(*age.X25519Identity)
+	if !ok {
+		return nil, fmt.Errorf("%s does not start with an X25519 age identity", path)
+	}
+	return x, nil
 }
 
 func GetKeyPath() (string, error) {
@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var historyPath = filepath.Join(Dir, "history.age")
+
+// DefaultHistoryLimit is how many deploys the history keeps by default
+const DefaultHistoryLimit = 100
+
+// HistoryEntry records one deploy
+type HistoryEntry struct {
+	Time    time.Time         `json:"time"`
+	Stack   string            `json:"stack"`
+	User    string            `json:"user"`
+	Commit  string            `json:"commit,omitempty"`
+	Images  map[string]string `json:"images,omitempty"`
+	Servers []string          `json:"servers,omitempty"`
+}
+
+// AppendHistory adds entry to the deploy history of the vault at path and
+// drops the oldest entries beyond limit. Every entry is encrypted on a line
+// of its own, so earlier lines are never rewritten and concurrent deploys
+// merge like any appended file.
+func AppendHistory(path string, entry HistoryEntry, limit int) error {
+	if err := loadIdentity(); err != nil {
+		return err
+	}
+
+	recipients, err := LoadRecipients(path)
+	if err != nil {
+		return err
+	}
+	if err := syncRecipients(path, recipients); err != nil {
+		return err
+	}
+
+	lines, err := readHistoryLines(path)
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+	cipher, err := EncryptValue(plain, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt history entry: %w", err)
+	}
+	lines = append(lines, []byte(cipher))
+	if limit > 0 && len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+
+	data := append(bytes.Join(lines, []byte("\n")), '\n')
+	return writeVaultFile(filepath.Join(path, historyPath), data)
+}
+
+// LoadHistory decrypts the deploy history of the vault at path, oldest
+// first
+func LoadHistory(path string) ([]HistoryEntry, error) {
+	lines, err := readHistoryLines(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadIdentity(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, 0, len(lines))
+	for i, line := range lines {
+		plain, err := decryptValue(string(line), identity)
+		if err != nil {
+			return nil, fmt.Errorf("history entry %d: %w", i+1, err)
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(plain, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse history entry %d: %w", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readHistoryLines returns the encrypted entries, none when there is no
+// history yet
+func readHistoryLines(path string) ([][]byte, error) {
+	data, err := os.ReadFile(filepath.Join(path, historyPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var lines [][]byte
+	for line := range bytes.Lines(data) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
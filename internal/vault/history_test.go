@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	dir := setupTestKey(t)
+
+	entries, err := LoadHistory(dir)
+	if err != nil {
+		t.Fatalf("LoadHistory failed on missing file: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no history, got %v", entries)
+	}
+
+	first := HistoryEntry{
+		Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Stack:   "myapp",
+		User:    "alice",
+		Commit:  "1a2b3c4",
+		Images:  map[string]string{"web": "ghcr.io/acme/web:1.2.0", "db": "postgres:16"},
+		Servers: []string{"203.0.113.1", "203.0.113.2"},
+	}
+	if err := AppendHistory(dir, first, DefaultHistoryLimit); err != nil {
+		t.Fatalf("AppendHistory failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, historyPath))
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	if bytes.Contains(data, []byte("alice")) || bytes.Contains(data, []byte("ghcr.io")) {
+		t.Errorf("expected the history to be encrypted, got %s", data)
+	}
+
+	second := HistoryEntry{Time: first.Time.Add(time.Hour), Stack: "myapp", User: "bob"}
+	if err := AppendHistory(dir, second, DefaultHistoryLimit); err != nil {
+		t.Fatalf("AppendHistory failed: %v", err)
+	}
+
+	// appending leaves the earlier lines as they were
+	appended, err := os.ReadFile(filepath.Join(dir, historyPath))
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	if !bytes.HasPrefix(appended, data) {
+		t.Error("expected the first entry to keep its ciphertext")
+	}
+
+	entries, err = LoadHistory(dir)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	got := entries[0]
+	if !got.Time.Equal(first.Time) || got.Stack != "myapp" || got.User != "alice" || got.Commit != "1a2b3c4" {
+		t.Errorf("unexpected first entry %+v", got)
+	}
+	if got.Images["web"] != "ghcr.io/acme/web:1.2.0" || !slices.Equal(got.Servers, first.Servers) {
+		t.Errorf("unexpected images or servers in %+v", got)
+	}
+	if entries[1].User != "bob" {
+		t.Errorf("expected the newest entry last, got %+v", entries[1])
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	dir := setupTestKey(t)
+
+	for i := range 5 {
+		if err := AppendHistory(dir, HistoryEntry{Stack: fmt.Sprintf("stack%d", i)}, 3); err != nil {
+			t.Fatalf("AppendHistory failed: %v", err)
+		}
+	}
+
+	entries, err := LoadHistory(dir)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	var stacks []string
+	for _, e := range entries {
+		stacks = append(stacks, e.Stack)
+	}
+	if !slices.Equal(stacks, []string{"stack2", "stack3", "stack4"}) {
+		t.Errorf("expected the 3 newest entries, got %v", stacks)
+	}
+}
@@ -0,0 +1,251 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+var recipientsPath = filepath.Join(Dir, "recipients.txt")
+
+// recipientsSumPath records which recipients the vault is encrypted to, so
+// a changed recipients.txt is noticed on the next write
+var recipientsSumPath = filepath.Join(Dir, "recipients.sum")
+
+// LoadRecipients returns the public keys new values are encrypted to. Without
+// a recipients.txt the vault is single-user and the local key is the only
+// recipient.
+func LoadRecipients(path string) ([]age.Recipient, error) {
+	data, err := os.ReadFile(filepath.Join(path, recipientsPath))
+	if os.IsNotExist(err) {
+		if err := loadIdentity(); err != nil {
+			return nil, err
+		}
+		return []age.Recipient{identity.Recipient()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+
+	keys, err := parseRecipients(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no recipients listed in %s", recipientsPath)
+	}
+
+	recipients := make([]age.Recipient, len(keys))
+	for i, key := range keys {
+		recipients[i] = key
+	}
+	return recipients, nil
+}
+
+// SaveRecipients validates keys and writes them to recipients.txt, one per
+// line in the given order with duplicates dropped.
+func SaveRecipients(path string, keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("at least one recipient is required")
+	}
+
+	var buf bytes.Buffer
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", key, err)
+		}
+		if seen[r.String()] {
+			continue
+		}
+		seen[r.String()] = true
+		fmt.Fprintln(&buf, r.String())
+	}
+
+	return writeVaultFile(filepath.Join(path, recipientsPath), buf.Bytes())
+}
+
+// ErrAlreadyInitialized is returned by InitVault when recipients.txt exists.
+var ErrAlreadyInitialized = errors.New("cicdez is already initialized")
+
+// InitVault creates an empty vault in path encrypted to recipients. Existing
+// config and secrets are kept, an existing recipient list is not replaced.
+func InitVault(path string, recipients []string) error {
+	if _, err := os.Stat(filepath.Join(path, recipientsPath)); err == nil {
+		return fmt.Errorf("%w (%s exists)", ErrAlreadyInitialized, recipientsPath)
+	}
+
+	if err := SaveRecipients(path, recipients); err != nil {
+		return err
+	}
+
+	for _, file := range []string{configPath, secretsPath} {
+		full := filepath.Join(path, file)
+		if _, err := os.Stat(full); err == nil {
+			continue
+		}
+		if err := writeVaultFile(full, []byte("{}\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRecipients(data []byte) ([]*age.X25519Recipient, error) {
+	var recipients []*age.X25519Recipient
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := age.ParseX25519Recipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", recipientsPath, n, err)
+		}
+		recipients = append(recipients, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+// recipientsSum fingerprints a recipient set, regardless of order
+func recipientsSum(recipients []age.Recipient) string {
+	keys := make([]string, len(recipients))
+	for i, r := range recipients {
+		keys[i] = fmt.Sprint(r)
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// syncRecipients re-encrypts the vault at path when recipients differ from
+// the set it was last encrypted to. Writers reuse unchanged ciphertext, so
+// without this a removed key could still read every old value and an added
+// one none of them.
+func syncRecipients(path string, recipients []age.Recipient) error {
+	data, err := os.ReadFile(filepath.Join(path, recipientsSumPath))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read recipients sum: %w", err)
+	}
+	if err == nil && strings.TrimSpace(string(data)) == recipientsSum(recipients) {
+		return nil
+	}
+	return rekey(path, recipients)
+}
+
+// Rekey re-encrypts every value of the vault at path to the recipients in
+// recipients.txt. Writes do this on their own once the list changed, Rekey
+// is for when nothing else needs writing.
+func Rekey(path string) error {
+	if err := loadIdentity(); err != nil {
+		return err
+	}
+	recipients, err := LoadRecipients(path)
+	if err != nil {
+		return err
+	}
+	return rekey(path, recipients)
+}
+
+func rekey(path string, recipients []age.Recipient) error {
+	encrypted, err := readSecrets(path)
+	if err != nil {
+		return err
+	}
+	if len(encrypted) > 0 {
+		for name, value := range encrypted {
+			plain, err := DecryptValue(value)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt secret %q: %w", name, err)
+			}
+			if encrypted[name], err = EncryptValue(plain, recipients...); err != nil {
+				return fmt.Errorf("failed to encrypt secret %q: %w", name, err)
+			}
+		}
+		data, err := yaml.Marshal(encrypted)
+		if err != nil {
+			return fmt.Errorf("failed to marshal secrets: %w", err)
+		}
+		if err := writeVaultFile(filepath.Join(path, secretsPath), data); err != nil {
+			return err
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(path, configPath)); err == nil {
+		servers, registries, err := parseConfigEntries(data)
+		if err != nil {
+			return err
+		}
+		if len(servers)+len(registries) > 0 {
+			var cf configFile
+			if cf.Servers, err = reencryptEntries("server", servers, recipients); err != nil {
+				return err
+			}
+			if cf.Registries, err = reencryptEntries("registry", registries, recipients); err != nil {
+				return err
+			}
+			data, err := yaml.Marshal(cf)
+			if err != nil {
+				return fmt.Errorf("failed to marshal config: %w", err)
+			}
+			if err := writeVaultFile(filepath.Join(path, configPath), data); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	lines, err := readHistoryLines(path)
+	if err != nil {
+		return err
+	}
+	if len(lines) > 0 {
+		for i, line := range lines {
+			plain, err := DecryptValue(string(line))
+			if err != nil {
+				return fmt.Errorf("history entry %d: %w", i+1, err)
+			}
+			cipher, err := EncryptValue(plain, recipients...)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt history entry %d: %w", i+1, err)
+			}
+			lines[i] = []byte(cipher)
+		}
+		data := append(bytes.Join(lines, []byte("\n")), '\n')
+		if err := writeVaultFile(filepath.Join(path, historyPath), data); err != nil {
+			return err
+		}
+	}
+
+	return writeVaultFile(filepath.Join(path, recipientsSumPath), []byte(recipientsSum(recipients)+"\n"))
+}
+
+// reencryptEntries encrypts the plaintext of entries again, in their order
+func reencryptEntries[R any](kind string, entries []entry[R], recipients []age.Recipient) ([]string, error) {
+	ciphers := make([]string, len(entries))
+	for i, e := range entries {
+		cipher, err := EncryptValue(e.plain, recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s entry %d: %w", kind, i, err)
+		}
+		ciphers[i] = cipher
+	}
+	return ciphers, nil
+}
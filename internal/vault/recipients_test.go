@@ -0,0 +1,222 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestInitVaultExternalRecipient(t *testing.T) {
+	dir := setupTestKey(t)
+
+	teammate, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+
+	if err := loadIdentity(); err != nil {
+		t.Fatalf("loadIdentity failed: %v", err)
+	}
+	if err := InitVault(dir, []string{identity.Recipient().String(), teammate.Recipient().String()}); err != nil {
+		t.Fatalf("InitVault failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, recipientsPath))
+	if err != nil {
+		t.Fatalf("failed to read recipients: %v", err)
+	}
+	if lines := strings.Fields(string(data)); len(lines) != 2 || lines[1] != teammate.Recipient().String() {
+		t.Fatalf("expected local and teammate recipients, got %q", data)
+	}
+
+	if err := SaveSecrets(dir, Secrets{"DB_PASSWORD": "secret123"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	// the local key still works
+	secrets, err := LoadSecrets(dir)
+	if err != nil {
+		t.Fatalf("LoadSecrets failed: %v", err)
+	}
+	if secrets["DB_PASSWORD"] != "secret123" {
+		t.Errorf("expected DB_PASSWORD=secret123, got %q", secrets["DB_PASSWORD"])
+	}
+
+	// and so does the teammate's
+	keyPath := filepath.Join(t.TempDir(), "teammate.key")
+	if err := os.WriteFile(keyPath, []byte(teammate.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write age key: %v", err)
+	}
+	t.Setenv(EnvAgeKeyPath, keyPath)
+	identity = nil
+
+	secrets, err = LoadSecrets(dir)
+	if err != nil {
+		t.Fatalf("LoadSecrets as teammate failed: %v", err)
+	}
+	if secrets["DB_PASSWORD"] != "secret123" {
+		t.Errorf("expected teammate to read DB_PASSWORD=secret123, got %q", secrets["DB_PASSWORD"])
+	}
+}
+
+func TestInitVaultNoSelf(t *testing.T) {
+	dir := setupTestKey(t)
+
+	teammate, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+
+	if err := InitVault(dir, []string{teammate.Recipient().String()}); err != nil {
+		t.Fatalf("InitVault failed: %v", err)
+	}
+	if err := SaveSecrets(dir, Secrets{"DB_PASSWORD": "secret123"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	if _, err := LoadSecrets(dir); err == nil {
+		t.Error("expected the local key to be unable to decrypt without being a recipient")
+	}
+}
+
+func TestInitVaultInvalidRecipient(t *testing.T) {
+	dir := setupTestKey(t)
+
+	err := InitVault(dir, []string{"age1notakey"})
+	if err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Fatalf("expected invalid recipient error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, Dir)); !os.IsNotExist(err) {
+		t.Errorf("expected no vault to be created, got %v", err)
+	}
+
+	if err := InitVault(dir, nil); err == nil {
+		t.Error("expected an error without any recipient")
+	}
+
+	teammate, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+	if err := InitVault(dir, []string{teammate.Recipient().String()}); err != nil {
+		t.Fatalf("InitVault failed: %v", err)
+	}
+	if err := InitVault(dir, []string{teammate.Recipient().String()}); !errors.Is(err, ErrAlreadyInitialized) {
+		t.Errorf("expected ErrAlreadyInitialized on a second init, got %v", err)
+	}
+}
+
+func TestSaveReencryptsOnRecipientChange(t *testing.T) {
+	dir := setupTestKey(t)
+	if err := loadIdentity(); err != nil {
+		t.Fatalf("loadIdentity failed: %v", err)
+	}
+	local := identity.Recipient().String()
+	if err := InitVault(dir, []string{local}); err != nil {
+		t.Fatalf("InitVault failed: %v", err)
+	}
+
+	secrets := Secrets{"DB_PASSWORD": "secret123"}
+	if err := SaveSecrets(dir, secrets); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	if err := SaveConfig(dir, Config{Servers: map[string]Server{"203.0.113.1": {User: "deploy"}}}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if err := AppendHistory(dir, HistoryEntry{Stack: "app"}, 0); err != nil {
+		t.Fatalf("AppendHistory failed: %v", err)
+	}
+	read := func(file string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		return string(data)
+	}
+	before := map[string]string{}
+	for _, file := range []string{secretsPath, configPath, historyPath} {
+		before[file] = read(file)
+	}
+
+	// the same recipients keep every ciphertext
+	if err := SaveSecrets(dir, secrets); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	if read(secretsPath) != before[secretsPath] || read(configPath) != before[configPath] {
+		t.Fatal("expected an unchanged vault to keep its ciphertext")
+	}
+
+	teammate, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+	if err := SaveRecipients(dir, []string{local, teammate.Recipient().String()}); err != nil {
+		t.Fatalf("SaveRecipients failed: %v", err)
+	}
+	if err := SaveSecrets(dir, secrets); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+	for _, file := range []string{secretsPath, configPath, historyPath} {
+		if read(file) == before[file] {
+			t.Errorf("expected %s to be re-encrypted to the new recipients", file)
+		}
+	}
+
+	keyPath := filepath.Join(t.TempDir(), "teammate.key")
+	if err := os.WriteFile(keyPath, []byte(teammate.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write age key: %v", err)
+	}
+	t.Setenv(EnvAgeKeyPath, keyPath)
+	identity = nil
+
+	if got, err := LoadSecrets(dir); err != nil || got["DB_PASSWORD"] != "secret123" {
+		t.Errorf("expected the teammate to read the secrets, got %v, %v", got, err)
+	}
+	if cfg, err := LoadConfig(dir); err != nil || cfg.Servers["203.0.113.1"].User != "deploy" {
+		t.Errorf("expected the teammate to read the config, got %v, %v", cfg, err)
+	}
+	if history, err := LoadHistory(dir); err != nil || len(history) != 1 {
+		t.Errorf("expected the teammate to read the history, got %v, %v", history, err)
+	}
+}
+
+func TestRekeyDropsRemovedRecipient(t *testing.T) {
+	dir := setupTestKey(t)
+	if err := loadIdentity(); err != nil {
+		t.Fatalf("loadIdentity failed: %v", err)
+	}
+	leaver, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate age key: %v", err)
+	}
+	local := identity.Recipient().String()
+	if err := InitVault(dir, []string{local, leaver.Recipient().String()}); err != nil {
+		t.Fatalf("InitVault failed: %v", err)
+	}
+	if err := SaveSecrets(dir, Secrets{"DB_PASSWORD": "secret123"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	if err := SaveRecipients(dir, []string{local}); err != nil {
+		t.Fatalf("SaveRecipients failed: %v", err)
+	}
+	if err := Rekey(dir); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+
+	encrypted, err := readSecrets(dir)
+	if err != nil {
+		t.Fatalf("readSecrets failed: %v", err)
+	}
+	if _, err := decryptValue(encrypted["DB_PASSWORD"], leaver); err == nil {
+		t.Error("expected the removed recipient to lose access")
+	}
+	if got, err := LoadSecrets(dir); err != nil || got["DB_PASSWORD"] != "secret123" {
+		t.Errorf("expected the remaining recipient to read the secrets, got %v, %v", got, err)
+	}
+}
@@ -2,14 +2,18 @@ package vault
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"text/template"
 
+	"filippo.io/age"
 	"github.com/compose-spec/compose-go/v2/types"
 	"gopkg.in/yaml.v3"
 )
@@ -21,31 +25,108 @@ var ErrNestedSecret = errors.New("nested values not supported")
 type Secrets map[string]string
 
 func LoadSecrets(path string) (Secrets, error) {
-	data, err := os.ReadFile(filepath.Join(path, secretsPath))
-	if os.IsNotExist(err) {
-		return nil, nil
+	encrypted, err := readSecrets(path)
+	if encrypted == nil || err != nil {
+		return nil, err
+	}
+
+	// surface a missing key as-is instead of buried under a per-secret error
+	if err := loadIdentity(); err != nil {
+		return nil, err
 	}
+	return decryptSecrets(encrypted, identity)
+}
+
+// LoadSecretsWithKey decrypts the vault at path with the age key at keyPath
+// instead of the local one, for vaults of other environments
+func LoadSecretsWithKey(path, keyPath string) (Secrets, error) {
+	encrypted, err := readSecrets(path)
+	if encrypted == nil || err != nil {
+		return nil, err
+	}
+
+	id, err := ReadIdentity(keyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read secrets: %w", err)
+		return nil, err
 	}
+	return decryptSecrets(encrypted, id)
+}
 
-	encrypted, err := ParseSecrets(data)
+// SecretNames returns the sorted names of the secrets in the vault at path.
+// Only values are encrypted, so no key is needed.
+func SecretNames(path string) ([]string, error) {
+	encrypted, err := readSecrets(path)
 	if err != nil {
 		return nil, err
 	}
+	names := make([]string, 0, len(encrypted))
+	for name := range encrypted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
 
+// readSecrets returns the encrypted secrets of the vault at path, nil when
+// it has none yet
+func readSecrets(path string) (Secrets, error) {
+	data, err := os.ReadFile(filepath.Join(path, secretsPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+	return ParseSecrets(data)
+}
+
+func decryptSecrets(encrypted Secrets, id *age.X25519Identity) (Secrets, error) {
 	secrets := make(Secrets, len(encrypted))
 	for name, value := range encrypted {
-		plain, err := DecryptValue(value)
+		plain, err := decryptValue(value, id)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt secret %q: %w", name, err)
 		}
 		secrets[name] = string(plain)
 	}
-
 	return secrets, nil
 }
 
+// SecretsDiff holds the names, never the values, of secrets that differ
+// between two vaults
+type SecretsDiff struct {
+	OnlyA   []string
+	OnlyB   []string
+	Changed []string
+}
+
+func (d SecretsDiff) Empty() bool {
+	return len(d.OnlyA) == 0 && len(d.OnlyB) == 0 && len(d.Changed) == 0
+}
+
+// DiffSecrets compares a with b, every list is sorted
+func DiffSecrets(a, b Secrets) SecretsDiff {
+	var diff SecretsDiff
+	for name, value := range a {
+		other, ok := b[name]
+		switch {
+		case !ok:
+			diff.OnlyA = append(diff.OnlyA, name)
+		case other != value:
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			diff.OnlyB = append(diff.OnlyB, name)
+		}
+	}
+	sort.Strings(diff.OnlyA)
+	sort.Strings(diff.OnlyB)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
 func ParseSecrets(data []byte) (Secrets, error) {
 	var raw map[string]any
 	if err := yaml.Unmarshal(data, &raw); err != nil {
@@ -65,6 +146,18 @@ func ParseSecrets(data []byte) (Secrets, error) {
 }
 
 func SaveSecrets(path string, secrets Secrets) error {
+	if err := loadIdentity(); err != nil {
+		return err
+	}
+
+	recipients, err := LoadRecipients(path)
+	if err != nil {
+		return err
+	}
+	if err := syncRecipients(path, recipients); err != nil {
+		return err
+	}
+
 	existing := Secrets{}
 	if data, err := os.ReadFile(filepath.Join(path, secretsPath)); err == nil {
 		if existing, err = ParseSecrets(data); err != nil {
@@ -82,7 +175,7 @@ func SaveSecrets(path string, secrets Secrets) error {
 				continue
 			}
 		}
-		enc, err := EncryptValue([]byte(value))
+		enc, err := EncryptValue([]byte(value), recipients...)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt secret %q: %w", name, err)
 		}
@@ -97,6 +190,12 @@ func SaveSecrets(path string, secrets Secrets) error {
 	return writeVaultFile(filepath.Join(path, secretsPath), data)
 }
 
+// sensitive output is stored as a swarm secret unless its type says config
+const (
+	SensitiveTypeSecret = "secret"
+	SensitiveTypeConfig = "config"
+)
+
 const (
 	SecretOutputEnv      = "env"
 	SecretOutputJSON     = "json"
@@ -166,13 +265,48 @@ func FormatRaw(allSecrets Secrets, needed []types.SensitiveSecret) ([]byte, erro
 	return nil, nil
 }
 
+// templateFuncs is a small, sprig-compatible subset for sensitive templates
+var templateFuncs = template.FuncMap{
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"b64dec": func(s string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", fmt.Errorf("b64dec: %w", err)
+		}
+		return string(data), nil
+	},
+	"indent": indent,
+	"nindent": func(n int, s string) string {
+		return "\n" + indent(n, s)
+	},
+	"quote": strconv.Quote,
+	// default comes first so it reads naturally in a pipeline:
+	// {{ .port | default "5432" }}. value is untyped so an unpicked name,
+	// which the template sees as missing, falls back too.
+	"default": func(def string, value any) string {
+		if value == nil || fmt.Sprint(value) == "" {
+			return def
+		}
+		return fmt.Sprint(value)
+	},
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// FormatTemplate renders templateContent with the picked secrets as data, a
+// map of output name (name, or source when unset) to value.
 func FormatTemplate(allSecrets Secrets, needed []types.SensitiveSecret, templateContent string) ([]byte, error) {
 	picked, err := pickSecrets(allSecrets, needed)
 	if err != nil {
 		return nil, err
 	}
 
-	tmpl, err := template.New("sensitive").Parse(templateContent)
+	tmpl, err := template.New("sensitive").Funcs(templateFuncs).Parse(templateContent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse template: %w", err)
 	}
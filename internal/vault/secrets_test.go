@@ -1,12 +1,16 @@
 package vault
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"filippo.io/age"
+	"github.com/compose-spec/compose-go/v2/types"
 	"gopkg.in/yaml.v3"
 )
 
@@ -102,6 +106,70 @@ func TestLoadSecretsMissing(t *testing.T) {
 	}
 }
 
+func TestLoadSecretsWithKey(t *testing.T) {
+	stagingDir := setupTestKey(t)
+	stagingKey := os.Getenv(EnvAgeKeyPath)
+	if err := SaveSecrets(stagingDir, Secrets{"DB_PASSWORD": "staging"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	// the local key from here on belongs to another environment
+	setupTestKey(t)
+	if _, err := LoadSecrets(stagingDir); err == nil {
+		t.Fatal("expected the local key not to decrypt the staging vault")
+	}
+
+	got, err := LoadSecretsWithKey(stagingDir, stagingKey)
+	if err != nil {
+		t.Fatalf("LoadSecretsWithKey failed: %v", err)
+	}
+	if got["DB_PASSWORD"] != "staging" {
+		t.Errorf("expected the staging value, got %v", got)
+	}
+}
+
+func TestSecretNames(t *testing.T) {
+	dir := setupTestKey(t)
+	if err := SaveSecrets(dir, Secrets{"DB_PASSWORD": "secret123", "API_KEY": "mykey"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	// the names are readable without the key that encrypted the values
+	t.Setenv(EnvAgeKeyPath, filepath.Join(t.TempDir(), "missing.key"))
+	identity = nil
+	names, err := SecretNames(dir)
+	if err != nil {
+		t.Fatalf("SecretNames failed: %v", err)
+	}
+	if !slices.Equal(names, []string{"API_KEY", "DB_PASSWORD"}) {
+		t.Errorf("expected sorted names, got %v", names)
+	}
+
+	names, err = SecretNames(t.TempDir())
+	if err != nil || len(names) != 0 {
+		t.Errorf("expected no names for an empty vault, got %v %v", names, err)
+	}
+}
+
+func TestDiffSecrets(t *testing.T) {
+	a := Secrets{"API_KEY": "a", "DB_PASSWORD": "same", "OLD_TOKEN": "x", "SMTP_PASSWORD": "one"}
+	b := Secrets{"API_KEY": "b", "DB_PASSWORD": "same", "NEW_TOKEN": "y", "SMTP_PASSWORD": "two"}
+
+	diff := DiffSecrets(a, b)
+	if !slices.Equal(diff.OnlyA, []string{"OLD_TOKEN"}) {
+		t.Errorf("expected OLD_TOKEN only in a, got %v", diff.OnlyA)
+	}
+	if !slices.Equal(diff.OnlyB, []string{"NEW_TOKEN"}) {
+		t.Errorf("expected NEW_TOKEN only in b, got %v", diff.OnlyB)
+	}
+	if !slices.Equal(diff.Changed, []string{"API_KEY", "SMTP_PASSWORD"}) {
+		t.Errorf("expected API_KEY and SMTP_PASSWORD to differ, got %v", diff.Changed)
+	}
+	if diff.Empty() || !DiffSecrets(a, a).Empty() {
+		t.Error("expected only identical vaults to have an empty diff")
+	}
+}
+
 func TestParseSecrets(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -161,3 +229,139 @@ func TestParseSecrets(t *testing.T) {
 		})
 	}
 }
+
+func TestNotInitialized(t *testing.T) {
+	dir := setupTestKey(t)
+
+	if err := SaveSecrets(dir, Secrets{"DB_PASSWORD": "secret123"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	t.Setenv(EnvAgeKeyPath, filepath.Join(dir, "missing.key"))
+	identity = nil
+
+	if _, err := LoadSecrets(dir); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("LoadSecrets: expected ErrNotInitialized, got %v", err)
+	}
+	if err := SaveSecrets(dir, Secrets{"API_KEY": "mykey"}); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("SaveSecrets: expected ErrNotInitialized, got %v", err)
+	}
+	if err := SaveConfig(dir, Config{}); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("SaveConfig: expected ErrNotInitialized, got %v", err)
+	}
+}
+
+func TestCheckInitialized(t *testing.T) {
+	dir := setupTestKey(t)
+
+	if err := CheckInitialized(dir); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized without a %s directory, got %v", Dir, err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, Dir), 0o755); err != nil {
+		t.Fatalf("failed to create vault dir: %v", err)
+	}
+	if err := CheckInitialized(dir); err != nil {
+		t.Errorf("expected initialized project, got %v", err)
+	}
+}
+
+func TestSaveSecretsFileMode(t *testing.T) {
+	dir := setupTestKey(t)
+
+	// a vault created by an older version with loose modes gets tightened
+	if err := os.Mkdir(filepath.Join(dir, Dir), 0o755); err != nil {
+		t.Fatalf("failed to create vault dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, secretsPath), []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write secrets: %v", err)
+	}
+
+	if err := SaveSecrets(dir, Secrets{"DB_PASSWORD": "secret123"}); err != nil {
+		t.Fatalf("SaveSecrets failed: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(dir, Dir):         0o700,
+		filepath.Join(dir, secretsPath): 0o600,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: expected mode %04o, got %04o", path, want, got)
+		}
+	}
+}
+
+func TestKeyPermissionWarning(t *testing.T) {
+	setupTestKey(t)
+	keyPath := os.Getenv(EnvAgeKeyPath)
+
+	var buf bytes.Buffer
+	warnOut = &buf
+	t.Cleanup(func() { warnOut = os.Stderr })
+
+	if err := loadIdentity(); err != nil {
+		t.Fatalf("loadIdentity failed: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no warning for a 0600 key, got %q", buf.String())
+	}
+
+	if err := os.Chmod(keyPath, 0o644); err != nil {
+		t.Fatalf("chmod failed: %v", err)
+	}
+	identity = nil
+	if err := loadIdentity(); err != nil {
+		t.Fatalf("loadIdentity failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "has permissions 0644") || !strings.Contains(buf.String(), "chmod 600 "+keyPath) {
+		t.Errorf("expected a permission warning, got %q", buf.String())
+	}
+}
+
+func TestFormatTemplateFuncs(t *testing.T) {
+	secrets := Secrets{"DB_PASSWORD": "s3cret", "CERT": "line1\nline2", "ENCODED": "aGVsbG8="}
+	needed := []types.SensitiveSecret{
+		{Source: "DB_PASSWORD", Name: "db_pass"},
+		{Source: "CERT", Name: "cert"},
+		{Source: "ENCODED", Name: "encoded"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"b64enc", `{{ .db_pass | b64enc }}`, "czNjcmV0"},
+		{"b64dec", `{{ .encoded | b64dec }}`, "hello"},
+		{"indent", `{{ .cert | indent 2 }}`, "  line1\n  line2"},
+		{"nindent", `cert:{{ .cert | nindent 4 }}`, "cert:\n    line1\n    line2"},
+		{"quote", `{{ .db_pass | quote }}`, `"s3cret"`},
+		{"default unset", `{{ .missing | default "5432" }}`, "5432"},
+		{"default set", `{{ .db_pass | default "none" }}`, "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatTemplate(secrets, needed, tt.template)
+			if err != nil {
+				t.Fatalf("FormatTemplate failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatTemplateUnknownFunc(t *testing.T) {
+	needed := []types.SensitiveSecret{{Source: "DB_PASSWORD"}}
+
+	_, err := FormatTemplate(Secrets{"DB_PASSWORD": "s3cret"}, needed, `{{ .DB_PASSWORD | upper }}`)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse template") {
+		t.Errorf("expected parse error for unknown function, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var stateDir = filepath.Join(Dir, "state")
+
+var ErrNoDeployState = errors.New("no detached deploy recorded")
+
+// DeployState is the local handle a detached deploy leaves behind, so a later
+// status or wait can reconnect without re-deriving the stack
+type DeployState struct {
+	Stack      string            `json:"stack"`
+	Servers    []string          `json:"servers"`
+	Services   map[string]string `json:"services"`
+	DeployedAt time.Time         `json:"deployed_at"`
+}
+
+// stateFile returns the state path of stack, rejecting names that would
+// escape the state directory
+func stateFile(path, stack string) (string, error) {
+	if stack == "" || stack == "." || stack == ".." || strings.ContainsAny(stack, `/\`) {
+		return "", fmt.Errorf("invalid stack name %q", stack)
+	}
+	return filepath.Join(path, stateDir, stack+".json"), nil
+}
+
+func SaveDeployState(path string, state DeployState) error {
+	file, err := stateFile(path, state.Stack)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deploy state: %w", err)
+	}
+
+	// state is machine-local and never meant to be committed
+	dir := filepath.Join(path, stateDir)
+	if err := writeVaultFile(filepath.Join(dir, ".gitignore"), []byte("*\n")); err != nil {
+		return err
+	}
+
+	return writeVaultFile(file, data)
+}
+
+// RemoveDeployState forgets the detached deploy of stack, if any
+func RemoveDeployState(path, stack string) error {
+	file, err := stateFile(path, stack)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove deploy state: %w", err)
+	}
+	return nil
+}
+
+func LoadDeployState(path, stack string) (DeployState, error) {
+	var state DeployState
+
+	file, err := stateFile(path, stack)
+	if err != nil {
+		return state, err
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, fmt.Errorf("%w for stack %s", ErrNoDeployState, stack)
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read deploy state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse deploy state: %w", err)
+	}
+
+	return state, nil
+}
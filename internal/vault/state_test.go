@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeployStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	want := DeployState{
+		Stack:      "myapp",
+		Servers:    []string{"203.0.113.1", "203.0.113.2"},
+		Services:   map[string]string{"id-web": "myapp_web", "id-db": "myapp_db"},
+		DeployedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := SaveDeployState(dir, want); err != nil {
+		t.Fatalf("SaveDeployState failed: %v", err)
+	}
+
+	got, err := LoadDeployState(dir, "myapp")
+	if err != nil {
+		t.Fatalf("LoadDeployState failed: %v", err)
+	}
+
+	if got.Stack != want.Stack || !got.DeployedAt.Equal(want.DeployedAt) {
+		t.Errorf("state mismatch: got %+v, want %+v", got, want)
+	}
+	if len(got.Servers) != 2 || got.Servers[0] != "203.0.113.1" {
+		t.Errorf("unexpected servers %v", got.Servers)
+	}
+	if len(got.Services) != 2 || got.Services["id-web"] != "myapp_web" {
+		t.Errorf("unexpected services %v", got.Services)
+	}
+
+	ignore, err := os.ReadFile(filepath.Join(dir, stateDir, ".gitignore"))
+	if err != nil {
+		t.Fatalf("expected state dir to be gitignored: %v", err)
+	}
+	if string(ignore) != "*\n" {
+		t.Errorf("unexpected .gitignore content %q", ignore)
+	}
+}
+
+func TestLoadDeployStateMissing(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := LoadDeployState(dir, "myapp"); !errors.Is(err, ErrNoDeployState) {
+		t.Errorf("expected ErrNoDeployState, got %v", err)
+	}
+}
+
+func TestDeployStateInvalidStack(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, stack := range []string{"", "..", "../x", `a\b`} {
+		if err := SaveDeployState(dir, DeployState{Stack: stack}); err == nil {
+			t.Errorf("expected SaveDeployState to reject %q", stack)
+		}
+		if _, err := LoadDeployState(dir, stack); err == nil {
+			t.Errorf("expected LoadDeployState to reject %q", stack)
+		}
+	}
+}
+
+func TestRemoveDeployState(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := SaveDeployState(dir, DeployState{Stack: "myapp"}); err != nil {
+		t.Fatalf("SaveDeployState failed: %v", err)
+	}
+	if err := RemoveDeployState(dir, "myapp"); err != nil {
+		t.Fatalf("RemoveDeployState failed: %v", err)
+	}
+	if _, err := LoadDeployState(dir, "myapp"); !errors.Is(err, ErrNoDeployState) {
+		t.Errorf("expected ErrNoDeployState after removal, got %v", err)
+	}
+	if err := RemoveDeployState(dir, "myapp"); err != nil {
+		t.Errorf("expected removing a missing state to succeed, got %v", err)
+	}
+}